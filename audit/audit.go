@@ -0,0 +1,262 @@
+// Package audit turns a search into a compliance sweep: an Auditor is an
+// x509search.Sink running each match through a set of Checks, such as for
+// overlong validity periods, weak algorithms, or broken chains, and reporting
+// the findings grouped by check, as JSON and as a human-readable summary.
+//
+// Checks are simple to write, so other linters, such as zlint, can be
+// adapted to run alongside the ones provided here.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// maxExamples is the number of certificates a Report lists for each finding.
+const maxExamples = 10
+
+// Severity is how serious a finding is.
+type Severity int
+
+const (
+	// SeverityNotice findings are worth knowing about, but comply.
+	SeverityNotice Severity = iota
+
+	// SeverityWarning findings go against recommendations, such as those in
+	// the Baseline Requirements marked SHOULD.
+	SeverityWarning
+
+	// SeverityError findings are compliance failures.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityNotice:
+		return "notice"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Finding is a problem a Check found with a certificate.
+type Finding struct {
+	// ID identifies the kind of problem, such as "validity.too_long", and
+	// groups findings in a Report.
+	ID string
+
+	Severity Severity
+
+	// Description describes the kind of problem, and is the same for every
+	// finding with the same ID.
+	Description string
+
+	// Detail describes the problem with this certificate in particular, such
+	// as its actual validity period. It may be empty.
+	Detail string
+}
+
+// Check examines a certificate, returning the problems it finds, if any.
+// A single goroutine is responsible for invoking Check.
+type Check interface {
+	Check(ctx context.Context, cert *x509.Certificate, metadata x509search.Metadata) []Finding
+}
+
+// CheckFunc adapts a function to a Check.
+type CheckFunc func(ctx context.Context, cert *x509.Certificate, metadata x509search.Metadata) []Finding
+
+func (f CheckFunc) Check(ctx context.Context, cert *x509.Certificate, metadata x509search.Metadata) []Finding {
+	return f(ctx, cert, metadata)
+}
+
+// Report is the outcome of an audit.
+type Report struct {
+	// Certificates is the number of certificates audited.
+	Certificates int64 `json:"certificates"`
+
+	// Failing is the number of certificates with at least one finding.
+	Failing int64 `json:"failing"`
+
+	// Findings groups the findings by ID, most severe first, then most
+	// common.
+	Findings []ReportFinding `json:"findings"`
+}
+
+// ReportFinding summarizes the findings with the same ID.
+type ReportFinding struct {
+	ID          string   `json:"id"`
+	Severity    Severity `json:"severity"`
+	Description string   `json:"description"`
+
+	// Count is the number of certificates with the finding.
+	Count int64 `json:"count"`
+
+	// Examples lists the first few certificates with the finding.
+	Examples []Example `json:"examples"`
+}
+
+// Example is a certificate with a finding.
+type Example struct {
+	// Fingerprint is the hex-encoded SHA-256 hash of the certificate.
+	Fingerprint string `json:"fingerprint"`
+
+	Serial  string `json:"serial"`
+	Subject string `json:"subject"`
+	Issuer  string `json:"issuer"`
+
+	// Source and Index locate the certificate in its data source.
+	Source string `json:"source,omitempty"`
+	Index  int64  `json:"index,omitempty"`
+
+	Detail string `json:"detail,omitempty"`
+}
+
+// Auditor runs each match through its Checks, and writes a Report once
+// closed.
+type Auditor struct {
+	checks  []Check
+	json    io.Writer
+	summary io.Writer
+
+	certificates int64
+	failing      int64
+	findings     map[string]*ReportFinding
+}
+
+// NewAuditor returns an Auditor running the given checks, which writes the
+// report as JSON to jsonOut and as a summary table to summaryOut once closed.
+// Either writer may be nil to skip that form.
+func NewAuditor(jsonOut io.Writer, summaryOut io.Writer, checks ...Check) *Auditor {
+	return &Auditor{
+		checks:   checks,
+		json:     jsonOut,
+		summary:  summaryOut,
+		findings: make(map[string]*ReportFinding),
+	}
+}
+
+// Write runs the checks on cert, recording their findings.
+func (a *Auditor) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	a.certificates++
+
+	var findings []Finding
+	for _, check := range a.checks {
+		findings = append(findings, check.Check(context.Background(), cert, metadata)...)
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	a.failing++
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	for _, finding := range findings {
+		group, ok := a.findings[finding.ID]
+		if !ok {
+			group = &ReportFinding{
+				ID:          finding.ID,
+				Severity:    finding.Severity,
+				Description: finding.Description,
+			}
+			a.findings[finding.ID] = group
+		}
+
+		group.Count++
+		if len(group.Examples) < maxExamples {
+			group.Examples = append(group.Examples, Example{
+				Fingerprint: hex.EncodeToString(fingerprint[:]),
+				Serial:      hex.EncodeToString(cert.SerialNumber.Bytes()),
+				Subject:     cert.Subject.String(),
+				Issuer:      cert.Issuer.String(),
+				Source:      metadata.Source,
+				Index:       metadata.Index,
+				Detail:      finding.Detail,
+			})
+		}
+	}
+	return nil
+}
+
+// Report returns the report of the certificates audited so far.
+func (a *Auditor) Report() Report {
+	report := Report{
+		Certificates: a.certificates,
+		Failing:      a.failing,
+		Findings:     make([]ReportFinding, 0, len(a.findings)),
+	}
+	for _, finding := range a.findings {
+		report.Findings = append(report.Findings, *finding)
+	}
+
+	sort.Slice(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.ID < b.ID
+	})
+
+	return report
+}
+
+// Close writes the report.
+func (a *Auditor) Close() error {
+	report := a.Report()
+
+	if a.json != nil {
+		encoder := json.NewEncoder(a.json)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(report)
+		if err != nil {
+			return fmt.Errorf("writing audit report: %w", err)
+		}
+	}
+
+	if a.summary != nil {
+		err := report.WriteSummary(a.summary)
+		if err != nil {
+			return fmt.Errorf("writing audit summary: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// WriteSummary writes a table of the report's findings, followed by its
+// totals.
+func (r Report) WriteSummary(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(table, "SEVERITY\tFINDING\tCOUNT\tDESCRIPTION")
+	for _, finding := range r.Findings {
+		fmt.Fprintf(table, "%s\t%s\t%d\t%s\n", strings.ToUpper(finding.Severity.String()), finding.ID, finding.Count, finding.Description)
+	}
+
+	err := table.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "\n%d of %d certificates had findings\n", r.Failing, r.Certificates)
+	return err
+}
@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/enrich"
+)
+
+var notBefore = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// issue returns a certificate for key, valid for validity and signed by
+// parent, or self-signed if parent is nil.
+func issue(t *testing.T, serial int64, key crypto.Signer, validity time.Duration, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: big.NewInt(serial).String()},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(validity - time.Second),
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newKey(t *testing.T) crypto.Signer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// ids returns the IDs of the findings of check for cert.
+func ids(check Check, cert *x509.Certificate) []string {
+	var ids []string
+	for _, finding := range check.Check(context.Background(), cert, x509search.Metadata{}) {
+		ids = append(ids, finding.ID)
+	}
+	return ids
+}
+
+func TestValidity(t *testing.T) {
+	rootKey := newKey(t)
+	root := issue(t, 1, rootKey, 20*365*24*time.Hour, nil, nil)
+
+	for validity, want := range map[time.Duration][]string{
+		90 * 24 * time.Hour:              nil,
+		DefaultMaxValidity:               nil,
+		DefaultMaxValidity + time.Second: {"validity.too_long"},
+	} {
+		leaf := issue(t, 2, newKey(t), validity, root, rootKey)
+		if got := ids(Validity(0), leaf); !slices.Equal(got, want) {
+			t.Errorf("validity of %s: findings %q, want %q", validity, got, want)
+		}
+	}
+
+	// CAs aren't held to the subscriber limit
+	if got := ids(Validity(0), root); got != nil {
+		t.Errorf("CA certificate has findings %q", got)
+	}
+
+	findings := Validity(90*24*time.Hour).Check(context.Background(), issue(t, 3, newKey(t), 100*24*time.Hour, root, rootKey), x509search.Metadata{})
+	if len(findings) != 1 || findings[0].Detail != "100 days" || findings[0].Description != "Validity period longer than 90 days" {
+		t.Errorf("findings for a 100-day certificate: %+v", findings)
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	rootKey := newKey(t)
+	root := issue(t, 1, rootKey, 365*24*time.Hour, nil, nil)
+
+	if got := ids(Algorithms(), issue(t, 2, newKey(t), 90*24*time.Hour, root, rootKey)); got != nil {
+		t.Errorf("P-256 certificate has findings %q", got)
+	}
+
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(Algorithms(), issue(t, 3, smallKey, 90*24*time.Hour, root, rootKey)); !slices.Equal(got, []string{"algorithm.small_rsa_key"}) {
+		t.Errorf("1024-bit RSA certificate has findings %q", got)
+	}
+
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(Algorithms(), issue(t, 4, p224Key, 90*24*time.Hour, root, rootKey)); !slices.Equal(got, []string{"algorithm.unsupported_curve"}) {
+		t.Errorf("P-224 certificate has findings %q", got)
+	}
+}
+
+func TestChain(t *testing.T) {
+	rootKey := newKey(t)
+	root := issue(t, 1, rootKey, 365*24*time.Hour, nil, nil)
+	otherKey := newKey(t)
+	other := issue(t, 2, otherKey, 365*24*time.Hour, nil, nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	chains, err := enrich.NewChains(roots, enrich.NewIssuers())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ids(Chain(chains), issue(t, 3, newKey(t), 90*24*time.Hour, root, rootKey)); got != nil {
+		t.Errorf("certificate issued by a trusted root has findings %q", got)
+	}
+	if got := ids(Chain(chains), issue(t, 4, newKey(t), 90*24*time.Hour, other, otherKey)); !slices.Equal(got, []string{"chain.invalid"}) {
+		t.Errorf("certificate issued by an untrusted root has findings %q", got)
+	}
+}
+
+func TestAuditor(t *testing.T) {
+	rootKey := newKey(t)
+	root := issue(t, 1, rootKey, 365*24*time.Hour, nil, nil)
+
+	// Every certificate gets a notice, and those with odd serials an error
+	notice := CheckFunc(func(context.Context, *x509.Certificate, x509search.Metadata) []Finding {
+		return []Finding{{ID: "test.notice", Severity: SeverityNotice, Description: "Notice"}}
+	})
+	odd := CheckFunc(func(_ context.Context, cert *x509.Certificate, _ x509search.Metadata) []Finding {
+		if cert.SerialNumber.Bit(0) == 0 {
+			return nil
+		}
+		return []Finding{{ID: "test.odd", Severity: SeverityError, Description: "Odd serial", Detail: cert.SerialNumber.String()}}
+	})
+
+	var jsonOut, summaryOut bytes.Buffer
+	auditor := NewAuditor(&jsonOut, &summaryOut, notice, odd)
+	for serial := int64(10); serial < 13; serial++ {
+		cert := issue(t, serial, newKey(t), 90*24*time.Hour, root, rootKey)
+		err := auditor.Write(cert, x509search.Metadata{Source: "log", Index: serial})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := auditor.Close()
+	if err != nil {
+		t.Fatalf("closing auditor: %s", err)
+	}
+
+	// Severity is written as text, so only the totals are read back
+	var totals struct {
+		Certificates int64 `json:"certificates"`
+		Failing      int64 `json:"failing"`
+	}
+	err = json.Unmarshal(jsonOut.Bytes(), &totals)
+	if err != nil {
+		t.Fatalf("decoding report: %s", err)
+	}
+	if totals.Certificates != 3 || totals.Failing != 3 {
+		t.Errorf("report counts %d failing of %d certificates, want 3 of 3", totals.Failing, totals.Certificates)
+	}
+
+	// Errors are listed before the more common notices
+	findings := auditor.Report().Findings
+	if len(findings) != 2 || findings[0].ID != "test.odd" || findings[1].ID != "test.notice" {
+		t.Fatalf("report findings: %+v", findings)
+	}
+	if findings[0].Count != 1 || findings[1].Count != 3 {
+		t.Errorf("findings counted %d and %d times, want 1 and 3", findings[0].Count, findings[1].Count)
+	}
+	example := findings[0].Examples[0]
+	if example.Detail != "11" || example.Source != "log" || example.Index != 11 || example.Serial != "0b" {
+		t.Errorf("error example: %+v", example)
+	}
+
+	if !strings.Contains(jsonOut.String(), `"severity": "error"`) {
+		t.Errorf("JSON report doesn't name severities: %s", jsonOut.String())
+	}
+	summary := summaryOut.String()
+	if !strings.Contains(summary, "ERROR") || !strings.HasSuffix(summary, "\n3 of 3 certificates had findings\n") {
+		t.Errorf("summary:\n%s", summary)
+	}
+}
@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/enrich"
+)
+
+// DefaultMaxValidity is the longest validity period the Baseline Requirements
+// allow subscriber certificates issued since September 2020.
+const DefaultMaxValidity = 398 * 24 * time.Hour
+
+// Validity returns a Check finding subscriber certificates, that is, those
+// that aren't CAs, valid for longer than maxValidity, counting the validity
+// period inclusively of notAfter, as RFC 5280 does. If maxValidity isn't
+// positive, DefaultMaxValidity is used.
+func Validity(maxValidity time.Duration) Check {
+	if maxValidity <= 0 {
+		maxValidity = DefaultMaxValidity
+	}
+
+	return CheckFunc(func(_ context.Context, cert *x509.Certificate, _ x509search.Metadata) []Finding {
+		if cert.IsCA {
+			return nil
+		}
+
+		validity := cert.NotAfter.Sub(cert.NotBefore) + time.Second
+		if validity <= maxValidity {
+			return nil
+		}
+
+		return []Finding{{
+			ID:          "validity.too_long",
+			Severity:    SeverityError,
+			Description: fmt.Sprintf("Validity period longer than %s", formatDays(maxValidity)),
+			Detail:      formatDays(validity),
+		}}
+	})
+}
+
+// Algorithms returns a Check finding certificates signed with MD5 or SHA-1,
+// or with an unknown algorithm, and those with keys the Baseline
+// Requirements don't allow: RSA keys shorter than 2048 bits or whose size
+// isn't a multiple of 8, ECDSA keys on curves other than P-256, P-384, and
+// P-521, and DSA keys.
+func Algorithms() Check {
+	return CheckFunc(func(_ context.Context, cert *x509.Certificate, _ x509search.Metadata) []Finding {
+		var findings []Finding
+
+		switch cert.SignatureAlgorithm {
+		case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			findings = append(findings, Finding{
+				ID:          "algorithm.weak_signature",
+				Severity:    SeverityError,
+				Description: "Signed with a broken hash algorithm",
+				Detail:      cert.SignatureAlgorithm.String(),
+			})
+		case x509.UnknownSignatureAlgorithm:
+			findings = append(findings, Finding{
+				ID:          "algorithm.unknown_signature",
+				Severity:    SeverityWarning,
+				Description: "Signed with an unrecognized algorithm",
+			})
+		}
+
+		switch key := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			bits := key.N.BitLen()
+			if bits < 2048 {
+				findings = append(findings, Finding{
+					ID:          "algorithm.small_rsa_key",
+					Severity:    SeverityError,
+					Description: "RSA key shorter than 2048 bits",
+					Detail:      fmt.Sprintf("%d bits", bits),
+				})
+			} else if bits%8 != 0 {
+				findings = append(findings, Finding{
+					ID:          "algorithm.rsa_key_size",
+					Severity:    SeverityError,
+					Description: "RSA key size not a multiple of 8 bits",
+					Detail:      fmt.Sprintf("%d bits", bits),
+				})
+			}
+		case *ecdsa.PublicKey:
+			switch key.Curve {
+			case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			default:
+				findings = append(findings, Finding{
+					ID:          "algorithm.unsupported_curve",
+					Severity:    SeverityError,
+					Description: "ECDSA key on a curve other than P-256, P-384, or P-521",
+					Detail:      key.Curve.Params().Name,
+				})
+			}
+		default:
+			if cert.PublicKeyAlgorithm == x509.DSA {
+				findings = append(findings, Finding{
+					ID:          "algorithm.dsa_key",
+					Severity:    SeverityError,
+					Description: "DSA key",
+				})
+			}
+		}
+
+		return findings
+	})
+}
+
+// Chain returns a Check finding certificates that don't chain to the roots
+// trusted by chains. See enrich.Chains.Verify.
+func Chain(chains *enrich.Chains) Check {
+	return CheckFunc(func(ctx context.Context, cert *x509.Certificate, _ x509search.Metadata) []Finding {
+		_, err := chains.Verify(ctx, cert)
+		if err == nil {
+			return nil
+		}
+
+		return []Finding{{
+			ID:          "chain.invalid",
+			Severity:    SeverityError,
+			Description: "No valid chain to a trusted root",
+			Detail:      err.Error(),
+		}}
+	})
+}
+
+// formatDays formats a duration in days, to two decimal places unless it's a
+// whole number of days.
+func formatDays(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	return fmt.Sprintf("%.2f days", d.Hours()/24)
+}
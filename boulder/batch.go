@@ -0,0 +1,79 @@
+package boulder
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// minBatchSize and maxBatchSize bound a tuned batch size.
+	minBatchSize = 10
+	maxBatchSize = 50000
+
+	// targetQueryDuration is how long the queries of a tuned batch size aim
+	// to take: long enough that the round trips don't dominate, and short
+	// enough not to hold the database up.
+	targetQueryDuration = time.Second
+
+	// maxBatchBytes bounds the bytes of certificates a tuned batch aims to
+	// return, so that a query isn't held open for long transferring them.
+	maxBatchBytes = 64 << 20
+)
+
+// batchSizer tunes the number of rows read per query from how long queries
+// take and how large their rows are, unless it's fixed.
+type batchSizer struct {
+	size  int
+	fixed bool
+}
+
+// newBatchSizer returns a batchSizer fixed at size, or tuned from
+// DefaultBatchSize if size isn't positive.
+func newBatchSizer(size int) *batchSizer {
+	if size > 0 {
+		return &batchSizer{size: size, fixed: true}
+	}
+	return &batchSizer{size: DefaultBatchSize}
+}
+
+// observe tunes the batch size after a query returned its result. It grows
+// when a full batch comes back well within targetQueryDuration, and shrinks
+// when the query took longer, or the batch's certificates took up more than
+// maxBatchBytes.
+func (b *batchSizer) observe(r result) {
+	if b.fixed || r.rows == 0 {
+		return
+	}
+
+	switch {
+	case r.elapsed > targetQueryDuration:
+		b.size /= 2
+	case r.elapsed < targetQueryDuration/4 && r.rows == b.size:
+		b.size *= 2
+	}
+
+	rowBytes := r.bytes / r.rows
+	if rowBytes > 0 && b.size > maxBatchBytes/rowBytes {
+		b.size = maxBatchBytes / rowBytes
+	}
+
+	b.size = min(max(b.size, minBatchSize), maxBatchSize)
+}
+
+// shrink cuts the batch size after a query timed out, and reports whether the
+// query should be retried with the smaller batch. A fixed batch size, or one
+// already at minBatchSize, can't shrink.
+func (b *batchSizer) shrink() bool {
+	if b.fixed || b.size <= minBatchSize {
+		return false
+	}
+	b.size = max(b.size/4, minBatchSize)
+	return true
+}
+
+// isTimeout reports whether err is the timeout of a single query, rather than
+// the cancellation of ctx, which the whole read runs under.
+func isTimeout(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded)
+}
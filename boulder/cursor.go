@@ -0,0 +1,74 @@
+package boulder
+
+import (
+	"maps"
+	"sync"
+)
+
+// Cursor records the ID of the last row a DataSource has sent from each table,
+// or Partition, it reads, keyed as Query.Table names them, so that an
+// interrupted scan can be resumed exactly where it stopped, by a DataSource
+// starting after those IDs. Resuming relies on rows being read in ID order, so
+// a Cursor can't be combined with IssuedChunk.
+//
+// A Cursor is safe for concurrent use.
+type Cursor struct {
+	mu     sync.Mutex
+	lastID map[string]int64
+}
+
+// NewCursor returns a Cursor starting after the given row IDs, keyed by table,
+// as returned by LastIDs. A new scan starts from a zero Cursor, or
+// NewCursor(nil).
+func NewCursor(startAfterIDs map[string]int64) *Cursor {
+	return &Cursor{
+		lastID: maps.Clone(startAfterIDs),
+	}
+}
+
+// LastID returns the ID of the last row sent from table, or, if none has been
+// sent yet, the ID the Cursor was created to start after, or 0. A nil Cursor
+// returns 0.
+func (c *Cursor) LastID(table string) int64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastID[table]
+}
+
+// LastIDs returns the IDs LastID returns for each table, keyed by table. A nil
+// Cursor returns an empty map.
+func (c *Cursor) LastIDs() map[string]int64 {
+	if c == nil {
+		return make(map[string]int64)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lastIDs := maps.Clone(c.lastID)
+	if lastIDs == nil {
+		lastIDs = make(map[string]int64)
+	}
+	return lastIDs
+}
+
+// advance records that the row with the given ID has been sent from table. A
+// nil Cursor records nothing.
+func (c *Cursor) advance(table string, id int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastID == nil {
+		c.lastID = make(map[string]int64)
+	}
+	c.lastID[table] = id
+}
@@ -0,0 +1,564 @@
+// Package boulder reads certificates from the database of Boulder, Let's
+// Encrypt's CA software, so that a CA's own record of what it issued can be
+// searched, and compared with what CT logs hold.
+//
+// The database is opened by the caller, with a driver of their choice
+// registered with database/sql. Boulder runs on MySQL or MariaDB, so that's
+// typically github.com/go-sql-driver/mysql, opened with parseTime=true.
+// Queries use "?" placeholders, which MySQL and SQLite drivers accept.
+package boulder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// DefaultBatchSize is the number of rows a DataSource reads per query when
+// BatchSize is zero.
+const DefaultBatchSize = 1000
+
+// Row identifies the database row a certificate was read from, and is the
+// Payload of the metadata of each certificate a DataSource finds.
+type Row struct {
+	// Table is "certificates" or "precertificates".
+	Table string
+
+	ID int64
+
+	// Serial is the certificate's serial number, as Boulder stores it: 36
+	// lowercase hexadecimal digits.
+	Serial string
+
+	// Status is the certificate's row of the certificateStatus table, if the
+	// DataSource joined it and it has one.
+	Status *Status
+}
+
+// Status is the revocation status of a certificate, from Boulder's
+// certificateStatus table.
+type Status struct {
+	// Status is "good" or "revoked".
+	Status string
+
+	// RevokedDate and RevokedReason are when and why the certificate was
+	// revoked, if it was.
+	RevokedDate   time.Time
+	RevokedReason int
+}
+
+// DataSource is an x509search.Sourcer reading the certificates and
+// precertificates Boulder issued within a window from its certificates and
+// precertificates tables. Rows are read in batches ordered by ID, so a
+// database that's still issuing can be read without holding a long-running
+// query open, or, with IssuedChunk set, in chunks of the window. Each row is
+// sent on as it's read, so memory use doesn't grow with the size of batches
+// or their certificates.
+type DataSource struct {
+	DB *sql.DB
+
+	// SourceName identifies the data source. If empty, it is named "boulder".
+	SourceName string
+
+	// IncludePrecertificates reads the precertificates table.
+	IncludePrecertificates bool
+
+	// IncludeCertificates reads the certificates table.
+	IncludeCertificates bool
+
+	// StartTimeInclusive and EndTimeInclusive bound the issued times of the
+	// certificates read.
+	StartTimeInclusive time.Time
+	EndTimeInclusive   time.Time
+
+	// BatchSize is the number of rows read per query when reading by ID. If
+	// it's zero, the batch size is tuned as rows are read, starting from
+	// DefaultBatchSize: it grows while queries are quick, and shrinks when
+	// they're slow, time out, or return too many bytes of certificates.
+	BatchSize int
+
+	// QueryTimeout, if positive, bounds the time each query may take. When
+	// the batch size is tuned, a query that times out is retried with a
+	// smaller batch; otherwise, the timeout fails the data source.
+	QueryTimeout time.Duration
+
+	// IssuedChunk, if positive, reads rows by their issued times rather than
+	// by ID: the window is split into chunks of this length, each read with
+	// a single "WHERE issued BETWEEN ? AND ?" query. Some deployments, such
+	// as those whose tables are partitioned by issued time, find this cheaper
+	// than paging through IDs. Each query stays open until all of its
+	// chunk's rows have been searched, so chunks should be short enough not
+	// to hold the database up for long.
+	IssuedChunk time.Duration
+
+	// IndexHint, if set, follows the table name in each query, to steer the
+	// database to its index on issued, such as "USE INDEX (issued_idx)" for
+	// MySQL or "INDEXED BY issued_idx" for SQLite.
+	IndexHint string
+
+	// Replicas are further copies of DB, such as read replicas, to spread the
+	// queries across. A query that fails is retried on the next database,
+	// until each has been tried, and the one that failed isn't queried again
+	// until it has answered a ping, which is tried every
+	// ReplicaRetryInterval.
+	Replicas []*sql.DB
+
+	// JoinStatus joins each certificate's row of the certificateStatus table,
+	// attaching it to its Row as Status, and annotating its metadata with
+	// "boulder.status", "good" or "revoked", and if it's revoked,
+	// "boulder.revokedAt" and "boulder.reason", sparing a second pass over
+	// the matches to look up their revocation.
+	JoinStatus bool
+
+	// Unrevoked skips revoked certificates in the queries, joining the
+	// certificateStatus table as JoinStatus does. Certificates without a
+	// status aren't skipped.
+	Unrevoked bool
+
+	// Unexpired skips certificates that have expired by the time they're
+	// read, in the queries.
+	Unexpired bool
+
+	// CollapseBySerial, with both IncludePrecertificates and
+	// IncludeCertificates set, skips precertificates whose final certificate
+	// was issued within the window, in the queries, so that each issuance is
+	// searched once, as its final certificate, rather than in both of its
+	// representations. Precertificates without a final certificate, whose
+	// issuance failed or which were issued after the window, are still read.
+	CollapseBySerial bool
+
+	// Partitions, if set, are the partitions or shards of the tables read,
+	// of which only those overlapping the window are queried, each on its
+	// own. Tables without partitions listed are queried as a whole.
+	Partitions []Partition
+
+	// Cursor, if set, records the ID of the last row sent from each table,
+	// and rows up to the IDs it holds are skipped, so that a scan can be
+	// resumed. Rows are sent in ID order from each table, so persisting the
+	// Cursor's LastIDs allows an interrupted scan to be resumed exactly where
+	// it stopped. Partitions are recorded separately, named as in
+	// Query.Table. It can't be combined with IssuedChunk.
+	Cursor *Cursor
+
+	// Observer, if set, is called after every query, such as to export its
+	// timing as metrics. It may be called concurrently. A QueryStats's
+	// Observe method totals the queries.
+	Observer func(Query)
+
+	// MaxConnections is the number of queries run concurrently, each worker
+	// querying DB or one of the Replicas in turn, so that a big scan doesn't
+	// overload any one of them. Each table is read by one worker when reading
+	// by ID, so more than two only help with IssuedChunk set, where the
+	// workers read separate chunks. If MaxConnections is less than 1, one
+	// query is run at a time.
+	MaxConnections int
+}
+
+func (d DataSource) Name() string {
+	if d.SourceName != "" {
+		return d.SourceName
+	}
+	return "boulder"
+}
+
+// Source sends the DER bytes of the selected certificates and
+// precertificates over certs.
+func (d DataSource) Source(ctx context.Context, certs chan<- []byte) error {
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.SourceEntries(ctx, entries)
+		close(entries)
+	}()
+
+	for entry := range entries {
+		select {
+		case certs <- entry.DER:
+		case <-ctx.Done():
+		}
+	}
+	return <-done
+}
+
+// SourceEntries sends the selected certificates and precertificates over
+// entries, each with the time it was issued as its Timestamp, its row ID as
+// its Index, and its Row as its Payload.
+func (d DataSource) SourceEntries(ctx context.Context, entries chan<- x509search.Entry) error {
+	if d.DB == nil {
+		return errors.New("no database")
+	}
+
+	if !d.IncludePrecertificates && !d.IncludeCertificates {
+		return errors.New("neither precertificates nor certificates included")
+	}
+
+	if d.StartTimeInclusive.IsZero() || d.EndTimeInclusive.IsZero() {
+		return errors.New("no window")
+	}
+
+	if d.Cursor != nil && d.IssuedChunk > 0 {
+		return errors.New("a cursor can't be combined with reading by issued time")
+	}
+
+	scans, err := d.scans()
+	if err != nil {
+		return err
+	}
+
+	var work []chunk
+	for _, s := range scans {
+		work = append(work, d.chunks(s)...)
+	}
+
+	concurrency := 1
+	if d.MaxConnections > 1 {
+		concurrency = d.MaxConnections
+	}
+
+	databases := newReplicas(append([]*sql.DB{d.DB}, d.Replicas...))
+
+	// A failed chunk cancels the remaining work
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var failure error
+	var failOnce sync.Once
+
+	workChan := make(chan chunk)
+	go func() {
+		defer close(workChan)
+		for _, c := range work {
+			select {
+			case workChan <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for worker := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range workChan {
+				err := d.sourceChunk(ctx, databases, worker, c, entries)
+				if err != nil {
+					failOnce.Do(func() {
+						failure = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return failure
+}
+
+// tables returns the tables the DataSource reads.
+func (d DataSource) tables() []string {
+	var tables []string
+	if d.IncludePrecertificates {
+		tables = append(tables, "precertificates")
+	}
+	if d.IncludeCertificates {
+		tables = append(tables, "certificates")
+	}
+	return tables
+}
+
+// chunk is a part of a scan read by a single worker.
+type chunk struct {
+	scan
+
+	// start and end bound the issued times of its rows, inclusively.
+	start, end time.Time
+}
+
+// chunks splits the rows a scan reads into the chunks the workers read: the
+// whole scan when reading by ID, or each IssuedChunk of it.
+func (d DataSource) chunks(s scan) []chunk {
+	if d.IssuedChunk <= 0 {
+		return []chunk{{scan: s, start: s.start, end: s.end}}
+	}
+
+	var chunks []chunk
+	for start := s.start; !start.After(s.end); start = start.Add(d.IssuedChunk) {
+		// BETWEEN includes both ends, so each chunk ends just before the next
+		// one starts
+		end := start.Add(d.IssuedChunk - time.Nanosecond)
+		if end.After(s.end) {
+			end = s.end
+		}
+
+		chunks = append(chunks, chunk{scan: s, start: start, end: end})
+	}
+	return chunks
+}
+
+// sourceChunk sends the certificates in a chunk, querying databases on behalf
+// of the given worker.
+func (d DataSource) sourceChunk(ctx context.Context, databases *replicas, worker int, c chunk, entries chan<- x509search.Entry) error {
+	// lastID is the ID of the last row sent. Rows are read in ID order, so
+	// rows up to it are skipped when a query is retried, and the next batch
+	// starts after it.
+	lastID := d.Cursor.LastID(c.name)
+	send := func(entry x509search.Entry) error {
+		if entry.Metadata.Index <= lastID {
+			return nil
+		}
+
+		select {
+		case entries <- entry:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		lastID = entry.Metadata.Index
+		d.Cursor.advance(c.name, lastID)
+		return nil
+	}
+
+	filters, filterArgs := d.filters(c.table)
+
+	if d.IssuedChunk > 0 {
+		query := fmt.Sprintf("%s WHERE t.issued BETWEEN ? AND ?%s ORDER BY t.id", d.selectFrom(c.from), filters)
+		args := append([]any{c.start.UTC(), c.end.UTC()}, filterArgs...)
+
+		_, err := d.query(ctx, databases, worker, c.table, Query{Table: c.name, Attempt: 1}, send, query, args...)
+		return err
+	}
+
+	sizer := newBatchSizer(d.BatchSize)
+
+	query := fmt.Sprintf("%s WHERE t.issued >= ? AND t.issued <= ?%s AND t.id > ? ORDER BY t.id LIMIT ?", d.selectFrom(c.from), filters)
+
+	attempt := 1
+	for {
+		batchSize := sizer.size
+
+		args := append([]any{c.start.UTC(), c.end.UTC()}, filterArgs...)
+		args = append(args, lastID, batchSize)
+
+		r, err := d.query(ctx, databases, worker, c.table, Query{Table: c.name, Attempt: attempt, BatchSize: batchSize}, send, query, args...)
+		if isTimeout(ctx, err) && sizer.shrink() {
+			fmt.Fprintf(os.Stderr, "%s: retrying with %d rows per query: %s\n", d.Name(), sizer.size, err.Error())
+			attempt++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		attempt = 1
+
+		sizer.observe(r)
+
+		if r.rows < batchSize {
+			return nil
+		}
+	}
+}
+
+// query runs a query with readRows on the database picked for the worker,
+// retrying it on the others in turn if it fails, and passes each attempt,
+// described by q, to the Observer. Queries that time out aren't retried, as
+// the fault lies with the query rather than the database. A retried query
+// reads the rows its failed attempts read again, which fn must skip.
+func (d DataSource) query(ctx context.Context, databases *replicas, worker int, table string, q Query, fn func(x509search.Entry) error, query string, args ...any) (result, error) {
+	for tries := 1; ; tries++ {
+		index := databases.pick(ctx, worker+tries-1)
+
+		r, err := d.readRows(ctx, databases.dbs[index], table, fn, query, args...)
+		if d.Observer != nil {
+			attempt := q
+			attempt.Database = index
+			attempt.Attempt = q.Attempt + tries - 1
+			attempt.Rows = r.rows
+			attempt.Bytes = r.bytes
+			attempt.Duration = r.elapsed
+			attempt.Timeout = isTimeout(ctx, err)
+			attempt.Err = err
+			d.Observer(attempt)
+		}
+		if err == nil || ctx.Err() != nil || isTimeout(ctx, err) {
+			return r, err
+		}
+
+		databases.fail(index)
+		if tries >= len(databases.dbs) {
+			return r, err
+		}
+		fmt.Fprintf(os.Stderr, "%s: retrying on another database: %s\n", d.Name(), err.Error())
+	}
+}
+
+// joinStatus reports whether the queries join the certificateStatus table.
+func (d DataSource) joinStatus() bool {
+	return d.JoinStatus || d.Unrevoked
+}
+
+// from returns the table, partition, or shard a scan queries, aliased as t,
+// followed by the IndexHint, if any.
+func (d DataSource) from(from string) string {
+	if d.IndexHint == "" {
+		return from + " AS t"
+	}
+	return from + " AS t " + d.IndexHint
+}
+
+// selectFrom returns the start of the queries of a scan querying from, up to
+// their WHERE clauses, selecting the columns readRows reads, with from
+// aliased as t, joined to certificateStatus, aliased as s, if needed.
+func (d DataSource) selectFrom(from string) string {
+	columns := "t.id, t.serial, t.der, t.issued"
+	from = d.from(from)
+	if d.joinStatus() {
+		columns += ", s.status, s.revokedDate, s.revokedReason"
+		from += " LEFT JOIN certificateStatus AS s ON s.serial = t.serial"
+	}
+	return "SELECT " + columns + " FROM " + from
+}
+
+// filters returns the conditions the queries reading table add to their
+// WHERE clauses, each preceded by AND, and their arguments.
+func (d DataSource) filters(table string) (string, []any) {
+	var filters string
+	var args []any
+	if d.Unrevoked {
+		filters += " AND (s.status IS NULL OR s.status <> 'revoked')"
+	}
+	if d.Unexpired {
+		filters += " AND t.expires > ?"
+		args = append(args, time.Now().UTC())
+	}
+	if d.CollapseBySerial && d.IncludeCertificates && table == "precertificates" {
+		filters += " AND NOT EXISTS (SELECT 1 FROM certificates AS c WHERE c.serial = t.serial AND c.issued <= ?)"
+		args = append(args, d.EndTimeInclusive.UTC())
+	}
+	return filters, args
+}
+
+// result describes the rows a query returned.
+type result struct {
+	// rows is the number of rows, and bytes their bytes of certificates.
+	rows, bytes int
+
+	// elapsed is the time spent in the query, not counting the time spent
+	// handing its rows on.
+	elapsed time.Duration
+}
+
+// readRows runs a query on db selecting the columns selectFrom selects from
+// rows of table, calling fn with an entry for each row as it's read, so that
+// only one row is held in memory at a time. QueryTimeout bounds the time
+// spent in the query, not counting the time fn takes. An error returned by
+// fn is returned as is.
+func (d DataSource) readRows(ctx context.Context, db *sql.DB, table string, fn func(x509search.Entry) error, query string, args ...any) (r result, err error) {
+	started := time.Now()
+
+	// paused is the time spent in fn, during which the query's timeout is
+	// paused, so that a search that's slow to take rows doesn't time the
+	// query out
+	var paused time.Duration
+	defer func() {
+		r.elapsed = time.Since(started) - paused
+	}()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timeout := fmt.Errorf("query timed out after %s: %w", d.QueryTimeout, context.DeadlineExceeded)
+	var timer *time.Timer
+	if d.QueryTimeout > 0 {
+		timer = time.AfterFunc(d.QueryTimeout, func() { cancel(timeout) })
+		defer timer.Stop()
+	}
+
+	// timedOut returns the timeout as the error if it cut err's query short
+	timedOut := func(err error) error {
+		if context.Cause(ctx) == timeout {
+			return timeout
+		}
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return r, fmt.Errorf("querying %s: %w", table, timedOut(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row Row
+		var der []byte
+		var issued time.Time
+		var status sql.NullString
+		var revokedDate sql.NullTime
+		var revokedReason sql.NullInt64
+		dest := []any{&row.ID, &row.Serial, &der, &issued}
+		if d.joinStatus() {
+			dest = append(dest, &status, &revokedDate, &revokedReason)
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return r, fmt.Errorf("reading %s: %w", table, err)
+		}
+		row.Table = table
+
+		metadata := x509search.Metadata{
+			Source:         d.Name(),
+			Index:          row.ID,
+			Timestamp:      issued,
+			Precertificate: table == "precertificates",
+		}
+		if status.Valid {
+			row.Status = &Status{
+				Status:        status.String,
+				RevokedDate:   revokedDate.Time,
+				RevokedReason: int(revokedReason.Int64),
+			}
+
+			metadata.Annotate("boulder.status", status.String)
+			if status.String == "revoked" {
+				metadata.Annotate("boulder.revokedAt", revokedDate.Time.UTC().Format(time.RFC3339))
+				metadata.Annotate("boulder.reason", strconv.FormatInt(revokedReason.Int64, 10))
+			}
+		}
+		metadata.Payload = row
+
+		r.rows++
+		r.bytes += len(der)
+
+		if timer != nil && !timer.Stop() {
+			return r, fmt.Errorf("reading %s: %w", table, timeout)
+		}
+
+		handedOn := time.Now()
+		err = fn(x509search.Entry{
+			DER:      der,
+			Metadata: metadata,
+		})
+		if err != nil {
+			return r, err
+		}
+		paused += time.Since(handedOn)
+
+		if timer != nil {
+			timer.Reset(d.QueryTimeout - (time.Since(started) - paused))
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return r, fmt.Errorf("reading %s: %w", table, timedOut(err))
+	}
+	return r, nil
+}
@@ -0,0 +1,926 @@
+package boulder
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+var testStart = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeRow is a row of a fake table.
+type fakeRow struct {
+	id      int64
+	serial  string
+	issued  time.Time
+	expires time.Time
+
+	// status, revokedDate, and revokedReason are the row's certificateStatus,
+	// if status is set.
+	status        string
+	revokedDate   time.Time
+	revokedReason int64
+}
+
+// fakeDB is a database/sql driver emulating the queries a DataSource makes on
+// tables of fakeRows.
+type fakeDB struct {
+	mu      sync.Mutex
+	tables  map[string][]fakeRow
+	queries []string
+
+	// err, if set, fails every query and ping.
+	err error
+
+	// beforeQuery, if set, is called at the start of each query.
+	beforeQuery func()
+
+	// maxLimit, if positive, makes queries for more rows than it hang until
+	// they're cancelled.
+	maxLimit int64
+
+	// failAfter, if positive, fails the rows of each query after that many.
+	failAfter int
+}
+
+// newFakeDB returns a database holding count rows in each of the
+// precertificates and certificates tables, issued a minute apart from
+// testStart, expiring 90 days later, with IDs starting at 1.
+func newFakeDB(t *testing.T, count int) (*fakeDB, *sql.DB) {
+	t.Helper()
+
+	fake := &fakeDB{tables: make(map[string][]fakeRow)}
+	for _, table := range []string{"precertificates", "certificates"} {
+		for i := range count {
+			fake.tables[table] = append(fake.tables[table], fakeRow{
+				id:      int64(i + 1),
+				serial:  fmt.Sprintf("%036x", i+1),
+				issued:  testStart.Add(time.Duration(i) * time.Minute),
+				expires: testStart.Add(time.Duration(i)*time.Minute + 90*24*time.Hour),
+			})
+		}
+	}
+
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return fake, db
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return fakeConn{f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+var (
+	fromPattern     = regexp.MustCompile(`FROM (\w+)(?: PARTITION \(\w+\))? AS t`)
+	boundaryPattern = regexp.MustCompile(`^SELECT t\.id FROM \w+ AS t WHERE t\.issued (>=|<=) \? ORDER BY t\.issued(, t\.id| DESC, t\.id DESC) LIMIT 1$`)
+)
+
+// query answers the queries DataSource makes, consuming the arguments of
+// their conditions in the order they're written.
+func (f *fakeDB) query(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if f.beforeQuery != nil {
+		f.beforeQuery()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queries = append(f.queries, query)
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	from := fromPattern.FindStringSubmatch(query)
+	if from == nil {
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+
+	// The first row issued from a time, or the last issued up to it
+	if boundary := boundaryPattern.FindStringSubmatch(query); boundary != nil {
+		bound := args[0].Value.(time.Time)
+		var found []fakeRow
+		for _, row := range f.tables[from[1]] {
+			if boundary[1] == ">=" && !row.issued.Before(bound) && found == nil {
+				found = []fakeRow{row}
+			}
+			if boundary[1] == "<=" && !row.issued.After(bound) {
+				found = []fakeRow{row}
+			}
+		}
+		return &fakeRows{rows: found, idOnly: true}, nil
+	}
+
+	if !strings.Contains(query, "ORDER BY t.id") {
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+
+	next := func() any {
+		arg := args[0].Value
+		args = args[1:]
+		return arg
+	}
+
+	var conditions []func(fakeRow) bool
+	if !strings.Contains(query, "t.issued >= ? AND t.issued <= ?") && !strings.Contains(query, "t.issued BETWEEN ? AND ?") {
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	start, end := next().(time.Time), next().(time.Time)
+	conditions = append(conditions, func(row fakeRow) bool {
+		return !row.issued.Before(start) && !row.issued.After(end)
+	})
+	if strings.Contains(query, "AND (s.status IS NULL OR s.status <> 'revoked')") {
+		conditions = append(conditions, func(row fakeRow) bool {
+			return row.status != "revoked"
+		})
+	}
+	if strings.Contains(query, "AND t.expires > ?") {
+		now := next().(time.Time)
+		conditions = append(conditions, func(row fakeRow) bool {
+			return row.expires.After(now)
+		})
+	}
+	if strings.Contains(query, "AND NOT EXISTS (SELECT 1 FROM certificates AS c WHERE c.serial = t.serial AND c.issued <= ?)") {
+		end := next().(time.Time)
+		conditions = append(conditions, func(row fakeRow) bool {
+			for _, certificate := range f.tables["certificates"] {
+				if certificate.serial == row.serial && !certificate.issued.After(end) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if strings.Contains(query, "AND t.id > ?") {
+		lastID := next().(int64)
+		conditions = append(conditions, func(row fakeRow) bool {
+			return row.id > lastID
+		})
+	}
+	limit := int64(-1)
+	if strings.HasSuffix(query, "LIMIT ?") {
+		limit = next().(int64)
+		if f.maxLimit > 0 && limit > f.maxLimit {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+	}
+	if len(args) > 0 {
+		return nil, fmt.Errorf("unused arguments %v for query: %s", args, query)
+	}
+
+	var selected []fakeRow
+	for _, row := range f.tables[from[1]] {
+		if int64(len(selected)) == limit {
+			break
+		}
+		matches := true
+		for _, condition := range conditions {
+			matches = matches && condition(row)
+		}
+		if matches {
+			selected = append(selected, row)
+		}
+	}
+
+	return &fakeRows{
+		rows:       selected,
+		failAfter:  f.failAfter,
+		joinStatus: strings.Contains(query, "LEFT JOIN certificateStatus AS s ON s.serial = t.serial"),
+	}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.query(ctx, query, args)
+}
+
+func (c fakeConn) Ping(ctx context.Context) error {
+	return c.db.err
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+type fakeRows struct {
+	rows       []fakeRow
+	joinStatus bool
+	failAfter  int
+	read       int
+
+	// idOnly returns only the id column.
+	idOnly bool
+}
+
+func (r *fakeRows) Columns() []string {
+	if r.idOnly {
+		return []string{"id"}
+	}
+	if r.joinStatus {
+		return []string{"id", "serial", "der", "issued", "status", "revokedDate", "revokedReason"}
+	}
+	return []string{"id", "serial", "der", "issued"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	if r.failAfter > 0 && r.read == r.failAfter {
+		return errors.New("connection reset")
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	r.read++
+
+	dest[0] = row.id
+	if r.idOnly {
+		return nil
+	}
+	dest[1] = row.serial
+	dest[2] = []byte(row.serial)
+	dest[3] = row.issued
+	if r.joinStatus {
+		dest[4], dest[5], dest[6] = nil, nil, nil
+		if row.status != "" {
+			dest[4] = row.status
+			dest[5] = row.revokedDate
+			dest[6] = row.revokedReason
+		}
+	}
+	return nil
+}
+
+// read returns the entries d finds, ordered as they were sent.
+func read(t *testing.T, d DataSource) []x509search.Entry {
+	t.Helper()
+
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.SourceEntries(context.Background(), entries)
+		close(entries)
+	}()
+
+	var found []x509search.Entry
+	for entry := range entries {
+		found = append(found, entry)
+	}
+
+	err := <-done
+	if err != nil {
+		t.Fatalf("SourceEntries: %s", err)
+	}
+	return found
+}
+
+// rowIDs returns the table and ID of each entry, such as "certificates/3",
+// sorted.
+func rowIDs(entries []x509search.Entry) []string {
+	var ids []string
+	for _, entry := range entries {
+		row, _ := x509search.PayloadAs[Row](entry.Metadata)
+		ids = append(ids, fmt.Sprintf("%s/%d", row.Table, row.ID))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// expectedIDs returns the IDs rowIDs returns for the rows of table with IDs
+// from first to last.
+func expectedIDs(table string, first, last int) []string {
+	var ids []string
+	for id := first; id <= last; id++ {
+		ids = append(ids, fmt.Sprintf("%s/%d", table, id))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestSourceEntries(t *testing.T) {
+	fake, db := newFakeDB(t, 10)
+
+	found := read(t, DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart.Add(2 * time.Minute),
+		EndTimeInclusive:    testStart.Add(8 * time.Minute),
+		BatchSize:           3,
+	})
+
+	expected := expectedIDs("certificates", 3, 9)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+
+	// Seven rows in batches of three take three queries
+	if len(fake.queries) != 3 {
+		t.Errorf("made %d queries, expected 3", len(fake.queries))
+	}
+
+	for _, entry := range found {
+		if entry.Metadata.Precertificate || entry.Metadata.Index <= 0 || entry.Metadata.Timestamp.IsZero() {
+			t.Errorf("unexpected metadata: %+v", entry.Metadata)
+		}
+	}
+}
+
+func TestSourceEntriesByIssued(t *testing.T) {
+	fake, db := newFakeDB(t, 10)
+
+	found := read(t, DataSource{
+		DB:                     db,
+		IncludePrecertificates: true,
+		StartTimeInclusive:     testStart,
+		EndTimeInclusive:       testStart.Add(9 * time.Minute),
+		IssuedChunk:            3 * time.Minute,
+	})
+
+	// Rows issued at the boundaries between chunks are found once
+	expected := expectedIDs("precertificates", 1, 10)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+
+	if len(fake.queries) != 4 {
+		t.Errorf("made %d queries, expected 4", len(fake.queries))
+	}
+}
+
+func TestSourceEntriesIndexHint(t *testing.T) {
+	fake, db := newFakeDB(t, 1)
+
+	read(t, DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart,
+		IndexHint:           "USE INDEX (issued_idx)",
+	})
+
+	expected := "SELECT t.id, t.serial, t.der, t.issued FROM certificates AS t USE INDEX (issued_idx) WHERE t.issued >= ? AND t.issued <= ? AND t.id > ? ORDER BY t.id LIMIT ?"
+	if len(fake.queries) != 1 || fake.queries[0] != expected {
+		t.Errorf("made queries %q, expected %q", fake.queries, expected)
+	}
+}
+
+func TestSourceEntriesReplicas(t *testing.T) {
+	primary, db := newFakeDB(t, 10)
+	replica, replicaDB := newFakeDB(t, 10)
+
+	// Neither database answers until both have been queried, so the second
+	// worker must pick up a chunk while the first waits
+	primaryQueried, replicaQueried := make(chan struct{}), make(chan struct{})
+	var primaryOnce, replicaOnce sync.Once
+	primary.beforeQuery = func() {
+		primaryOnce.Do(func() { close(primaryQueried) })
+		<-replicaQueried
+	}
+	replica.beforeQuery = func() {
+		replicaOnce.Do(func() { close(replicaQueried) })
+		<-primaryQueried
+	}
+
+	found := read(t, DataSource{
+		DB:                     db,
+		Replicas:               []*sql.DB{replicaDB},
+		IncludePrecertificates: true,
+		IncludeCertificates:    true,
+		StartTimeInclusive:     testStart,
+		EndTimeInclusive:       testStart.Add(9 * time.Minute),
+		IssuedChunk:            2 * time.Minute,
+		MaxConnections:         2,
+	})
+
+	expected := append(expectedIDs("certificates", 1, 10), expectedIDs("precertificates", 1, 10)...)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+
+	// The workers are spread across the databases
+	if len(primary.queries) == 0 || len(replica.queries) == 0 || len(primary.queries)+len(replica.queries) != 10 {
+		t.Errorf("made %d queries to the primary and %d to the replica, expected 10 spread across both", len(primary.queries), len(replica.queries))
+	}
+}
+
+func TestSourceEntriesFailover(t *testing.T) {
+	primary, db := newFakeDB(t, 10)
+	primary.err = errors.New("connection refused")
+	replica, replicaDB := newFakeDB(t, 10)
+
+	found := read(t, DataSource{
+		DB:                  db,
+		Replicas:            []*sql.DB{replicaDB},
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(9 * time.Minute),
+		BatchSize:           3,
+	})
+
+	expected := expectedIDs("certificates", 1, 10)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+
+	// Once it has failed, the primary is left alone
+	if len(primary.queries) != 1 || len(replica.queries) != 4 {
+		t.Errorf("made %d queries to the primary and %d to the replica, expected 1 and 4", len(primary.queries), len(replica.queries))
+	}
+}
+
+func TestSourceEntriesAllFailed(t *testing.T) {
+	primary, db := newFakeDB(t, 10)
+	primary.err = errors.New("connection refused")
+	replica, replicaDB := newFakeDB(t, 10)
+	replica.err = errors.New("connection refused")
+
+	err := DataSource{
+		DB:                  db,
+		Replicas:            []*sql.DB{replicaDB},
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(9 * time.Minute),
+	}.SourceEntries(context.Background(), make(chan x509search.Entry))
+	if !errors.Is(err, primary.err) && !errors.Is(err, replica.err) {
+		t.Errorf("got error %v, expected connection refused", err)
+	}
+}
+
+func TestBatchSizer(t *testing.T) {
+	fixed := newBatchSizer(100)
+	fixed.observe(result{rows: 100, elapsed: time.Millisecond})
+	if fixed.size != 100 || fixed.shrink() {
+		t.Errorf("fixed batch size changed to %d", fixed.size)
+	}
+
+	sizer := newBatchSizer(0)
+	if sizer.size != DefaultBatchSize {
+		t.Fatalf("started at %d, expected %d", sizer.size, DefaultBatchSize)
+	}
+
+	// Quick, full batches grow
+	sizer.observe(result{rows: sizer.size, elapsed: time.Millisecond})
+	if sizer.size != 2*DefaultBatchSize {
+		t.Errorf("grew to %d, expected %d", sizer.size, 2*DefaultBatchSize)
+	}
+
+	// Quick batches that aren't full don't
+	sizer.observe(result{rows: 10, elapsed: time.Millisecond})
+	if sizer.size != 2*DefaultBatchSize {
+		t.Errorf("changed to %d, expected %d", sizer.size, 2*DefaultBatchSize)
+	}
+
+	// Slow batches shrink
+	sizer.observe(result{rows: sizer.size, elapsed: 2 * targetQueryDuration})
+	if sizer.size != DefaultBatchSize {
+		t.Errorf("shrank to %d, expected %d", sizer.size, DefaultBatchSize)
+	}
+
+	// Batches of large certificates are capped by their bytes
+	sizer.observe(result{rows: sizer.size, bytes: sizer.size << 20, elapsed: time.Millisecond})
+	if sizer.size != maxBatchBytes>>20 {
+		t.Errorf("capped at %d, expected %d", sizer.size, maxBatchBytes>>20)
+	}
+
+	// Timeouts shrink the batch until it reaches the minimum
+	for sizer.shrink() {
+	}
+	if sizer.size != minBatchSize {
+		t.Errorf("shrank to %d, expected %d", sizer.size, minBatchSize)
+	}
+}
+
+func TestSourceEntriesQueryTimeout(t *testing.T) {
+	fake, db := newFakeDB(t, 10)
+	fake.maxLimit = 100
+
+	found := read(t, DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(9 * time.Minute),
+		QueryTimeout:        10 * time.Millisecond,
+	})
+
+	expected := expectedIDs("certificates", 1, 10)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+
+	// The batch shrinks from 1000 to 250 to 62 rows before it's answered
+	if len(fake.queries) != 3 {
+		t.Errorf("made %d queries, expected 3", len(fake.queries))
+	}
+}
+
+func TestSourceEntriesQueryTimeoutFixed(t *testing.T) {
+	fake, db := newFakeDB(t, 10)
+	fake.maxLimit = 100
+
+	err := DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(9 * time.Minute),
+		BatchSize:           1000,
+		QueryTimeout:        10 * time.Millisecond,
+	}.SourceEntries(context.Background(), make(chan x509search.Entry))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, expected a timeout", err)
+	}
+}
+
+func TestSourceEntriesCursor(t *testing.T) {
+	_, db := newFakeDB(t, 10)
+
+	// Stop the scan after four rows have been received
+	cursor := NewCursor(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- DataSource{
+			DB:                  db,
+			IncludeCertificates: true,
+			StartTimeInclusive:  testStart,
+			EndTimeInclusive:    testStart.Add(9 * time.Minute),
+			BatchSize:           3,
+			Cursor:              cursor,
+		}.SourceEntries(ctx, entries)
+	}()
+	for range 4 {
+		<-entries
+	}
+	cancel()
+	err := <-done
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected context.Canceled", err)
+	}
+
+	lastIDs := cursor.LastIDs()
+	if len(lastIDs) != 1 || lastIDs["certificates"] != 4 {
+		t.Fatalf("cursor stopped at %v, expected certificates at 4", lastIDs)
+	}
+
+	// Resuming finds the rest
+	found := read(t, DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(9 * time.Minute),
+		BatchSize:           3,
+		Cursor:              NewCursor(lastIDs),
+	})
+	expected := expectedIDs("certificates", 5, 10)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+}
+
+func TestNilCursor(t *testing.T) {
+	var cursor *Cursor
+	if got := cursor.LastID("certificates"); got != 0 {
+		t.Errorf("nil cursor has last ID %d, expected 0", got)
+	}
+	if got := cursor.LastIDs(); got == nil || len(got) != 0 {
+		t.Errorf("nil cursor has last IDs %v, expected an empty map", got)
+	}
+}
+
+func TestSourceEntriesCursorByIssued(t *testing.T) {
+	_, db := newFakeDB(t, 10)
+
+	err := DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(9 * time.Minute),
+		IssuedChunk:         time.Minute,
+		Cursor:              NewCursor(nil),
+	}.SourceEntries(context.Background(), make(chan x509search.Entry))
+	if err == nil {
+		t.Error("expected an error combining a cursor with reading by issued time")
+	}
+}
+
+func TestSourceEntriesStatus(t *testing.T) {
+	fake, db := newFakeDB(t, 4)
+	revokedAt := testStart.Add(time.Hour)
+	for i := range fake.tables["certificates"] {
+		row := &fake.tables["certificates"][i]
+		switch row.id {
+		case 1:
+			row.status = "good"
+		case 2:
+			row.status, row.revokedDate, row.revokedReason = "revoked", revokedAt, 1
+		case 3:
+			row.expires = time.Now().Add(time.Hour)
+			row.status = "good"
+		}
+	}
+
+	found := read(t, DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(3 * time.Minute),
+		JoinStatus:          true,
+	})
+	if len(found) != 4 {
+		t.Fatalf("found %d certificates, expected 4", len(found))
+	}
+
+	statuses := make(map[int64]*Status)
+	for _, entry := range found {
+		row, _ := x509search.PayloadAs[Row](entry.Metadata)
+		statuses[row.ID] = row.Status
+		if row.Status != nil && entry.Metadata.Annotations["boulder.status"] != row.Status.Status {
+			t.Errorf("row %d annotated with %v, expected status %q", row.ID, entry.Metadata.Annotations, row.Status.Status)
+		}
+	}
+	if statuses[1] == nil || statuses[1].Status != "good" {
+		t.Errorf("row 1 has status %+v, expected good", statuses[1])
+	}
+	if statuses[2] == nil || statuses[2].Status != "revoked" || !statuses[2].RevokedDate.Equal(revokedAt) || statuses[2].RevokedReason != 1 {
+		t.Errorf("row 2 has status %+v, expected revoked", statuses[2])
+	}
+	if statuses[4] != nil {
+		t.Errorf("row 4 has status %+v, expected none", statuses[4])
+	}
+	for _, entry := range found {
+		if entry.Metadata.Index == 2 && (entry.Metadata.Annotations["boulder.revokedAt"] != revokedAt.Format(time.RFC3339) || entry.Metadata.Annotations["boulder.reason"] != "1") {
+			t.Errorf("revoked row annotated with %v", entry.Metadata.Annotations)
+		}
+	}
+
+	// Revoked and expired certificates are filtered out in the query
+	found = read(t, DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(3 * time.Minute),
+		Unrevoked:           true,
+		Unexpired:           true,
+	})
+	expected := expectedIDs("certificates", 3, 3)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+
+	found = read(t, DataSource{
+		DB:                  db,
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(3 * time.Minute),
+		Unrevoked:           true,
+	})
+	expected = []string{"certificates/1", "certificates/3", "certificates/4"}
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+}
+
+func TestSourceEntriesStreamFailover(t *testing.T) {
+	primary, db := newFakeDB(t, 10)
+	primary.failAfter = 3
+	_, replicaDB := newFakeDB(t, 10)
+
+	// The rows the primary sent before failing aren't sent again
+	found := read(t, DataSource{
+		DB:                  db,
+		Replicas:            []*sql.DB{replicaDB},
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(9 * time.Minute),
+		IssuedChunk:         time.Hour,
+	})
+	expected := expectedIDs("certificates", 1, 10)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+}
+
+func TestSourceEntriesSlowSearch(t *testing.T) {
+	fake, db := newFakeDB(t, 10)
+
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- DataSource{
+			DB:                  db,
+			IncludeCertificates: true,
+			StartTimeInclusive:  testStart,
+			EndTimeInclusive:    testStart.Add(9 * time.Minute),
+			BatchSize:           100,
+			QueryTimeout:        20 * time.Millisecond,
+		}.SourceEntries(context.Background(), entries)
+		close(entries)
+	}()
+
+	// Taking the rows slowly doesn't count against the query's timeout
+	count := 0
+	for range entries {
+		time.Sleep(10 * time.Millisecond)
+		count++
+	}
+	err := <-done
+	if err != nil {
+		t.Fatalf("SourceEntries: %s", err)
+	}
+	if count != 10 || len(fake.queries) != 1 {
+		t.Errorf("found %d rows in %d queries, expected 10 in 1", count, len(fake.queries))
+	}
+}
+
+func TestSourceEntriesCollapseBySerial(t *testing.T) {
+	fake, db := newFakeDB(t, 10)
+
+	// Rows 7 to 10 have no final certificate, and row 3's was issued after
+	// the window
+	fake.tables["certificates"] = fake.tables["certificates"][:6]
+	fake.tables["certificates"][2].issued = testStart.Add(time.Hour)
+
+	found := read(t, DataSource{
+		DB:                     db,
+		IncludePrecertificates: true,
+		IncludeCertificates:    true,
+		StartTimeInclusive:     testStart,
+		EndTimeInclusive:       testStart.Add(9 * time.Minute),
+		CollapseBySerial:       true,
+	})
+
+	expected := []string{"certificates/1", "certificates/2", "certificates/4", "certificates/5", "certificates/6"}
+	expected = append(expected, "precertificates/10", "precertificates/3")
+	expected = append(expected, expectedIDs("precertificates", 7, 9)...)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+}
+
+func TestSourceEntriesObserver(t *testing.T) {
+	primary, db := newFakeDB(t, 10)
+	primary.err = errors.New("connection refused")
+	_, replicaDB := newFakeDB(t, 10)
+
+	var mu sync.Mutex
+	var queries []Query
+	stats := &QueryStats{}
+	read(t, DataSource{
+		DB:                  db,
+		Replicas:            []*sql.DB{replicaDB},
+		IncludeCertificates: true,
+		StartTimeInclusive:  testStart,
+		EndTimeInclusive:    testStart.Add(9 * time.Minute),
+		BatchSize:           3,
+		Observer: func(query Query) {
+			mu.Lock()
+			defer mu.Unlock()
+			queries = append(queries, query)
+			stats.Observe(query)
+		},
+	})
+
+	// The failed query is retried on the replica, which answers the rest
+	if len(queries) != 5 {
+		t.Fatalf("observed %d queries, expected 5", len(queries))
+	}
+	if queries[0].Database != 0 || queries[0].Attempt != 1 || queries[0].Err == nil {
+		t.Errorf("first query was %+v, expected a failure on the primary", queries[0])
+	}
+	if queries[1].Database != 1 || queries[1].Attempt != 2 || queries[1].Rows != 3 || queries[1].BatchSize != 3 {
+		t.Errorf("second query was %+v, expected a retry on the replica returning 3 rows", queries[1])
+	}
+
+	counts := stats.Counts()
+	expected := QueryCounts{
+		Queries:  5,
+		Rows:     10,
+		Bytes:    10 * 36,
+		Duration: counts.Duration,
+		Errors:   1,
+		Retries:  1,
+	}
+	if counts != expected {
+		t.Errorf("counted %+v, expected %+v", counts, expected)
+	}
+}
+
+func TestEstimateRows(t *testing.T) {
+	_, db := newFakeDB(t, 10)
+
+	d := DataSource{
+		DB:                     db,
+		IncludePrecertificates: true,
+		IncludeCertificates:    true,
+		StartTimeInclusive:     testStart.Add(2 * time.Minute),
+		EndTimeInclusive:       testStart.Add(8 * time.Minute),
+	}
+	estimate, err := d.EstimateRows(context.Background())
+	if err != nil {
+		t.Fatalf("EstimateRows: %s", err)
+	}
+	if estimate != 14 {
+		t.Errorf("estimated %d rows, expected 14", estimate)
+	}
+
+	// Rows the cursor has been past aren't counted
+	d.Cursor = NewCursor(map[string]int64{"certificates": 5})
+	estimate, err = d.EstimateRows(context.Background())
+	if err != nil {
+		t.Fatalf("EstimateRows: %s", err)
+	}
+	if estimate != 11 {
+		t.Errorf("estimated %d rows, expected 11", estimate)
+	}
+
+	// A window without rows has none
+	d.StartTimeInclusive = testStart.Add(time.Hour)
+	d.EndTimeInclusive = testStart.Add(2 * time.Hour)
+	estimate, err = d.EstimateRows(context.Background())
+	if err != nil {
+		t.Fatalf("EstimateRows: %s", err)
+	}
+	if estimate != 0 {
+		t.Errorf("estimated %d rows, expected none", estimate)
+	}
+}
+
+func TestSourceEntriesPartitions(t *testing.T) {
+	fake, db := newFakeDB(t, 10)
+
+	// The rows of the precertificates table are split between two shards
+	fake.tables["precertificates_a"] = fake.tables["precertificates"][:5]
+	fake.tables["precertificates_b"] = fake.tables["precertificates"][5:]
+	delete(fake.tables, "precertificates")
+
+	cursor := NewCursor(nil)
+	found := read(t, DataSource{
+		DB:                     db,
+		IncludePrecertificates: true,
+		IncludeCertificates:    true,
+		StartTimeInclusive:     testStart,
+		EndTimeInclusive:       testStart.Add(9 * time.Minute),
+		Partitions: []Partition{
+			{Table: "certificates", Name: "p0", End: testStart.Add(5 * time.Minute)},
+			{Table: "certificates", Name: "p1", Start: testStart.Add(5 * time.Minute), End: testStart.Add(time.Hour)},
+			{Table: "certificates", Name: "p2", Start: testStart.Add(time.Hour)},
+			{Table: "precertificates", Name: "precertificates_a", Sharded: true, End: testStart.Add(5 * time.Minute)},
+			{Table: "precertificates", Name: "precertificates_b", Sharded: true, Start: testStart.Add(5 * time.Minute)},
+		},
+		Cursor: cursor,
+	})
+
+	expected := append(expectedIDs("certificates", 1, 10), expectedIDs("precertificates", 1, 10)...)
+	if !slices.Equal(rowIDs(found), expected) {
+		t.Errorf("found %v, expected %v", rowIDs(found), expected)
+	}
+
+	// Only the partitions overlapping the window are queried, each on its own
+	var froms []string
+	for _, query := range fake.queries {
+		froms = append(froms, query[strings.Index(query, "FROM "):strings.Index(query, " AS t")])
+	}
+	expectedFroms := []string{"FROM precertificates_a", "FROM precertificates_b", "FROM certificates PARTITION (p0)", "FROM certificates PARTITION (p1)"}
+	if !slices.Equal(froms, expectedFroms) {
+		t.Errorf("queried %q, expected %q", froms, expectedFroms)
+	}
+
+	lastIDs := cursor.LastIDs()
+	expectedLastIDs := map[string]int64{"precertificates_a": 5, "precertificates_b": 10, "certificates/p0": 5, "certificates/p1": 10}
+	if !maps.Equal(lastIDs, expectedLastIDs) {
+		t.Errorf("cursor at %v, expected %v", lastIDs, expectedLastIDs)
+	}
+}
@@ -0,0 +1,66 @@
+package boulder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// EstimateRows estimates the number of rows the DataSource will read, without
+// reading them, so that a scan can be scheduled, and its progress shown. It
+// finds the IDs of the first and last rows issued within the window in each
+// table, or partition, with two queries the index on issued answers cheaply,
+// and counts the IDs between them: Boulder's IDs increase as rows are
+// inserted, in close to the order they were issued. Rows the Cursor has been
+// past aren't counted, but rows Unrevoked, Unexpired, or CollapseBySerial
+// would skip are.
+func (d DataSource) EstimateRows(ctx context.Context) (int64, error) {
+	if d.DB == nil {
+		return 0, errors.New("no database")
+	}
+
+	if d.StartTimeInclusive.IsZero() || d.EndTimeInclusive.IsZero() {
+		return 0, errors.New("no window")
+	}
+
+	scans, err := d.scans()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, s := range scans {
+		first, err := d.boundaryID(ctx, s.name, fmt.Sprintf("SELECT t.id FROM %s WHERE t.issued >= ? ORDER BY t.issued, t.id LIMIT 1", d.from(s.from)), s.start.UTC())
+		if err != nil {
+			return 0, err
+		}
+		last, err := d.boundaryID(ctx, s.name, fmt.Sprintf("SELECT t.id FROM %s WHERE t.issued <= ? ORDER BY t.issued DESC, t.id DESC LIMIT 1", d.from(s.from)), s.end.UTC())
+		if err != nil {
+			return 0, err
+		}
+		if first == 0 || last == 0 {
+			continue
+		}
+
+		first = max(first, d.Cursor.LastID(s.name)+1)
+		if last >= first {
+			total += last - first + 1
+		}
+	}
+	return total, nil
+}
+
+// boundaryID runs a query on DB selecting the ID of a single row of the named
+// scan, and returns it, or 0 if there's no such row.
+func (d DataSource) boundaryID(ctx context.Context, name string, query string, args ...any) (int64, error) {
+	var id int64
+	err := d.DB.QueryRowContext(ctx, query, args...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("estimating rows of %s: %w", name, err)
+	}
+	return id, nil
+}
@@ -0,0 +1,125 @@
+package boulder
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Serial formats a serial number as Boulder stores it.
+func Serial(serial *big.Int) string {
+	return fmt.Sprintf("%036x", serial)
+}
+
+// Lookup finds certificates claiming to be issued by a CA's issuers that the
+// CA's Boulder database has no record of. Such a certificate in a CT log
+// points to a compromised issuer key if its signature is valid, or to log
+// poisoning or a forgery if it isn't, and either way calls for incident
+// response.
+//
+// A certificate claims an issuer if its issuer name is the issuer's subject,
+// whatever its authority key identifier, as a forgery needn't get that right.
+// It is known to Boulder if its serial number is in the precertificates or
+// certificates table. Lookup is safe for concurrent use.
+type Lookup struct {
+	db      *sql.DB
+	issuers []*x509.Certificate
+}
+
+// NewLookup returns a Lookup of certificates claiming one of issuers in db.
+func NewLookup(db *sql.DB, issuers ...*x509.Certificate) (*Lookup, error) {
+	if db == nil {
+		return nil, errors.New("no database")
+	}
+
+	if len(issuers) == 0 {
+		return nil, errors.New("no issuers")
+	}
+
+	return &Lookup{
+		db:      db,
+		issuers: issuers,
+	}, nil
+}
+
+// Claimed returns the issuer cert claims to be issued by, or nil if it claims
+// none of them. Of several issuers with the same name, the one whose subject
+// key identifier is cert's authority key identifier is preferred.
+func (l *Lookup) Claimed(cert *x509.Certificate) *x509.Certificate {
+	var claimed *x509.Certificate
+	for _, issuer := range l.issuers {
+		if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		if bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+			return issuer
+		}
+		if claimed == nil {
+			claimed = issuer
+		}
+	}
+	return claimed
+}
+
+// Known reports whether Boulder's database has a precertificate or
+// certificate with the given serial number.
+func (l *Lookup) Known(ctx context.Context, serial *big.Int) (bool, error) {
+	for _, table := range []string{"precertificates", "certificates"} {
+		var found int
+		err := l.db.QueryRowContext(ctx, fmt.Sprintf("SELECT 1 FROM %s WHERE serial = ? LIMIT 1", table), Serial(serial)).Scan(&found)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("querying %s: %w", table, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Filter returns a filter matching certificates claiming one of the issuers
+// that Boulder has no record of. If the database can't be queried, the error
+// is reported on stderr and the certificate matches, so that none go
+// unreported.
+func (l *Lookup) Filter() func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		if l.Claimed(cert) == nil {
+			return false
+		}
+
+		known, err := l.Known(context.Background(), cert.SerialNumber)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "looking up serial %s: %s\n", Serial(cert.SerialNumber), err.Error())
+			return true
+		}
+		return !known
+	}
+}
+
+// Enrich annotates a match claiming one of the issuers with "boulder.known",
+// whether Boulder has a record of it, and "boulder.signed", whether its
+// signature is valid for the issuer it claims.
+func (l *Lookup) Enrich(ctx context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	issuer := l.Claimed(cert)
+	if issuer == nil {
+		return nil
+	}
+
+	metadata.Annotate("boulder.signed", strconv.FormatBool(cert.CheckSignatureFrom(issuer) == nil))
+
+	known, err := l.Known(ctx, cert.SerialNumber)
+	if err != nil {
+		return err
+	}
+	metadata.Annotate("boulder.known", strconv.FormatBool(known))
+	return nil
+}
@@ -0,0 +1,100 @@
+package boulder
+
+import (
+	"sync"
+	"time"
+)
+
+// Query describes a single query a DataSource ran.
+type Query struct {
+	// Table is the table queried, or for a Partition, the table and the
+	// partition, separated by a slash, such as "certificates/p2025", or the
+	// shard.
+	Table string
+
+	// Database is the index of the database queried: 0 for DB, or i+1 for
+	// Replicas[i].
+	Database int
+
+	// Attempt is the 1-based attempt number of the query, which is greater
+	// than 1 when it's retried on another database, or with a smaller batch
+	// after timing out.
+	Attempt int
+
+	// BatchSize is the number of rows the query asked for, or 0 if it read
+	// a whole IssuedChunk.
+	BatchSize int
+
+	// Rows is the number of rows the query returned, and Bytes their bytes of
+	// certificates.
+	Rows  int
+	Bytes int
+
+	// Duration is the time taken by the query, not counting the time spent
+	// waiting for the search to take its rows.
+	Duration time.Duration
+
+	// Timeout is true if the query failed because it exceeded QueryTimeout.
+	Timeout bool
+
+	// Err is the error the query failed with, if it failed.
+	Err error
+}
+
+// QueryCounts totals the queries a DataSource ran, showing the load a search
+// puts on the database.
+type QueryCounts struct {
+	// Queries counts the queries run, and Rows and Bytes total the rows they
+	// returned and their bytes of certificates.
+	Queries int64
+	Rows    int64
+	Bytes   int64
+
+	// Duration totals the time taken by the queries.
+	Duration time.Duration
+
+	// Timeouts counts the queries that exceeded QueryTimeout, and Errors the
+	// others that failed.
+	Timeouts int64
+	Errors   int64
+
+	// Retries counts the queries that were retries of failed ones.
+	Retries int64
+}
+
+// QueryStats accumulates the QueryCounts of the queries it observes. Its
+// Observe method can be a DataSource's Observer. It is safe for concurrent use.
+type QueryStats struct {
+	mu     sync.Mutex
+	counts QueryCounts
+}
+
+// Observe records a query.
+func (s *QueryStats) Observe(query Query) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts.Queries++
+	s.counts.Rows += int64(query.Rows)
+	s.counts.Bytes += int64(query.Bytes)
+	s.counts.Duration += query.Duration
+
+	switch {
+	case query.Timeout:
+		s.counts.Timeouts++
+	case query.Err != nil:
+		s.counts.Errors++
+	}
+
+	if query.Attempt > 1 {
+		s.counts.Retries++
+	}
+}
+
+// Counts returns the totals of the queries observed so far.
+func (s *QueryStats) Counts() QueryCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counts
+}
@@ -0,0 +1,106 @@
+package boulder
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Partition is a part of the precertificates or certificates table holding
+// the rows issued over a range of time, as some deployments split their
+// tables by issued time to keep them manageable. A DataSource with
+// Partitions queries only those of a table overlapping its window, each
+// directly, rather than leaving the database to find the rows across all of
+// them.
+type Partition struct {
+	// Table is the table the partition is part of: "precertificates" or
+	// "certificates".
+	Table string
+
+	// Name is the name of the partition. If Sharded is set, it's a table of
+	// its own, with the same columns as Table, queried in place of it;
+	// otherwise it's a partition of Table, selected with a PARTITION clause,
+	// as MySQL and MariaDB support.
+	Name    string
+	Sharded bool
+
+	// Start and End bound the issued times of the partition's rows, from
+	// Start inclusive to End exclusive, as RANGE partitions are bounded. A
+	// zero Start or End leaves that side unbounded.
+	Start time.Time
+	End   time.Time
+}
+
+// scan is a table, or a partition of one, that a DataSource reads as a whole
+// or in chunks.
+type scan struct {
+	// table is "precertificates" or "certificates".
+	table string
+
+	// name identifies the scan in the Cursor: the table, the table and the
+	// partition, separated by a slash, or the shard.
+	name string
+
+	// from is the table, the table with a PARTITION clause, or the shard
+	// queried.
+	from string
+
+	// start and end bound the issued times of the rows read, inclusively:
+	// the window, or the part of it the partition holds.
+	start, end time.Time
+}
+
+// scans returns the tables, or partitions of them, the DataSource reads.
+func (d DataSource) scans() ([]scan, error) {
+	var scans []scan
+	for _, table := range d.tables() {
+		partitioned := false
+		for _, p := range d.Partitions {
+			if p.Table != table {
+				continue
+			}
+			partitioned = true
+
+			start, end := d.StartTimeInclusive, d.EndTimeInclusive
+			if p.Start.After(start) {
+				start = p.Start
+			}
+			if !p.End.IsZero() && !p.End.After(end) {
+				end = p.End.Add(-time.Nanosecond)
+			}
+			if start.After(end) {
+				continue
+			}
+
+			if p.Sharded {
+				if table == "certificates" && d.CollapseBySerial && d.IncludePrecertificates {
+					return nil, errors.New("collapsing by serial can't be combined with sharded certificates tables")
+				}
+				scans = append(scans, scan{table: table, name: p.Name, from: p.Name, start: start, end: end})
+				continue
+			}
+			scans = append(scans, scan{
+				table: table,
+				name:  table + "/" + p.Name,
+				from:  fmt.Sprintf("%s PARTITION (%s)", table, p.Name),
+				start: start,
+				end:   end,
+			})
+		}
+
+		if !partitioned {
+			scans = append(scans, scan{table: table, name: table, from: table, start: d.StartTimeInclusive, end: d.EndTimeInclusive})
+		}
+	}
+
+	for _, p := range d.Partitions {
+		if p.Table != "precertificates" && p.Table != "certificates" {
+			return nil, fmt.Errorf("partition %q of unknown table %q", p.Name, p.Table)
+		}
+		if p.Name == "" {
+			return nil, fmt.Errorf("unnamed partition of %s", p.Table)
+		}
+	}
+
+	return scans, nil
+}
@@ -0,0 +1,86 @@
+package boulder
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// ReplicaRetryInterval is how long a DataSource avoids a database after a
+// query to it fails, before pinging it to see whether it has recovered.
+const ReplicaRetryInterval = 30 * time.Second
+
+// pingTimeout bounds the ping checking whether a database has recovered.
+const pingTimeout = 5 * time.Second
+
+// replicas spreads a DataSource's queries across its DB and Replicas, and
+// tracks which of them have failed. It is safe for concurrent use.
+type replicas struct {
+	dbs []*sql.DB
+
+	mu sync.Mutex
+
+	// failed holds the time each database last failed, or the zero time if
+	// it's healthy.
+	failed []time.Time
+}
+
+func newReplicas(dbs []*sql.DB) *replicas {
+	return &replicas{
+		dbs:    dbs,
+		failed: make([]time.Time, len(dbs)),
+	}
+}
+
+// pick returns the index of the database to query, which is the preferred
+// one, counting around the databases, unless it has failed, in which case
+// it's the next healthy one after it. If none are healthy, the preferred one
+// is returned anyway.
+func (r *replicas) pick(ctx context.Context, preferred int) int {
+	for i := range r.dbs {
+		index := (preferred + i) % len(r.dbs)
+		if r.healthy(ctx, index) {
+			return index
+		}
+	}
+	return preferred % len(r.dbs)
+}
+
+// healthy reports whether the database with the given index can be queried:
+// that it hasn't failed, or that it failed at least ReplicaRetryInterval ago
+// and answers a ping.
+func (r *replicas) healthy(ctx context.Context, index int) bool {
+	r.mu.Lock()
+	failed := r.failed[index]
+	r.mu.Unlock()
+
+	if failed.IsZero() {
+		return true
+	}
+	if time.Since(failed) < ReplicaRetryInterval {
+		return false
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	err := r.dbs[index].PingContext(pingCtx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.failed[index] = time.Now()
+		return false
+	}
+	r.failed[index] = time.Time{}
+	return true
+}
+
+// fail records that a query to the database with the given index failed.
+func (r *replicas) fail(index int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failed[index] = time.Now()
+}
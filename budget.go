@@ -0,0 +1,106 @@
+package x509search
+
+import (
+	"errors"
+	"time"
+)
+
+// Budget bounds the wall-clock time a search may take, for searches run by
+// job systems with hard time limits. When a budget runs out, the search stops
+// and Execute returns without error, having delivered the matches found so
+// far; ExecuteSummary reports which budget ran out. Every budget is optional,
+// and a budget that isn't positive is unlimited.
+//
+// Data sources may have budgets of their own for their stages, such as
+// staticctapi.DataSource.BoundsTimeout.
+type Budget struct {
+	// Total bounds the whole search. Once it runs out, the search stops at
+	// once, without processing the certificates the data sources have
+	// already sent.
+	Total time.Duration
+
+	// Sources bounds the time the data sources run for. Once it runs out,
+	// the data sources are stopped, and the certificates they have already
+	// sent are processed, subject to Drain.
+	Sources time.Duration
+
+	// Drain bounds the time spent processing the certificates already sent
+	// once the Sources budget has run out.
+	Drain time.Duration
+}
+
+// Status describes how a search ended.
+type Status int
+
+const (
+	// StatusComplete means every data source was exhausted.
+	StatusComplete Status = iota
+
+	// StatusDeadlineExceeded means a budget ran out, so the search's results
+	// are partial.
+	StatusDeadlineExceeded
+
+	// StatusCancelled means the context passed to Execute was done.
+	StatusCancelled
+
+	// StatusFailed means the search failed with an error.
+	StatusFailed
+
+	// StatusInterrupted means the search was stopped via Search.Stop, so its
+	// results are partial.
+	StatusInterrupted
+)
+
+// String returns a lowercase name for the status.
+func (s Status) String() string {
+	switch s {
+	case StatusComplete:
+		return "complete"
+	case StatusDeadlineExceeded:
+		return "deadline exceeded"
+	case StatusCancelled:
+		return "cancelled"
+	case StatusFailed:
+		return "failed"
+	case StatusInterrupted:
+		return "interrupted"
+	default:
+		return "unknown"
+	}
+}
+
+// Stage names the budget that ran out when a search's status is
+// StatusDeadlineExceeded.
+type Stage string
+
+const (
+	StageTotal   Stage = "total"
+	StageSources Stage = "sources"
+	StageDrain   Stage = "drain"
+)
+
+// Summary describes a finished search.
+type Summary struct {
+	Status Status
+
+	// Stage is the budget that ran out, if Status is StatusDeadlineExceeded.
+	Stage Stage
+
+	// Certificates is the number of certificates received from the data
+	// sources, including those rejected by the filters.
+	Certificates int64
+
+	// Matches is the number of certificates that matched and were delivered.
+	Matches int64
+
+	// Duration is the time the search took.
+	Duration time.Duration
+}
+
+// These are the causes of the contexts cancelled when a budget runs out, or
+// the search is stopped.
+var (
+	errTotalBudget   = errors.New("total budget exceeded")
+	errSourcesBudget = errors.New("sources budget exceeded")
+	errStopped       = errors.New("search stopped")
+)
@@ -3,6 +3,12 @@ package x509search
 import (
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/bits-and-blooms/bloom/v3"
 )
@@ -13,6 +19,25 @@ type Cacher interface {
 	Cache(*x509.Certificate) bool
 }
 
+// RawCacher is implemented by cachers that can de-duplicate certificates
+// using their DER bytes alone, without the certificates being parsed.
+type RawCacher interface {
+	// CacheRaw adds the certificate with the given DER encoding to the cache
+	// and returns whether it was already present. It must agree with Cache
+	// for the same certificate.
+	CacheRaw([]byte) bool
+}
+
+// SourceCacher is implemented by cachers that record where the certificates
+// they cache were found. Search calls CacheFrom in place of Cache and CacheRaw
+// for cachers that implement it.
+type SourceCacher interface {
+	// CacheFrom adds the certificate with the given DER encoding, found with
+	// the given metadata, to the cache and returns whether it was already
+	// present. It must agree with Cache for the same certificate.
+	CacheFrom([]byte, Metadata) bool
+}
+
 // NopCacher does not cache certificates.
 type NopCacher struct{}
 
@@ -21,45 +46,158 @@ func (c NopCacher) Cache(_ *x509.Certificate) bool {
 	return false
 }
 
+// CacheRaw always returns false.
+func (c NopCacher) CacheRaw(_ []byte) bool {
+	return false
+}
+
 // BloomCacher uses a bloom filter to cache certificate matches. Because bloom
 // filters are probabilistic data structures, they may occasionally report
 // false-positives, resulting in certificate matches being ignored by the search
 // algorithm. If full-and-complete results are required with absolute certainty,
 // do not use BloomCacher.
 type BloomCacher struct {
-	filter *bloom.BloomFilter
+	filter      *bloom.BloomFilter
+	fingerprint Fingerprinter
 }
 
 // NewBloomCacher returns a BloomCacher that uses countEstimate and
 // falsePositiveRate to determine the size of the underlying bloom filter.
-func NewBloomCacher(countEstimate uint, falsePositiveRate float64) *BloomCacher {
+func NewBloomCacher(countEstimate uint, falsePositiveRate float64, opts ...CacherOption) *BloomCacher {
 	return &BloomCacher{
-		filter: bloom.NewWithEstimates(countEstimate, falsePositiveRate),
+		filter:      bloom.NewWithEstimates(countEstimate, falsePositiveRate),
+		fingerprint: applyCacherOptions(opts).fingerprint,
 	}
 }
 
 // Cache uses a bloom filter to determine membership in the cache.
 func (c *BloomCacher) Cache(cert *x509.Certificate) bool {
-	return c.filter.TestOrAdd(cert.Raw)
+	return c.CacheRaw(cert.Raw)
+}
+
+// CacheRaw uses a bloom filter to determine membership in the cache.
+func (c *BloomCacher) CacheRaw(der []byte) bool {
+	fingerprint := c.fingerprint(der)
+	return c.filter.TestOrAdd(fingerprint[:])
+}
+
+// DefaultScalableBloomCapacity is the capacity of the first layer of a
+// ScalableBloomCacher if none is specified.
+const DefaultScalableBloomCapacity = 1 << 16
+
+// These are the parameters of a ScalableBloomCacher's layers: each holds
+// scalableBloomGrowth times as many certificates as the last, at
+// scalableBloomTightening times its false-positive rate.
+const (
+	scalableBloomGrowth     = 2
+	scalableBloomTightening = 0.8
+)
+
+// ScalableBloomCacher is a BloomCacher that needn't know how many
+// certificates it will cache. It starts with a small bloom filter, and each
+// time the newest fills, adds another twice as large with a tighter
+// false-positive rate, so that the rate across all of them stays within the
+// target however many certificates are cached. The false positives are those
+// of a BloomCacher, so the same caveat applies: if full-and-complete results
+// are required with absolute certainty, do not use ScalableBloomCacher.
+//
+// Each lookup tests every layer, so starting with a capacity near the real
+// count keeps lookups fast. Memory use is within a factor of two or so of a
+// BloomCacher sized for the final count.
+type ScalableBloomCacher struct {
+	falsePositiveRate float64
+	fingerprint       Fingerprinter
+
+	// layers holds the bloom filters, oldest first, and capacity and count
+	// are the capacity of the newest and the number of certificates added to
+	// it
+	layers   []*bloom.BloomFilter
+	capacity uint
+	count    uint
+}
+
+// NewScalableBloomCacher returns a ScalableBloomCacher whose first layer holds
+// initialCapacity certificates, keeping its false-positive rate within
+// falsePositiveRate. If initialCapacity is zero, DefaultScalableBloomCapacity
+// is used.
+func NewScalableBloomCacher(initialCapacity uint, falsePositiveRate float64, opts ...CacherOption) *ScalableBloomCacher {
+	if initialCapacity == 0 {
+		initialCapacity = DefaultScalableBloomCapacity
+	}
+
+	c := &ScalableBloomCacher{
+		falsePositiveRate: falsePositiveRate,
+		fingerprint:       applyCacherOptions(opts).fingerprint,
+	}
+	c.addLayer(initialCapacity)
+	return c
+}
+
+// Cache uses a series of bloom filters to determine membership in the cache.
+func (c *ScalableBloomCacher) Cache(cert *x509.Certificate) bool {
+	return c.CacheRaw(cert.Raw)
+}
+
+// CacheRaw uses a series of bloom filters to determine membership in the
+// cache.
+func (c *ScalableBloomCacher) CacheRaw(der []byte) bool {
+	fingerprint := c.fingerprint(der)
+	for _, layer := range c.layers {
+		if layer.Test(fingerprint[:]) {
+			return true
+		}
+	}
+
+	if c.count >= c.capacity {
+		c.addLayer(c.capacity * scalableBloomGrowth)
+	}
+
+	c.layers[len(c.layers)-1].Add(fingerprint[:])
+	c.count++
+	return false
 }
 
-// Sha256MapCacher uses a map of SHA-256 certificate fingerprints to cache
-// certificates.
+// Layers returns the number of bloom filters in use.
+func (c *ScalableBloomCacher) Layers() int {
+	return len(c.layers)
+}
+
+// addLayer adds a bloom filter with the given capacity. The false-positive
+// rates of the layers form a geometric series summing to the target rate.
+func (c *ScalableBloomCacher) addLayer(capacity uint) {
+	rate := c.falsePositiveRate * (1 - scalableBloomTightening) *
+		math.Pow(scalableBloomTightening, float64(len(c.layers)))
+
+	c.layers = append(c.layers, bloom.NewWithEstimates(capacity, rate))
+	c.capacity = capacity
+	c.count = 0
+}
+
+// Sha256MapCacher uses a map of SHA-256 certificate fingerprints, or those
+// chosen with WithFingerprint, to cache certificates.
 type Sha256MapCacher struct {
-	certs map[[32]byte]bool
+	certs       map[[32]byte]bool
+	fingerprint Fingerprinter
 }
 
-func NewSha256MapCacher() *Sha256MapCacher {
+func NewSha256MapCacher(opts ...CacherOption) *Sha256MapCacher {
 	return &Sha256MapCacher{
-		certs: make(map[[32]byte]bool),
+		certs:       make(map[[32]byte]bool),
+		fingerprint: applyCacherOptions(opts).fingerprint,
 	}
 }
 
-// Cache calculates the SHA-256 fingerprint of the given certificate and uses it
-// to determine membership in the cache.
+// Cache calculates the fingerprint of the given certificate and uses it to
+// determine membership in the cache.
 func (c *Sha256MapCacher) Cache(cert *x509.Certificate) bool {
-	// Use the certificate's Sha256 fingerprint as the map key
-	hash := sha256.Sum256(cert.Raw)
+	return c.CacheRaw(cert.Raw)
+}
+
+// CacheRaw calculates the fingerprint of the given DER bytes and uses it to
+// determine membership in the cache.
+func (c *Sha256MapCacher) CacheRaw(der []byte) bool {
+	// Use the certificate's fingerprint as the map key
+	hash := c.fingerprint(der)
 
 	// When a map key isn't present, Go returns the zero value, so false
 	present := c.certs[hash]
@@ -68,3 +206,208 @@ func (c *Sha256MapCacher) Cache(cert *x509.Certificate) bool {
 	c.certs[hash] = true
 	return present
 }
+
+// DefaultCacherShards is the number of shards a ShardedCacher uses if none is
+// specified.
+const DefaultCacherShards = 64
+
+// ShardedCacher caches SHA-256 certificate fingerprints like Sha256MapCacher,
+// but is safe for concurrent use. Fingerprints are partitioned across a number
+// of independently-locked maps so that goroutines caching different
+// certificates rarely contend for the same lock. It's the recommended cacher
+// wherever certificates are cached from more than one goroutine, such as in a
+// staticctapi.Deduplicator shared by several data sources.
+type ShardedCacher struct {
+	shards      []cacherShard
+	fingerprint Fingerprinter
+}
+
+type cacherShard struct {
+	mu    sync.Mutex
+	certs map[[32]byte]bool
+}
+
+// NewShardedCacher returns a ShardedCacher with the given number of shards. If
+// shards is less than 1, DefaultCacherShards is used.
+func NewShardedCacher(shards int, opts ...CacherOption) *ShardedCacher {
+	if shards < 1 {
+		shards = DefaultCacherShards
+	}
+
+	c := &ShardedCacher{
+		shards:      make([]cacherShard, shards),
+		fingerprint: applyCacherOptions(opts).fingerprint,
+	}
+	for i := range c.shards {
+		c.shards[i].certs = make(map[[32]byte]bool)
+	}
+	return c
+}
+
+// Cache calculates the fingerprint of the given certificate and uses it to
+// determine membership in the cache.
+func (c *ShardedCacher) Cache(cert *x509.Certificate) bool {
+	return c.CacheRaw(cert.Raw)
+}
+
+// CacheRaw calculates the fingerprint of the given DER bytes and uses it to
+// determine membership in the cache.
+func (c *ShardedCacher) CacheRaw(der []byte) bool {
+	hash := c.fingerprint(der)
+
+	// The fingerprint's leading bytes are uniformly distributed
+	shard := &c.shards[binary.BigEndian.Uint64(hash[:8])%uint64(len(c.shards))]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	present := shard.certs[hash]
+	shard.certs[hash] = true
+	return present
+}
+
+// WriteTo writes the fingerprints in the cache to w, so that the cache can be
+// restored with ReadFrom, such as when resuming an interrupted search. It may
+// be called while the cache is in use, in which case fingerprints cached
+// concurrently may or may not be written.
+func (c *ShardedCacher) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for i := range c.shards {
+		shard := &c.shards[i]
+
+		shard.mu.Lock()
+		hashes := make([]byte, 0, len(shard.certs)*sha256.Size)
+		for hash := range shard.certs {
+			hashes = append(hashes, hash[:]...)
+		}
+		shard.mu.Unlock()
+
+		n, err := w.Write(hashes)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom adds the fingerprints written by WriteTo to the cache.
+func (c *ShardedCacher) ReadFrom(r io.Reader) (int64, error) {
+	var read int64
+	for {
+		var hash [32]byte
+		n, err := io.ReadFull(r, hash[:])
+		read += int64(n)
+		if errors.Is(err, io.EOF) {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+
+		shard := &c.shards[binary.BigEndian.Uint64(hash[:8])%uint64(len(c.shards))]
+		shard.mu.Lock()
+		shard.certs[hash] = true
+		shard.mu.Unlock()
+	}
+}
+
+// WindowCacher suppresses duplicate certificates only within a sliding window,
+// bounded by age, by count, or both, rather than forever. Once a certificate
+// has left the window, it's reported again the next time it's seen. This
+// suits monitors that run for months, where remembering every certificate
+// would grow without bound, and where an occasional repeated alert is
+// acceptable.
+type WindowCacher struct {
+	maxAge      time.Duration
+	maxEntries  int
+	fingerprint Fingerprinter
+
+	// order holds the cached fingerprints oldest first, alongside the times
+	// they were cached, and certs maps each one to its time
+	order []windowEntry
+	certs map[[32]byte]time.Time
+
+	// now returns the current time, and is replaceable for testing
+	now func() time.Time
+}
+
+type windowEntry struct {
+	hash   [32]byte
+	cached time.Time
+}
+
+// NewWindowCacher returns a WindowCacher that forgets certificates once they
+// were first cached more than maxAge ago, or once more than maxEntries newer
+// certificates have been cached. A zero maxAge or maxEntries leaves the window
+// unbounded in that dimension.
+func NewWindowCacher(maxAge time.Duration, maxEntries int, opts ...CacherOption) *WindowCacher {
+	return &WindowCacher{
+		maxAge:      maxAge,
+		maxEntries:  maxEntries,
+		fingerprint: applyCacherOptions(opts).fingerprint,
+		certs:       make(map[[32]byte]time.Time),
+		now:         time.Now,
+	}
+}
+
+// Cache calculates the fingerprint of the given certificate and uses it to
+// determine membership in the window.
+func (c *WindowCacher) Cache(cert *x509.Certificate) bool {
+	return c.CacheRaw(cert.Raw)
+}
+
+// CacheRaw calculates the fingerprint of the given DER bytes and uses it to
+// determine membership in the window.
+func (c *WindowCacher) CacheRaw(der []byte) bool {
+	hash := c.fingerprint(der)
+	now := c.now()
+
+	c.expire(now)
+
+	_, present := c.certs[hash]
+	if present {
+		return true
+	}
+
+	c.certs[hash] = now
+	c.order = append(c.order, windowEntry{hash: hash, cached: now})
+
+	if c.maxEntries > 0 && len(c.order) > c.maxEntries {
+		c.evict(1)
+	}
+
+	return false
+}
+
+// expire forgets the certificates that have aged out of the window.
+func (c *WindowCacher) expire(now time.Time) {
+	if c.maxAge <= 0 {
+		return
+	}
+
+	expired := 0
+	for expired < len(c.order) && now.Sub(c.order[expired].cached) > c.maxAge {
+		expired++
+	}
+	c.evict(expired)
+}
+
+// evict forgets the n oldest certificates.
+func (c *WindowCacher) evict(n int) {
+	if n == 0 {
+		return
+	}
+
+	for _, entry := range c.order[:n] {
+		delete(c.certs, entry.hash)
+	}
+
+	// Clear the evicted entries so the backing array doesn't pin them, and
+	// reallocate once it's mostly unused
+	clear(c.order[:n])
+	c.order = c.order[n:]
+	if cap(c.order) > 2*len(c.order)+64 {
+		c.order = append([]windowEntry(nil), c.order...)
+	}
+}
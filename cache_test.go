@@ -0,0 +1,69 @@
+package x509search
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// lockedCacher guards a Sha256MapCacher with a single mutex, the simplest way
+// to share it between goroutines.
+type lockedCacher struct {
+	mu     sync.Mutex
+	cacher *Sha256MapCacher
+}
+
+func (c *lockedCacher) CacheRaw(der []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cacher.CacheRaw(der)
+}
+
+func TestShardedCacher(t *testing.T) {
+	cacher := NewShardedCacher(0)
+
+	var wg sync.WaitGroup
+	var duplicates atomic.Int64
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			der := make([]byte, 8)
+			for i := range 1000 {
+				binary.BigEndian.PutUint64(der, uint64(i))
+				if cacher.CacheRaw(der) {
+					duplicates.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each certificate is new to exactly one of the goroutines
+	if got := duplicates.Load(); got != 7*1000 {
+		t.Errorf("got %d duplicates, want %d", got, 7*1000)
+	}
+}
+
+// benchmarkParallelCacher caches distinct certificates from parallel
+// goroutines, about one in four of them a duplicate.
+func benchmarkParallelCacher(b *testing.B, cacher RawCacher) {
+	var next atomic.Uint64
+	b.RunParallel(func(pb *testing.PB) {
+		der := make([]byte, 512)
+		for pb.Next() {
+			binary.BigEndian.PutUint64(der, next.Add(1)%(uint64(b.N)*3/4+1))
+			cacher.CacheRaw(der)
+		}
+	})
+}
+
+func BenchmarkParallelCacher(b *testing.B) {
+	b.Run("Sha256MapCacher", func(b *testing.B) {
+		benchmarkParallelCacher(b, &lockedCacher{cacher: NewSha256MapCacher()})
+	})
+	b.Run("ShardedCacher", func(b *testing.B) {
+		benchmarkParallelCacher(b, NewShardedCacher(0))
+	})
+}
@@ -0,0 +1,436 @@
+package cacher
+
+import (
+	"bufio"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/letsencrypt/x509search"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Defaults for the fields of DiskOptions.
+const (
+	DefaultDiskBatchSize         = 10_000
+	DefaultDiskExpectedCount     = 100_000_000
+	DefaultDiskFalsePositiveRate = 0.01
+)
+
+// The names of the files in a Disk cacher's directory.
+const (
+	diskFile    = "fingerprints.db"
+	compactFile = "fingerprints.db.compact"
+	bloomFile   = "bloom"
+)
+
+// compactTxSize is the number of bytes Compact copies per transaction.
+const compactTxSize = 64 << 20
+
+// fingerprintsBucket is the bucket holding the fingerprints, as keys with
+// empty values.
+var fingerprintsBucket = []byte("fingerprints")
+
+// errNoDatabase is returned once a Compact that couldn't reopen the database
+// has left the cacher without one.
+var errNoDatabase = errors.New("cache database closed by a failed compaction")
+
+// DiskOptions configures a Disk cacher. Zero fields take their defaults.
+type DiskOptions struct {
+	// BatchSize is the number of new fingerprints held in memory before
+	// they're written to disk in one transaction.
+	BatchSize int
+
+	// ExpectedCount is the number of fingerprints the cache is expected to
+	// hold, used to size the bloom filter.
+	ExpectedCount uint
+
+	// FalsePositiveRate is the target false-positive rate of the bloom
+	// filter, at ExpectedCount fingerprints. False positives only cost a
+	// lookup on disk.
+	FalsePositiveRate float64
+
+	// CompactInterval, if positive, is how often the database is compacted
+	// while the cacher is open. See Disk for what compaction costs.
+	CompactInterval time.Duration
+}
+
+// Disk de-duplicates matches by fingerprint, SHA-256 by default, in a bbolt
+// database in a directory on disk, for caches too large to hold in memory,
+// such as when de-duplicating a scan of whole logs. New fingerprints are held
+// in memory and written out in batches, each in one transaction. A bloom
+// filter over every fingerprint answers most lookups of new certificates
+// without reading the disk.
+//
+// The bloom filter takes about 1.2 bytes per expected fingerprint at a 1%
+// false-positive rate, in memory and on disk. Close saves it, so that opening
+// the cache loads it rather than rebuilding it from the database, which reads
+// every fingerprint; it's only rebuilt after a crash, or if ExpectedCount or
+// FalsePositiveRate change. A crash also loses the batch held in memory, whose
+// certificates are then reported again.
+//
+// As fingerprints arrive in random order, and each batch copies the pages it
+// touches, the database's pages are left partly full and many are left free,
+// so each fingerprint takes around 175 bytes on disk. Compact rewrites the
+// database with full pages, to around 55 bytes per fingerprint. It needs
+// the free space for a second copy of the database while it runs, reads and
+// writes every fingerprint, and pauses caching until it's done, so it's best
+// run between searches rather than during one. A cacher that stays open across
+// many searches, such as a daemon's, can instead compact itself every
+// CompactInterval.
+//
+// A Disk cacher is safe for concurrent use, but only one may use a directory
+// at a time, and it must be closed to write out its last batch.
+type Disk struct {
+	mu   sync.Mutex
+	dir  string
+	db   *bolt.DB
+	opts DiskOptions
+
+	fingerprint x509search.Fingerprinter
+
+	batch  map[[32]byte]struct{}
+	filter *bloom.BloomFilter
+
+	// stop is closed by Close to stop compacting every CompactInterval, and
+	// compactor is done once it has.
+	stop      chan struct{}
+	compactor sync.WaitGroup
+}
+
+// OpenDisk opens the Disk cacher in dir, creating the directory if needed. The
+// directory must always be opened with the same fingerprint.
+func OpenDisk(dir string, opts DiskOptions, cacherOpts ...x509search.CacherOption) (*Disk, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultDiskBatchSize
+	}
+	if opts.ExpectedCount == 0 {
+		opts.ExpectedCount = DefaultDiskExpectedCount
+	}
+	if opts.FalsePositiveRate <= 0 || opts.FalsePositiveRate >= 1 {
+		opts.FalsePositiveRate = DefaultDiskFalsePositiveRate
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	db, err := openDatabase(filepath.Join(dir, diskFile))
+	if err != nil {
+		return nil, fmt.Errorf("opening cache database: %w", err)
+	}
+
+	// A compaction that was interrupted leaves its partial copy behind
+	err = os.Remove(filepath.Join(dir, compactFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		db.Close()
+		return nil, fmt.Errorf("removing partial compaction: %w", err)
+	}
+
+	d := &Disk{
+		dir:         dir,
+		db:          db,
+		opts:        opts,
+		fingerprint: x509search.ApplyCacherOptions(cacherOpts...),
+		batch:       make(map[[32]byte]struct{}),
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(fingerprintsBucket)
+		return err
+	})
+	if err == nil {
+		err = d.loadFilter()
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("loading cache database: %w", err)
+	}
+
+	if opts.CompactInterval > 0 {
+		d.stop = make(chan struct{})
+		d.compactor.Add(1)
+		go d.compactEvery(opts.CompactInterval)
+	}
+
+	return d, nil
+}
+
+// openDatabase opens the bbolt database at path. Another process holding the
+// database would otherwise block bolt.Open forever.
+func openDatabase(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+}
+
+// Cache adds the certificate's fingerprint to the cache, and returns whether
+// it was already present.
+func (d *Disk) Cache(cert *x509.Certificate) bool {
+	return d.CacheRaw(cert.Raw)
+}
+
+// CacheRaw adds the fingerprint of the given DER bytes to the cache, and
+// returns whether it was already present. Failures to read or write the
+// database are reported on stderr, and the fingerprint is kept in memory.
+func (d *Disk) CacheRaw(der []byte) bool {
+	hash := d.fingerprint(der)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	present, err := d.contains(hash)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reading disk cache: %s\n", err.Error())
+	}
+	if present {
+		return true
+	}
+
+	d.batch[hash] = struct{}{}
+	d.filter.Add(hash[:])
+
+	if len(d.batch) >= d.opts.BatchSize {
+		err = d.flush()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "writing disk cache: %s\n", err.Error())
+		}
+	}
+
+	return false
+}
+
+// Compact writes out the fingerprints held in memory, and rewrites the
+// database into a new file with full pages, which replaces the old one. See
+// Disk for its costs.
+//
+// If the database can't be reopened afterwards, the cacher is left without
+// one: fingerprints are then only kept in memory, and every later Compact and
+// Close returns an error.
+func (d *Disk) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.db == nil {
+		return errNoDatabase
+	}
+
+	err := d.flush()
+	if err != nil {
+		return fmt.Errorf("writing disk cache: %w", err)
+	}
+
+	path := filepath.Join(d.dir, diskFile)
+	compactPath := filepath.Join(d.dir, compactFile)
+
+	compacted, err := bolt.Open(compactPath, 0o644, nil)
+	if err != nil {
+		return fmt.Errorf("creating compacted cache database: %w", err)
+	}
+	err = bolt.Compact(compacted, d.db, compactTxSize)
+	closeErr := compacted.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(compactPath)
+		return fmt.Errorf("compacting cache database: %w", err)
+	}
+
+	err = d.db.Close()
+	if err != nil {
+		os.Remove(compactPath)
+		return fmt.Errorf("closing cache database: %w", err)
+	}
+
+	// If the compacted copy can't replace the database, the database is
+	// reopened as it was
+	renameErr := os.Rename(compactPath, path)
+	if renameErr != nil {
+		os.Remove(compactPath)
+	}
+
+	db, err := openDatabase(path)
+	if err != nil {
+		d.db = nil
+		return fmt.Errorf("reopening cache database: %w", err)
+	}
+	d.db = db
+	if renameErr != nil {
+		return fmt.Errorf("replacing cache database: %w", renameErr)
+	}
+	return nil
+}
+
+// Close stops compacting the database every CompactInterval, writes out the
+// fingerprints held in memory, saves the bloom filter, and closes the
+// database.
+func (d *Disk) Close() error {
+	if d.stop != nil {
+		close(d.stop)
+		d.compactor.Wait()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.db == nil {
+		return errNoDatabase
+	}
+
+	err := d.flush()
+	if err == nil {
+		err = d.saveFilter()
+	}
+	closeErr := d.db.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// compactEvery compacts the database every interval until Close is called.
+// Failures are reported on stderr.
+func (d *Disk) compactEvery(interval time.Duration) {
+	defer d.compactor.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			// A failed compaction that left the cacher without a database
+			// has already been reported
+			err := d.Compact()
+			if errors.Is(err, errNoDatabase) {
+				return
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "compacting disk cache: %s\n", err.Error())
+			}
+		}
+	}
+}
+
+// contains reports whether hash is in the cache.
+func (d *Disk) contains(hash [32]byte) (bool, error) {
+	_, ok := d.batch[hash]
+	if ok {
+		return true, nil
+	}
+
+	if !d.filter.Test(hash[:]) {
+		return false, nil
+	}
+
+	if d.db == nil {
+		return false, errNoDatabase
+	}
+
+	found := false
+	err := d.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(fingerprintsBucket).Get(hash[:]) != nil
+		return nil
+	})
+	return found, err
+}
+
+// flush writes the batch to the database. The batch is kept if the write
+// fails, to be retried by the next flush.
+func (d *Disk) flush() error {
+	if len(d.batch) == 0 {
+		return nil
+	}
+
+	if d.db == nil {
+		return errNoDatabase
+	}
+
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(fingerprintsBucket)
+		for hash := range d.batch {
+			err := bucket.Put(hash[:], []byte{})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	clear(d.batch)
+	return nil
+}
+
+// loadFilter reads the bloom filter saved by Close, and removes it, so that a
+// crash before the next Close, which would leave it missing the fingerprints
+// cached since, makes it be rebuilt. It's also rebuilt if it's missing, or
+// was sized for a different ExpectedCount or FalsePositiveRate, by reading
+// every fingerprint in the database.
+func (d *Disk) loadFilter() error {
+	path := filepath.Join(d.dir, bloomFile)
+	m, k := bloom.EstimateParameters(d.opts.ExpectedCount, d.opts.FalsePositiveRate)
+
+	file, err := os.Open(path)
+	if err == nil {
+		filter := &bloom.BloomFilter{}
+		_, err = filter.ReadFrom(bufio.NewReader(file))
+		file.Close()
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err == nil && filter.Cap() == m && filter.K() == k {
+			d.filter = filter
+			return nil
+		}
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "reading disk cache bloom filter, rebuilding it: %s\n", err.Error())
+	}
+
+	d.filter = bloom.New(m, k)
+	return d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(fingerprintsBucket).ForEach(func(k, _ []byte) error {
+			d.filter.Add(k)
+			return nil
+		})
+	})
+}
+
+// saveFilter writes the bloom filter to disk, so that it needn't be rebuilt
+// when the cache is next opened.
+func (d *Disk) saveFilter() error {
+	// The filter is written to a temporary file first, so that a partly
+	// written one is never loaded
+	path := filepath.Join(d.dir, bloomFile)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	_, err = d.filter.WriteTo(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+	}
+	return err
+}
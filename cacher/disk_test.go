@@ -0,0 +1,242 @@
+package cacher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// der returns distinct stand-ins for certificates' DER bytes.
+func der(i int) []byte {
+	return []byte(fmt.Sprintf("certificate %d", i))
+}
+
+func openDisk(t *testing.T, dir string, opts DiskOptions) *Disk {
+	t.Helper()
+
+	disk, err := OpenDisk(dir, opts)
+	if err != nil {
+		t.Fatalf("opening disk cacher: %s", err)
+	}
+	return disk
+}
+
+func TestDisk(t *testing.T) {
+	disk := openDisk(t, t.TempDir(), DiskOptions{BatchSize: 10})
+	defer disk.Close()
+
+	// Enough to flush a few batches, so that lookups hit both the database
+	// and the batch in memory
+	for i := range 35 {
+		if disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: reported as cached before it was added", i)
+		}
+	}
+	for i := range 35 {
+		if !disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: not cached", i)
+		}
+	}
+}
+
+func TestDiskReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	disk := openDisk(t, dir, DiskOptions{BatchSize: 10})
+	for i := range 25 {
+		disk.CacheRaw(der(i))
+	}
+	err := disk.Close()
+	if err != nil {
+		t.Fatalf("closing disk cacher: %s", err)
+	}
+
+	disk = openDisk(t, dir, DiskOptions{BatchSize: 10})
+	defer disk.Close()
+
+	// Both the flushed batches and the one written by Close are kept
+	for i := range 25 {
+		if !disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: forgotten after reopening", i)
+		}
+	}
+	if disk.CacheRaw(der(25)) {
+		t.Error("new certificate reported as cached after reopening")
+	}
+}
+
+func TestDiskReopenWithoutClose(t *testing.T) {
+	dir := t.TempDir()
+
+	disk := openDisk(t, dir, DiskOptions{BatchSize: 10})
+	for i := range 15 {
+		disk.CacheRaw(der(i))
+	}
+
+	// Simulate a crash: the database is closed without writing the batch
+	disk.db.Close()
+
+	disk = openDisk(t, dir, DiskOptions{BatchSize: 10})
+	defer disk.Close()
+
+	for i := range 10 {
+		if !disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: flushed batch forgotten after a crash", i)
+		}
+	}
+	for i := 10; i < 15; i++ {
+		if disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: unflushed batch survived a crash", i)
+		}
+	}
+}
+
+func TestDiskLocked(t *testing.T) {
+	dir := t.TempDir()
+
+	disk := openDisk(t, dir, DiskOptions{})
+	defer disk.Close()
+
+	_, err := OpenDisk(dir, DiskOptions{})
+	if err == nil {
+		t.Error("opened a directory already in use")
+	}
+}
+
+func TestDiskCompact(t *testing.T) {
+	disk := openDisk(t, t.TempDir(), DiskOptions{BatchSize: 10})
+	defer disk.Close()
+
+	for i := range 35 {
+		disk.CacheRaw(der(i))
+	}
+
+	err := disk.Compact()
+	if err != nil {
+		t.Fatalf("compacting disk cacher: %s", err)
+	}
+
+	// Both the flushed batches and the one Compact wrote out are kept
+	for i := range 35 {
+		if !disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: forgotten after compacting", i)
+		}
+	}
+	if disk.CacheRaw(der(35)) {
+		t.Error("new certificate reported as cached after compacting")
+	}
+}
+
+func TestDiskCompactInterval(t *testing.T) {
+	dir := t.TempDir()
+	disk := openDisk(t, dir, DiskOptions{BatchSize: 1000, CompactInterval: 10 * time.Millisecond})
+
+	for i := range 35 {
+		disk.CacheRaw(der(i))
+	}
+
+	// Compacting writes out the batch held in memory, so the fingerprints
+	// reach the database without a Close
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		disk.mu.Lock()
+		flushed := len(disk.batch) == 0
+		disk.mu.Unlock()
+		if flushed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("batch not written out by periodic compaction")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err := disk.Close()
+	if err != nil {
+		t.Fatalf("closing disk cacher: %s", err)
+	}
+}
+
+func TestDiskWithoutDatabase(t *testing.T) {
+	disk := openDisk(t, t.TempDir(), DiskOptions{BatchSize: 10})
+	for i := range 15 {
+		disk.CacheRaw(der(i))
+	}
+
+	// Simulate a Compact that couldn't reopen the database
+	disk.db.Close()
+	disk.db = nil
+
+	// Fingerprints are still kept in memory, without panicking
+	for i := 15; i < 25; i++ {
+		if disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: reported as cached before it was added", i)
+		}
+	}
+	if !disk.CacheRaw(der(24)) {
+		t.Error("certificate 24: not cached in memory")
+	}
+
+	err := disk.Compact()
+	if !errors.Is(err, errNoDatabase) {
+		t.Errorf("compacting without a database returned %v", err)
+	}
+	err = disk.Close()
+	if !errors.Is(err, errNoDatabase) {
+		t.Errorf("closing without a database returned %v", err)
+	}
+}
+
+func TestDiskFilterSaved(t *testing.T) {
+	dir := t.TempDir()
+	bloomPath := filepath.Join(dir, bloomFile)
+
+	disk := openDisk(t, dir, DiskOptions{BatchSize: 10, ExpectedCount: 1000})
+	for i := range 25 {
+		disk.CacheRaw(der(i))
+	}
+	err := disk.Close()
+	if err != nil {
+		t.Fatalf("closing disk cacher: %s", err)
+	}
+	_, err = os.Stat(bloomPath)
+	if err != nil {
+		t.Fatalf("bloom filter not saved: %s", err)
+	}
+
+	// The saved filter is removed once it's loaded, so that it's rebuilt if
+	// the cache isn't closed
+	disk = openDisk(t, dir, DiskOptions{BatchSize: 10, ExpectedCount: 1000})
+	_, err = os.Stat(bloomPath)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("loaded bloom filter left in place: %v", err)
+	}
+	for i := range 25 {
+		if !disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: forgotten with the saved filter", i)
+		}
+	}
+	err = disk.Close()
+	if err != nil {
+		t.Fatalf("closing disk cacher: %s", err)
+	}
+
+	// A filter saved for a different size is rebuilt
+	disk = openDisk(t, dir, DiskOptions{BatchSize: 10, ExpectedCount: 2000})
+	defer disk.Close()
+
+	m, k := bloom.EstimateParameters(2000, DefaultDiskFalsePositiveRate)
+	if disk.filter.Cap() != m || disk.filter.K() != k {
+		t.Error("bloom filter saved for a different size was loaded")
+	}
+	for i := range 25 {
+		if !disk.CacheRaw(der(i)) {
+			t.Errorf("certificate %d: forgotten with the rebuilt filter", i)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package cacher provides x509search.Cacher implementations backed by
+// external services and on-disk stores, for de-duplicating matches across
+// processes or beyond what fits in memory.
+package cacher
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// DefaultMemcachedTimeout bounds each request a Memcached cacher makes, if no
+// timeout is given.
+const DefaultMemcachedTimeout = time.Second
+
+// maxIdleMemcachedConns is the number of idle connections kept open to each
+// server.
+const maxIdleMemcachedConns = 8
+
+// maxRelativeTTL is the longest expiry memcached accepts as a number of
+// seconds; longer ones are taken to be Unix timestamps.
+const maxRelativeTTL = 30 * 24 * time.Hour
+
+// Memcached de-duplicates matches in memcached, so that a fleet of
+// short-lived search jobs can share what they've already found. Each match is
+// stored under its fingerprint, SHA-256 by default, with an atomic add, which
+// fails if another job already stored it, and expires after a TTL so that
+// memcached needn't hold every certificate ever found. Fingerprints are spread
+// across the servers by their value.
+//
+// memcached evicts items under memory pressure, so a duplicate is
+// occasionally reported again. If a server can't be reached, the failure is
+// reported on stderr and the match is treated as new, so that nothing is
+// lost. A Memcached cacher is safe for concurrent use.
+type Memcached struct {
+	servers []string
+	prefix  string
+	ttl     time.Duration
+	timeout time.Duration
+
+	fingerprint x509search.Fingerprinter
+
+	// idle holds the idle connections to each server
+	idle []chan *memcachedConn
+}
+
+type memcachedConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// NewMemcached returns a Memcached cacher using the memcached servers at the
+// given host:port addresses. Keys are prefixed with prefix, so that unrelated
+// searches sharing the servers don't de-duplicate against each other. A ttl
+// of zero keeps matches until they're evicted. If timeout is zero,
+// DefaultMemcachedTimeout is used. Jobs sharing the servers and prefix must use
+// the same fingerprint.
+func NewMemcached(servers []string, prefix string, ttl, timeout time.Duration, opts ...x509search.CacherOption) (*Memcached, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("no memcached servers")
+	}
+
+	if ttl < 0 {
+		return nil, errors.New("negative ttl")
+	}
+
+	// Keys are at most 250 bytes, of which the fingerprint takes 64
+	if len(prefix) > 186 || strings.ContainsAny(prefix, " \t\r\n") {
+		return nil, errors.New("prefix must be at most 186 bytes, without whitespace")
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultMemcachedTimeout
+	}
+
+	m := &Memcached{
+		servers:     servers,
+		prefix:      prefix,
+		ttl:         ttl,
+		timeout:     timeout,
+		fingerprint: x509search.ApplyCacherOptions(opts...),
+		idle:        make([]chan *memcachedConn, len(servers)),
+	}
+	for i := range m.idle {
+		m.idle[i] = make(chan *memcachedConn, maxIdleMemcachedConns)
+	}
+	return m, nil
+}
+
+// Cache stores the certificate's fingerprint, and returns whether it was
+// already stored.
+func (m *Memcached) Cache(cert *x509.Certificate) bool {
+	return m.CacheRaw(cert.Raw)
+}
+
+// CacheRaw stores the fingerprint of the given DER bytes, and returns whether
+// it was already stored.
+func (m *Memcached) CacheRaw(der []byte) bool {
+	hash := m.fingerprint(der)
+	server := int(binary.BigEndian.Uint64(hash[:8]) % uint64(len(m.servers)))
+
+	present, err := m.add(server, m.prefix+hex.EncodeToString(hash[:]))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "caching match in memcached at %s: %s\n", m.servers[server], err.Error())
+		return false
+	}
+	return present
+}
+
+// Close closes the idle connections to the servers.
+func (m *Memcached) Close() error {
+	for _, idle := range m.idle {
+		closeIdle(idle)
+	}
+	return nil
+}
+
+// closeIdle closes the connections in idle.
+func closeIdle(idle chan *memcachedConn) {
+	for {
+		select {
+		case c := <-idle:
+			c.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// add stores an empty item under key on the given server, reporting whether
+// the key was already present.
+func (m *Memcached) add(server int, key string) (bool, error) {
+	c, err := m.conn(server)
+	if err != nil {
+		return false, err
+	}
+
+	err = c.conn.SetDeadline(time.Now().Add(m.timeout))
+	if err != nil {
+		c.conn.Close()
+		return false, err
+	}
+
+	fmt.Fprintf(c.rw, "add %s 0 %d 0\r\n\r\n", key, m.expiry())
+	err = c.rw.Flush()
+	if err != nil {
+		c.conn.Close()
+		return false, err
+	}
+
+	line, err := c.rw.ReadString('\n')
+	if err != nil {
+		c.conn.Close()
+		return false, err
+	}
+
+	switch strings.TrimSuffix(line, "\r\n") {
+	case "STORED":
+		m.release(server, c)
+		return false, nil
+	case "NOT_STORED":
+		m.release(server, c)
+		return true, nil
+	default:
+		// The connection's state is unknown after an error
+		c.conn.Close()
+		return false, fmt.Errorf("unexpected response: %q", strings.TrimSpace(line))
+	}
+}
+
+// expiry returns the expiry time sent with each item.
+func (m *Memcached) expiry() int64 {
+	if m.ttl == 0 {
+		return 0
+	}
+
+	if m.ttl > maxRelativeTTL {
+		return time.Now().Add(m.ttl).Unix()
+	}
+
+	// Round up, as an expiry of zero means never
+	return int64((m.ttl + time.Second - 1) / time.Second)
+}
+
+// conn returns an idle connection to the given server, or a new one.
+func (m *Memcached) conn(server int) (*memcachedConn, error) {
+	select {
+	case c := <-m.idle[server]:
+		return c, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", m.servers[server], m.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memcachedConn{
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}, nil
+}
+
+// release returns a connection to the given server's idle connections, or
+// closes it if there are already enough.
+func (m *Memcached) release(server int, c *memcachedConn) {
+	select {
+	case m.idle[server] <- c:
+	default:
+		c.conn.Close()
+	}
+}
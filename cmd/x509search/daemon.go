@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/config"
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// runDaemon runs a search that follows its logs indefinitely, serving metrics
+// and health checks over HTTP, until it is interrupted.
+func runDaemon(args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML or JSON search configuration file, whose window must set follow")
+	listen := flags.String("listen", ":9100", "address serving /metrics and /healthz")
+	reloadInterval := flags.Duration("reload-interval", 30*time.Second, "how often the configuration's domainsFile is checked for changes")
+	healthInterval := flags.Duration("health-interval", time.Minute, "how often the logs' checkpoints are checked for /healthz")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *configFile == "" {
+		return errors.New("missing required flag: -config")
+	}
+
+	searchConfig, err := config.LoadFile(*configFile)
+	if err != nil {
+		return err
+	}
+
+	if len(searchConfig.Sinks) == 0 {
+		return errors.New("no sinks configured")
+	}
+
+	if !searchConfig.Window.Follow {
+		return errors.New("the daemon requires a configuration whose window sets follow")
+	}
+
+	search, err := searchConfig.Build(time.Now())
+	if err != nil {
+		return fmt.Errorf("building search: %w", err)
+	}
+
+	defer func() {
+		err := search.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "closing outputs: %s\n", err.Error())
+		}
+	}()
+
+	d := &daemon{
+		search:   search,
+		progress: &x509search.Progress{},
+		tiles:    &staticctapi.Progress{},
+		health:   make(map[*staticctapi.Log]staticctapi.Health),
+	}
+
+	search.Progress = d.progress
+	for i, source := range search.DataSources {
+		if dataSource, ok := source.(staticctapi.DataSource); ok {
+			dataSource.Progress = d.tiles
+			search.DataSources[i] = dataSource
+
+			if !containsLog(d.logs, dataSource.Log) {
+				d.logs = append(d.logs, dataSource.Log)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", d.serveMetrics)
+	mux.HandleFunc("/healthz", d.serveHealth)
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		d.reloadEvery(ctx, *reloadInterval)
+	}()
+	go func() {
+		defer wg.Done()
+		d.checkHealthEvery(ctx, *healthInterval)
+	}()
+
+	fmt.Fprintf(os.Stderr, "following %d logs, serving metrics on %s\n", len(d.logs), *listen)
+
+	searchErr := make(chan error, 1)
+	go func() {
+		searchErr <- search.Execute(ctx)
+	}()
+
+	select {
+	case err = <-searchErr:
+		// The search only finishes once interrupted, or if its sources fail
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			err = nil
+		}
+	case err = <-serverErr:
+		err = fmt.Errorf("serving metrics: %w", err)
+		stop()
+		<-searchErr
+	}
+
+	stop()
+	wg.Wait()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = errors.Join(err, server.Shutdown(shutdownCtx))
+
+	return err
+}
+
+// daemon holds the state reported by a running daemon.
+type daemon struct {
+	search   *config.Search
+	logs     []*staticctapi.Log
+	progress *x509search.Progress
+	tiles    *staticctapi.Progress
+
+	reloads      atomic.Int64
+	reloadErrors atomic.Int64
+
+	mu     sync.Mutex
+	health map[*staticctapi.Log]staticctapi.Health
+}
+
+// reloadEvery reloads the search's watchlist every interval until ctx is done.
+func (d *daemon) reloadEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := d.search.ReloadWatchlist()
+		if err != nil {
+			d.reloadErrors.Add(1)
+			fmt.Fprintf(os.Stderr, "reloading watchlist: %s\n", err.Error())
+			continue
+		}
+
+		if reloaded {
+			d.reloads.Add(1)
+			fmt.Fprintf(os.Stderr, "reloaded watchlist: %d domains\n", d.search.WatchlistSize())
+		}
+	}
+}
+
+// checkHealthEvery checks the health of each log every interval until ctx is
+// done, starting immediately.
+func (d *daemon) checkHealthEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, log := range d.logs {
+			health := log.CheckHealth(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			d.mu.Lock()
+			d.health[log] = health
+			d.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveHealth reports whether every log was reachable and fresh when last
+// checked, listing each log's state.
+func (d *daemon) serveHealth(w http.ResponseWriter, _ *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	healthy := true
+	var report []string
+	for _, log := range d.logs {
+		health, ok := d.health[log]
+		switch {
+		case !ok:
+			report = append(report, fmt.Sprintf("%s: not checked yet", log.MetricsEndpoint))
+		case health.Err != nil:
+			healthy = false
+			report = append(report, fmt.Sprintf("%s: %s", log.MetricsEndpoint, health.Err))
+		case health.Stale:
+			healthy = false
+			report = append(report, fmt.Sprintf("%s: stale checkpoint, %s old", log.MetricsEndpoint, health.CheckpointAge.Round(time.Second)))
+		default:
+			report = append(report, fmt.Sprintf("%s: ok, tree size %d", log.MetricsEndpoint, health.TreeSize))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	for _, line := range report {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// serveMetrics writes the daemon's metrics in the Prometheus text format.
+func (d *daemon) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	completed, _ := d.tiles.Tiles()
+	writeMetric(w, "x509search_certificates_total", "counter", "Certificates read from the logs.", d.progress.Certificates())
+	writeMetric(w, "x509search_matches_total", "counter", "Certificates matching the search's filters.", d.progress.Matches())
+	writeMetric(w, "x509search_tiles_total", "counter", "Data tiles searched.", completed)
+	writeMetric(w, "x509search_watchlist_domains", "gauge", "Domains in the watchlist.", int64(d.search.WatchlistSize()))
+	writeMetric(w, "x509search_watchlist_reloads_total", "counter", "Times the watchlist was reloaded after changing.", d.reloads.Load())
+	writeMetric(w, "x509search_watchlist_reload_errors_total", "counter", "Times the watchlist couldn't be reloaded.", d.reloadErrors.Load())
+
+	writeHeader(w, "x509search_source_matches_total", "counter", "Matches found by each source.")
+	matches := d.progress.MatchesBySource()
+	sources := make([]string, 0, len(matches))
+	for source := range matches {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		writeSample(w, "x509search_source_matches_total", fmt.Sprintf("source=%q", source), matches[source])
+	}
+
+	writeHeader(w, "x509search_log_requests_total", "counter", "Requests made to each log, by HTTP status or failure.")
+	for _, log := range d.logs {
+		counts := log.RequestCounts()
+
+		statuses := make([]int, 0, len(counts.ByStatus))
+		for status := range counts.ByStatus {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+
+		for _, status := range statuses {
+			writeSample(w, "x509search_log_requests_total", fmt.Sprintf(`log=%q,status="%d"`, log.MetricsEndpoint.String(), status), counts.ByStatus[status])
+		}
+		writeSample(w, "x509search_log_requests_total", fmt.Sprintf(`log=%q,status="timeout"`, log.MetricsEndpoint.String()), counts.Timeouts)
+		writeSample(w, "x509search_log_requests_total", fmt.Sprintf(`log=%q,status="error"`, log.MetricsEndpoint.String()), counts.NetworkErrors)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	writeHeader(w, "x509search_log_up", "gauge", "Whether the log's checkpoint could be fetched when last checked.")
+	for _, log := range d.logs {
+		health, ok := d.health[log]
+		if !ok {
+			continue
+		}
+		up := int64(0)
+		if health.Err == nil {
+			up = 1
+		}
+		writeSample(w, "x509search_log_up", fmt.Sprintf("log=%q", log.MetricsEndpoint.String()), up)
+	}
+
+	writeHeader(w, "x509search_log_tree_size", "gauge", "The log's tree size when last checked.")
+	for _, log := range d.logs {
+		health, ok := d.health[log]
+		if ok && health.Err == nil {
+			writeSample(w, "x509search_log_tree_size", fmt.Sprintf("log=%q", log.MetricsEndpoint.String()), health.TreeSize)
+		}
+	}
+
+	writeHeader(w, "x509search_log_checkpoint_age_seconds", "gauge", "The age of the log's checkpoint when last checked.")
+	for _, log := range d.logs {
+		health, ok := d.health[log]
+		if ok && health.Err == nil {
+			writeSample(w, "x509search_log_checkpoint_age_seconds", fmt.Sprintf("log=%q", log.MetricsEndpoint.String()), int64(health.CheckpointAge.Seconds()))
+		}
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines describing a metric.
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes a single sample of a metric, with the given labels.
+func writeSample(w io.Writer, name, labels string, value int64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
+
+// writeMetric writes a metric with a single sample.
+func writeMetric(w io.Writer, name, kind, help string, value int64) {
+	writeHeader(w, name, kind, help)
+	writeSample(w, name, "", value)
+}
+
+// containsLog reports whether logs contains log.
+func containsLog(logs []*staticctapi.Log, log *staticctapi.Log) bool {
+	for _, l := range logs {
+		if l == log {
+			return true
+		}
+	}
+	return false
+}
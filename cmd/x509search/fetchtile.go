@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// runFetchTile downloads a single data tile and prints a line describing each
+// of its entries, which helps when debugging gaps or odd entries in a search.
+func runFetchTile(args []string) error {
+	flags := flag.NewFlagSet("fetch-tile", flag.ContinueOnError)
+	logUrl := flags.String("log", "", "monitoring prefix URL of the tiled log")
+	tileIndex := flags.Int64("index", -1, "index of the data tile to fetch")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *logUrl == "" {
+		return errors.New("missing required flag: -log")
+	}
+
+	if *tileIndex < 0 {
+		return errors.New("missing required flag: -index")
+	}
+
+	log, err := staticctapi.NewLog(*logUrl)
+	if err != nil {
+		return fmt.Errorf("creating log: %w", err)
+	}
+
+	entries, err := log.GetTileEntries(context.Background(), *tileIndex)
+	if err != nil {
+		return fmt.Errorf("getting entries for tile %d: %w", *tileIndex, err)
+	}
+
+	fmt.Printf("tile path: tile/data/%s\n", staticctapi.TilePathFromIndex(*tileIndex))
+	fmt.Printf("entries: %d\n\n", len(entries))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tTIMESTAMP\tPRECERT\tFINGERPRINT\tISSUER FINGERPRINT\tSUBJECT")
+
+	for _, entry := range entries {
+		der := entry.Certificate
+		if entry.IsPrecert {
+			der = entry.PreCertificate
+		}
+
+		fingerprint := sha256.Sum256(der)
+
+		issuer := "-"
+		if len(entry.ChainFingerprints) > 0 {
+			issuer = fmt.Sprintf("%x", entry.ChainFingerprints[0])
+		}
+
+		subject := "-"
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			subject = fmt.Sprintf("(unparseable: %s)", err)
+		} else if cert.Subject.String() != "" {
+			subject = cert.Subject.String()
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%t\t%x\t%s\t%s\n",
+			entry.LeafIndex,
+			time.UnixMilli(entry.Timestamp).UTC().Format(time.RFC3339Nano),
+			entry.IsPrecert,
+			fingerprint,
+			issuer,
+			subject,
+		)
+	}
+
+	return w.Flush()
+}
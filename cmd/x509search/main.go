@@ -0,0 +1,87 @@
+// Command x509search provides tools for planning, running, and debugging
+// searches of Certificate Transparency logs.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a subcommand of x509search.
+type command struct {
+	// description is a one-line summary shown in the usage message.
+	description string
+
+	// run executes the subcommand with the arguments following its name.
+	run func(args []string) error
+}
+
+var commands = map[string]command{
+	"daemon": {
+		description: "follow logs indefinitely, serving metrics and health checks",
+		run:         runDaemon,
+	},
+	"fetch-tile": {
+		description: "print the entries of a single data tile",
+		run:         runFetchTile,
+	},
+	"reconcile": {
+		description: "report the certificates found by only one of two searches",
+		run:         runReconcile,
+	},
+	"run": {
+		description: "run a search described by a configuration file",
+		run:         runRun,
+	},
+	"search": {
+		description: "search a tiled log and print matching certificates",
+		run:         runSearch,
+	},
+	"tile-index": {
+		description: "map a timestamp to the data tile containing it",
+		run:         runTileIndex,
+	},
+	"verify-logging": {
+		description: "check that issued certificates appear in enough CT logs",
+		run:         runVerifyLogging,
+	},
+	"verify": {
+		description: "verify a certificate's inclusion in a tiled log",
+		run:         runVerify,
+	},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: x509search <command> [flags]\n\ncommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", name, commands[name].description)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(os.Args[2:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
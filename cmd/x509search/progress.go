@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/boulder"
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// progressDisplay periodically renders the progress of a running search.
+type progressDisplay struct {
+	out      io.Writer
+	search   *x509search.Progress
+	tiles    *staticctapi.Progress
+	started  time.Time
+	terminal bool
+
+	// queries are the Boulder sources, whose progress is counted in rows
+	// rather than tiles.
+	queries []sourceQueries
+}
+
+func newProgressDisplay(out *os.File, search *x509search.Progress, tiles *staticctapi.Progress) *progressDisplay {
+	terminal := false
+	info, err := out.Stat()
+	if err == nil {
+		terminal = info.Mode()&os.ModeCharDevice != 0
+	}
+
+	return &progressDisplay{
+		out:      out,
+		search:   search,
+		tiles:    tiles,
+		started:  time.Now(),
+		terminal: terminal,
+	}
+}
+
+// start renders progress until ctx is cancelled, then renders a final line.
+// The returned channel is closed once the final line has been written.
+func (d *progressDisplay) start(ctx context.Context) <-chan struct{} {
+	// Redraw a single line on terminals, and log occasional lines otherwise
+	interval := 30 * time.Second
+	if d.terminal {
+		interval = 1 * time.Second
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				d.render(time.Now())
+				if d.terminal {
+					fmt.Fprintln(d.out)
+				}
+				return
+			case now := <-ticker.C:
+				d.render(now)
+			}
+		}
+	}()
+
+	return done
+}
+
+func (d *progressDisplay) render(now time.Time) {
+	line := d.line(now)
+	if d.terminal {
+		// Return to the start of the line and clear it before redrawing
+		fmt.Fprintf(d.out, "\r\033[K%s", line)
+		return
+	}
+	fmt.Fprintln(d.out, line)
+}
+
+func (d *progressDisplay) line(now time.Time) string {
+	elapsed := now.Sub(d.started)
+	completed, total := d.tiles.Tiles()
+	certificates := d.search.Certificates()
+
+	// The search finishes when both the tiles and the rows are done, so the
+	// later of their estimates is shown
+	var remaining time.Duration
+	known := false
+	estimate := func(done, total int64) {
+		if done > 0 && total >= done {
+			remaining = max(remaining, time.Duration(float64(elapsed)*float64(total-done)/float64(done)))
+			known = true
+		}
+	}
+
+	var parts []string
+	if total > 0 || len(d.queries) == 0 {
+		percent := 0.0
+		if total > 0 {
+			percent = float64(completed) / float64(total) * 100
+		}
+		parts = append(parts, fmt.Sprintf("tiles %d/%d (%.1f%%)", completed, total, percent))
+		estimate(completed, total)
+	}
+
+	if len(d.queries) > 0 {
+		rows, totalRows := int64(0), int64(0)
+		for _, source := range d.queries {
+			rows += source.stats.Counts().Rows
+			if totalRows >= 0 && source.estimate >= 0 {
+				totalRows += source.estimate
+			} else {
+				totalRows = -1
+			}
+		}
+
+		if totalRows >= 0 {
+			// Retried queries may return more rows than estimated
+			percent := 100.0
+			if totalRows > rows {
+				percent = float64(rows) / float64(totalRows) * 100
+			}
+			parts = append(parts, fmt.Sprintf("rows %d/~%d (%.1f%%)", rows, totalRows, percent))
+			estimate(rows, max(rows, totalRows))
+		} else {
+			parts = append(parts, fmt.Sprintf("rows %d", rows))
+		}
+	}
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(certificates) / elapsed.Seconds()
+	}
+
+	eta := "unknown"
+	if known {
+		eta = remaining.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("%s  certs %d (%.0f/s)  matches %d  elapsed %s  ETA %s",
+		strings.Join(parts, "  "), certificates, rate, d.search.Matches(), elapsed.Round(time.Second), eta)
+}
+
+// printRequestCounts summarizes the requests made to each log, so that a slow
+// search can be attributed to rate limiting, server errors, or timeouts.
+func printRequestCounts(out io.Writer, logs []*staticctapi.Log) {
+	for _, log := range logs {
+		counts := log.RequestCounts()
+
+		statuses := make([]int, 0, len(counts.ByStatus))
+		for status := range counts.ByStatus {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+
+		summary := []string{}
+		for _, status := range statuses {
+			summary = append(summary, fmt.Sprintf("%d: %d", status, counts.ByStatus[status]))
+		}
+		summary = append(summary, fmt.Sprintf("timeouts: %d", counts.Timeouts))
+		summary = append(summary, fmt.Sprintf("network errors: %d", counts.NetworkErrors))
+
+		retries := int64(0)
+		for attempt, count := range counts.ByAttempt {
+			if attempt > 1 {
+				retries += count
+			}
+		}
+		summary = append(summary, fmt.Sprintf("retries: %d", retries))
+
+		fmt.Fprintf(out, "requests to %s: %s\n", log.MetricsEndpoint, strings.Join(summary, ", "))
+	}
+}
+
+// sourceQueries holds the totals of the queries a Boulder source has run, and
+// the number of rows it was estimated to read, or -1 if that's unknown.
+type sourceQueries struct {
+	source   string
+	stats    *boulder.QueryStats
+	estimate int64
+}
+
+// printQueryCounts summarizes the queries each Boulder source has run, so that
+// the load a search put on the database can be seen.
+func printQueryCounts(out io.Writer, queries []sourceQueries) {
+	for _, source := range queries {
+		counts := source.stats.Counts()
+		fmt.Fprintf(out, "queries by %s: %d, rows: %d, bytes: %d, time: %s, timeouts: %d, errors: %d, retries: %d\n",
+			source.source, counts.Queries, counts.Rows, counts.Bytes, counts.Duration.Round(time.Millisecond), counts.Timeouts, counts.Errors, counts.Retries)
+	}
+}
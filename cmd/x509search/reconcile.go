@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search/config"
+	"github.com/letsencrypt/x509search/reconcile"
+)
+
+// runReconcile runs the searches described by two configuration files, and
+// reports the certificates found by only one of them.
+func runReconcile(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	leftFile := flags.String("left", "", "YAML or JSON configuration file of the first search")
+	rightFile := flags.String("right", "", "YAML or JSON configuration file of the second search")
+	key := flags.String("key", "sha256", "what certificates are paired by, as for a cacher's fingerprint, such as sha256 or issuer-serial")
+	format := flags.String("format", "diff", "report format: diff or json")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *leftFile == "" || *rightFile == "" {
+		return errors.New("missing required flags: -left and -right")
+	}
+
+	fingerprint, err := config.ParseFingerprint(*key)
+	if err != nil {
+		return err
+	}
+
+	if *format != "diff" && *format != "json" {
+		return fmt.Errorf("unknown format: %q", *format)
+	}
+
+	// Both searches resolve relative windows against the same time
+	now := time.Now()
+
+	var sides []reconcile.Side
+	for _, path := range []string{*leftFile, *rightFile} {
+		searchConfig, err := config.LoadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if searchConfig.Window.Follow {
+			return fmt.Errorf("%s: can't reconcile a search that follows its logs", path)
+		}
+
+		search, err := searchConfig.Build(now)
+		if err != nil {
+			return fmt.Errorf("building search %s: %w", path, err)
+		}
+
+		defer func() {
+			err := search.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "closing outputs: %s\n", err.Error())
+			}
+		}()
+
+		sides = append(sides, reconcile.Side{
+			Name:   strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+			Search: search.Search,
+		})
+	}
+
+	// An interrupted reconciliation would report certificates as missing
+	// that just hadn't been found yet, so it's cancelled outright
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := reconcile.Reconcile(ctx, sides[0], sides[1], fingerprint)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return report.WriteDiff(os.Stdout)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/boulder"
+	"github.com/letsencrypt/x509search/config"
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// runRun executes a search described by a configuration file.
+func runRun(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML or JSON search configuration file")
+	showProgress := flags.Bool("progress", true, "show search progress on stderr")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *configFile == "" {
+		return errors.New("missing required flag: -config")
+	}
+
+	searchConfig, err := config.LoadFile(*configFile)
+	if err != nil {
+		return err
+	}
+
+	if len(searchConfig.Sinks) == 0 {
+		return errors.New("no sinks configured")
+	}
+
+	search, err := searchConfig.Build(time.Now())
+	if err != nil {
+		return fmt.Errorf("building search: %w", err)
+	}
+
+	defer func() {
+		err := search.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "closing outputs: %s\n", err.Error())
+		}
+	}()
+
+	interrupt := x509search.NotifyInterrupt(context.Background())
+	defer interrupt.Release()
+	search.Stop = interrupt.Stopping()
+
+	ctx, cancel := context.WithCancel(interrupt.Context())
+	defer cancel()
+
+	go reportInterrupt(ctx, interrupt)
+
+	var queries []sourceQueries
+	stopProgress := func() {}
+	if *showProgress {
+		searchProgress := &x509search.Progress{}
+		tileProgress := &staticctapi.Progress{}
+
+		search.Progress = searchProgress
+		for i, source := range search.DataSources {
+			switch dataSource := source.(type) {
+			case staticctapi.DataSource:
+				dataSource.Progress = tileProgress
+				search.DataSources[i] = dataSource
+			case boulder.DataSource:
+				stats := &boulder.QueryStats{}
+				dataSource.Observer = stats.Observe
+				search.DataSources[i] = dataSource
+
+				estimate, err := dataSource.EstimateRows(ctx)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", dataSource.Name(), err.Error())
+					estimate = -1
+				}
+				queries = append(queries, sourceQueries{source: dataSource.Name(), stats: stats, estimate: estimate})
+			}
+		}
+
+		display := newProgressDisplay(os.Stderr, searchProgress, tileProgress)
+		display.queries = queries
+		done := display.start(ctx)
+		stopProgress = func() {
+			cancel()
+			<-done
+		}
+		defer stopProgress()
+	}
+
+	err = search.Execute(ctx)
+	stopProgress()
+	printQueryCounts(os.Stderr, queries)
+	return err
+}
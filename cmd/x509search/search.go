@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/crtsh"
+	"github.com/letsencrypt/x509search/enrich"
+	"github.com/letsencrypt/x509search/sink"
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// runSearch searches a tiled log for certificates matching simple criteria and
+// writes matches to stdout, in PEM format unless a template is given.
+func runSearch(args []string) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	logUrl := flags.String("log", "", "monitoring prefix URL of the tiled log")
+	origin := flags.String("origin", "", "if set, reject checkpoints from -log that don't have this origin line")
+	allLogs := flags.Bool("all-logs", false, "search every usable log in the log list, instead of -log")
+	logListUrl := flags.String("log-list", staticctapi.DefaultLogListURL, "URL of the v3 log list used by -all-logs")
+	startString := flags.String("start", "", "start of the search window, in RFC 3339 format")
+	endString := flags.String("end", "", "end of the search window, in RFC 3339 format")
+	notBeforeSlack := flags.Duration("not-before-slack", 0, "if set, -start and -end bound certificates' notBefore, and logs are searched this much further on either side")
+	connections := flags.Int("connections", 10, "maximum concurrent connections to the log, or to all logs combined with -all-logs")
+	prefetch := flags.Int("prefetch", 0, "number of downloaded tiles per log that may wait to be searched, so downloads continue while matches are filtered")
+	precerts := flags.Bool("precerts", true, "include precertificates")
+	certs := flags.Bool("certs", false, "include final certificates")
+	domain := flags.String("domain", "", "only match certificates for this domain or its subdomains")
+	issuerOrg := flags.String("issuer-org", "", "only match certificates with this issuer organization")
+	format := flags.String("format", "", "text/template used to print each match, instead of PEM")
+	jsonFields := flags.String("jsonl", "", "print matches as lines of JSON with these comma-separated fields (\"default\" for the usual set), instead of PEM")
+	derOutput := flags.Bool("der", false, "print matches as back-to-back DER, instead of PEM")
+	aggregate := flags.String("aggregate", "", "comma-separated dimensions to count matches by, instead of printing them")
+	orderWindow := flags.Duration("order-window", 0, "deliver matches in timestamp order within this window")
+	failFast := flags.Bool("fail-fast", false, "stop the search if a tile can't be fetched, instead of skipping it")
+	showProgress := flags.Bool("progress", true, "show search progress on stderr")
+	parseFailures := flags.String("parse-failures", "", "write certificates that can't be parsed, with their provenance, to this directory")
+	sqliteFile := flags.String("sqlite", "", "also write matches to this SQLite database, creating it if needed")
+	postgresDSN := flags.String("postgres", "", "also insert matches into a PostgreSQL database with this connection string")
+	postgresTable := flags.String("postgres-table", "certificates", "table used by -postgres, created if needed")
+	zipFile := flags.String("zip", "", "also write matches to this zip archive, with an index.csv manifest")
+	exportTiles := flags.String("export-tiles", "", "also write matches and their issuers to this directory in tile format")
+	crossCheck := flags.Bool("crtsh", false, "cross-check matches for -domain against crt.sh and report discrepancies")
+	crlSources := flags.String("crls", "", "comma-separated URLs or files of CRLs used to annotate matches with their revocation status")
+	revocation := flags.String("revocation", "", "only match certificates that are \"revoked\" or \"unrevoked\" according to -crls")
+	ccadbSource := flags.String("ccadb", "", "URL or file of a CCADB certificate records report, used to annotate matches with their CA owner (\"default\" for the CCADB's own)")
+	caOwner := flags.String("ca-owner", "", "only match certificates issued by this CA owner, according to -ccadb")
+	checkOCSP := flags.Bool("ocsp", false, "annotate matches with their OCSP status, available to -format as .Provenance.Annotations")
+	rootsFile := flags.String("roots", "", "PEM file of trusted roots; annotate matches with whether they chain to one of them")
+	requireChain := flags.Bool("require-chain", false, "only match certificates that chain to one of -roots")
+	userAgent := flags.String("user-agent", x509search.DefaultUserAgent, "User-Agent sent with every request, ideally including your contact details")
+	issuersFile := flags.String("issuers", "", "PEM file of intermediates used by -ocsp and -roots, in addition to those fetched via AIA")
+	stateFile := flags.String("state", "", "periodically save the search's progress to this file, and resume from it if it exists")
+	stateInterval := flags.Duration("state-interval", 30*time.Second, "how often -state is saved")
+	timeLimit := flags.Duration("time-limit", 0, "stop the search after this long, keeping the matches found so far")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *startString == "" || *endString == "" {
+		return errors.New("missing required flag: -start and -end must both be set")
+	}
+
+	if (*logUrl == "") == !*allLogs {
+		return errors.New("exactly one of -log and -all-logs must be set")
+	}
+
+	start, err := time.Parse(time.RFC3339, *startString)
+	if err != nil {
+		return fmt.Errorf("parsing start time: %w", err)
+	}
+
+	end, err := time.Parse(time.RFC3339, *endString)
+	if err != nil {
+		return fmt.Errorf("parsing end time: %w", err)
+	}
+
+	if *crossCheck && *domain == "" {
+		return errors.New("-crtsh requires -domain")
+	}
+
+	tileProgress := &staticctapi.Progress{}
+	template := staticctapi.DataSource{
+		IncludePrecertificates: *precerts,
+		IncludeCertificates:    *certs,
+		StartTimeInclusive:     start,
+		EndTimeInclusive:       end,
+		MaxConnections:         *connections,
+		Prefetch:               *prefetch,
+		Progress:               tileProgress,
+		FailFast:               *failFast,
+		WindowByNotBefore:      *notBeforeSlack > 0,
+		NotBeforeSlack:         *notBeforeSlack,
+	}
+
+	var dataSources []x509search.Sourcer
+	errorBehavior := x509search.ErrorBehaviorCancel
+	if *allLogs {
+		logList, err := staticctapi.FetchLogList(context.Background(), nil, *logListUrl)
+		if err != nil {
+			return err
+		}
+
+		// Few logs cover the whole window, and one unreachable log shouldn't
+		// end the whole search
+		template.Clamp = true
+		errorBehavior = x509search.ErrorBehaviorContinue
+
+		dataSources, err = staticctapi.UsableDataSources(logList, template, *connections)
+		if err != nil {
+			return err
+		}
+
+		// Exported entries are copied from the logs' tiles, which RFC 6962
+		// logs don't have
+		if *exportTiles != "" {
+			usable := len(dataSources)
+			dataSources = slices.DeleteFunc(dataSources, func(source x509search.Sourcer) bool {
+				_, rfc6962 := source.(staticctapi.RFC6962DataSource)
+				return rfc6962
+			})
+			if skipped := usable - len(dataSources); skipped > 0 {
+				fmt.Fprintf(os.Stderr, "skipping %d RFC 6962 logs, whose entries can't be exported as tiles\n", skipped)
+			}
+		}
+	} else {
+		log, err := staticctapi.NewLog(*logUrl)
+		if err != nil {
+			return fmt.Errorf("creating log: %w", err)
+		}
+
+		log.ExpectedOrigin = *origin
+
+		source := template
+		source.Log = log
+		dataSources = []x509search.Sourcer{source}
+	}
+
+	var state *searchState
+	if *stateFile != "" {
+		state, err = loadState(*stateFile, args)
+		if err != nil {
+			return err
+		}
+
+		// RFC 6962 logs are searched without a cursor, so start over
+		for i, dataSource := range dataSources {
+			source, ok := dataSource.(staticctapi.DataSource)
+			if !ok {
+				continue
+			}
+			source.Cursor = state.cursor(source.Log)
+			dataSources[i] = source
+		}
+	}
+
+	logs := []*staticctapi.Log{}
+	for _, dataSource := range dataSources {
+		var log *staticctapi.Log
+		switch source := dataSource.(type) {
+		case staticctapi.DataSource:
+			log = source.Log
+		case staticctapi.RFC6962DataSource:
+			log = source.Log
+		}
+		log.UserAgent = *userAgent
+		logs = append(logs, log)
+	}
+
+	var output x509search.Sink = sink.NewPEM(os.Stdout)
+	switch {
+	case countSet(*format != "", *aggregate != "", *derOutput, *jsonFields != "") > 1:
+		return errors.New("-format, -aggregate, -jsonl, and -der are mutually exclusive")
+	case *jsonFields != "":
+		var fields []string
+		if *jsonFields != "default" {
+			fields = sink.ParseJSONLFields(*jsonFields)
+		}
+		output, err = sink.NewJSONL(os.Stdout, fields)
+		if err != nil {
+			return err
+		}
+	case *derOutput:
+		output = sink.NewDER(os.Stdout, false)
+	case *format != "":
+		output, err = sink.NewTemplate(os.Stdout, *format)
+		if err != nil {
+			return err
+		}
+	case *aggregate != "":
+		dimensions, err := sink.ParseDimensions(strings.Split(*aggregate, ","))
+		if err != nil {
+			return err
+		}
+		output = sink.NewAggregate(os.Stdout, dimensions...)
+	}
+
+	if *orderWindow > 0 {
+		output, err = sink.NewOrdered(output, *orderWindow, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	sinks := []x509search.Sink{output}
+
+	if *exportTiles != "" {
+		var tileWriter x509search.Sink
+		tileWriter, err = staticctapi.NewTileWriter(context.Background(), *exportTiles, logs...)
+		if err != nil {
+			return err
+		}
+		if *orderWindow > 0 {
+			tileWriter, err = sink.NewOrdered(tileWriter, *orderWindow, 0)
+			if err != nil {
+				return err
+			}
+		}
+		sinks = append(sinks, tileWriter)
+	}
+
+	var archive *os.File
+	if *zipFile != "" {
+		archive, err = os.Create(*zipFile)
+		if err != nil {
+			return fmt.Errorf("creating zip archive: %w", err)
+		}
+		defer archive.Close()
+		sinks = append(sinks, sink.NewZip(archive, false))
+	}
+
+	var database *sql.DB
+	if *sqliteFile != "" {
+		database, err = sql.Open("sqlite", *sqliteFile)
+		if err != nil {
+			return fmt.Errorf("opening SQLite database: %w", err)
+		}
+		defer database.Close()
+
+		sqliteSink, err := sink.NewSQLite(database)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sqliteSink)
+	}
+
+	var inventory *sql.DB
+	if *postgresDSN != "" {
+		inventory, err = sql.Open("postgres", *postgresDSN)
+		if err != nil {
+			return fmt.Errorf("opening PostgreSQL database: %w", err)
+		}
+		defer inventory.Close()
+
+		postgresSink, err := sink.NewPostgres(inventory, *postgresTable, 0)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, postgresSink)
+	}
+
+	collector := crtsh.NewCollector()
+	if *crossCheck {
+		sinks = append(sinks, collector)
+	}
+
+	var parseErrorCallback func([]byte, x509search.Metadata, error)
+	if *parseFailures != "" {
+		failures, err := sink.NewFailureDirectory(*parseFailures)
+		if err != nil {
+			return err
+		}
+		parseErrorCallback = failures.Capture
+	}
+
+	var enrichers []x509search.Enricher
+
+	var revocationFilter func(*x509.Certificate) bool
+	if *crlSources != "" {
+		crls := enrich.NewCRLs()
+		crls.UserAgent = *userAgent
+		for _, source := range strings.Split(*crlSources, ",") {
+			err := crls.Load(context.Background(), strings.TrimSpace(source))
+			if err != nil {
+				return err
+			}
+		}
+		enrichers = append(enrichers, crls)
+
+		switch *revocation {
+		case "":
+		case "revoked":
+			revocationFilter = crls.Filter(enrich.CRLRevoked)
+		case "unrevoked":
+			revocationFilter = crls.Filter(enrich.CRLUnrevoked)
+		default:
+			return fmt.Errorf("unknown -revocation status: %q", *revocation)
+		}
+	} else if *revocation != "" {
+		return errors.New("-revocation requires -crls")
+	}
+
+	var caOwnerFilter func(*x509.Certificate) bool
+	if *ccadbSource != "" {
+		source := *ccadbSource
+		if source == "default" {
+			source = enrich.DefaultCCADBURL
+		}
+
+		catalog, err := enrich.LoadCCADB(context.Background(), nil, source)
+		if err != nil {
+			return err
+		}
+		enrichers = append(enrichers, catalog)
+
+		if *caOwner != "" {
+			caOwnerFilter = catalog.Filter(*caOwner)
+		}
+	} else if *caOwner != "" {
+		return errors.New("-ca-owner requires -ccadb")
+	}
+
+	issuers := enrich.NewIssuers()
+	issuers.FetchAIA = true
+	issuers.UserAgent = *userAgent
+	if *issuersFile != "" {
+		err := issuers.Load(*issuersFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *checkOCSP {
+		ocsp, err := enrich.NewOCSP(issuers)
+		if err != nil {
+			return err
+		}
+		ocsp.UserAgent = *userAgent
+		enrichers = append(enrichers, ocsp)
+	}
+
+	var rootsFilter func(*x509.Certificate) bool
+	if *rootsFile != "" {
+		pemData, err := os.ReadFile(*rootsFile)
+		if err != nil {
+			return fmt.Errorf("reading roots: %w", err)
+		}
+
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pemData) {
+			return fmt.Errorf("no certificates found in %s", *rootsFile)
+		}
+
+		chains, err := enrich.NewChains(roots, issuers)
+		if err != nil {
+			return err
+		}
+		enrichers = append(enrichers, chains)
+
+		if *requireChain {
+			rootsFilter = chains.Filter()
+		}
+	} else if *requireChain {
+		return errors.New("-require-chain requires -roots")
+	}
+
+	searchProgress := &x509search.Progress{}
+
+	search := x509search.Search{
+		Filter: func(cert *x509.Certificate) bool {
+			if *issuerOrg != "" && !containsString(cert.Issuer.Organization, *issuerOrg) {
+				return false
+			}
+			if *domain != "" && !coversDomain(cert.DNSNames, *domain) {
+				return false
+			}
+			if revocationFilter != nil && !revocationFilter(cert) {
+				return false
+			}
+			if caOwnerFilter != nil && !caOwnerFilter(cert) {
+				return false
+			}
+			if rootsFilter != nil && !rootsFilter(cert) {
+				return false
+			}
+			return true
+		},
+		ParseErrorCallback:      parseErrorCallback,
+		Enrichers:               enrichers,
+		Sinks:                   sinks,
+		DataSources:             dataSources,
+		DataSourceErrorBehavior: errorBehavior,
+		Progress:                searchProgress,
+	}
+
+	// Matches found before an interruption are remembered, so that they aren't
+	// written again when their tiles are searched again
+	if state != nil {
+		search.MatchCacher = state.matches
+	}
+
+	// The first interrupt lets the certificates already found be output, and
+	// the state saved, before exiting
+	interrupt := x509search.NotifyInterrupt(context.Background())
+	defer interrupt.Release()
+	search.Stop = interrupt.Stopping()
+
+	ctx, cancel := context.WithCancel(interrupt.Context())
+	defer cancel()
+
+	go reportInterrupt(ctx, interrupt)
+
+	stopProgress := func() {}
+	if *showProgress {
+		display := newProgressDisplay(os.Stderr, searchProgress, tileProgress)
+		done := display.start(ctx)
+		stopProgress = func() {
+			cancel()
+			<-done
+		}
+	}
+
+	stopState := func() {}
+	if state != nil {
+		stateCtx, cancelState := context.WithCancel(ctx)
+		done := state.start(stateCtx, *stateInterval)
+		stopState = func() {
+			cancelState()
+			<-done
+		}
+	}
+
+	search.Budget.Total = *timeLimit
+
+	summary, err := search.ExecuteSummary(ctx)
+	stopProgress()
+	stopState()
+
+	if summary.Status == x509search.StatusDeadlineExceeded {
+		fmt.Fprintf(os.Stderr, "time limit reached after %s, results are partial\n", summary.Duration.Round(time.Second))
+	}
+
+	// A completed search has nothing to resume, but an interrupted one keeps
+	// its progress
+	if state != nil && err == nil && summary.Status == x509search.StatusComplete {
+		err = os.Remove(*stateFile)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	} else if state != nil {
+		err = errors.Join(err, state.save())
+	}
+
+	if *showProgress {
+		printRequestCounts(os.Stderr, logs)
+	}
+
+	// Closing the sinks may write output, such as an aggregate summary or a
+	// final partial tile
+	for _, closer := range sinks {
+		err = errors.Join(err, closer.Close())
+	}
+	if archive != nil {
+		err = errors.Join(err, archive.Close())
+	}
+	if database != nil {
+		err = errors.Join(err, database.Close())
+	}
+	if inventory != nil {
+		err = errors.Join(err, inventory.Close())
+	}
+	if err != nil || !*crossCheck {
+		return err
+	}
+
+	return reportCrossCheck(collector, *domain, start, end, *userAgent)
+}
+
+// countSet returns the number of flags that are set.
+func countSet(flags ...bool) int {
+	count := 0
+	for _, set := range flags {
+		if set {
+			count++
+		}
+	}
+	return count
+}
+
+// reportCrossCheck compares the matches recorded by collector with the
+// certificates crt.sh knows for domain and its subdomains, and prints the
+// discrepancies to stderr.
+func reportCrossCheck(collector *crtsh.Collector, domain string, start, end time.Time, userAgent string) error {
+	client := &crtsh.Client{UserAgent: userAgent}
+	report, err := client.CrossCheck(context.Background(), crtsh.Query{
+		Identities: []string{domain, "%." + domain},
+		Start:      start,
+		End:        end,
+	}, collector)
+	if err != nil {
+		return fmt.Errorf("cross-checking with crt.sh: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "crt.sh cross-check: %d in common, %d missing from crt.sh, %d missing from search\n",
+		report.Common, len(report.MissingFromCrtSh), len(report.MissingFromSearch))
+
+	for _, cert := range report.MissingFromCrtSh {
+		fmt.Fprintf(os.Stderr, "missing from crt.sh: serial %x, subject %q\n", cert.SerialNumber, cert.Subject.CommonName)
+	}
+
+	for _, record := range report.MissingFromSearch {
+		fmt.Fprintf(os.Stderr, "missing from search: serial %s, crt.sh ID %d, subject %q\n", record.Serial, record.ID, record.CommonName)
+	}
+
+	return nil
+}
+
+// containsString reports whether values contains value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// coversDomain reports whether any of names is domain or one of its
+// subdomains.
+func coversDomain(names []string, domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// reportInterrupt tells the user what a first interrupt does, unless ctx is
+// done first.
+func reportInterrupt(ctx context.Context, interrupt *x509search.Interrupt) {
+	select {
+	case <-interrupt.Stopping():
+		fmt.Fprintln(os.Stderr, "interrupted, finishing the certificates already found; interrupt again to exit at once")
+	case <-ctx.Done():
+	}
+}
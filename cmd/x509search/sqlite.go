@@ -0,0 +1,5 @@
+package main
+
+// The SQLite driver used by the -sqlite flag and by "sqlite" sinks in
+// configuration files.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// searchState is the progress of a search, persisted so that an interrupted
+// search can be resumed by running the same command again.
+type searchState struct {
+	path    string
+	args    []string
+	cursors map[string]*staticctapi.Cursor
+	matches *x509search.ShardedCacher
+
+	// mu serializes saves
+	mu sync.Mutex
+}
+
+// stateFile is the format of the file written by a searchState.
+type stateFile struct {
+	// Args are the command-line arguments of the search, which must match
+	// for the search to be resumed.
+	Args []string `json:"args"`
+
+	// Cursors are the first tiles of each log that haven't been searched,
+	// keyed by the log's URL.
+	Cursors map[string]int64 `json:"cursors"`
+
+	// Failed are the tiles of each log that couldn't be fetched, keyed by
+	// the log's URL, which are retried when resuming.
+	Failed map[string][]int64 `json:"failed,omitempty"`
+
+	// Matches are the fingerprints of the matches found so far.
+	Matches []byte `json:"matches"`
+}
+
+// loadState returns the state of the search with the given arguments from the
+// file at path, or a fresh state if the file doesn't exist yet.
+func loadState(path string, args []string) (*searchState, error) {
+	state := &searchState{
+		path:    path,
+		args:    args,
+		cursors: make(map[string]*staticctapi.Cursor),
+		matches: x509search.NewShardedCacher(0),
+	}
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+
+	var saved stateFile
+	err = json.Unmarshal(contents, &saved)
+	if err != nil {
+		return nil, fmt.Errorf("parsing state file: %w", err)
+	}
+
+	if !slices.Equal(saved.Args, args) {
+		return nil, fmt.Errorf("state file %s is for a different search: %q", path, saved.Args)
+	}
+
+	for url, next := range saved.Cursors {
+		state.cursors[url] = staticctapi.NewCursor(next, saved.Failed[url]...)
+	}
+
+	_, err = state.matches.ReadFrom(bytes.NewReader(saved.Matches))
+	if err != nil {
+		return nil, fmt.Errorf("reading matches from state file: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "resuming search from %s\n", path)
+	return state, nil
+}
+
+// cursor returns the cursor tracking the search of log.
+func (s *searchState) cursor(log *staticctapi.Log) *staticctapi.Cursor {
+	url := log.MetricsEndpoint.String()
+
+	cursor, ok := s.cursors[url]
+	if !ok {
+		cursor = staticctapi.NewCursor(0)
+		s.cursors[url] = cursor
+	}
+	return cursor
+}
+
+// save atomically replaces the state file with the current state.
+func (s *searchState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := stateFile{
+		Args:    s.args,
+		Cursors: make(map[string]int64, len(s.cursors)),
+	}
+	for url, cursor := range s.cursors {
+		saved.Cursors[url] = cursor.Next()
+
+		failed := cursor.Failed()
+		if len(failed) > 0 {
+			if saved.Failed == nil {
+				saved.Failed = make(map[string][]int64)
+			}
+			saved.Failed[url] = failed
+		}
+	}
+
+	var matches bytes.Buffer
+	_, err := s.matches.WriteTo(&matches)
+	if err != nil {
+		return fmt.Errorf("writing matches to state file: %w", err)
+	}
+	saved.Matches = matches.Bytes()
+
+	contents, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("encoding state file: %w", err)
+	}
+
+	// Write to a temporary file first, so that an interruption mid-write
+	// leaves the previous state intact
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating state file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(contents)
+	if err != nil {
+		temp.Close()
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	err = temp.Close()
+	if err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+
+	err = os.Rename(temp.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("replacing state file: %w", err)
+	}
+	return nil
+}
+
+// start saves the state every interval until ctx is cancelled. The returned
+// channel is closed once saving has stopped.
+func (s *searchState) start(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := s.save()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "saving search state: %s\n", err.Error())
+				}
+			}
+		}
+	}()
+	return done
+}
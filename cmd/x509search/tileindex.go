@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// runTileIndex performs the same binary search used to bound a search window
+// and prints the data tile containing the given time, without running a
+// search.
+func runTileIndex(args []string) error {
+	flags := flag.NewFlagSet("tile-index", flag.ContinueOnError)
+	logUrl := flags.String("log", "", "monitoring prefix URL of the tiled log")
+	timeString := flags.String("time", "", "timestamp to locate, in RFC 3339 format")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *logUrl == "" {
+		return errors.New("missing required flag: -log")
+	}
+
+	if *timeString == "" {
+		return errors.New("missing required flag: -time")
+	}
+
+	t, err := time.Parse(time.RFC3339, *timeString)
+	if err != nil {
+		return fmt.Errorf("parsing time: %w", err)
+	}
+
+	log, err := staticctapi.NewLog(*logUrl)
+	if err != nil {
+		return fmt.Errorf("creating log: %w", err)
+	}
+
+	ctx := context.Background()
+
+	lastTile, err := log.GetLastFullTileIndex(ctx)
+	if err != nil {
+		return fmt.Errorf("getting index of current final tile: %w", err)
+	}
+
+	tileIndex, err := log.GetTileIndexFromTime(ctx, t, 0, lastTile)
+	if err != nil {
+		return fmt.Errorf("getting tile index: %w", err)
+	}
+
+	fmt.Printf("tile index: %d\n", tileIndex)
+	fmt.Printf("tile path: tile/data/%s\n", staticctapi.TilePathFromIndex(tileIndex))
+	fmt.Printf("entry indexes: %d-%d\n", tileIndex*256, tileIndex*256+255)
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"filippo.io/sunlight"
+	"golang.org/x/mod/sumdb/tlog"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// runVerify locates a certificate's entry in a tiled log and verifies its
+// inclusion proof against a checkpoint signed by the log.
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	logUrl := flags.String("log", "", "monitoring prefix URL of the tiled log")
+	keyFile := flags.String("key", "", "PEM file containing the log's public key")
+	certFile := flags.String("cert", "", "PEM file containing the certificate or precertificate")
+	leafIndex := flags.Int64("index", -1, "leaf index of the entry, if the certificate has no SCT from the log")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *logUrl == "" || *keyFile == "" || *certFile == "" {
+		return errors.New("missing required flag: -log, -key, and -cert must all be set")
+	}
+
+	key, err := readPublicKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := readCertificate(*certFile)
+	if err != nil {
+		return err
+	}
+
+	log, err := staticctapi.NewLog(*logUrl)
+	if err != nil {
+		return fmt.Errorf("creating log: %w", err)
+	}
+
+	ctx := context.Background()
+
+	tree, err := log.GetVerifiedTree(ctx, key)
+	if err != nil {
+		return fmt.Errorf("getting verified tree: %w", err)
+	}
+
+	var entry *sunlight.LogEntry
+	if *leafIndex >= 0 {
+		entry, err = log.GetEntry(ctx, *leafIndex)
+	} else {
+		var sct staticctapi.SCT
+		sct, err = findSCT(cert, key)
+		if err != nil {
+			return err
+		}
+		entry, err = log.GetEntryBySCT(ctx, sct)
+	}
+	if err != nil {
+		return fmt.Errorf("getting log entry: %w", err)
+	}
+
+	matches, err := entryMatches(entry, cert)
+	if err != nil {
+		return err
+	}
+
+	if !matches {
+		return fmt.Errorf("entry %d does not contain the certificate", entry.LeafIndex)
+	}
+
+	leafHash := tlog.RecordHash(entry.MerkleTreeLeaf())
+
+	err = log.ProveInclusion(ctx, tree, entry.LeafIndex, leafHash)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("leaf index: %d\n", entry.LeafIndex)
+	fmt.Printf("verified inclusion in tree of size %d\n", tree.N)
+
+	return nil
+}
+
+// findSCT returns the SCT embedded in cert that was issued by the log with the
+// given public key.
+func findSCT(cert *x509.Certificate, key any) (staticctapi.SCT, error) {
+	logID, err := staticctapi.LogIDFromKey(key)
+	if err != nil {
+		return staticctapi.SCT{}, err
+	}
+
+	scts, err := staticctapi.EmbeddedSCTs(cert)
+	if err != nil {
+		return staticctapi.SCT{}, fmt.Errorf("reading embedded SCTs: %w", err)
+	}
+
+	for _, sct := range scts {
+		if sct.LogID == logID {
+			return sct, nil
+		}
+	}
+
+	return staticctapi.SCT{}, errors.New("certificate has no SCT from this log; use -index")
+}
+
+// entryMatches reports whether entry was logged for cert. A final certificate
+// with embedded SCTs matches the precertificate entry it was issued from.
+func entryMatches(entry *sunlight.LogEntry, cert *x509.Certificate) (bool, error) {
+	if !entry.IsPrecert {
+		return bytes.Equal(entry.Certificate, cert.Raw), nil
+	}
+
+	if bytes.Equal(entry.PreCertificate, cert.Raw) {
+		return true, nil
+	}
+
+	tbs, err := x509search.NormalizeTBS(cert.RawTBSCertificate)
+	if err != nil {
+		return false, fmt.Errorf("normalizing certificate: %w", err)
+	}
+
+	return bytes.Equal(entry.Certificate, tbs), nil
+}
+
+// readCertificate parses the first certificate in a PEM file.
+func readCertificate(path string) (*x509.Certificate, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading certificate file: %w", err)
+	}
+
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// readPublicKey parses a PEM-encoded PKIX public key.
+func readPublicKey(path string) (any, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PEM public key found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/letsencrypt/x509search/config"
+	"github.com/letsencrypt/x509search/reconcile"
+)
+
+// runVerifyLogging checks that every certificate found by one configured
+// search, such as of a CA's database, is found in enough of the logs searched
+// by another.
+func runVerifyLogging(args []string) error {
+	flags := flag.NewFlagSet("verify-logging", flag.ContinueOnError)
+	issuedFile := flags.String("issued", "", "YAML or JSON configuration file of the search for the certificates issued, such as of a boulder source")
+	logsFile := flags.String("logs", "", "YAML or JSON configuration file of the search of the CT logs")
+	minLogs := flags.Int("min-logs", 2, "number of logs each certificate must be found in")
+	key := flags.String("key", "issuer-serial", "what certificates are paired by, as for a cacher's fingerprint")
+	format := flags.String("format", "text", "report format: text or json")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *issuedFile == "" || *logsFile == "" {
+		return errors.New("missing required flags: -issued and -logs")
+	}
+
+	fingerprint, err := config.ParseFingerprint(*key)
+	if err != nil {
+		return err
+	}
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format: %q", *format)
+	}
+
+	now := time.Now()
+
+	var sides []reconcile.Side
+	for _, path := range []string{*issuedFile, *logsFile} {
+		searchConfig, err := config.LoadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if searchConfig.Window.Follow {
+			return fmt.Errorf("%s: can't verify a search that follows its logs", path)
+		}
+
+		// Each log must report its own copy of every certificate
+		if path == *logsFile && searchConfig.DeduplicateSources {
+			return fmt.Errorf("%s: can't count the logs holding each certificate with deduplicateSources set", path)
+		}
+
+		search, err := searchConfig.Build(now)
+		if err != nil {
+			return fmt.Errorf("building search %s: %w", path, err)
+		}
+
+		defer func() {
+			err := search.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "closing outputs: %s\n", err.Error())
+			}
+		}()
+
+		sides = append(sides, reconcile.Side{
+			Name:   path,
+			Search: search.Search,
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := reconcile.VerifyLogged(ctx, sides[0], sides[1], *minLogs, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(report.Uncovered) > 0 {
+		return fmt.Errorf("%d certificates found in fewer than %d logs", len(report.Uncovered), *minLogs)
+	}
+	return nil
+}
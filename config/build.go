@@ -0,0 +1,1265 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/audit"
+	"github.com/letsencrypt/x509search/boulder"
+	"github.com/letsencrypt/x509search/cacher"
+	"github.com/letsencrypt/x509search/elasticsearch"
+	"github.com/letsencrypt/x509search/enrich"
+	"github.com/letsencrypt/x509search/filter"
+	"github.com/letsencrypt/x509search/mongodb"
+	"github.com/letsencrypt/x509search/sink"
+	"github.com/letsencrypt/x509search/staticctapi"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Search is a search built from a Config, along with the output files it holds
+// open. Close must be called once the search has finished.
+type Search struct {
+	x509search.Search
+
+	closers   []io.Closer
+	watchlist *watchlist
+}
+
+// ReloadWatchlist re-reads the file named by Filters.DomainsFile if it has
+// changed since it was last read, and reports whether it had. It may be called
+// while the search is running, and the new domains apply to the certificates
+// filtered afterwards. If the file can't be read, the search carries on with
+// the previous domains.
+func (s *Search) ReloadWatchlist() (bool, error) {
+	if s.watchlist == nil {
+		return false, nil
+	}
+
+	return s.watchlist.reload()
+}
+
+// WatchlistSize returns the number of domains read from Filters.DomainsFile.
+func (s *Search) WatchlistSize() int {
+	if s.watchlist == nil {
+		return 0
+	}
+
+	return s.watchlist.len()
+}
+
+// Close closes the search's sinks, then any files opened for them.
+func (s *Search) Close() error {
+	var errs []error
+	for _, sink := range s.Sinks {
+		errs = append(errs, sink.Close())
+	}
+	for _, closer := range s.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Build constructs the search described by c. Relative time windows are
+// resolved against now.
+func (c *Config) Build(now time.Time) (*Search, error) {
+	var start, end time.Time
+	var err error
+	if c.Window != (Window{}) || !c.windowless() {
+		start, end, err = c.Window.bounds(now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	search := &Search{}
+
+	search.DataSources, search.closers, err = c.buildSources(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	search.MatchCacher, err = c.Cacher.build()
+	if err != nil {
+		return nil, err
+	}
+
+	closer, ok := search.MatchCacher.(io.Closer)
+	if ok {
+		search.closers = append(search.closers, closer)
+	}
+
+	switch c.ErrorBehavior {
+	case "", "cancel":
+		search.DataSourceErrorBehavior = x509search.ErrorBehaviorCancel
+	case "continue":
+		search.DataSourceErrorBehavior = x509search.ErrorBehaviorContinue
+	default:
+		return nil, fmt.Errorf("unknown error behavior: %q", c.ErrorBehavior)
+	}
+
+	enrichment, err := c.Enrich.load(c.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Filters.DomainsFile != "" {
+		search.watchlist, err = loadWatchlist(c.Filters.DomainsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	search.DERFilter, search.Filter, err = c.Filters.build(enrichment, search.watchlist)
+	if err != nil {
+		return nil, err
+	}
+
+	search.Enrichers = enrichment.enrichers(c.Enrich.OCSP)
+
+	if c.Filters.MaxLag > 0 || c.Filters.MaxLead > 0 {
+		skew := filter.TimestampSkew{
+			MaxLag:  time.Duration(c.Filters.MaxLag),
+			MaxLead: time.Duration(c.Filters.MaxLead),
+		}
+		search.MetadataFilter = skew.Filter()
+		search.Enrichers = append(search.Enrichers, skew)
+	}
+
+	if c.Filters.LabeledWatchlist != "" {
+		labeled, err := filter.LoadWatchlist(c.Filters.LabeledWatchlist)
+		if err != nil {
+			return nil, err
+		}
+
+		watched := labeled.Filter()
+		filtered := search.Filter
+		search.Filter = func(cert *x509.Certificate) bool {
+			return watched(cert) && filtered(cert)
+		}
+		search.Enrichers = append(search.Enrichers, labeled)
+	}
+
+	if c.Filters.UnknownToBoulder != nil {
+		lookup, err := search.buildBoulderLookup(*c.Filters.UnknownToBoulder)
+		if err != nil {
+			_ = search.Close()
+			return nil, err
+		}
+
+		unknown := lookup.Filter()
+		filtered := search.Filter
+		search.Filter = func(cert *x509.Certificate) bool {
+			return filtered(cert) && unknown(cert)
+		}
+		search.Enrichers = append(search.Enrichers, lookup)
+	}
+
+	if c.ParseFailures != "" {
+		failures, err := sink.NewFailureDirectory(c.ParseFailures)
+		if err != nil {
+			return nil, err
+		}
+		search.ParseErrorCallback = failures.Capture
+	}
+
+	err = search.buildSinks(c.Sinks, enrichment)
+	if err != nil {
+		_ = search.Close()
+		return nil, err
+	}
+
+	return search, nil
+}
+
+// windowless reports whether none of the sources are restricted by the window,
+// which can then be left empty.
+func (c *Config) windowless() bool {
+	for _, source := range c.Sources {
+		if source.Type != "elasticsearch" && source.Type != "mongodb" {
+			return false
+		}
+	}
+	return len(c.Sources) > 0
+}
+
+// buildSources returns the data sources, along with the databases opened for
+// them.
+func (c *Config) buildSources(start time.Time, end time.Time) ([]x509search.Sourcer, []io.Closer, error) {
+	if len(c.Sources) == 0 {
+		return nil, nil, errors.New("no sources configured")
+	}
+
+	// Sources referring to the same log share a Log, and so its connections
+	logs := make(map[string]*staticctapi.Log)
+
+	var deduplicator *staticctapi.Deduplicator
+	if c.DeduplicateSources {
+		deduplicator = staticctapi.NewDeduplicator(nil)
+	}
+
+	sources := make([]x509search.Sourcer, 0, len(c.Sources))
+	var closers []io.Closer
+	for i, source := range c.Sources {
+		switch source.Type {
+		case "static-ct":
+			if source.URL == "" {
+				return nil, nil, fmt.Errorf("source %d: missing url", i)
+			}
+
+			log, ok := logs[source.URL]
+			if !ok {
+				var err error
+				log, err = staticctapi.NewLog(source.URL)
+				if err != nil {
+					return nil, nil, fmt.Errorf("source %d: creating log: %w", i, err)
+				}
+
+				log.ExpectedOrigin = source.Origin
+				log.UserAgent = c.UserAgent
+
+				for _, mirror := range source.Mirrors {
+					mirrorUrl, err := url.Parse(mirror)
+					if err != nil {
+						return nil, nil, fmt.Errorf("source %d: parsing mirror URL: %w", i, err)
+					}
+					log.Mirrors = append(log.Mirrors, mirrorUrl)
+				}
+
+				err = source.Auth.apply(log)
+				if err != nil {
+					return nil, nil, fmt.Errorf("source %d: %w", i, err)
+				}
+				logs[source.URL] = log
+			}
+
+			sources = append(sources, staticctapi.DataSource{
+				Log:                    log,
+				SourceName:             source.Name,
+				IncludePrecertificates: source.Precertificates,
+				IncludeCertificates:    source.Certificates,
+				StartTimeInclusive:     start,
+				EndTimeInclusive:       end,
+				MaxConnections:         source.MaxConnections,
+				Prefetch:               source.Prefetch,
+				PrefetchBytes:          source.PrefetchBytes,
+				Clamp:                  source.Clamp,
+				FailFast:               source.FailFast,
+				WindowByNotBefore:      c.Window.ByNotBefore,
+				NotBeforeSlack:         time.Duration(c.Window.NotBeforeSlack),
+				Deduplicator:           deduplicator,
+				Follow:                 c.Window.Follow,
+				PollInterval:           time.Duration(c.Window.PollInterval),
+			})
+		case "boulder":
+			if source.Driver == "" || source.DSN == "" {
+				return nil, nil, fmt.Errorf("source %d: missing driver or dsn", i)
+			}
+			if c.Window.Follow || c.Window.ByNotBefore {
+				return nil, nil, fmt.Errorf("source %d: boulder sources can't follow or window by notBefore", i)
+			}
+
+			db, err := sql.Open(source.Driver, source.DSN)
+			if err != nil {
+				return nil, nil, fmt.Errorf("source %d: opening database: %w", i, err)
+			}
+
+			closers = append(closers, db)
+
+			var replicas []*sql.DB
+			for _, dsn := range source.Replicas {
+				replica, err := sql.Open(source.Driver, dsn)
+				if err != nil {
+					return nil, nil, fmt.Errorf("source %d: opening replica: %w", i, err)
+				}
+				closers = append(closers, replica)
+				replicas = append(replicas, replica)
+			}
+
+			var partitions []boulder.Partition
+			for _, partition := range source.Partitions {
+				partitions = append(partitions, boulder.Partition(partition))
+			}
+
+			sources = append(sources, boulder.DataSource{
+				DB:                     db,
+				SourceName:             source.Name,
+				IncludePrecertificates: source.Precertificates,
+				IncludeCertificates:    source.Certificates,
+				StartTimeInclusive:     start,
+				EndTimeInclusive:       end,
+				BatchSize:              source.BatchSize,
+				QueryTimeout:           time.Duration(source.QueryTimeout),
+				IssuedChunk:            time.Duration(source.IssuedChunk),
+				IndexHint:              source.IndexHint,
+				JoinStatus:             source.JoinStatus,
+				Unrevoked:              source.Unrevoked,
+				Unexpired:              source.Unexpired,
+				CollapseBySerial:       source.CollapseBySerial,
+				Partitions:             partitions,
+				Replicas:               replicas,
+				MaxConnections:         source.MaxConnections,
+			})
+		case "elasticsearch":
+			if source.URL == "" || source.Index == "" || source.Field == "" {
+				return nil, nil, fmt.Errorf("source %d: missing url, index, or field", i)
+			}
+			if c.Window.Follow {
+				return nil, nil, fmt.Errorf("source %d: elasticsearch sources can't follow", i)
+			}
+
+			var query json.RawMessage
+			if source.Query != nil {
+				var err error
+				query, err = json.Marshal(source.Query)
+				if err != nil {
+					return nil, nil, fmt.Errorf("source %d: encoding query: %w", i, err)
+				}
+			}
+
+			header, client, err := source.Auth.httpClient()
+			if err != nil {
+				return nil, nil, fmt.Errorf("source %d: %w", i, err)
+			}
+			if client != nil {
+				client.Timeout = elasticsearch.DefaultTimeout
+			}
+
+			sources = append(sources, elasticsearch.DataSource{
+				URL:            source.URL,
+				Index:          source.Index,
+				Field:          source.Field,
+				Encoding:       source.Encoding,
+				Query:          query,
+				TimestampField: source.TimestampField,
+				BatchSize:      source.BatchSize,
+				ScrollTimeout:  time.Duration(source.ScrollTimeout),
+				SourceName:     source.Name,
+				HTTPClient:     client,
+				Header:         header,
+				UserAgent:      c.UserAgent,
+			})
+		case "mongodb":
+			if source.DSN == "" || source.Database == "" || source.Collection == "" || source.Field == "" {
+				return nil, nil, fmt.Errorf("source %d: missing dsn, database, collection, or field", i)
+			}
+			if c.Window.Follow {
+				return nil, nil, fmt.Errorf("source %d: mongodb sources can't follow", i)
+			}
+
+			client, err := source.connectMongoDB()
+			if err != nil {
+				return nil, nil, fmt.Errorf("source %d: %w", i, err)
+			}
+
+			closers = append(closers, mongoClient{client})
+
+			var filter any
+			if source.Query != nil {
+				filter = source.Query
+			}
+
+			sources = append(sources, mongodb.DataSource{
+				Collection:     client.Database(source.Database).Collection(source.Collection),
+				Filter:         filter,
+				Field:          source.Field,
+				TimestampField: source.TimestampField,
+				ResumeFile:     source.ResumeFile,
+				BatchSize:      int32(source.BatchSize),
+				SourceName:     source.Name,
+			})
+		default:
+			return nil, nil, fmt.Errorf("source %d: unknown type: %q", i, source.Type)
+		}
+	}
+
+	return sources, closers, nil
+}
+
+// connectMongoDB returns a client of a "mongodb" source's deployment, with
+// the credentials and TLS configuration of its Auth, if any, overriding those
+// in its DSN.
+func (s Source) connectMongoDB() (*mongo.Client, error) {
+	auth := s.Auth
+	if len(auth.Headers) > 0 || auth.BearerTokenFile != "" || auth.APIKeyFile != "" {
+		return nil, errors.New("mongodb sources only support username, passwordFile, and TLS auth")
+	}
+	if (auth.Username == "") != (auth.PasswordFile == "") {
+		return nil, errors.New("username and passwordFile must be set together")
+	}
+
+	clientOptions := options.Client().ApplyURI(s.DSN)
+
+	if auth.Username != "" {
+		password, err := readSecret(auth.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading password: %w", err)
+		}
+
+		var credential options.Credential
+		if clientOptions.Auth != nil {
+			credential = *clientOptions.Auth
+		}
+		credential.Username = auth.Username
+		credential.Password = password
+		credential.PasswordSet = true
+		clientOptions.SetAuth(credential)
+	}
+
+	tlsConfig, err := auth.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	// Connect doesn't contact the deployment, so a bad DSN is reported here
+	// but an unreachable one only once the search starts
+	client, err := mongo.Connect(clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to mongodb: %w", err)
+	}
+	return client, nil
+}
+
+// mongoClient closes a mongo.Client, as an io.Closer.
+type mongoClient struct {
+	*mongo.Client
+}
+
+func (c mongoClient) Close() error {
+	return c.Disconnect(context.Background())
+}
+
+func (a Auth) apply(log *staticctapi.Log) error {
+	if a.Username != "" || a.PasswordFile != "" || a.APIKeyFile != "" {
+		return errors.New("username, passwordFile, and apiKeyFile aren't supported by static-ct sources")
+	}
+
+	if len(a.Headers) > 0 {
+		log.Header = a.header()
+	}
+
+	if a.BearerTokenFile != "" {
+		token, err := readSecret(a.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("reading bearer token: %w", err)
+		}
+		log.BearerToken = token
+	}
+
+	tlsConfig, err := a.tlsConfig()
+	if err != nil {
+		return err
+	}
+	log.TLSConfig = tlsConfig
+	return nil
+}
+
+// httpClient returns the headers and client for requests authenticated by a,
+// for sources other than logs.
+func (a Auth) httpClient() (http.Header, *http.Client, error) {
+	header := a.header()
+
+	if a.BearerTokenFile != "" {
+		token, err := readSecret(a.BearerTokenFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading bearer token: %w", err)
+		}
+		header.Add("Authorization", "Bearer "+token)
+	}
+
+	if a.APIKeyFile != "" {
+		key, err := readSecret(a.APIKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading API key: %w", err)
+		}
+		header.Add("Authorization", "ApiKey "+key)
+	}
+
+	if (a.Username == "") != (a.PasswordFile == "") {
+		return nil, nil, errors.New("username and passwordFile must be set together")
+	}
+
+	if a.Username != "" {
+		password, err := readSecret(a.PasswordFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading password: %w", err)
+		}
+		header.Add("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(a.Username+":"+password)))
+	}
+
+	if len(header["Authorization"]) > 1 {
+		return nil, nil, errors.New("only one of bearerTokenFile, apiKeyFile, and username can be set")
+	}
+
+	tlsConfig, err := a.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tlsConfig == nil {
+		return header, nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return header, &http.Client{Transport: transport}, nil
+}
+
+// header returns the configured Headers.
+func (a Auth) header() http.Header {
+	header := make(http.Header)
+	for name, value := range a.Headers {
+		header.Set(name, value)
+	}
+	return header
+}
+
+// tlsConfig returns the configured client certificate and roots, or nil if
+// neither is configured.
+func (a Auth) tlsConfig() (*tls.Config, error) {
+	if (a.ClientCertificate == "") != (a.ClientKey == "") {
+		return nil, errors.New("clientCertificate and clientKey must be set together")
+	}
+
+	if a.ClientCertificate == "" && a.RootCAs == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if a.ClientCertificate != "" {
+		certificate, err := tls.LoadX509KeyPair(a.ClientCertificate, a.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if a.RootCAs != "" {
+		rootCAs, err := readCertPool(a.RootCAs)
+		if err != nil {
+			return nil, fmt.Errorf("reading root CAs: %w", err)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	return tlsConfig, nil
+}
+
+// readSecret reads a secret from a file, ignoring surrounding whitespace.
+func readSecret(path string) (string, error) {
+	secret, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
+
+// enrichment holds the data loaded for the configured enrichers, which
+// filters may also use. Fields are nil if not configured.
+type enrichment struct {
+	issuers *enrich.Issuers
+	crls    *enrich.CRLs
+	catalog *enrich.Catalog
+	chains  *enrich.Chains
+
+	userAgent string
+}
+
+func (e Enrich) load(userAgent string) (*enrichment, error) {
+	loaded := &enrichment{
+		issuers:   enrich.NewIssuers(),
+		userAgent: userAgent,
+	}
+
+	loaded.issuers.FetchAIA = e.FetchIssuers
+	loaded.issuers.UserAgent = userAgent
+	for _, path := range e.Issuers {
+		err := loaded.issuers.Load(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(e.CRLs) > 0 {
+		loaded.crls = enrich.NewCRLs()
+		loaded.crls.UserAgent = userAgent
+		if len(e.Issuers) > 0 {
+			loaded.crls.Issuers = loaded.issuers
+		}
+
+		for _, source := range e.CRLs {
+			err := loaded.crls.Load(context.Background(), source)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if e.CCADB != "" {
+		var err error
+		loaded.catalog, err = enrich.LoadCCADB(context.Background(), nil, e.CCADB)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.Roots != "" {
+		roots, err := readCertPool(e.Roots)
+		if err != nil {
+			return nil, fmt.Errorf("reading roots: %w", err)
+		}
+
+		loaded.chains, err = enrich.NewChains(roots, loaded.issuers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return loaded, nil
+}
+
+// enrichers returns the enrichers for the loaded data, along with an OCSP
+// enricher if ocsp is set.
+func (e *enrichment) enrichers(ocsp bool) []x509search.Enricher {
+	var enrichers []x509search.Enricher
+
+	if ocsp {
+		// The issuers are never nil, so this can't fail
+		responder, _ := enrich.NewOCSP(e.issuers)
+		responder.UserAgent = e.userAgent
+		enrichers = append(enrichers, responder)
+	}
+
+	if e.crls != nil {
+		enrichers = append(enrichers, e.crls)
+	}
+
+	if e.catalog != nil {
+		enrichers = append(enrichers, e.catalog)
+	}
+
+	if e.chains != nil {
+		enrichers = append(enrichers, e.chains)
+	}
+
+	return enrichers
+}
+
+// readCertPool reads a PEM file of certificates into a pool.
+func readCertPool(path string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// build returns the prefilter and filter for f. The prefilter is nil if no
+// filter needs one.
+func (f Filters) build(enrichment *enrichment, watchlist *watchlist) (func([]byte) bool, func(*x509.Certificate) bool, error) {
+	var publicKeys *filter.PublicKeys
+	if len(f.PublicKeys) > 0 {
+		var pemData []byte
+		for _, path := range f.PublicKeys {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("reading public keys: %w", err)
+			}
+			pemData = append(pemData, data...)
+			pemData = append(pemData, '\n')
+		}
+
+		var err error
+		publicKeys, err = filter.ParsePublicKeysPEM(pemData)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing public keys: %w", err)
+		}
+	}
+
+	var derFilters []func([]byte) bool
+	var publicKey func(*x509.Certificate) bool
+	if publicKeys != nil {
+		derFilters = append(derFilters, publicKeys.DERFilter())
+		publicKey = publicKeys.Filter()
+	}
+
+	if len(f.Serials) > 0 {
+		serials := make([]*big.Int, len(f.Serials))
+		for i, value := range f.Serials {
+			serial, err := parseHex(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing serial %q: %w", value, err)
+			}
+			serials[i] = new(big.Int).SetBytes(serial)
+		}
+
+		serialFilter, err := filter.SerialNumbers(serials...)
+		if err != nil {
+			return nil, nil, err
+		}
+		derFilters = append(derFilters, serialFilter)
+	}
+
+	for _, keyIDs := range []struct {
+		values []string
+		build  func(...[]byte) (func([]byte) bool, error)
+	}{
+		{f.SubjectKeyIDs, filter.SubjectKeyIDs},
+		{f.AuthorityKeyIDs, filter.AuthorityKeyIDs},
+	} {
+		if len(keyIDs.values) == 0 {
+			continue
+		}
+
+		ids := make([][]byte, len(keyIDs.values))
+		for i, value := range keyIDs.values {
+			var err error
+			ids[i], err = parseHex(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing key identifier %q: %w", value, err)
+			}
+		}
+
+		keyIDFilter, err := keyIDs.build(ids...)
+		if err != nil {
+			return nil, nil, err
+		}
+		derFilters = append(derFilters, keyIDFilter)
+	}
+
+	var derFilter func([]byte) bool
+	switch len(derFilters) {
+	case 0:
+	case 1:
+		derFilter = derFilters[0]
+	default:
+		derFilter = func(der []byte) bool {
+			for _, filter := range derFilters {
+				if !filter(der) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	var subjects []func(*x509.Certificate) bool
+	for _, subject := range f.Subjects {
+		var mode filter.SubjectMode
+		switch subject.Match {
+		case "", "exact":
+			mode = filter.SubjectExact
+		case "contains":
+			mode = filter.SubjectContains
+		default:
+			return nil, nil, fmt.Errorf("unknown subject match: %q", subject.Match)
+		}
+
+		subjectFilter, err := filter.Subject(subject.Attribute, mode, subject.Values...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("building subject filter: %w", err)
+		}
+		subjects = append(subjects, subjectFilter)
+	}
+
+	var extKeyUsage func(*x509.Certificate) bool
+	if len(f.ExtKeyUsages) > 0 {
+		usages := make([]asn1.ObjectIdentifier, len(f.ExtKeyUsages))
+		for i, name := range f.ExtKeyUsages {
+			var err error
+			usages[i], err = filter.ParseExtKeyUsage(name)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		var err error
+		extKeyUsage, err = filter.ExtKeyUsage(usages...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var ca func(*x509.Certificate) bool
+	switch {
+	case f.PathLen != "":
+		var err error
+		ca, err = parsePathLen(f.PathLen)
+		if err != nil {
+			return nil, nil, err
+		}
+	case f.CA:
+		ca = filter.CA()
+	}
+
+	var nameConstraints []func(*x509.Certificate) bool
+	if f.NameConstraintViolations != "" {
+		cas := enrich.NewIssuers()
+		err := cas.Load(f.NameConstraintViolations)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, ca := range cas.Known() {
+			constraints, err := filter.NewNameConstraints(ca)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", ca.Subject, err)
+			}
+			nameConstraints = append(nameConstraints, constraints.Filter())
+		}
+	}
+
+	var expiring func(*x509.Certificate) bool
+	if f.ExpiringWithin > 0 {
+		expiring = filter.ExpiringWithin(time.Duration(f.ExpiringWithin))
+	}
+
+	var keyReuse func(*x509.Certificate) bool
+	if f.KeyReuseSubjects > 0 || f.KeyReuseIssuers > 0 {
+		keyReuse = filter.NewKeyReuse().Filter(f.KeyReuseSubjects, f.KeyReuseIssuers)
+	}
+
+	var revocation func(*x509.Certificate) bool
+	switch f.Revocation {
+	case "":
+	case "revoked", "unrevoked":
+		if enrichment.crls == nil {
+			return nil, nil, errors.New("revocation filter requires CRLs")
+		}
+		status := enrich.CRLRevoked
+		if f.Revocation == "unrevoked" {
+			status = enrich.CRLUnrevoked
+		}
+		revocation = enrichment.crls.Filter(status)
+	default:
+		return nil, nil, fmt.Errorf("unknown revocation status: %q", f.Revocation)
+	}
+
+	var caOwner func(*x509.Certificate) bool
+	if len(f.CAOwners) > 0 {
+		if enrichment.catalog == nil {
+			return nil, nil, errors.New("CA owner filter requires a CCADB report")
+		}
+		caOwner = enrichment.catalog.Filter(f.CAOwners...)
+	}
+
+	var chainsToRoots func(*x509.Certificate) bool
+	if f.ChainsToRoots {
+		if enrichment.chains == nil {
+			return nil, nil, errors.New("chainsToRoots filter requires roots")
+		}
+		chainsToRoots = enrichment.chains.Filter()
+	}
+
+	certFilter := func(cert *x509.Certificate) bool {
+		if publicKey != nil && !publicKey(cert) {
+			return false
+		}
+		if len(f.IssuerOrganizations) > 0 && !anyEqual(cert.Issuer.Organization, f.IssuerOrganizations) {
+			return false
+		}
+		if len(subjects) > 0 && !anyMatch(subjects, cert) {
+			return false
+		}
+		if extKeyUsage != nil && !extKeyUsage(cert) {
+			return false
+		}
+		if ca != nil && !ca(cert) {
+			return false
+		}
+		if expiring != nil && !expiring(cert) {
+			return false
+		}
+		if len(f.Domains) > 0 || watchlist != nil {
+			if !matchesDomain(cert.DNSNames, f.Domains) && (watchlist == nil || !watchlist.matches(cert.DNSNames)) {
+				return false
+			}
+		}
+		if len(nameConstraints) > 0 && !anyMatch(nameConstraints, cert) {
+			return false
+		}
+		if revocation != nil && !revocation(cert) {
+			return false
+		}
+		if caOwner != nil && !caOwner(cert) {
+			return false
+		}
+		if chainsToRoots != nil && !chainsToRoots(cert) {
+			return false
+		}
+
+		// Key reuse is only tracked among certificates matching the rest
+		if keyReuse != nil && !keyReuse(cert) {
+			return false
+		}
+		return true
+	}
+
+	return derFilter, certFilter, nil
+}
+
+// buildBoulderLookup opens the database described by config, and returns a
+// lookup of its issuers in it.
+func (s *Search) buildBoulderLookup(config BoulderLookup) (*boulder.Lookup, error) {
+	if config.Driver == "" || config.DSN == "" || config.Issuers == "" {
+		return nil, errors.New("unknownToBoulder requires a driver, dsn, and issuers")
+	}
+
+	issuers := enrich.NewIssuers()
+	err := issuers.Load(config.Issuers)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(config.Driver, config.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	s.closers = append(s.closers, db)
+
+	return boulder.NewLookup(db, issuers.Known()...)
+}
+
+// ParseFingerprint returns the fingerprint function with the given name, as
+// listed for Cacher.Fingerprint. An empty name selects "sha256".
+func ParseFingerprint(name string) (x509search.Fingerprinter, error) {
+	switch name {
+	case "", "sha256":
+		return x509search.SHA256Fingerprint, nil
+	case "xxhash64":
+		return x509search.XXHash64Fingerprint, nil
+	case "tbs-sha256":
+		return x509search.TBSFingerprint, nil
+	case "issuer-serial":
+		return x509search.IssuerSerialFingerprint, nil
+	case "normalized-tbs":
+		return x509search.NormalizedTBSFingerprint, nil
+	default:
+		return nil, fmt.Errorf("unknown fingerprint: %q", name)
+	}
+}
+
+func (c Cacher) build() (x509search.Cacher, error) {
+	fingerprint, err := ParseFingerprint(c.Fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("cacher: %w", err)
+	}
+	withFingerprint := x509search.WithFingerprint(fingerprint)
+
+	switch c.Type {
+	case "", "none":
+		return x509search.NopCacher{}, nil
+	case "sha256":
+		return x509search.NewSha256MapCacher(withFingerprint), nil
+	case "sharded":
+		return x509search.NewShardedCacher(0, withFingerprint), nil
+	case "tbs":
+		return x509search.NewNormalizedTBSCacher(), nil
+	case "window":
+		if c.MaxAge <= 0 && c.MaxEntries <= 0 {
+			return nil, errors.New("window cacher requires maxAge or maxEntries")
+		}
+		return x509search.NewWindowCacher(time.Duration(c.MaxAge), c.MaxEntries, withFingerprint), nil
+	case "bloom":
+		if c.CountEstimate == 0 || c.FalsePositiveRate <= 0 || c.FalsePositiveRate >= 1 {
+			return nil, errors.New("bloom cacher requires countEstimate and a falsePositiveRate between 0 and 1")
+		}
+		return x509search.NewBloomCacher(c.CountEstimate, c.FalsePositiveRate, withFingerprint), nil
+	case "scalable-bloom":
+		if c.FalsePositiveRate <= 0 || c.FalsePositiveRate >= 1 {
+			return nil, errors.New("scalable-bloom cacher requires a falsePositiveRate between 0 and 1")
+		}
+		return x509search.NewScalableBloomCacher(c.CountEstimate, c.FalsePositiveRate, withFingerprint), nil
+	case "memcached":
+		memcached, err := cacher.NewMemcached(c.Servers, c.Prefix, time.Duration(c.TTL), 0, withFingerprint)
+		if err != nil {
+			return nil, fmt.Errorf("creating memcached cacher: %w", err)
+		}
+		return memcached, nil
+	case "disk":
+		if c.Path == "" {
+			return nil, errors.New("disk cacher requires path")
+		}
+		disk, err := cacher.OpenDisk(c.Path, cacher.DiskOptions{
+			ExpectedCount:     c.CountEstimate,
+			FalsePositiveRate: c.FalsePositiveRate,
+			CompactInterval:   time.Duration(c.CompactInterval),
+		}, withFingerprint)
+		if err != nil {
+			return nil, fmt.Errorf("opening disk cacher: %w", err)
+		}
+		return disk, nil
+	default:
+		return nil, fmt.Errorf("unknown cacher type: %q", c.Type)
+	}
+}
+
+func (s *Search) buildSinks(sinks []Sink, enrichment *enrichment) error {
+	for i, sinkConfig := range sinks {
+		// Database sinks manage their own connections
+		if sinkConfig.Type == "sqlite" || sinkConfig.Type == "postgres" {
+			built, err := s.buildDatabase(sinkConfig)
+			if err != nil {
+				return fmt.Errorf("sink %d: %w", i, err)
+			}
+			s.Sinks = append(s.Sinks, built)
+			continue
+		}
+
+		writer, err := s.openOutput(sinkConfig.Path)
+		if err != nil {
+			return fmt.Errorf("sink %d: %w", i, err)
+		}
+
+		var built x509search.Sink
+		switch sinkConfig.Type {
+		case "pem":
+			built = sink.NewPEM(writer)
+		case "template":
+			if sinkConfig.Template == "" {
+				return fmt.Errorf("sink %d: missing template", i)
+			}
+			built, err = sink.NewTemplate(writer, sinkConfig.Template)
+			if err != nil {
+				return fmt.Errorf("sink %d: %w", i, err)
+			}
+		case "aggregate":
+			dimensions, err := sink.ParseDimensions(sinkConfig.Dimensions)
+			if err != nil {
+				return fmt.Errorf("sink %d: %w", i, err)
+			}
+			built = sink.NewAggregate(writer, dimensions...)
+		case "audit":
+			built, err = s.buildAuditor(sinkConfig, writer, enrichment)
+			if err != nil {
+				return fmt.Errorf("sink %d: %w", i, err)
+			}
+		case "jsonl":
+			built, err = sink.NewJSONL(writer, sinkConfig.Fields)
+			if err != nil {
+				return fmt.Errorf("sink %d: %w", i, err)
+			}
+		case "zip":
+			built = sink.NewZip(writer, sinkConfig.DER)
+		case "der":
+			built = sink.NewDER(writer, sinkConfig.LengthPrefixed)
+		default:
+			return fmt.Errorf("sink %d: unknown type: %q", i, sinkConfig.Type)
+		}
+
+		if sinkConfig.OrderWindow != 0 {
+			built, err = sink.NewOrdered(built, time.Duration(sinkConfig.OrderWindow), sinkConfig.OrderMaxBuffered)
+			if err != nil {
+				return fmt.Errorf("sink %d: %w", i, err)
+			}
+		}
+
+		s.Sinks = append(s.Sinks, built)
+	}
+
+	return nil
+}
+
+// buildDatabase opens the database for a database sink, which is closed along
+// with the search.
+func (s *Search) buildDatabase(sinkConfig Sink) (x509search.Sink, error) {
+	if sinkConfig.Type == "postgres" {
+		if sinkConfig.DSN == "" {
+			return nil, errors.New("postgres sink requires a dsn")
+		}
+
+		db, err := sql.Open("postgres", sinkConfig.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("opening database: %w", err)
+		}
+		s.closers = append(s.closers, db)
+
+		table := sinkConfig.Table
+		if table == "" {
+			table = "certificates"
+		}
+
+		return sink.NewPostgres(db, table, 0)
+	}
+
+	if sinkConfig.Path == "" || sinkConfig.Path == "-" {
+		return nil, errors.New("sqlite sink requires a path")
+	}
+
+	driver := sinkConfig.Driver
+	if driver == "" {
+		driver = "sqlite"
+	}
+
+	db, err := sql.Open(driver, sinkConfig.Path)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	s.closers = append(s.closers, db)
+
+	return sink.NewSQLite(db)
+}
+
+// buildAuditor returns an "audit" sink writing its report to writer.
+func (s *Search) buildAuditor(sinkConfig Sink, writer io.Writer, enrichment *enrichment) (x509search.Sink, error) {
+	names := sinkConfig.Checks
+	if len(names) == 0 {
+		names = []string{"validity", "algorithms"}
+		if enrichment.chains != nil {
+			names = append(names, "chain")
+		}
+	}
+
+	var checks []audit.Check
+	for _, name := range names {
+		switch name {
+		case "validity":
+			checks = append(checks, audit.Validity(time.Duration(sinkConfig.MaxValidity)))
+		case "algorithms":
+			checks = append(checks, audit.Algorithms())
+		case "chain":
+			if enrichment.chains == nil {
+				return nil, errors.New("chain check requires roots")
+			}
+			checks = append(checks, audit.Chain(enrichment.chains))
+		default:
+			return nil, fmt.Errorf("unknown audit check: %q", name)
+		}
+	}
+
+	var summary io.Writer = os.Stderr
+	if sinkConfig.Summary != "" {
+		var err error
+		summary, err = s.openOutput(sinkConfig.Summary)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return audit.NewAuditor(writer, summary, checks...), nil
+}
+
+// openOutput opens path for writing, or returns stdout if path is empty or
+// "-".
+func (s *Search) openOutput(path string) (io.Writer, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating output file: %w", err)
+	}
+
+	s.closers = append(s.closers, file)
+	return file, nil
+}
+
+// parsePathLen returns the CA filter for a Filters.PathLen condition.
+func parsePathLen(condition string) (func(*x509.Certificate) bool, error) {
+	if condition == "unconstrained" {
+		return filter.CAUnconstrained(), nil
+	}
+
+	invalid := fmt.Errorf("invalid pathLen condition: %q", condition)
+	parse := func(s string) (int, error) {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			return 0, invalid
+		}
+		return n, nil
+	}
+
+	switch {
+	case strings.HasPrefix(condition, "<="):
+		max, err := parse(condition[2:])
+		if err != nil {
+			return nil, err
+		}
+		return filter.CAPathLen(0, max), nil
+	case strings.HasPrefix(condition, ">="):
+		min, err := parse(condition[2:])
+		if err != nil {
+			return nil, err
+		}
+		return filter.CAPathLen(min, -1), nil
+	}
+
+	low, high, isRange := strings.Cut(condition, "-")
+	min, err := parse(low)
+	if err != nil {
+		return nil, err
+	}
+	max := min
+	if isRange {
+		max, err = parse(high)
+		if err != nil || max < min {
+			return nil, invalid
+		}
+	}
+	return filter.CAPathLen(min, max), nil
+}
+
+// parseHex decodes a hexadecimal value, ignoring any colons or spaces
+// separating its bytes.
+func parseHex(value string) ([]byte, error) {
+	value = strings.NewReplacer(":", "", " ", "").Replace(value)
+	if len(value)%2 == 1 {
+		value = "0" + value
+	}
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return decoded, nil
+}
+
+// anyMatch reports whether cert matches any of filters.
+func anyMatch(filters []func(*x509.Certificate) bool, cert *x509.Certificate) bool {
+	for _, matches := range filters {
+		if matches(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyEqual reports whether values and candidates have an element in common.
+func anyEqual(values []string, candidates []string) bool {
+	for _, value := range values {
+		for _, candidate := range candidates {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
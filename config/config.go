@@ -0,0 +1,714 @@
+// Package config builds x509search searches from declarative YAML or JSON
+// documents, so that recurring searches can be kept under version control and
+// run without writing code.
+//
+// A configuration looks like this:
+//
+//	window:
+//	  last: 1h
+//	sources:
+//	  - type: static-ct
+//	    url: https://rome2025h1.fly.storage.tigris.dev/
+//	    precertificates: true
+//	    maxConnections: 10
+//	filters:
+//	  domains: [example.com]
+//	cacher:
+//	  type: sha256
+//	sinks:
+//	  - type: pem
+//	    path: matches.pem
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes a complete search.
+type Config struct {
+	// Window is the timespan to search.
+	Window Window `json:"window"`
+
+	// Sources lists the data sources to search.
+	Sources []Source `json:"sources"`
+
+	// Filters restricts which certificates match. If empty, every certificate
+	// matches.
+	Filters Filters `json:"filters"`
+
+	// Cacher selects how matches are de-duplicated.
+	Cacher Cacher `json:"cacher"`
+
+	// Sinks lists where matches are written. It may only be empty if the
+	// program running the search handles matches itself, as the reconcile
+	// command does.
+	Sinks []Sink `json:"sinks"`
+
+	// ErrorBehavior is either "cancel" (the default) or "continue", and
+	// corresponds to Search.DataSourceErrorBehavior.
+	ErrorBehavior string `json:"errorBehavior"`
+
+	// ParseFailures, if set, is a directory where certificates that can't be
+	// parsed are kept, along with their provenance. See
+	// sink.FailureDirectory.
+	ParseFailures string `json:"parseFailures"`
+
+	// DeduplicateSources drops certificates already found by another source
+	// before they reach the search, which saves parsing the copies found when
+	// searching several logs. See staticctapi.Deduplicator.
+	DeduplicateSources bool `json:"deduplicateSources"`
+
+	// Enrich selects additional information to attach to matches.
+	Enrich Enrich `json:"enrich"`
+
+	// UserAgent is sent with every request made by the search, to logs and
+	// by enrichers. If empty, x509search.DefaultUserAgent is used. Log
+	// operators ask monitors to identify themselves with contact details.
+	UserAgent string `json:"userAgent"`
+}
+
+// Enrich selects the enrichers run on each match. The annotations they make
+// are available to template sinks as .Provenance.Annotations.
+type Enrich struct {
+	// OCSP queries each match's OCSP responder for its revocation status. See
+	// enrich.OCSP.
+	OCSP bool `json:"ocsp"`
+
+	// Issuers lists PEM files of the issuing certificates of expected
+	// matches, needed to query OCSP responders, and of the intermediates
+	// needed to build chains to Roots.
+	Issuers []string `json:"issuers"`
+
+	// FetchIssuers fetches issuers that aren't listed in Issuers from each
+	// match's Authority Information Access URL.
+	FetchIssuers bool `json:"fetchIssuers"`
+
+	// CRLs lists the URLs or files of CRLs loaded before the search, and used
+	// to annotate matches with their revocation status. All of the shards of
+	// a partitioned CRL must be listed. If Issuers is set, each CRL must be
+	// signed by one of them. See enrich.CRLs.
+	CRLs []string `json:"crls"`
+
+	// CCADB is the URL or file of a CCADB certificate records report, used
+	// to annotate matches with their issuing CA operator. See enrich.Catalog
+	// and enrich.DefaultCCADBURL.
+	CCADB string `json:"ccadb"`
+
+	// Roots is a PEM file of trusted roots. If set, each match is annotated
+	// with whether it chains to one of them, using the intermediates in
+	// Issuers and those fetched when FetchIssuers is set. See enrich.Chains.
+	Roots string `json:"roots"`
+}
+
+// Window is the timespan to search. Either both Start and End, or Last, must
+// be set, unless Follow is set.
+type Window struct {
+	// Start is the inclusive start of the window.
+	Start time.Time `json:"start"`
+
+	// End is the inclusive end of the window.
+	End time.Time `json:"end"`
+
+	// Last defines the window as the given duration ending at the time the
+	// search is built, which suits searches that are run on a schedule.
+	Last Duration `json:"last"`
+
+	// ByNotBefore makes the window bound certificates' notBefore timestamps
+	// rather than the times they were logged, with the logs searched over the
+	// window widened by NotBeforeSlack. See
+	// staticctapi.DataSource.WindowByNotBefore.
+	ByNotBefore bool `json:"byNotBefore"`
+
+	// NotBeforeSlack widens the window searched when ByNotBefore is set.
+	NotBeforeSlack Duration `json:"notBeforeSlack"`
+
+	// Follow searches logs indefinitely, from Start, or Last before the time
+	// the search is built, onwards. If neither is set, only entries logged
+	// after the search starts are searched. End can't be set, and neither can
+	// ByNotBefore. See staticctapi.DataSource.Follow.
+	Follow bool `json:"follow"`
+
+	// PollInterval is how often followed logs are checked for new entries.
+	PollInterval Duration `json:"pollInterval"`
+}
+
+// Source describes a data source.
+type Source struct {
+	// Type selects the kind of data source: "static-ct", a log implementing
+	// the Static CT API; "boulder", the database of a Boulder CA, read from
+	// DSN with the database/sql driver named by Driver, see
+	// boulder.DataSource; "elasticsearch", the documents of an
+	// Elasticsearch or OpenSearch Index at URL matching Query, see
+	// elasticsearch.DataSource; or "mongodb", the documents of a MongoDB
+	// Collection in Database matching Query, connecting to DSN, see
+	// mongodb.DataSource.
+	Type string `json:"type"`
+
+	// Name identifies the source in messages, metrics, and the provenance of
+	// its matches. If empty, the source is named after URL.
+	Name string `json:"name"`
+
+	// Driver is the name of the database/sql driver a "boulder" source is
+	// read with, which the program must register. Boulder uses MySQL, for
+	// which the x509search command doesn't include a driver, so it can only
+	// read databases copied into SQLite, with the "sqlite" driver.
+	Driver string `json:"driver"`
+
+	// DSN is the connection string of a "boulder" source's database, or the
+	// mongodb:// or mongodb+srv:// URI of a "mongodb" source's deployment,
+	// which can set any of the driver's options, such as replicaSet or
+	// readPreference.
+	DSN string `json:"dsn"`
+
+	// Replicas are the connection strings of further copies of a "boulder"
+	// source's database, such as read replicas, opened with the same Driver.
+	// Queries are spread across them, failing over from one to another. See
+	// boulder.DataSource.Replicas.
+	Replicas []string `json:"replicas"`
+
+	// Database and Collection are the collection a "mongodb" source reads.
+	Database   string `json:"database"`
+	Collection string `json:"collection"`
+
+	// ResumeFile, if set, is where a "mongodb" source records how far it has
+	// read, so that the next search resumes from there.
+	ResumeFile string `json:"resumeFile"`
+
+	// BatchSize is the number of rows a "boulder" source reads per query, or
+	// documents an "elasticsearch" or "mongodb" source reads per request. A
+	// "boulder" source without one tunes it as it reads.
+	BatchSize int `json:"batchSize"`
+
+	// QueryTimeout, if set, bounds each query of a "boulder" source. See
+	// boulder.DataSource.QueryTimeout.
+	QueryTimeout Duration `json:"queryTimeout"`
+
+	// IssuedChunk, if set, makes a "boulder" source read rows by issued time,
+	// a chunk of the window of this length at a time, rather than by ID, and
+	// IndexHint, such as "USE INDEX (issued_idx)", follows the table name in
+	// its queries. See boulder.DataSource.IssuedChunk.
+	IssuedChunk Duration `json:"issuedChunk"`
+	IndexHint   string   `json:"indexHint"`
+
+	// JoinStatus makes a "boulder" source join the certificateStatus table,
+	// annotating its matches with their revocation status, and Unrevoked and
+	// Unexpired make it skip revoked and expired certificates in its
+	// queries. See boulder.DataSource.JoinStatus.
+	JoinStatus bool `json:"joinStatus"`
+	Unrevoked  bool `json:"unrevoked"`
+	Unexpired  bool `json:"unexpired"`
+
+	// CollapseBySerial makes a "boulder" source reading both precertificates
+	// and certificates skip precertificates whose final certificate it reads.
+	// See boulder.DataSource.CollapseBySerial.
+	CollapseBySerial bool `json:"collapseBySerial"`
+
+	// Partitions are the partitions or shards of a "boulder" source's
+	// tables, of which only those overlapping the window are queried. See
+	// boulder.DataSource.Partitions.
+	Partitions []Partition `json:"partitions"`
+
+	// URL is the monitoring prefix of the log, or the address of an
+	// "elasticsearch" source's cluster.
+	URL string `json:"url"`
+
+	// Index is the index, alias, or pattern an "elasticsearch" source reads.
+	Index string `json:"index"`
+
+	// Field is the field of each document holding a certificate, with the
+	// names of nested objects separated by dots. For "elasticsearch" sources,
+	// Encoding is how it's encoded: "base64" (the default), "hex", or "pem".
+	// For "mongodb" sources, it must be binary data.
+	Field    string `json:"field"`
+	Encoding string `json:"encoding"`
+
+	// Query selects the documents an "elasticsearch" source reads, in the
+	// query DSL, or a "mongodb" source reads, as a query filter. If empty,
+	// every document is read. These sources aren't restricted by the Window,
+	// which Query can do instead.
+	Query map[string]any `json:"query"`
+
+	// TimestampField, if set, is the field of each document holding the time
+	// it was recorded, used as the timestamp of its certificate.
+	TimestampField string `json:"timestampField"`
+
+	// ScrollTimeout is how long the cluster keeps an "elasticsearch"
+	// source's scroll open between requests.
+	ScrollTimeout Duration `json:"scrollTimeout"`
+
+	// Origin, if set, is the origin line the log's checkpoints must have. See
+	// staticctapi.Log.ExpectedOrigin.
+	Origin string `json:"origin"`
+
+	// Mirrors lists alternative monitoring prefixes serving the same log,
+	// tried when URL fails. See staticctapi.Log.Mirrors.
+	Mirrors []string `json:"mirrors"`
+
+	// Precertificates includes precertificates in the search.
+	Precertificates bool `json:"precertificates"`
+
+	// Certificates includes final certificates in the search.
+	Certificates bool `json:"certificates"`
+
+	// MaxConnections is the number of concurrent requests made to the log,
+	// or queries a "boulder" source runs.
+	MaxConnections int `json:"maxConnections"`
+
+	// Prefetch and PrefetchBytes let downloaded tiles queue up to be
+	// searched, bounded by count and by bytes of certificates. See
+	// staticctapi.DataSource.Prefetch.
+	Prefetch      int   `json:"prefetch"`
+	PrefetchBytes int64 `json:"prefetchBytes"`
+
+	// FailFast fails the source when a tile can't be fetched, instead of
+	// skipping the tile. See staticctapi.DataSource.FailFast.
+	FailFast bool `json:"failFast"`
+
+	// Clamp truncates the window to the log's entries instead of failing when
+	// the window extends beyond them. See staticctapi.DataSource.Clamp.
+	Clamp bool `json:"clamp"`
+
+	// Auth configures authentication to private mirrors of the log, or to an
+	// "elasticsearch" source's cluster. Sources with the same URL share a
+	// log, and so the first source's Auth.
+	Auth Auth `json:"auth"`
+}
+
+// Auth configures authentication to a log or cluster. Secrets are read from
+// files so they needn't be kept in the configuration itself.
+type Auth struct {
+	// Headers are sent with every request to the log.
+	Headers map[string]string `json:"headers"`
+
+	// BearerTokenFile is a file containing a bearer token sent with every
+	// request to the log.
+	BearerTokenFile string `json:"bearerTokenFile"`
+
+	// APIKeyFile is a file containing an Elasticsearch API key, in its
+	// encoded form, for "elasticsearch" sources.
+	APIKeyFile string `json:"apiKeyFile"`
+
+	// Username and PasswordFile, a file containing the password, configure
+	// basic authentication for "elasticsearch" sources, or authentication
+	// with the mechanism set in a "mongodb" source's DSN, SCRAM by default.
+	Username     string `json:"username"`
+	PasswordFile string `json:"passwordFile"`
+
+	// ClientCertificate and ClientKey are PEM files holding a client
+	// certificate and its private key, for mirrors requiring mutual TLS.
+	ClientCertificate string `json:"clientCertificate"`
+	ClientKey         string `json:"clientKey"`
+
+	// RootCAs is a PEM file of CA certificates trusted to authenticate the
+	// log, instead of the system roots.
+	RootCAs string `json:"rootCAs"`
+}
+
+// Partition is a partition or shard of a "boulder" source's table, holding
+// the rows issued from Start, inclusive, to End, exclusive, either of which
+// may be left out. See boulder.Partition.
+type Partition struct {
+	// Table is "precertificates" or "certificates".
+	Table string `json:"table"`
+
+	// Name is the name of the partition, or, if Sharded is set, of the table
+	// holding the shard.
+	Name    string `json:"name"`
+	Sharded bool   `json:"sharded"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Filters restricts which certificates match. Within each field, a
+// certificate must match at least one of the listed values; across fields, it
+// must match all fields that are set.
+type Filters struct {
+	// Domains matches certificates containing a DNS name equal to, or a
+	// subdomain of, one of the listed domains.
+	Domains []string `json:"domains"`
+
+	// DomainsFile is a watchlist file of further domains matched like those
+	// in Domains, one per line, with blank lines and lines starting with "#"
+	// ignored. The file can be changed while a search runs, and is re-read
+	// by Search.ReloadWatchlist.
+	DomainsFile string `json:"domainsFile"`
+
+	// PublicKeys lists PEM files of public keys, certificates, or private
+	// keys, and matches certificates for any of their keys, such as to find
+	// the certificates issued for a compromised key. Certificates for other
+	// keys are rejected without being parsed.
+	PublicKeys []string `json:"publicKeys"`
+
+	// Serials, SubjectKeyIDs, and AuthorityKeyIDs match certificates with one
+	// of the listed serial numbers, subject key identifiers, or authority key
+	// identifiers, each given in hexadecimal, optionally separated by colons
+	// or spaces, as printed by openssl. Like PublicKeys, they reject other
+	// certificates without parsing them.
+	Serials         []string `json:"serials"`
+	SubjectKeyIDs   []string `json:"subjectKeyIDs"`
+	AuthorityKeyIDs []string `json:"authorityKeyIDs"`
+
+	// LabeledWatchlist is a watchlist file of domains with labels, such as
+	// the customers watching them, in the CSV or JSON format read by
+	// filter.LoadWatchlist. It matches certificates for the domains like
+	// Domains, and annotates each match with the domains and labels it hit, in
+	// "watchlist.domains" and "watchlist.labels".
+	LabeledWatchlist string `json:"labeledWatchlist"`
+
+	// IssuerOrganizations matches certificates whose issuer has one of the
+	// listed organization names.
+	IssuerOrganizations []string `json:"issuerOrganizations"`
+
+	// Subjects matches certificates whose Subject has an attribute matching
+	// one of the listed SubjectFilters.
+	Subjects []SubjectFilter `json:"subjects"`
+
+	// ExtKeyUsages matches certificates asserting one of the listed extended
+	// key usages, each named as in RFC 5280, such as "codeSigning" or
+	// "OCSPSigning", or given as a dotted OID.
+	ExtKeyUsages []string `json:"extKeyUsages"`
+
+	// CA matches CA certificates, that is, those whose basic constraints
+	// assert cA.
+	CA bool `json:"ca"`
+
+	// PathLen matches CA certificates by their path length constraint, and
+	// is one of "N", "N-M", "<=N", or ">=N" for a constraint of N, between N
+	// and M, at most N, or at least N, or "unconstrained" for those without
+	// one. CAs without a constraint count as unbounded, so only match ">=N"
+	// and "unconstrained". Setting PathLen implies CA.
+	PathLen string `json:"pathLen"`
+
+	// Revocation is either "revoked" or "unrevoked", and matches
+	// certificates with that status in the CRLs listed in Enrich.CRLs.
+	// Certificates whose issuer has no CRL listed never match.
+	Revocation string `json:"revocation"`
+
+	// CAOwners matches certificates whose issuer belongs to one of the listed
+	// CA operators, according to the CCADB report named by Enrich.CCADB.
+	CAOwners []string `json:"caOwners"`
+
+	// NameConstraintViolations is a PEM file of name-constrained CA
+	// certificates, and matches certificates issued directly by one of them
+	// whose subject alternative names violate its name constraints. See
+	// filter.NameConstraints.
+	NameConstraintViolations string `json:"nameConstraintViolations"`
+
+	// UnknownToBoulder matches certificates claiming to be issued by one of
+	// a CA's issuers, of which its Boulder database has no record, and
+	// annotates each with whether its signature is valid. See
+	// boulder.Lookup.
+	UnknownToBoulder *BoulderLookup `json:"unknownToBoulder"`
+
+	// MaxLag and MaxLead match certificates recorded by their data source,
+	// such as in a CT log entry, more than MaxLag after their notBefore, or
+	// more than MaxLead before it, which points to backdated or postdated
+	// certificates, or delayed logging. Each is ignored if zero. See
+	// filter.TimestampSkew.
+	MaxLag  Duration `json:"maxLag"`
+	MaxLead Duration `json:"maxLead"`
+
+	// ExpiringWithin matches certificates that haven't expired, but will
+	// within this long, such as to find the certificates for Domains that are
+	// due for renewal.
+	ExpiringWithin Duration `json:"expiringWithin"`
+
+	// KeyReuseSubjects and KeyReuseIssuers match certificates whose public
+	// key has been seen, among the certificates matching the other filters,
+	// with at least that many distinct subjects or issuers, to find keys
+	// shared across unrelated certificates. Each is ignored if zero. See
+	// filter.KeyReuse.
+	KeyReuseSubjects int `json:"keyReuseSubjects"`
+	KeyReuseIssuers  int `json:"keyReuseIssuers"`
+
+	// ChainsToRoots matches certificates that chain to one of the roots in
+	// Enrich.Roots, which scopes a search to a single CA hierarchy. It's
+	// applied after the other filters, as it's the most expensive.
+	ChainsToRoots bool `json:"chainsToRoots"`
+}
+
+// SubjectFilter matches certificates by an attribute of their Subject.
+type SubjectFilter struct {
+	// Attribute is one of "CN", "serialNumber", "C", "O", or "OU".
+	Attribute string `json:"attribute"`
+
+	// Values are compared with each instance of the attribute, and the
+	// filter matches if any of them match.
+	Values []string `json:"values"`
+
+	// Match is "exact" (the default), or "contains", which matches values
+	// containing one of Values, ignoring case.
+	Match string `json:"match"`
+}
+
+// BoulderLookup describes a Boulder CA's database and issuers, for
+// Filters.UnknownToBoulder.
+type BoulderLookup struct {
+	// Driver and DSN are the database/sql driver and connection string of
+	// the database, as for a "boulder" Source.
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+
+	// Issuers is a PEM file of the CA's issuing certificates.
+	Issuers string `json:"issuers"`
+}
+
+// Cacher selects how matches are de-duplicated.
+type Cacher struct {
+	// Type is one of "none" (the default), "sha256", "sharded", "bloom",
+	// "scalable-bloom", "tbs", "window", "memcached", or "disk". A "sharded"
+	// cacher is a "sha256" cacher that is safe for concurrent use. A
+	// "scalable-bloom" cacher is a "bloom" cacher that grows as it fills,
+	// starting from CountEstimate if it's set. A "tbs" cacher treats a
+	// precertificate and its final certificate as the same match. A "window"
+	// cacher only suppresses duplicates within the window set by MaxAge and
+	// MaxEntries. A "memcached" cacher shares matches with other searches
+	// through the memcached Servers; see cacher.Memcached. A "disk" cacher
+	// keeps matches in the directory at Path, for more than fit in memory;
+	// see cacher.Disk.
+	Type string `json:"type"`
+
+	// CountEstimate is the expected number of matches, used to size a bloom
+	// cacher, the first layer of a scalable-bloom cacher, or a disk cacher's
+	// bloom filter.
+	CountEstimate uint `json:"countEstimate"`
+
+	// FalsePositiveRate is the target false-positive rate of a bloom or
+	// scalable-bloom cacher, or a disk cacher's bloom filter.
+	FalsePositiveRate float64 `json:"falsePositiveRate"`
+
+	// MaxAge is how long a window cacher remembers a match.
+	MaxAge Duration `json:"maxAge"`
+
+	// MaxEntries is how many matches a window cacher remembers.
+	MaxEntries int `json:"maxEntries"`
+
+	// Servers lists the host:port addresses of the memcached servers used by
+	// a memcached cacher.
+	Servers []string `json:"servers"`
+
+	// Prefix is prepended to the keys a memcached cacher stores, to keep
+	// unrelated searches sharing the servers apart.
+	Prefix string `json:"prefix"`
+
+	// TTL is how long a memcached cacher remembers a match. If TTL is zero,
+	// matches are remembered until memcached evicts them.
+	TTL Duration `json:"ttl"`
+
+	// Fingerprint selects what certificates are de-duplicated on, and is one
+	// of "sha256" (the default), the SHA-256 hash of the certificate;
+	// "xxhash64", a faster but not collision-resistant hash; "tbs-sha256",
+	// the SHA-256 hash of the TBSCertificate, ignoring the signature;
+	// "issuer-serial", the issuer and serial number; or "normalized-tbs", the
+	// SHA-256 hash of the TBSCertificate without its CT poison and SCT list
+	// extensions, as used by a "tbs" cacher, so that precertificates and their
+	// final certificates are the same match. It doesn't apply to a "tbs"
+	// cacher, which always uses "normalized-tbs".
+	Fingerprint string `json:"fingerprint"`
+
+	// Path is the directory a disk cacher keeps its files in. Matches are
+	// remembered across searches using the same directory.
+	Path string `json:"path"`
+
+	// CompactInterval, if set, is how often a disk cacher compacts its
+	// directory. See cacher.Disk for what compaction costs.
+	CompactInterval Duration `json:"compactInterval"`
+}
+
+// Sink describes where matches are written.
+type Sink struct {
+	// Type selects the output format, and is one of "pem", "template",
+	// "jsonl", "aggregate", "audit", "zip", "der", "sqlite", or "postgres". A
+	// "sqlite" sink writes to the database file at Path, using the
+	// database/sql driver named by Driver. A "postgres" sink writes to Table
+	// in the database at DSN. An "audit" sink writes the report of
+	// audit.Auditor as JSON to Path, and its summary to Summary.
+	Type string `json:"type"`
+
+	// Path is the file matches are written to. If Path is empty or "-",
+	// matches are written to stdout.
+	Path string `json:"path"`
+
+	// Template is the text/template used to render matches for the
+	// "template" type. See sink.Template for details.
+	Template string `json:"template"`
+
+	// Dimensions lists the names of the dimensions grouped by the "aggregate"
+	// type, as found in sink.Dimensions.
+	Dimensions []string `json:"dimensions"`
+
+	// Checks lists the checks run by the "audit" type, out of "validity",
+	// "algorithms", and "chain", which requires Enrich.Roots. If empty, all of
+	// them are run, except "chain" if Enrich.Roots isn't set.
+	Checks []string `json:"checks"`
+
+	// MaxValidity is the longest validity period the "validity" check allows
+	// subscriber certificates. If zero, audit.DefaultMaxValidity is used.
+	MaxValidity Duration `json:"maxValidity"`
+
+	// Summary is the file an "audit" sink writes its human-readable summary
+	// to. If empty, the summary is written to stderr, or if "-", to stdout.
+	Summary string `json:"summary"`
+
+	// Fields lists the fields written by the "jsonl" type. See sink.JSONL.
+	Fields []string `json:"fields"`
+
+	// DER stores certificates in DER rather than PEM form in a "zip" archive.
+	DER bool `json:"der"`
+
+	// LengthPrefixed precedes each certificate written by a "der" sink with
+	// its length. See sink.DER.
+	LengthPrefixed bool `json:"lengthPrefixed"`
+
+	// Driver is the name of the database/sql driver used by a "sqlite" sink,
+	// which must be registered by the program. If empty, "sqlite" is used,
+	// which is the name modernc.org/sqlite registers, as the x509search
+	// command does.
+	Driver string `json:"driver"`
+
+	// DSN is the connection string of a "postgres" sink's database.
+	DSN string `json:"dsn"`
+
+	// Table is the table a "postgres" sink inserts into. If empty,
+	// "certificates" is used. See sink.Postgres.
+	Table string `json:"table"`
+
+	// OrderWindow, if set, delivers matches to the sink in timestamp order
+	// within the given window. See sink.Ordered for details.
+	OrderWindow Duration `json:"orderWindow"`
+
+	// OrderMaxBuffered bounds the number of matches held for ordering.
+	OrderMaxBuffered int `json:"orderMaxBuffered"`
+}
+
+// Duration is a time.Duration that is written in configurations as a string
+// such as "90m" or "24h".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Parse parses a configuration document. YAML is a superset of JSON, so
+// documents in either format are accepted. Unknown fields are rejected.
+func Parse(data []byte) (*Config, error) {
+	// Decode YAML into generic values, then re-encode as JSON, so that a single
+	// set of struct tags and unmarshalers serves both formats
+	var generic any
+	err := yaml.Unmarshal(data, &generic)
+	if err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	if generic == nil {
+		return nil, errors.New("empty configuration")
+	}
+
+	jsonData, err := json.Marshal(generic)
+	if err != nil {
+		return nil, fmt.Errorf("converting configuration: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+
+	var config Config
+	err = decoder.Decode(&config)
+	if err != nil {
+		return nil, fmt.Errorf("decoding configuration: %w", err)
+	}
+
+	return &config, nil
+}
+
+// LoadFile reads and parses the configuration document at path.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading configuration: %w", err)
+	}
+
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+
+	return config, nil
+}
+
+// bounds returns the start and end of the window, relative to now if the
+// window is defined by Last.
+func (w Window) bounds(now time.Time) (time.Time, time.Time, error) {
+	if w.Follow {
+		if !w.End.IsZero() {
+			return time.Time{}, time.Time{}, errors.New("a followed window can't set end")
+		}
+		if w.ByNotBefore {
+			return time.Time{}, time.Time{}, errors.New("a followed window can't be by notBefore")
+		}
+		if w.Last != 0 && !w.Start.IsZero() {
+			return time.Time{}, time.Time{}, errors.New("window must set either last or start, not both")
+		}
+		if w.Last < 0 {
+			return time.Time{}, time.Time{}, errors.New("window last is negative")
+		}
+		if w.Last != 0 {
+			return now.Add(-time.Duration(w.Last)), time.Time{}, nil
+		}
+		return w.Start, time.Time{}, nil
+	}
+
+	if w.Last != 0 {
+		if !w.Start.IsZero() || !w.End.IsZero() {
+			return time.Time{}, time.Time{}, errors.New("window must set either last or start and end, not both")
+		}
+		if w.Last < 0 {
+			return time.Time{}, time.Time{}, errors.New("window last is negative")
+		}
+		return now.Add(-time.Duration(w.Last)), now, nil
+	}
+
+	if w.Start.IsZero() || w.End.IsZero() {
+		return time.Time{}, time.Time{}, errors.New("window must set either last or start and end")
+	}
+
+	return w.Start, w.End, nil
+}
+
+// matchesDomain reports whether any of names is one of domains or a subdomain
+// of one.
+func matchesDomain(names []string, domains []string) bool {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		for _, domain := range domains {
+			domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+			if name == domain || strings.HasSuffix(name, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
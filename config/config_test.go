@@ -0,0 +1,188 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	yamlConfig, err := Parse([]byte(`
+window:
+  last: 90m
+sources:
+  - type: static-ct
+    url: https://log.example/
+    precertificates: true
+    maxConnections: 4
+filters:
+  domains: [example.com]
+cacher:
+  type: sha256
+sinks:
+  - type: pem
+    path: matches.pem
+`))
+	if err != nil {
+		t.Fatalf("parsing YAML: %s", err)
+	}
+	if time.Duration(yamlConfig.Window.Last) != 90*time.Minute {
+		t.Errorf("window last is %s, want 90m", time.Duration(yamlConfig.Window.Last))
+	}
+	if len(yamlConfig.Sources) != 1 || yamlConfig.Sources[0].URL != "https://log.example/" || yamlConfig.Sources[0].MaxConnections != 4 {
+		t.Errorf("parsed sources %+v", yamlConfig.Sources)
+	}
+	if yamlConfig.Cacher.Type != "sha256" || len(yamlConfig.Sinks) != 1 || yamlConfig.Sinks[0].Path != "matches.pem" {
+		t.Errorf("parsed cacher %+v and sinks %+v", yamlConfig.Cacher, yamlConfig.Sinks)
+	}
+
+	// JSON is accepted as YAML
+	jsonConfig, err := Parse([]byte(`{"window": {"last": "1h"}, "filters": {"domains": ["example.com"]}}`))
+	if err != nil {
+		t.Fatalf("parsing JSON: %s", err)
+	}
+	if time.Duration(jsonConfig.Window.Last) != time.Hour || len(jsonConfig.Filters.Domains) != 1 {
+		t.Errorf("parsed JSON configuration %+v", jsonConfig)
+	}
+
+	for name, data := range map[string]string{
+		"empty":            "",
+		"unknown field":    "windw:\n  last: 1h\n",
+		"numeric duration": "window:\n  last: 3600\n",
+		"bad duration":     "window:\n  last: an hour\n",
+	} {
+		_, err := Parse([]byte(data))
+		if err == nil {
+			t.Errorf("parsing %s configuration succeeded", name)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search.yaml")
+	err := os.WriteFile(path, []byte("window:\n  last: bad\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors name the file they came from
+	_, err = LoadFile(path)
+	if err == nil || !strings.HasPrefix(err.Error(), "search.yaml: ") {
+		t.Errorf("loading an invalid file returned %v", err)
+	}
+}
+
+func TestWindowBounds(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	start := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 5, 2, 0, 0, 0, 0, time.UTC)
+
+	gotStart, gotEnd, err := Window{Last: Duration(time.Hour)}.bounds(now)
+	if err != nil || !gotStart.Equal(now.Add(-time.Hour)) || !gotEnd.Equal(now) {
+		t.Errorf("last 1h window is %s to %s (%v), want the hour before now", gotStart, gotEnd, err)
+	}
+
+	gotStart, gotEnd, err = Window{Start: start, End: end}.bounds(now)
+	if err != nil || !gotStart.Equal(start) || !gotEnd.Equal(end) {
+		t.Errorf("fixed window is %s to %s (%v), want %s to %s", gotStart, gotEnd, err, start, end)
+	}
+
+	for name, window := range map[string]Window{
+		"empty":         {},
+		"start only":    {Start: start},
+		"last and end":  {Last: Duration(time.Hour), End: end},
+		"negative last": {Last: Duration(-time.Hour)},
+	} {
+		_, _, err := window.bounds(now)
+		if err == nil {
+			t.Errorf("%s window is valid", name)
+		}
+	}
+}
+
+func TestMatchesDomain(t *testing.T) {
+	domains := []string{"Example.com."}
+	for name, want := range map[string]bool{
+		"example.com":         true,
+		"WWW.EXAMPLE.COM":     true,
+		"a.b.example.com":     true,
+		"notexample.com":      false,
+		"example.com.evil.io": false,
+	} {
+		if got := matchesDomain([]string{name}, domains); got != want {
+			t.Errorf("matchesDomain(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
+
+func TestCacherBuild(t *testing.T) {
+	for _, cacher := range []Cacher{
+		{},
+		{Type: "none"},
+		{Type: "sha256"},
+		{Type: "bloom", CountEstimate: 1000, FalsePositiveRate: 0.01},
+	} {
+		_, err := cacher.build()
+		if err != nil {
+			t.Errorf("building %+v: %s", cacher, err)
+		}
+	}
+
+	for _, cacher := range []Cacher{
+		{Type: "bloom"},
+		{Type: "bloom", CountEstimate: 1000, FalsePositiveRate: 1},
+		{Type: "lru"},
+	} {
+		_, err := cacher.build()
+		if err == nil {
+			t.Errorf("building %+v succeeded", cacher)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "matches.pem")
+	config := &Config{
+		Window:  Window{Last: Duration(time.Hour)},
+		Sources: []Source{{Type: "static-ct", URL: "https://log.example/", Certificates: true}},
+		Sinks:   []Sink{{Type: "pem", Path: path}},
+	}
+
+	search, err := config.Build(now)
+	if err != nil {
+		t.Fatalf("building search: %s", err)
+	}
+	if len(search.DataSources) != 1 {
+		t.Errorf("built %d data sources, want 1", len(search.DataSources))
+	}
+	err = search.Close()
+	if err != nil {
+		t.Errorf("closing search: %s", err)
+	}
+
+	// The sink's output file is created when the search is built
+	_, err = os.Stat(path)
+	if err != nil {
+		t.Errorf("output file: %s", err)
+	}
+
+	for name, modify := range map[string]func(*Config){
+		"no window":      func(c *Config) { c.Window = Window{} },
+		"no sources":     func(c *Config) { c.Sources = nil },
+		"unknown source": func(c *Config) { c.Sources = []Source{{Type: "ftp", URL: "ftp://log.example/"}} },
+		"missing url":    func(c *Config) { c.Sources = []Source{{Type: "static-ct"}} },
+		"unknown error":  func(c *Config) { c.ErrorBehavior = "retry" },
+		"unknown sink":   func(c *Config) { c.Sinks = []Sink{{Type: "csv"}} },
+	} {
+		invalid := *config
+		modify(&invalid)
+		search, err := invalid.Build(now)
+		if err == nil {
+			search.Close()
+			t.Errorf("building a search with %s succeeded", name)
+		}
+	}
+}
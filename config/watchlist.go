@@ -0,0 +1,94 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watchlist holds the domains read from Filters.DomainsFile, which may be
+// replaced while the search runs. It is safe for concurrent use.
+type watchlist struct {
+	path string
+
+	mu      sync.RWMutex
+	domains []string
+	modTime time.Time
+}
+
+// loadWatchlist reads the watchlist file at path.
+func loadWatchlist(path string) (*watchlist, error) {
+	w := &watchlist{path: path}
+
+	_, err := w.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// reload re-reads the watchlist file if it has been modified since it was
+// last read, and reports whether it was. If the file can't be read, the
+// previous domains are kept.
+func (w *watchlist) reload() (bool, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, fmt.Errorf("reading watchlist: %w", err)
+	}
+
+	w.mu.RLock()
+	unchanged := info.ModTime().Equal(w.modTime)
+	w.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	contents, err := os.ReadFile(w.path)
+	if err != nil {
+		return false, fmt.Errorf("reading watchlist: %w", err)
+	}
+
+	var domains []string
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return false, fmt.Errorf("reading watchlist: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.domains = domains
+	w.modTime = info.ModTime()
+	return true, nil
+}
+
+// len returns the number of domains in the watchlist.
+func (w *watchlist) len() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return len(w.domains)
+}
+
+// matches reports whether any of names is one of the watchlist's domains or a
+// subdomain of one.
+func (w *watchlist) matches(names []string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return matchesDomain(names, w.domains)
+}
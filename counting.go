@@ -0,0 +1,132 @@
+package x509search
+
+import (
+	"bytes"
+	"crypto/x509"
+	"sort"
+	"sync"
+)
+
+// CountingCacher de-duplicates certificates by fingerprint like ShardedCacher,
+// but also counts how many times each was seen, and from which data sources,
+// so that cross-logging can be analyzed rather than just suppressed. Only
+// certificates reaching the cacher are counted, that is, those matching the
+// search's filters.
+//
+// It holds a map per certificate on top of its fingerprint, so uses several
+// times the memory of a ShardedCacher. It is safe for concurrent use.
+type CountingCacher struct {
+	mu          sync.Mutex
+	certs       map[[32]byte]*certCount
+	fingerprint Fingerprinter
+}
+
+type certCount struct {
+	count   int
+	sources map[string]int
+}
+
+// CertificateCount describes how often a certificate was seen.
+type CertificateCount struct {
+	// Fingerprint is the certificate's fingerprint, by default the SHA-256
+	// hash of its DER encoding.
+	Fingerprint [32]byte
+
+	// Count is the number of times the certificate was seen.
+	Count int
+
+	// Sources counts the times the certificate was seen from each data
+	// source, keyed by the source's name, or by Metadata.Source if it doesn't
+	// have one. Certificates seen without either aren't counted here.
+	Sources map[string]int
+}
+
+func NewCountingCacher(opts ...CacherOption) *CountingCacher {
+	return &CountingCacher{
+		certs:       make(map[[32]byte]*certCount),
+		fingerprint: applyCacherOptions(opts).fingerprint,
+	}
+}
+
+// Cache counts the given certificate and returns whether it had been seen
+// before.
+func (c *CountingCacher) Cache(cert *x509.Certificate) bool {
+	return c.CacheFrom(cert.Raw, Metadata{})
+}
+
+// CacheRaw counts the certificate with the given DER bytes and returns
+// whether it had been seen before.
+func (c *CountingCacher) CacheRaw(der []byte) bool {
+	return c.CacheFrom(der, Metadata{})
+}
+
+// CacheFrom counts the certificate with the given DER bytes against the data
+// source described by metadata, and returns whether it had been seen before.
+func (c *CountingCacher) CacheFrom(der []byte, metadata Metadata) bool {
+	hash := c.fingerprint(der)
+
+	source := metadata.SourceName
+	if source == "" {
+		source = metadata.Source
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counted, present := c.certs[hash]
+	if !present {
+		counted = &certCount{}
+		c.certs[hash] = counted
+	}
+
+	counted.count++
+	if source != "" {
+		if counted.sources == nil {
+			counted.sources = make(map[string]int)
+		}
+		counted.sources[source]++
+	}
+
+	return present
+}
+
+// Len returns the number of distinct certificates seen.
+func (c *CountingCacher) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.certs)
+}
+
+// Counts returns the count of every certificate seen at least minCount times,
+// most often seen first, with ties ordered by fingerprint.
+func (c *CountingCacher) Counts(minCount int) []CertificateCount {
+	c.mu.Lock()
+	var counts []CertificateCount
+	for hash, counted := range c.certs {
+		if counted.count < minCount {
+			continue
+		}
+
+		sources := make(map[string]int, len(counted.sources))
+		for source, count := range counted.sources {
+			sources[source] = count
+		}
+
+		counts = append(counts, CertificateCount{
+			Fingerprint: hash,
+			Count:       counted.count,
+			Sources:     sources,
+		})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return bytes.Compare(counts[i].Fingerprint[:], counts[j].Fingerprint[:]) < 0
+	})
+
+	return counts
+}
@@ -0,0 +1,89 @@
+package crtsh
+
+import (
+	"context"
+	"crypto/x509"
+	"sort"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Collector is an x509search.Sink that records the serial numbers of a
+// search's matches for a later CrossCheck.
+type Collector struct {
+	matches map[string]*x509.Certificate
+}
+
+// NewCollector returns an empty Collector.
+func NewCollector() *Collector {
+	return &Collector{
+		matches: make(map[string]*x509.Certificate),
+	}
+}
+
+// Write records cert. A precertificate and its final certificate share a
+// serial number, and so are recorded once.
+func (c *Collector) Write(cert *x509.Certificate, _ x509search.Metadata) error {
+	c.matches[cert.SerialNumber.Text(16)] = cert
+	return nil
+}
+
+// Close does nothing.
+func (c *Collector) Close() error {
+	return nil
+}
+
+// Report describes the differences between a search's matches and crt.sh.
+type Report struct {
+	// Common is the number of certificates found by both.
+	Common int
+
+	// MissingFromCrtSh lists certificates the search found that crt.sh didn't
+	// return, ordered by serial number.
+	MissingFromCrtSh []*x509.Certificate
+
+	// MissingFromSearch lists certificates crt.sh returned that the search
+	// didn't find, ordered by serial number.
+	MissingFromSearch []Record
+}
+
+// CrossCheck queries crt.sh and compares the results with the matches
+// recorded by collector, pairing certificates by serial number. The query
+// should select the same certificates as the search's filters and window.
+func (c *Client) CrossCheck(ctx context.Context, query Query, collector *Collector) (Report, error) {
+	records, err := c.Search(ctx, query)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{}
+	found := make(map[string]bool)
+
+	for _, record := range records {
+		if found[record.Serial] {
+			continue
+		}
+		found[record.Serial] = true
+
+		if _, ok := collector.matches[record.Serial]; ok {
+			report.Common++
+			continue
+		}
+		report.MissingFromSearch = append(report.MissingFromSearch, record)
+	}
+
+	for serial, cert := range collector.matches {
+		if !found[serial] {
+			report.MissingFromCrtSh = append(report.MissingFromCrtSh, cert)
+		}
+	}
+
+	sort.Slice(report.MissingFromSearch, func(i, j int) bool {
+		return report.MissingFromSearch[i].Serial < report.MissingFromSearch[j].Serial
+	})
+	sort.Slice(report.MissingFromCrtSh, func(i, j int) bool {
+		return report.MissingFromCrtSh[i].SerialNumber.Cmp(report.MissingFromCrtSh[j].SerialNumber) < 0
+	})
+
+	return report, nil
+}
@@ -0,0 +1,225 @@
+// Package crtsh cross-checks search results against crt.sh, reporting
+// certificates found by a search that crt.sh doesn't know about and vice
+// versa. The discrepancies help gauge how well a search's chosen logs and time
+// window cover the certificates that exist for a given identity.
+package crtsh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// DefaultBaseURL is the address of the public crt.sh service.
+const DefaultBaseURL = "https://crt.sh/"
+
+// Client queries crt.sh.
+type Client struct {
+	// HTTPClient is used to make requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// UserAgent is sent with each request. If empty,
+	// x509search.DefaultUserAgent is used.
+	UserAgent string
+
+	// BaseURL is the address of the crt.sh instance. If empty, DefaultBaseURL
+	// is used.
+	BaseURL string
+}
+
+// Query selects certificates from crt.sh.
+type Query struct {
+	// Identities lists the identities to search for, in crt.sh syntax. For
+	// example, "example.com" matches that name, and "%.example.com" matches
+	// its subdomains.
+	Identities []string
+
+	// Start and End restrict results to certificates first logged within the
+	// timespan, matching the semantics of a search's time window. Either may
+	// be the zero value to leave that end of the window open.
+	Start time.Time
+	End   time.Time
+}
+
+// Record is a certificate known to crt.sh.
+type Record struct {
+	// ID is the crt.sh certificate ID.
+	ID int64
+
+	// Serial is the lowercase, hex-encoded serial number, without leading
+	// zeros.
+	Serial string
+
+	IssuerName string
+	CommonName string
+
+	// Names lists the identities crt.sh associates with the certificate.
+	Names []string
+
+	// EntryTimestamp is the time crt.sh first saw the certificate in a CT
+	// log.
+	EntryTimestamp time.Time
+
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// record mirrors the JSON output of crt.sh.
+type record struct {
+	ID             int64  `json:"id"`
+	SerialNumber   string `json:"serial_number"`
+	IssuerName     string `json:"issuer_name"`
+	CommonName     string `json:"common_name"`
+	NameValue      string `json:"name_value"`
+	EntryTimestamp string `json:"entry_timestamp"`
+	NotBefore      string `json:"not_before"`
+	NotAfter       string `json:"not_after"`
+}
+
+// Search returns the records matching query, de-duplicated across identities.
+// Precertificates and their final certificates are collapsed into a single
+// record.
+func (c *Client) Search(ctx context.Context, query Query) ([]Record, error) {
+	if len(query.Identities) == 0 {
+		return nil, errors.New("no identities to query")
+	}
+
+	seen := make(map[int64]bool)
+	records := []Record{}
+
+	for _, identity := range query.Identities {
+		results, err := c.search(ctx, identity)
+		if err != nil {
+			return nil, fmt.Errorf("querying crt.sh for %q: %w", identity, err)
+		}
+
+		for _, result := range results {
+			if seen[result.ID] {
+				continue
+			}
+			seen[result.ID] = true
+
+			if !query.Start.IsZero() && result.EntryTimestamp.Before(query.Start) {
+				continue
+			}
+			if !query.End.IsZero() && result.EntryTimestamp.After(query.End) {
+				continue
+			}
+
+			records = append(records, result)
+		}
+	}
+
+	return records, nil
+}
+
+func (c *Client) search(ctx context.Context, identity string) ([]Record, error) {
+	baseUrl := c.BaseURL
+	if baseUrl == "" {
+		baseUrl = DefaultBaseURL
+	}
+
+	queryUrl, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base URL: %w", err)
+	}
+
+	queryUrl.RawQuery = url.Values{
+		"q":           {identity},
+		"output":      {"json"},
+		"deduplicate": {"Y"},
+	}.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, queryUrl.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("building http request: %w", err)
+	}
+
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = x509search.DefaultUserAgent
+	}
+	request.Header.Set("User-Agent", userAgent)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("requesting results: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+
+	var raw []record
+	err = json.NewDecoder(response.Body).Decode(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("decoding results: %w", err)
+	}
+
+	records := make([]Record, 0, len(raw))
+	for _, r := range raw {
+		parsed, err := r.parse()
+		if err != nil {
+			return nil, fmt.Errorf("parsing record %d: %w", r.ID, err)
+		}
+		records = append(records, parsed)
+	}
+
+	return records, nil
+}
+
+func (r record) parse() (Record, error) {
+	serial, ok := new(big.Int).SetString(r.SerialNumber, 16)
+	if !ok {
+		return Record{}, fmt.Errorf("invalid serial number: %q", r.SerialNumber)
+	}
+
+	entryTimestamp, err := parseTimestamp(r.EntryTimestamp)
+	if err != nil {
+		return Record{}, fmt.Errorf("parsing entry timestamp: %w", err)
+	}
+
+	notBefore, err := parseTimestamp(r.NotBefore)
+	if err != nil {
+		return Record{}, fmt.Errorf("parsing notBefore: %w", err)
+	}
+
+	notAfter, err := parseTimestamp(r.NotAfter)
+	if err != nil {
+		return Record{}, fmt.Errorf("parsing notAfter: %w", err)
+	}
+
+	return Record{
+		ID:             r.ID,
+		Serial:         serial.Text(16),
+		IssuerName:     r.IssuerName,
+		CommonName:     r.CommonName,
+		Names:          strings.Split(r.NameValue, "\n"),
+		EntryTimestamp: entryTimestamp,
+		NotBefore:      notBefore,
+		NotAfter:       notAfter,
+	}, nil
+}
+
+// parseTimestamp parses the zone-less UTC timestamps used by crt.sh.
+func parseTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05", s, time.UTC)
+}
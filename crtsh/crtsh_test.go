@@ -0,0 +1,152 @@
+package crtsh
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// newFakeCrtSh serves results for each identity in results, in crt.sh's JSON
+// output format.
+func newFakeCrtSh(t *testing.T, results map[string][]record) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("output") != "json" {
+			t.Errorf("request without JSON output: %s", r.URL)
+		}
+
+		found, ok := results[query.Get("q")]
+		if !ok {
+			http.Error(w, "unknown identity", http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(found)
+	}))
+	t.Cleanup(server.Close)
+
+	return &Client{BaseURL: server.URL + "/"}
+}
+
+func TestSearch(t *testing.T) {
+	client := newFakeCrtSh(t, map[string][]record{
+		"example.com": {
+			{ID: 1, SerialNumber: "00ab", NameValue: "example.com\nwww.example.com", EntryTimestamp: "2025-01-01T12:00:00.123", NotBefore: "2025-01-01T11:00:00", NotAfter: "2025-04-01T11:00:00"},
+			{ID: 2, SerialNumber: "cd", NameValue: "example.com", EntryTimestamp: "2024-12-01T00:00:00"},
+		},
+		"%.example.com": {
+			{ID: 1, SerialNumber: "00ab", NameValue: "example.com\nwww.example.com", EntryTimestamp: "2025-01-01T12:00:00.123"},
+			{ID: 3, SerialNumber: "ef", NameValue: "a.example.com", EntryTimestamp: "2025-01-02T00:00:00"},
+		},
+	})
+
+	records, err := client.Search(context.Background(), Query{
+		Identities: []string{"example.com", "%.example.com"},
+		Start:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("searching: %s", err)
+	}
+
+	// Record 1 is returned for both identities but reported once, and record 2
+	// was logged before the window
+	var ids []int64
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	if !slices.Equal(ids, []int64{1, 3}) {
+		t.Fatalf("found records %d, want 1 and 3", ids)
+	}
+
+	first := records[0]
+	if first.Serial != "ab" {
+		t.Errorf("serial is %q, want it without leading zeros", first.Serial)
+	}
+	if !slices.Equal(first.Names, []string{"example.com", "www.example.com"}) {
+		t.Errorf("names are %q", first.Names)
+	}
+	if want := time.Date(2025, 1, 1, 12, 0, 0, 123000000, time.UTC); !first.EntryTimestamp.Equal(want) {
+		t.Errorf("entry timestamp is %s, want %s", first.EntryTimestamp, want)
+	}
+	if want := time.Date(2025, 4, 1, 11, 0, 0, 0, time.UTC); !first.NotAfter.Equal(want) {
+		t.Errorf("notAfter is %s, want %s", first.NotAfter, want)
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	client := newFakeCrtSh(t, map[string][]record{
+		"bad.example": {{ID: 1, SerialNumber: "not hex"}},
+	})
+
+	_, err := client.Search(context.Background(), Query{})
+	if err == nil {
+		t.Error("searching without identities succeeded")
+	}
+
+	_, err = client.Search(context.Background(), Query{Identities: []string{"unknown.example"}})
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("searching with a failing crt.sh returned %v", err)
+	}
+
+	_, err = client.Search(context.Background(), Query{Identities: []string{"bad.example"}})
+	if err == nil || !strings.Contains(err.Error(), "invalid serial number") {
+		t.Errorf("searching with an invalid record returned %v", err)
+	}
+}
+
+func TestCrossCheck(t *testing.T) {
+	client := newFakeCrtSh(t, map[string][]record{
+		"example.com": {
+			{ID: 1, SerialNumber: "01"},
+			{ID: 2, SerialNumber: "02"},
+			// A precertificate and its final certificate share a serial
+			{ID: 3, SerialNumber: "03"},
+			{ID: 4, SerialNumber: "03"},
+			{ID: 5, SerialNumber: "05"},
+		},
+	})
+
+	collector := NewCollector()
+	for _, serial := range []int64{1, 3, 4, 6} {
+		cert := &x509.Certificate{SerialNumber: big.NewInt(serial)}
+		err := collector.Write(cert, x509search.Metadata{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := client.CrossCheck(context.Background(), Query{Identities: []string{"example.com"}}, collector)
+	if err != nil {
+		t.Fatalf("cross-checking: %s", err)
+	}
+
+	if report.Common != 2 {
+		t.Errorf("found %d certificates in common, want 2", report.Common)
+	}
+
+	var missingFromSearch []string
+	for _, record := range report.MissingFromSearch {
+		missingFromSearch = append(missingFromSearch, record.Serial)
+	}
+	if !slices.Equal(missingFromSearch, []string{"2", "5"}) {
+		t.Errorf("missing from search: %q, want 2 and 5", missingFromSearch)
+	}
+
+	var missingFromCrtSh []int64
+	for _, cert := range report.MissingFromCrtSh {
+		missingFromCrtSh = append(missingFromCrtSh, cert.SerialNumber.Int64())
+	}
+	if !slices.Equal(missingFromCrtSh, []int64{4, 6}) {
+		t.Errorf("missing from crt.sh: %d, want 4 and 6", missingFromCrtSh)
+	}
+}
@@ -0,0 +1,357 @@
+// Package elasticsearch provides a data source reading certificates from an
+// Elasticsearch or OpenSearch index, for collections kept in a SIEM or a
+// similar document store. It uses the scroll API over plain HTTP, which both
+// implement, rather than a client library.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+const (
+	// DefaultBatchSize is the number of documents a DataSource reads per
+	// request when BatchSize is zero.
+	DefaultBatchSize = 1000
+
+	// DefaultScrollTimeout is how long the index keeps a DataSource's scroll
+	// open between requests when ScrollTimeout is zero.
+	DefaultScrollTimeout = 5 * time.Minute
+
+	// DefaultTimeout bounds each request, including reading its response,
+	// made by a DataSource without an HTTPClient.
+	DefaultTimeout = time.Minute
+
+	// maxResponseSize bounds the size of a response, which holds a batch of
+	// certificates.
+	maxResponseSize = 256 << 20
+)
+
+// defaultClient makes the requests of a DataSource without an HTTPClient, so
+// that a cluster that stops responding fails the search rather than stalling
+// it.
+var defaultClient = &http.Client{Timeout: DefaultTimeout}
+
+// Hit identifies the document a certificate was read from, and is the Payload
+// of the metadata of each certificate a DataSource finds.
+type Hit struct {
+	Index string
+	ID    string
+}
+
+// DataSource is an x509search.Sourcer reading certificates from the documents
+// of an index matching a query.
+type DataSource struct {
+	// URL is the address of the cluster, such as "https://localhost:9200".
+	URL string
+
+	// Index is the index, alias, or comma-separated list or pattern of
+	// indices searched.
+	Index string
+
+	// Field is the field of each document holding a certificate, with the
+	// names of nested objects separated by dots, such as "tls.server.der".
+	// Documents without it are skipped.
+	Field string
+
+	// Encoding is how certificates are encoded in Field: "base64" (the
+	// default), as Elasticsearch stores binary fields; "hex"; or "pem".
+	Encoding string
+
+	// Query is the query selecting the documents, in the query DSL, such as
+	// {"range": {"@timestamp": {"gte": "now-1d"}}}. If empty, every document
+	// is read.
+	Query json.RawMessage
+
+	// TimestampField, if set, is the field of each document holding the time
+	// it was recorded, in RFC 3339 format, which is used as the Timestamp of
+	// its certificate's metadata.
+	TimestampField string
+
+	// BatchSize is the number of documents read per request. If zero,
+	// DefaultBatchSize is used.
+	BatchSize int
+
+	// ScrollTimeout is how long the cluster keeps the scroll open between
+	// requests. If zero, DefaultScrollTimeout is used.
+	ScrollTimeout time.Duration
+
+	// SourceName identifies the data source. If empty, it's named after URL
+	// and Index.
+	SourceName string
+
+	// HTTPClient makes the requests. If nil, a client whose requests time out
+	// after DefaultTimeout is used.
+	HTTPClient *http.Client
+
+	// Header is sent with every request, such as an Authorization header with
+	// an API key.
+	Header http.Header
+
+	// UserAgent is sent with every request. If empty,
+	// x509search.DefaultUserAgent is used.
+	UserAgent string
+}
+
+func (d DataSource) Name() string {
+	if d.SourceName != "" {
+		return d.SourceName
+	}
+	return strings.TrimSuffix(d.URL, "/") + "/" + d.Index
+}
+
+// searchResponse mirrors the parts of a search or scroll response used here.
+type searchResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			Index  string          `json:"_index"`
+			ID     string          `json:"_id"`
+			Source json.RawMessage `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// Source sends the DER bytes of the certificates found over certs.
+func (d DataSource) Source(ctx context.Context, certs chan<- []byte) error {
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.SourceEntries(ctx, entries)
+		close(entries)
+	}()
+
+	for entry := range entries {
+		select {
+		case certs <- entry.DER:
+		case <-ctx.Done():
+		}
+	}
+	return <-done
+}
+
+// SourceEntries sends the certificates found over entries, each with its
+// document as its Payload. Documents whose certificates can't be decoded are
+// reported on stderr and skipped.
+func (d DataSource) SourceEntries(ctx context.Context, entries chan<- x509search.Entry) error {
+	if d.URL == "" || d.Index == "" || d.Field == "" {
+		return errors.New("missing URL, index, or field")
+	}
+
+	decode, err := decoder(d.Encoding)
+	if err != nil {
+		return err
+	}
+
+	batchSize := d.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	scrollTimeout := d.ScrollTimeout
+	if scrollTimeout <= 0 {
+		scrollTimeout = DefaultScrollTimeout
+	}
+	keepAlive := fmt.Sprintf("%ds", int(scrollTimeout.Seconds()))
+
+	sourceFields := []string{d.Field}
+	if d.TimestampField != "" {
+		sourceFields = append(sourceFields, d.TimestampField)
+	}
+
+	body := map[string]any{
+		"size":    batchSize,
+		"_source": sourceFields,
+		"sort":    []string{"_doc"},
+	}
+	if len(d.Query) > 0 {
+		body["query"] = d.Query
+	}
+
+	var response searchResponse
+	err = d.request(ctx, http.MethodPost, "/"+url.PathEscape(d.Index)+"/_search?scroll="+keepAlive, body, &response)
+	if err != nil {
+		return fmt.Errorf("searching %s: %w", d.Index, err)
+	}
+
+	defer func() {
+		if response.ScrollID == "" {
+			return
+		}
+
+		// Free the scroll's resources on the cluster, even if ctx is done
+		clearCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		err := d.request(clearCtx, http.MethodDelete, "/_search/scroll", map[string]any{"scroll_id": response.ScrollID}, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: clearing scroll: %s\n", d.Name(), err.Error())
+		}
+	}()
+
+	for len(response.Hits.Hits) > 0 {
+		for _, hit := range response.Hits.Hits {
+			var document map[string]any
+			err := json.Unmarshal(hit.Source, &document)
+			if err != nil {
+				return fmt.Errorf("parsing document %s: %w", hit.ID, err)
+			}
+
+			value, ok := lookup(document, d.Field).(string)
+			if !ok {
+				continue
+			}
+
+			der, err := decode(value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: decoding certificate in document %s: %s\n", d.Name(), hit.ID, err.Error())
+				continue
+			}
+
+			metadata := x509search.Metadata{
+				Source:  d.Name(),
+				Index:   -1,
+				Payload: Hit{Index: hit.Index, ID: hit.ID},
+			}
+			if d.TimestampField != "" {
+				timestamp, ok := lookup(document, d.TimestampField).(string)
+				if ok {
+					metadata.Timestamp, _ = time.Parse(time.RFC3339Nano, timestamp)
+				}
+			}
+
+			select {
+			case entries <- x509search.Entry{DER: der, Metadata: metadata}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		scrollID := response.ScrollID
+		response = searchResponse{}
+		err = d.request(ctx, http.MethodPost, "/_search/scroll", map[string]any{"scroll": keepAlive, "scroll_id": scrollID}, &response)
+		if err != nil {
+			response.ScrollID = scrollID
+			return fmt.Errorf("scrolling %s: %w", d.Index, err)
+		}
+	}
+
+	return nil
+}
+
+// request sends body as JSON to path, and decodes the response into result
+// unless it's nil.
+func (d DataSource) request(ctx context.Context, method string, path string, body any, result any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding request: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(d.URL, "/")+path, bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	for name, values := range d.Header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	userAgent := d.UserAgent
+	if userAgent == "" {
+		userAgent = x509search.DefaultUserAgent
+	}
+	request.Header.Set("User-Agent", userAgent)
+
+	client := d.HTTPClient
+	if client == nil {
+		client = defaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("making request: %w", err)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize+1))
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	if len(data) > maxResponseSize {
+		return errors.New("response body too large")
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status: %s: %s", response.Status, bytes.TrimSpace(data))
+	}
+
+	if result == nil {
+		return nil
+	}
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the value of a field of document, with the names of nested
+// objects separated by dots. Fields whose names contain dots are also found,
+// as Elasticsearch treats them the same as nested objects.
+func lookup(document map[string]any, field string) any {
+	value, ok := document[field]
+	if ok {
+		return value
+	}
+
+	for i := range field {
+		if field[i] != '.' {
+			continue
+		}
+
+		nested, ok := document[field[:i]].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		value := lookup(nested, field[i+1:])
+		if value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// decoder returns the function decoding certificates in the given encoding.
+func decoder(encoding string) (func(string) ([]byte, error), error) {
+	switch encoding {
+	case "", "base64":
+		return base64.StdEncoding.DecodeString, nil
+	case "hex":
+		return hex.DecodeString, nil
+	case "pem":
+		return func(value string) ([]byte, error) {
+			block, _ := pem.Decode([]byte(value))
+			if block == nil {
+				return nil, errors.New("no PEM block found")
+			}
+			return block.Bytes, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding: %q", encoding)
+	}
+}
@@ -0,0 +1,198 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// fakeCluster serves the scroll API over pages of documents, each a
+// certificate in "tls.der" and the time it was recorded in "@timestamp".
+type fakeCluster struct {
+	t     *testing.T
+	pages [][]string
+
+	// failScroll fails the scroll requests with a 500.
+	failScroll bool
+
+	mu      sync.Mutex
+	cleared []string
+}
+
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		c.t.Errorf("decoding request body: %s", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := 0
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/certs/_search":
+		if r.URL.Query().Get("scroll") == "" {
+			c.t.Errorf("search without a scroll: %s", r.URL)
+		}
+	case r.Method == http.MethodPost && r.URL.Path == "/_search/scroll":
+		if c.failScroll {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+
+		// Each page's scroll ID is the number of the page that follows
+		_, err := fmt.Sscanf(fmt.Sprint(body["scroll_id"]), "scroll-%d", &page)
+		if err != nil {
+			c.t.Errorf("scrolling with unknown ID %v", body["scroll_id"])
+		}
+	case r.Method == http.MethodDelete && r.URL.Path == "/_search/scroll":
+		c.mu.Lock()
+		c.cleared = append(c.cleared, fmt.Sprint(body["scroll_id"]))
+		c.mu.Unlock()
+		return
+	default:
+		c.t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+		return
+	}
+
+	hits := []map[string]any{}
+	if page < len(c.pages) {
+		for _, id := range c.pages[page] {
+			hits = append(hits, map[string]any{
+				"_index": "certs",
+				"_id":    id,
+				"_source": map[string]any{
+					"tls":        map[string]any{"der": base64.StdEncoding.EncodeToString([]byte("certificate " + id))},
+					"@timestamp": "2025-01-01T00:00:00Z",
+				},
+			})
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"_scroll_id": fmt.Sprintf("scroll-%d", page+1),
+		"hits":       map[string]any{"hits": hits},
+	})
+}
+
+func (c *fakeCluster) clearedScrolls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.cleared)
+}
+
+func newFakeCluster(t *testing.T, cluster *fakeCluster) DataSource {
+	t.Helper()
+
+	cluster.t = t
+	server := httptest.NewServer(cluster)
+	t.Cleanup(server.Close)
+
+	return DataSource{
+		URL:            server.URL,
+		Index:          "certs",
+		Field:          "tls.der",
+		TimestampField: "@timestamp",
+		BatchSize:      2,
+	}
+}
+
+// read returns every entry d sends, and the error it returns.
+func read(d DataSource) ([]x509search.Entry, error) {
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.SourceEntries(context.Background(), entries)
+		close(entries)
+	}()
+
+	var found []x509search.Entry
+	for entry := range entries {
+		found = append(found, entry)
+	}
+	return found, <-done
+}
+
+func TestSourceEntriesScrolls(t *testing.T) {
+	cluster := &fakeCluster{pages: [][]string{{"a", "b"}, {"c", "d"}, {"e"}}}
+	d := newFakeCluster(t, cluster)
+
+	found, err := read(d)
+	if err != nil {
+		t.Fatalf("reading certificates: %s", err)
+	}
+
+	var ids []string
+	for _, entry := range found {
+		hit, _ := x509search.PayloadAs[Hit](entry.Metadata)
+		ids = append(ids, hit.ID)
+
+		if string(entry.DER) != "certificate "+hit.ID {
+			t.Errorf("document %s: read certificate %q", hit.ID, entry.DER)
+		}
+		if !entry.Metadata.Timestamp.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("document %s: read timestamp %s", hit.ID, entry.Metadata.Timestamp)
+		}
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !slices.Equal(ids, want) {
+		t.Errorf("read documents %q, want %q", ids, want)
+	}
+
+	// The scroll is cleared once the pages run out
+	if cleared := cluster.clearedScrolls(); !slices.Equal(cleared, []string{"scroll-4"}) {
+		t.Errorf("cleared scrolls %q, want the last one", cleared)
+	}
+}
+
+func TestSourceEntriesClearsFailedScroll(t *testing.T) {
+	cluster := &fakeCluster{pages: [][]string{{"a", "b"}, {"c"}}, failScroll: true}
+	d := newFakeCluster(t, cluster)
+
+	found, err := read(d)
+	if err == nil || !strings.Contains(err.Error(), "scrolling certs") {
+		t.Errorf("reading with failing scrolls returned %v", err)
+	}
+	if len(found) != 2 {
+		t.Errorf("read %d certificates before the scroll failed, want 2", len(found))
+	}
+
+	// The scroll that couldn't be continued is still cleared
+	if cleared := cluster.clearedScrolls(); !slices.Equal(cleared, []string{"scroll-1"}) {
+		t.Errorf("cleared scrolls %q, want the failed one", cleared)
+	}
+}
+
+func TestSourceEntriesClearsCancelledScroll(t *testing.T) {
+	cluster := &fakeCluster{pages: [][]string{{"a", "b"}, {"c"}}}
+	d := newFakeCluster(t, cluster)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.SourceEntries(ctx, entries)
+	}()
+
+	// Stop after the first certificate
+	<-entries
+	cancel()
+
+	err := <-done
+	if err != context.Canceled {
+		t.Errorf("cancelled read returned %v", err)
+	}
+	if cleared := cluster.clearedScrolls(); !slices.Equal(cleared, []string{"scroll-1"}) {
+		t.Errorf("cleared scrolls %q, want the open one", cleared)
+	}
+}
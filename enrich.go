@@ -0,0 +1,16 @@
+package x509search
+
+import (
+	"context"
+	"crypto/x509"
+)
+
+// Enricher attaches additional information about a match to its metadata,
+// typically from an external service, before the match is passed to the
+// search's callbacks and sinks.
+type Enricher interface {
+	// Enrich records information about cert in metadata, usually with
+	// Metadata.Annotate. If Enrich returns an error, it's reported on stderr
+	// and the match is delivered with whatever annotations were made.
+	Enrich(ctx context.Context, cert *x509.Certificate, metadata *Metadata) error
+}
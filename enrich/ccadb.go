@@ -0,0 +1,219 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// DefaultCCADBURL is the location of the CCADB report listing every root and
+// intermediate certificate record.
+const DefaultCCADBURL = "https://ccadb.my.salesforce-sites.com/ccadb/AllCertificateRecordsCSVFormatv4"
+
+// maxCCADBSize bounds the size of a CCADB report fetched over HTTP.
+const maxCCADBSize = 1 << 28
+
+// CARecord describes a CA certificate listed in the CCADB.
+type CARecord struct {
+	// Owner is the CA operator responsible for the certificate: its
+	// subordinate CA owner if it has one, and otherwise its CA owner.
+	Owner string
+
+	// Name is the CCADB's name for the certificate.
+	Name string
+
+	// Fingerprint is the hex-encoded SHA-256 fingerprint of the certificate.
+	Fingerprint string
+}
+
+// Catalog maps issuing CA certificates to the CA operators responsible for
+// them, as recorded in the CCADB, so that matches can be grouped by who
+// issued them. Matches are attributed by their authority key identifier, or,
+// when the issuing certificate itself is at hand, by its public key.
+//
+// A Catalog is read-only once loaded, and so is safe for concurrent use.
+type Catalog struct {
+	bySKID map[string]CARecord
+	bySPKI map[[32]byte]CARecord
+}
+
+// ccadbColumns are the CCADB report columns a Catalog is built from. The
+// report's PEM column is optional, and provides the public keys.
+var ccadbColumns = struct {
+	owner, subordinateOwner, name, fingerprint, skid, pem string
+}{
+	owner:            "CA Owner",
+	subordinateOwner: "Subordinate CA Owner",
+	name:             "Certificate Name",
+	fingerprint:      "SHA-256 Fingerprint",
+	skid:             "Subject Key Identifier",
+	pem:              "X.509 Certificate (PEM)",
+}
+
+// ParseCCADB builds a Catalog from a CCADB certificate records report in CSV
+// format, such as the one at DefaultCCADBURL.
+func ParseCCADB(r io.Reader) (*Catalog, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CCADB header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	for _, required := range []string{ccadbColumns.owner, ccadbColumns.fingerprint, ccadbColumns.skid} {
+		_, ok := columns[required]
+		if !ok {
+			return nil, fmt.Errorf("CCADB report has no %q column", required)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	catalog := &Catalog{
+		bySKID: make(map[string]CARecord),
+		bySPKI: make(map[[32]byte]CARecord),
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CCADB record: %w", err)
+		}
+
+		record := CARecord{
+			Owner:       field(row, ccadbColumns.subordinateOwner),
+			Name:        field(row, ccadbColumns.name),
+			Fingerprint: strings.ToLower(field(row, ccadbColumns.fingerprint)),
+		}
+		if record.Owner == "" {
+			record.Owner = field(row, ccadbColumns.owner)
+		}
+
+		skid, err := decodeKeyID(field(row, ccadbColumns.skid))
+		if err == nil && len(skid) > 0 {
+			catalog.bySKID[string(skid)] = record
+		}
+
+		block, _ := pem.Decode([]byte(field(row, ccadbColumns.pem)))
+		if block != nil {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				catalog.bySPKI[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] = record
+			}
+		}
+	}
+
+	return catalog, nil
+}
+
+// LoadCCADB builds a Catalog from the CCADB report at source, which is either
+// an HTTP or HTTPS URL or the path of a file. If client is nil,
+// http.DefaultClient is used. Requests are sent with
+// x509search.DefaultUserAgent.
+func LoadCCADB(ctx context.Context, client *http.Client, source string) (*Catalog, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = get(ctx, client, "", source, maxCCADBSize)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading CCADB report from %s: %w", source, err)
+	}
+
+	return ParseCCADB(bytes.NewReader(data))
+}
+
+// decodeKeyID decodes a key identifier as written in the CCADB, which may be
+// base64 or (optionally colon-separated) hex.
+func decodeKeyID(value string) ([]byte, error) {
+	compact := strings.ReplaceAll(value, ":", "")
+	if len(compact)%2 == 0 {
+		decoded, err := hex.DecodeString(compact)
+		if err == nil {
+			return decoded, nil
+		}
+	}
+
+	return base64.StdEncoding.DecodeString(value)
+}
+
+// Issuer returns the CCADB record of cert's issuer, found by its authority
+// key identifier.
+func (c *Catalog) Issuer(cert *x509.Certificate) (CARecord, bool) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return CARecord{}, false
+	}
+
+	record, ok := c.bySKID[string(cert.AuthorityKeyId)]
+	return record, ok
+}
+
+// IssuerByKey returns the CCADB record of a CA certificate with the same
+// public key as issuer. Keys are only known if the report includes PEM.
+func (c *Catalog) IssuerByKey(issuer *x509.Certificate) (CARecord, bool) {
+	record, ok := c.bySPKI[sha256.Sum256(issuer.RawSubjectPublicKeyInfo)]
+	return record, ok
+}
+
+// Filter returns a filter matching certificates issued by a CA certificate
+// belonging to one of owners, compared case-insensitively.
+func (c *Catalog) Filter(owners ...string) func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		record, ok := c.Issuer(cert)
+		if !ok {
+			return false
+		}
+
+		for _, owner := range owners {
+			if strings.EqualFold(record.Owner, owner) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Enrich annotates a match with its issuer's CCADB record. It sets
+// "ccadb.owner", "ccadb.issuer", and "ccadb.issuerFingerprint", or nothing if
+// the issuer isn't in the catalog.
+func (c *Catalog) Enrich(_ context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	record, ok := c.Issuer(cert)
+	if !ok {
+		return nil
+	}
+
+	metadata.Annotate("ccadb.owner", record.Owner)
+	metadata.Annotate("ccadb.issuer", record.Name)
+	metadata.Annotate("ccadb.issuerFingerprint", record.Fingerprint)
+	return nil
+}
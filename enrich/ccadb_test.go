@@ -0,0 +1,127 @@
+package enrich
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// ccadbReport returns a CCADB report in CSV format listing the given CA
+// certificates, with the owners and subordinate owners given.
+func ccadbReport(t *testing.T, cas []*x509.Certificate, owners, subordinateOwners []string) string {
+	t.Helper()
+
+	var report strings.Builder
+	w := csv.NewWriter(&report)
+	w.Write([]string{"CA Owner", "Subordinate CA Owner", "Certificate Name", "SHA-256 Fingerprint", "Subject Key Identifier", "X.509 Certificate (PEM)"})
+	for i, ca := range cas {
+		fingerprint := sha256.Sum256(ca.Raw)
+
+		// Key identifiers are written in colon-separated hex
+		var skid []string
+		for _, b := range ca.SubjectKeyId {
+			skid = append(skid, hex.EncodeToString([]byte{b}))
+		}
+
+		w.Write([]string{
+			owners[i],
+			subordinateOwners[i],
+			ca.Subject.CommonName,
+			strings.ToUpper(hex.EncodeToString(fingerprint[:])),
+			strings.Join(skid, ":"),
+			string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+		})
+	}
+	w.Flush()
+	if w.Error() != nil {
+		t.Fatal(w.Error())
+	}
+	return report.String()
+}
+
+func TestCatalog(t *testing.T) {
+	root, rootKey := newCA(t, "Example Root")
+	intermediate, intermediateKey := newCA(t, "Example Issuing CA")
+	unlisted, unlistedKey := newCA(t, "Unlisted CA")
+
+	report := ccadbReport(t,
+		[]*x509.Certificate{root, intermediate},
+		[]string{"Example Trust", "Example Trust"},
+		[]string{"", "Example Hosting"},
+	)
+	catalog, err := ParseCCADB(strings.NewReader(report))
+	if err != nil {
+		t.Fatalf("parsing report: %s", err)
+	}
+
+	// The intermediate's records attribute it to its subordinate owner
+	leaf := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}}, newKey(t), intermediate, intermediateKey)
+	record, ok := catalog.Issuer(leaf)
+	if !ok || record.Owner != "Example Hosting" || record.Name != "Example Issuing CA" {
+		t.Errorf("got issuer record %+v, %t", record, ok)
+	}
+	fingerprint := sha256.Sum256(intermediate.Raw)
+	if record.Fingerprint != hex.EncodeToString(fingerprint[:]) {
+		t.Errorf("got fingerprint %s, want it lowercased", record.Fingerprint)
+	}
+
+	record, ok = catalog.IssuerByKey(root)
+	if !ok || record.Owner != "Example Trust" {
+		t.Errorf("got record by key %+v, %t", record, ok)
+	}
+
+	other := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.net"}}, newKey(t), unlisted, unlistedKey)
+	rootIssued := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "example.org"}}, newKey(t), root, rootKey)
+	filter := catalog.Filter("example hosting")
+	if !filter(leaf) || filter(other) || filter(rootIssued) {
+		t.Error("filter matched the wrong certificates")
+	}
+
+	var metadata x509search.Metadata
+	err = catalog.Enrich(context.Background(), leaf, &metadata)
+	if err != nil {
+		t.Fatalf("enriching: %s", err)
+	}
+	if metadata.Annotations["ccadb.owner"] != "Example Hosting" || metadata.Annotations["ccadb.issuer"] != "Example Issuing CA" {
+		t.Errorf("got annotations %v", metadata.Annotations)
+	}
+
+	metadata = x509search.Metadata{}
+	err = catalog.Enrich(context.Background(), other, &metadata)
+	if err != nil || metadata.Annotations != nil {
+		t.Errorf("enriching an unlisted issuer's certificate: %v, %v", err, metadata.Annotations)
+	}
+}
+
+func TestLoadCCADB(t *testing.T) {
+	ca, _ := newCA(t, "Example CA")
+	report := ccadbReport(t, []*x509.Certificate{ca}, []string{"Example Trust"}, []string{""})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(report))
+	}))
+	defer server.Close()
+
+	catalog, err := LoadCCADB(context.Background(), nil, server.URL)
+	if err != nil {
+		t.Fatalf("loading report: %s", err)
+	}
+	record, ok := catalog.IssuerByKey(ca)
+	if !ok || record.Owner != "Example Trust" {
+		t.Errorf("got record %+v, %t", record, ok)
+	}
+
+	_, err = ParseCCADB(strings.NewReader("CA Owner,Certificate Name\nExample Trust,Example CA\n"))
+	if err == nil {
+		t.Error("got no error for a report missing columns")
+	}
+}
@@ -0,0 +1,167 @@
+package enrich
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// maxChainDepth bounds the number of issuers looked up when building a chain.
+const maxChainDepth = 5
+
+// Chains builds and validates chains from matches to a set of trusted roots,
+// to answer questions such as whether a certificate actually chains to the
+// roots of a given root program. Intermediates are drawn from Issuers, which
+// may fetch them via AIA.
+//
+// Certificates are validated as of their notBefore time, so that expired
+// certificates found in old log entries still validate. Precertificates are
+// validated as if they lacked the poison extension.
+//
+// Chains is safe for concurrent use.
+type Chains struct {
+	roots   *x509.CertPool
+	issuers *Issuers
+
+	// verified maps issuers, identified by name and key identifier, to the
+	// issuing certificate of a chain found through them, or to nil if
+	// chains through them failed
+	mu       sync.Mutex
+	verified map[string]*x509.Certificate
+}
+
+// NewChains returns a Chains validating against roots, with intermediates
+// found in issuers.
+func NewChains(roots *x509.CertPool, issuers *Issuers) (*Chains, error) {
+	if roots == nil {
+		return nil, errors.New("nil root pool")
+	}
+
+	if issuers == nil {
+		return nil, errors.New("nil issuers")
+	}
+
+	return &Chains{
+		roots:    roots,
+		issuers:  issuers,
+		verified: make(map[string]*x509.Certificate),
+	}, nil
+}
+
+// Verify builds and validates the chains from cert to the trusted roots.
+func (c *Chains) Verify(ctx context.Context, cert *x509.Certificate) ([][]*x509.Certificate, error) {
+	intermediates := x509.NewCertPool()
+	for _, issuer := range c.issuers.Known() {
+		intermediates.AddCert(issuer)
+	}
+
+	// Walk up the chain so that intermediates only available via AIA are
+	// included. Failing to find one isn't an error here, as the issuer may
+	// be a trusted root.
+	current := cert
+	for range maxChainDepth {
+		issuer, err := c.issuers.Find(ctx, current)
+		if err != nil {
+			break
+		}
+
+		intermediates.AddCert(issuer)
+		if issued(issuer, issuer) {
+			break
+		}
+		current = issuer
+	}
+
+	return asLeaf(cert).Verify(x509.VerifyOptions{
+		Roots:         c.roots,
+		Intermediates: intermediates,
+		CurrentTime:   cert.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+}
+
+// ChainsToRoots reports whether cert chains to one of the trusted roots. Once a
+// chain has been found through an issuer, later certificates from the same
+// issuer only have their signatures checked, and once an issuer is found not to
+// chain to a root, later certificates from it are rejected outright, which
+// makes ChainsToRoots cheap enough to run on every certificate in a log.
+func (c *Chains) ChainsToRoots(ctx context.Context, cert *x509.Certificate) bool {
+	key := string(cert.RawIssuer) + string(cert.AuthorityKeyId)
+
+	c.mu.Lock()
+	issuer, known := c.verified[key]
+	c.mu.Unlock()
+
+	if known {
+		return issuer != nil && cert.CheckSignatureFrom(issuer) == nil
+	}
+
+	chains, err := c.Verify(ctx, cert)
+	if err != nil {
+		// Only failures to find a root say anything about the issuer
+		var unknownAuthority x509.UnknownAuthorityError
+		if errors.As(err, &unknownAuthority) {
+			c.mu.Lock()
+			c.verified[key] = nil
+			c.mu.Unlock()
+		}
+		return false
+	}
+
+	// A certificate that is itself a trusted root has no issuer to remember
+	chain := chains[0]
+	if len(chain) > 1 {
+		c.mu.Lock()
+		c.verified[key] = chain[1]
+		c.mu.Unlock()
+	}
+
+	return true
+}
+
+// Filter returns a filter matching certificates that chain to one of the
+// trusted roots, such as to scope a log-wide search to a single CA hierarchy.
+// See ChainsToRoots.
+func (c *Chains) Filter() func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		return c.ChainsToRoots(context.Background(), cert)
+	}
+}
+
+// Enrich annotates a match with the outcome of validating it. It sets
+// "chain.valid" to "true" or "false", and either "chain.root" to the subject
+// of the root the first chain found ends in, or "chain.error" to the reason
+// validation failed.
+func (c *Chains) Enrich(ctx context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	chains, err := c.Verify(ctx, cert)
+	if err != nil {
+		metadata.Annotate("chain.valid", "false")
+		metadata.Annotate("chain.error", err.Error())
+		return nil
+	}
+
+	chain := chains[0]
+	metadata.Annotate("chain.valid", "true")
+	metadata.Annotate("chain.root", chain[len(chain)-1].Subject.String())
+	return nil
+}
+
+// asLeaf returns cert ready for validation as a leaf. Precertificates are
+// copied without the poison extension, which Go would otherwise reject as an
+// unhandled critical extension.
+func asLeaf(cert *x509.Certificate) *x509.Certificate {
+	if !x509search.IsPrecertificate(cert) {
+		return cert
+	}
+
+	leaf := *cert
+	leaf.UnhandledCriticalExtensions = slices.DeleteFunc(slices.Clone(cert.UnhandledCriticalExtensions), func(oid asn1.ObjectIdentifier) bool {
+		return oid.Equal(x509search.PoisonOID)
+	})
+	return &leaf
+}
@@ -0,0 +1,146 @@
+package enrich
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// testHierarchy is a root, an intermediate it issued, and that
+// intermediate's key, valid for the past three years.
+type testHierarchy struct {
+	root, intermediate *x509.Certificate
+	intermediateKey    crypto.Signer
+}
+
+func newHierarchy(t *testing.T, name string) testHierarchy {
+	t.Helper()
+
+	notBefore := time.Now().AddDate(-3, 0, 0)
+	rootKey, intermediateKey := newKey(t), newKey(t)
+	root := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " Root"},
+		NotBefore:             notBefore,
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, rootKey, nil, nil)
+	intermediate := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name + " Issuing CA"},
+		NotBefore:             notBefore,
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, intermediateKey, root, rootKey)
+
+	return testHierarchy{root: root, intermediate: intermediate, intermediateKey: intermediateKey}
+}
+
+// leaf issues a certificate for name from the hierarchy's intermediate.
+func (h testHierarchy) leaf(t *testing.T, name string, template *x509.Certificate) *x509.Certificate {
+	t.Helper()
+
+	template.Subject = pkix.Name{CommonName: name}
+	template.DNSNames = []string{name}
+	return issue(t, template, newKey(t), h.intermediate, h.intermediateKey)
+}
+
+func TestChains(t *testing.T) {
+	trusted := newHierarchy(t, "Trusted")
+	roots := x509.NewCertPool()
+	roots.AddCert(trusted.root)
+
+	chains, err := NewChains(roots, NewIssuers(trusted.intermediate))
+	if err != nil {
+		t.Fatalf("creating validator: %s", err)
+	}
+
+	// Precertificates, and certificates long expired, validate too
+	expired := trusted.leaf(t, "expired.example", &x509.Certificate{
+		NotBefore: time.Now().AddDate(-2, 0, 0),
+		NotAfter:  time.Now().AddDate(-1, 0, 0),
+	})
+	precertificate := trusted.leaf(t, "precert.example", &x509.Certificate{
+		ExtraExtensions: []pkix.Extension{{
+			Id:       asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3},
+			Critical: true,
+			Value:    []byte{0x05, 0x00},
+		}},
+	})
+	for _, cert := range []*x509.Certificate{trusted.leaf(t, "example.com", &x509.Certificate{}), expired, precertificate} {
+		var metadata x509search.Metadata
+		err = chains.Enrich(context.Background(), cert, &metadata)
+		if err != nil {
+			t.Fatalf("enriching: %s", err)
+		}
+		if metadata.Annotations["chain.valid"] != "true" || metadata.Annotations["chain.root"] != "CN=Trusted Root" {
+			t.Errorf("%s: got annotations %v", cert.Subject.CommonName, metadata.Annotations)
+		}
+	}
+
+	untrusted := newHierarchy(t, "Untrusted")
+	var metadata x509search.Metadata
+	err = chains.Enrich(context.Background(), untrusted.leaf(t, "example.net", &x509.Certificate{}), &metadata)
+	if err != nil {
+		t.Fatalf("enriching: %s", err)
+	}
+	if metadata.Annotations["chain.valid"] != "false" || metadata.Annotations["chain.error"] == "" {
+		t.Errorf("untrusted certificate: got annotations %v", metadata.Annotations)
+	}
+
+	_, err = NewChains(nil, NewIssuers())
+	if err == nil {
+		t.Error("got no error without roots")
+	}
+}
+
+func TestChainsToRoots(t *testing.T) {
+	trusted := newHierarchy(t, "Trusted")
+	untrusted := newHierarchy(t, "Untrusted")
+	roots := x509.NewCertPool()
+	roots.AddCert(trusted.root)
+
+	chains, err := NewChains(roots, NewIssuers(trusted.intermediate, untrusted.intermediate))
+	if err != nil {
+		t.Fatalf("creating validator: %s", err)
+	}
+	filter := chains.Filter()
+
+	// Later certificates from each issuer are checked against the outcome
+	// for the first
+	for i := range 2 {
+		if !filter(trusted.leaf(t, "example.com", &x509.Certificate{})) {
+			t.Errorf("certificate %d from the trusted hierarchy didn't match", i)
+		}
+		if filter(untrusted.leaf(t, "example.net", &x509.Certificate{})) {
+			t.Errorf("certificate %d from the untrusted hierarchy matched", i)
+		}
+	}
+
+	// A certificate claiming to be from the trusted intermediate, whose
+	// chain has been found, still needs its signature
+	forgerKey := newKey(t)
+	forger := issue(t, &x509.Certificate{
+		Subject:               trusted.intermediate.Subject,
+		SubjectKeyId:          trusted.intermediate.SubjectKeyId,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, forgerKey, nil, nil)
+	forged := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "forged.example"}}, newKey(t), forger, forgerKey)
+	if filter(forged) {
+		t.Error("forged certificate matched")
+	}
+
+	// A trusted root is its own chain
+	if !filter(trusted.root) {
+		t.Error("trusted root didn't match")
+	}
+}
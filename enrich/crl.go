@@ -0,0 +1,199 @@
+package enrich
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// maxCRLSize bounds the size of a CRL fetched over HTTP.
+const maxCRLSize = 1 << 28
+
+// CRLs matches and annotates certificates by their revocation status in a set
+// of loaded CRLs. Unlike OCSP, it makes no requests while the search runs, so
+// suits sweeps over many matches, such as finding the logged certificates of
+// an issuer that have not yet been revoked.
+//
+// A certificate is covered if a CRL from its issuer has been loaded. Issuers
+// that partition their CRLs into shards have every shard covering every
+// certificate, so all of an issuer's shards must be loaded for the results to
+// be accurate.
+//
+// CRLs is safe for concurrent use.
+type CRLs struct {
+	// HTTPClient is used to fetch CRLs by URL. If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+
+	// UserAgent is sent with each request for a CRL. If empty,
+	// x509search.DefaultUserAgent is used.
+	UserAgent string
+
+	// Issuers, if set, is used to verify the signature of each CRL loaded,
+	// which must be from one of its known issuers.
+	Issuers *Issuers
+
+	mu      sync.RWMutex
+	issuers map[string]bool
+	revoked map[string]x509.RevocationListEntry
+}
+
+// CRLStatus is the revocation status of a certificate according to CRLs.
+type CRLStatus int
+
+const (
+	// CRLUncovered means no CRL from the certificate's issuer was loaded.
+	CRLUncovered CRLStatus = iota
+
+	// CRLUnrevoked means the certificate's issuer's CRLs don't list it.
+	CRLUnrevoked
+
+	// CRLRevoked means one of the certificate's issuer's CRLs lists it.
+	CRLRevoked
+)
+
+// String returns the name of the status, as used in annotations.
+func (s CRLStatus) String() string {
+	switch s {
+	case CRLUnrevoked:
+		return "unrevoked"
+	case CRLRevoked:
+		return "revoked"
+	default:
+		return "uncovered"
+	}
+}
+
+// NewCRLs returns an empty set of CRLs.
+func NewCRLs() *CRLs {
+	return &CRLs{
+		issuers: make(map[string]bool),
+		revoked: make(map[string]x509.RevocationListEntry),
+	}
+}
+
+// Load adds the CRL at source, which is either an HTTP or HTTPS URL or the
+// path of a file. The CRL may be DER or PEM encoded.
+func (c *CRLs) Load(ctx context.Context, source string) error {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = get(ctx, c.HTTPClient, c.UserAgent, source, maxCRLSize)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return fmt.Errorf("loading CRL from %s: %w", source, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block != nil {
+		data = block.Bytes
+	}
+
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("parsing CRL from %s: %w", source, err)
+	}
+
+	return c.Add(list)
+}
+
+// Add adds a parsed CRL, verifying its signature first if Issuers is set.
+// Expired CRLs are added, but reported on stderr, as revocations aren't
+// withdrawn.
+func (c *CRLs) Add(list *x509.RevocationList) error {
+	if c.Issuers != nil {
+		err := verifyCRL(list, c.Issuers.Known())
+		if err != nil {
+			return err
+		}
+	}
+
+	if !list.NextUpdate.IsZero() && time.Now().After(list.NextUpdate) {
+		fmt.Fprintf(os.Stderr, "CRL from %q expired at %s\n", list.Issuer, list.NextUpdate.Format(time.RFC3339))
+	}
+
+	issuer := string(list.RawIssuer)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.issuers[issuer] = true
+	for _, entry := range list.RevokedCertificateEntries {
+		c.revoked[issuer+entry.SerialNumber.String()] = entry
+	}
+
+	return nil
+}
+
+// Status returns the revocation status of cert, along with its CRL entry if
+// it's revoked.
+func (c *CRLs) Status(cert *x509.Certificate) (CRLStatus, x509.RevocationListEntry) {
+	issuer := string(cert.RawIssuer)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.issuers[issuer] {
+		return CRLUncovered, x509.RevocationListEntry{}
+	}
+
+	entry, ok := c.revoked[issuer+cert.SerialNumber.String()]
+	if !ok {
+		return CRLUnrevoked, x509.RevocationListEntry{}
+	}
+
+	return CRLRevoked, entry
+}
+
+// Filter returns a filter matching covered certificates with the given status,
+// either CRLRevoked or CRLUnrevoked. Uncovered certificates never match, as
+// their status isn't known.
+func (c *CRLs) Filter(status CRLStatus) func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		actual, _ := c.Status(cert)
+		return actual == status
+	}
+}
+
+// Enrich annotates a match with its revocation status. It sets:
+//
+//   - "crl.status" to "revoked", "unrevoked", or "uncovered"
+//   - "crl.revokedAt" to the RFC 3339 revocation time, if revoked
+//   - "crl.reason" to the numeric CRL reason code, if revoked
+func (c *CRLs) Enrich(_ context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	status, entry := c.Status(cert)
+
+	metadata.Annotate("crl.status", status.String())
+	if status == CRLRevoked {
+		metadata.Annotate("crl.revokedAt", entry.RevocationTime.UTC().Format(time.RFC3339))
+		metadata.Annotate("crl.reason", strconv.Itoa(entry.ReasonCode))
+	}
+
+	return nil
+}
+
+// verifyCRL checks that list was signed by one of issuers.
+func verifyCRL(list *x509.RevocationList, issuers []*x509.Certificate) error {
+	for _, issuer := range issuers {
+		if string(issuer.RawSubject) != string(list.RawIssuer) {
+			continue
+		}
+
+		if list.CheckSignatureFrom(issuer) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("CRL from %q not signed by a known issuer", list.Issuer)
+}
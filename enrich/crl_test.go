@@ -0,0 +1,135 @@
+package enrich
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestCRLs(t *testing.T) {
+	ca, caKey := newCA(t, "Example CA")
+	other, otherKey := newCA(t, "Other CA")
+	revokedAt := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(2), RevocationTime: revokedAt, ReasonCode: 4},
+		},
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The CRL is loaded from a server, and again from a PEM file
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(der)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unrevoked := issue(t, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "a.example"}}, newKey(t), ca, caKey)
+	revoked := issue(t, &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "b.example"}}, newKey(t), ca, caKey)
+	uncovered := issue(t, &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "c.example"}}, newKey(t), other, otherKey)
+
+	for _, source := range []string{server.URL + "/ca.crl", path} {
+		crls := NewCRLs()
+		err = crls.Load(context.Background(), source)
+		if err != nil {
+			t.Fatalf("loading CRL from %s: %s", source, err)
+		}
+
+		for _, tc := range []struct {
+			cert *x509.Certificate
+			want CRLStatus
+		}{
+			{unrevoked, CRLUnrevoked},
+			{revoked, CRLRevoked},
+			{uncovered, CRLUncovered},
+		} {
+			status, _ := crls.Status(tc.cert)
+			if status != tc.want {
+				t.Errorf("%s: got status %s, want %s", tc.cert.Subject.CommonName, status, tc.want)
+			}
+		}
+
+		filter := crls.Filter(CRLRevoked)
+		if !filter(revoked) || filter(unrevoked) || filter(uncovered) {
+			t.Error("filter matched the wrong certificates")
+		}
+
+		var metadata x509search.Metadata
+		err = crls.Enrich(context.Background(), revoked, &metadata)
+		if err != nil {
+			t.Fatalf("enriching: %s", err)
+		}
+		want := map[string]string{
+			"crl.status":    "revoked",
+			"crl.revokedAt": "2025-02-01T00:00:00Z",
+			"crl.reason":    "4",
+		}
+		for key, value := range want {
+			if metadata.Annotations[key] != value {
+				t.Errorf("annotated %s as %q, want %q", key, metadata.Annotations[key], value)
+			}
+		}
+	}
+}
+
+func TestCRLsVerify(t *testing.T) {
+	ca, caKey := newCA(t, "Example CA")
+	impostor, impostorKey := newCA(t, "Example CA")
+
+	// The impostor has the CA's name, but not its key
+	crls := NewCRLs()
+	crls.Issuers = NewIssuers(ca)
+
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	genuine, err := x509.CreateRevocationList(rand.Reader, template, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := x509.CreateRevocationList(rand.Reader, template, impostor, impostorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		der  []byte
+		ok   bool
+	}{
+		{"genuine", genuine, true},
+		{"forged", forged, false},
+	} {
+		parsed, err := x509.ParseRevocationList(tc.der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = crls.Add(parsed)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s CRL: got error %v", tc.name, err)
+		}
+	}
+}
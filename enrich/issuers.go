@@ -0,0 +1,214 @@
+// Package enrich provides x509search.Enricher implementations that annotate
+// search matches with information from outside the data sources, such as
+// revocation status.
+package enrich
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// maxIssuerSize bounds the size of an issuer certificate fetched via AIA.
+const maxIssuerSize = 1 << 16
+
+// Issuers finds the issuing certificates of matches, which are needed to query
+// OCSP responders and to check CRL signatures. It's seeded with known
+// issuers, and can fall back to fetching an issuer from the certificate's
+// Authority Information Access URLs.
+//
+// Issuers is safe for concurrent use.
+type Issuers struct {
+	// HTTPClient is used to fetch issuers via AIA. If nil, http.DefaultClient
+	// is used.
+	HTTPClient *http.Client
+
+	// UserAgent is sent with each request for an issuer. If empty,
+	// x509search.DefaultUserAgent is used.
+	UserAgent string
+
+	// FetchAIA enables fetching issuers that weren't supplied from the
+	// certificate's caIssuers URLs.
+	FetchAIA bool
+
+	mu      sync.Mutex
+	issuers []*x509.Certificate
+	fetched map[string]*x509.Certificate
+}
+
+// NewIssuers returns an Issuers seeded with the given certificates.
+func NewIssuers(issuers ...*x509.Certificate) *Issuers {
+	return &Issuers{
+		issuers: issuers,
+		fetched: make(map[string]*x509.Certificate),
+	}
+}
+
+// Add makes more issuers available.
+func (i *Issuers) Add(issuers ...*x509.Certificate) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.issuers = append(i.issuers, issuers...)
+}
+
+// Load adds the certificates in a PEM file.
+func (i *Issuers) Load(path string) error {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading issuers: %w", err)
+	}
+
+	var issuers []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("parsing issuer from %s: %w", path, err)
+		}
+		issuers = append(issuers, cert)
+	}
+
+	if len(issuers) == 0 {
+		return fmt.Errorf("no certificates found in %s", path)
+	}
+
+	i.Add(issuers...)
+	return nil
+}
+
+// Find returns the issuer of cert, which is a known issuer whose key verifies
+// cert's signature.
+func (i *Issuers) Find(ctx context.Context, cert *x509.Certificate) (*x509.Certificate, error) {
+	i.mu.Lock()
+	candidates := i.issuers
+	i.mu.Unlock()
+
+	for _, candidate := range candidates {
+		if issued(candidate, cert) {
+			return candidate, nil
+		}
+	}
+
+	if !i.FetchAIA {
+		return nil, fmt.Errorf("no known issuer for %q", cert.Issuer)
+	}
+
+	for _, url := range cert.IssuingCertificateURL {
+		candidate, err := i.fetch(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		if issued(candidate, cert) {
+			return candidate, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no issuer found for %q via AIA", cert.Issuer)
+}
+
+// Known returns the issuers supplied so far, excluding those fetched via AIA.
+func (i *Issuers) Known() []*x509.Certificate {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]*x509.Certificate(nil), i.issuers...)
+}
+
+// fetch downloads the certificate at a caIssuers URL, reusing any previous
+// download of it.
+func (i *Issuers) fetch(ctx context.Context, url string) (*x509.Certificate, error) {
+	i.mu.Lock()
+	cert, ok := i.fetched[url]
+	i.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	body, err := get(ctx, i.HTTPClient, i.UserAgent, url, maxIssuerSize)
+	if err != nil {
+		return nil, fmt.Errorf("fetching issuer: %w", err)
+	}
+
+	cert, err = x509.ParseCertificate(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing issuer from %s: %w", url, err)
+	}
+
+	i.mu.Lock()
+	i.fetched[url] = cert
+	i.mu.Unlock()
+
+	return cert, nil
+}
+
+// issued reports whether issuer's key signed cert.
+func issued(issuer, cert *x509.Certificate) bool {
+	if len(cert.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 && string(cert.AuthorityKeyId) != string(issuer.SubjectKeyId) {
+		return false
+	}
+
+	return cert.CheckSignatureFrom(issuer) == nil
+}
+
+// get fetches url, returning at most maxSize bytes of the body.
+func get(ctx context.Context, client *http.Client, userAgent string, url string, maxSize int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	return do(client, userAgent, request, maxSize)
+}
+
+// do makes request, returning at most maxSize bytes of the body of a
+// successful response. If client is nil, http.DefaultClient is used, and if
+// userAgent is empty, x509search.DefaultUserAgent is sent.
+func do(client *http.Client, userAgent string, request *http.Request, maxSize int64) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if userAgent == "" {
+		userAgent = x509search.DefaultUserAgent
+	}
+	request.Header.Set("User-Agent", userAgent)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status from %s: %s", request.URL.Host, response.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	if int64(len(body)) > maxSize {
+		return nil, errors.New("response body too large")
+	}
+
+	return body, nil
+}
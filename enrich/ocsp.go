@@ -0,0 +1,212 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/x509search"
+)
+
+const (
+	// DefaultOCSPInterval is the minimum time between requests to a single
+	// OCSP responder if OCSP.MinInterval is zero.
+	DefaultOCSPInterval = 100 * time.Millisecond
+
+	// DefaultOCSPCacheTTL is how long a response without a nextUpdate time is
+	// cached for if OCSP.CacheTTL is zero.
+	DefaultOCSPCacheTTL = time.Hour
+
+	// maxOCSPResponseSize bounds the size of an OCSP response.
+	maxOCSPResponseSize = 1 << 16
+)
+
+// OCSP annotates matches with their revocation status, as reported by the
+// OCSP responder listed in each certificate. It sets:
+//
+//   - "ocsp.status" to "good", "revoked", or "unknown"
+//   - "ocsp.revokedAt" to the RFC 3339 revocation time, if revoked
+//   - "ocsp.reason" to the numeric CRL reason code, if revoked
+//
+// Certificates without an OCSP responder aren't annotated. Responses are cached
+// until their nextUpdate time, and requests to each responder are spaced out
+// by MinInterval so that a search with many matches doesn't hammer it.
+//
+// OCSP is safe for concurrent use.
+type OCSP struct {
+	// HTTPClient is used to query responders. If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+
+	// UserAgent is sent with each request to a responder. If empty,
+	// x509search.DefaultUserAgent is used.
+	UserAgent string
+
+	// MinInterval is the minimum time between requests to a single responder.
+	// If zero, DefaultOCSPInterval is used.
+	MinInterval time.Duration
+
+	// CacheTTL is how long a response without a nextUpdate time is cached.
+	// If zero, DefaultOCSPCacheTTL is used.
+	CacheTTL time.Duration
+
+	issuers *Issuers
+
+	mu          sync.Mutex
+	cache       map[string]ocspResult
+	nextRequest map[string]time.Time
+}
+
+type ocspResult struct {
+	response *ocsp.Response
+	expires  time.Time
+}
+
+// NewOCSP returns an OCSP enricher that finds the issuers needed to build
+// requests in issuers.
+func NewOCSP(issuers *Issuers) (*OCSP, error) {
+	if issuers == nil {
+		return nil, errors.New("nil issuers")
+	}
+
+	return &OCSP{
+		issuers:     issuers,
+		cache:       make(map[string]ocspResult),
+		nextRequest: make(map[string]time.Time),
+	}, nil
+}
+
+// Enrich queries the OCSP responder for cert and records the status reported.
+func (o *OCSP) Enrich(ctx context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	if len(cert.OCSPServer) == 0 {
+		return nil
+	}
+
+	response, err := o.status(ctx, cert)
+	if err != nil {
+		return fmt.Errorf("checking OCSP status of %s: %w", cert.SerialNumber.Text(16), err)
+	}
+
+	switch response.Status {
+	case ocsp.Good:
+		metadata.Annotate("ocsp.status", "good")
+	case ocsp.Revoked:
+		metadata.Annotate("ocsp.status", "revoked")
+		metadata.Annotate("ocsp.revokedAt", response.RevokedAt.UTC().Format(time.RFC3339))
+		metadata.Annotate("ocsp.reason", strconv.Itoa(response.RevocationReason))
+	default:
+		metadata.Annotate("ocsp.status", "unknown")
+	}
+
+	return nil
+}
+
+// status returns the OCSP response for cert, from the cache if possible.
+func (o *OCSP) status(ctx context.Context, cert *x509.Certificate) (*ocsp.Response, error) {
+	key := string(cert.RawIssuer) + cert.SerialNumber.String()
+
+	o.mu.Lock()
+	cached, ok := o.cache[key]
+	o.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.response, nil
+	}
+
+	issuer, err := o.issuers.Find(ctx, cert)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating OCSP request: %w", err)
+	}
+
+	body, err := o.query(ctx, cert.OCSPServer[0], request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OCSP response: %w", err)
+	}
+
+	expires := response.NextUpdate
+	if expires.IsZero() {
+		ttl := o.CacheTTL
+		if ttl == 0 {
+			ttl = DefaultOCSPCacheTTL
+		}
+		expires = time.Now().Add(ttl)
+	}
+
+	o.mu.Lock()
+	o.cache[key] = ocspResult{response: response, expires: expires}
+	o.mu.Unlock()
+
+	return response, nil
+}
+
+// query POSTs an OCSP request to a responder, once the responder's rate limit
+// allows it.
+func (o *OCSP) query(ctx context.Context, responder string, request []byte) ([]byte, error) {
+	responderURL, err := url.Parse(responder)
+	if err != nil {
+		return nil, fmt.Errorf("parsing OCSP responder URL: %w", err)
+	}
+
+	err = o.wait(ctx, responderURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, responder, bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/ocsp-request")
+
+	return do(o.HTTPClient, o.UserAgent, httpRequest, maxOCSPResponseSize)
+}
+
+// wait blocks until a request may be made to host, reserving the slot.
+func (o *OCSP) wait(ctx context.Context, host string) error {
+	interval := o.MinInterval
+	if interval == 0 {
+		interval = DefaultOCSPInterval
+	}
+
+	o.mu.Lock()
+	now := time.Now()
+	next := o.nextRequest[host]
+	if next.Before(now) {
+		next = now
+	}
+	o.nextRequest[host] = next.Add(interval)
+	o.mu.Unlock()
+
+	delay := next.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,202 @@
+package enrich
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// issue issues a certificate from template for key, signed by parent with
+// parentKey, or self-signed if parent is nil. A template without a serial
+// number or validity period is given them.
+func issue(t *testing.T, template *x509.Certificate, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(1)
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = template.NotBefore.AddDate(0, 3, 0)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newCA issues a self-signed CA certificate named name.
+func newCA(t *testing.T, name string) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+
+	key := newKey(t)
+	return issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, key, nil, nil), key
+}
+
+func TestOCSP(t *testing.T) {
+	ca, caKey := newCA(t, "Example CA")
+	revokedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	var requests atomic.Int32
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		response, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:           ocsp.Revoked,
+			SerialNumber:     request.SerialNumber,
+			RevokedAt:        revokedAt,
+			RevocationReason: ocsp.KeyCompromise,
+			ThisUpdate:       time.Now().Add(-time.Hour),
+			NextUpdate:       time.Now().Add(time.Hour),
+		}, caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(response)
+	}))
+	defer responder.Close()
+
+	leaf := issue(t, &x509.Certificate{
+		Subject:    pkix.Name{CommonName: "example.com"},
+		OCSPServer: []string{responder.URL},
+	}, newKey(t), ca, caKey)
+
+	enricher, err := NewOCSP(NewIssuers(ca))
+	if err != nil {
+		t.Fatalf("creating enricher: %s", err)
+	}
+
+	// The second match is answered from the cache
+	for range 2 {
+		var metadata x509search.Metadata
+		err = enricher.Enrich(context.Background(), leaf, &metadata)
+		if err != nil {
+			t.Fatalf("enriching: %s", err)
+		}
+
+		want := map[string]string{
+			"ocsp.status":    "revoked",
+			"ocsp.revokedAt": revokedAt.UTC().Format(time.RFC3339),
+			"ocsp.reason":    "1",
+		}
+		for key, value := range want {
+			if metadata.Annotations[key] != value {
+				t.Errorf("annotated %s as %q, want %q", key, metadata.Annotations[key], value)
+			}
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("made %d requests, want 1", requests.Load())
+	}
+
+	// Certificates without a responder aren't annotated
+	var metadata x509search.Metadata
+	err = enricher.Enrich(context.Background(), issue(t, &x509.Certificate{}, newKey(t), ca, caKey), &metadata)
+	if err != nil || metadata.Annotations != nil {
+		t.Errorf("enriching a certificate without a responder: %v, %v", err, metadata.Annotations)
+	}
+
+	// Without its issuer, a certificate's status can't be requested
+	orphaned, err := NewOCSP(NewIssuers())
+	if err != nil {
+		t.Fatalf("creating enricher: %s", err)
+	}
+	err = orphaned.Enrich(context.Background(), leaf, &x509search.Metadata{})
+	if err == nil {
+		t.Error("got no error enriching a certificate without its issuer")
+	}
+
+	_, err = NewOCSP(nil)
+	if err == nil {
+		t.Error("got no error without issuers")
+	}
+}
+
+func TestIssuersFetchAIA(t *testing.T) {
+	ca, caKey := newCA(t, "Example CA")
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write(ca.Raw)
+	}))
+	defer server.Close()
+
+	leaf := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "example.com"},
+		IssuingCertificateURL: []string{server.URL + "/ca.der"},
+	}, newKey(t), ca, caKey)
+
+	issuers := NewIssuers()
+	_, err := issuers.Find(context.Background(), leaf)
+	if err == nil {
+		t.Error("found an issuer without fetching it")
+	}
+
+	issuers.FetchAIA = true
+	for range 2 {
+		issuer, err := issuers.Find(context.Background(), leaf)
+		if err != nil {
+			t.Fatalf("finding issuer: %s", err)
+		}
+		if !issuer.Equal(ca) {
+			t.Errorf("found issuer %q, want %q", issuer.Subject, ca.Subject)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("fetched the issuer %d times, want once", requests.Load())
+	}
+}
@@ -0,0 +1,56 @@
+package filter
+
+import (
+	"crypto/x509"
+)
+
+// CA returns a filter matching CA certificates, that is, those with a valid
+// basic constraints extension asserting cA, such as for sweeping logs for
+// intermediates.
+func CA() func(*x509.Certificate) bool {
+	return isCA
+}
+
+// CAPathLen returns a filter matching CA certificates whose path length
+// constraint is between min and max, inclusive. A negative max leaves the
+// constraint unbounded above. CAs without a path length constraint may have
+// paths of any length beneath them, so they only match if max is negative.
+func CAPathLen(min, max int) func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		if !isCA(cert) {
+			return false
+		}
+
+		pathLen, constrained := pathLenConstraint(cert)
+		if !constrained {
+			return max < 0
+		}
+		return pathLen >= min && (max < 0 || pathLen <= max)
+	}
+}
+
+// CAUnconstrained returns a filter matching CA certificates without a path
+// length constraint.
+func CAUnconstrained() func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		_, constrained := pathLenConstraint(cert)
+		return isCA(cert) && !constrained
+	}
+}
+
+func isCA(cert *x509.Certificate) bool {
+	return cert.BasicConstraintsValid && cert.IsCA
+}
+
+// pathLenConstraint returns the certificate's path length constraint, and
+// whether it has one.
+func pathLenConstraint(cert *x509.Certificate) (int, bool) {
+	switch {
+	case cert.MaxPathLen > 0:
+		return cert.MaxPathLen, true
+	case cert.MaxPathLen == 0 && cert.MaxPathLenZero:
+		return 0, true
+	default:
+		return 0, false
+	}
+}
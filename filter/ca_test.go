@@ -0,0 +1,39 @@
+package filter
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestCAFilters(t *testing.T) {
+	newCA := func(maxPathLen int, zero bool) *x509.Certificate {
+		return issue(t, &x509.Certificate{
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			MaxPathLen:            maxPathLen,
+			MaxPathLenZero:        zero,
+		}, newKey(t), nil, nil)
+	}
+	pathLenZero := newCA(0, true)
+	pathLenTwo := newCA(2, false)
+	unconstrained := newCA(-1, false)
+	leaf := issue(t, &x509.Certificate{BasicConstraintsValid: true}, newKey(t), nil, nil)
+
+	for _, tc := range []struct {
+		name   string
+		filter func(*x509.Certificate) bool
+		want   []bool // for pathLenZero, pathLenTwo, unconstrained and leaf
+	}{
+		{"CA", CA(), []bool{true, true, true, false}},
+		{"CAPathLen(0, 1)", CAPathLen(0, 1), []bool{true, false, false, false}},
+		{"CAPathLen(1, -1)", CAPathLen(1, -1), []bool{false, true, true, false}},
+		{"CAPathLen(2, 2)", CAPathLen(2, 2), []bool{false, true, false, false}},
+		{"CAUnconstrained", CAUnconstrained(), []bool{false, false, true, false}},
+	} {
+		for i, cert := range []*x509.Certificate{pathLenZero, pathLenTwo, unconstrained, leaf} {
+			if got := tc.filter(cert); got != tc.want[i] {
+				t.Errorf("%s on certificate %d: got %t, want %t", tc.name, i, got, tc.want[i])
+			}
+		}
+	}
+}
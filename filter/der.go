@@ -0,0 +1,181 @@
+package filter
+
+import (
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+var (
+	// subjectKeyIDOID and authorityKeyIDOID are the OIDs of the subject and
+	// authority key identifier extensions.
+	subjectKeyIDOID   = asn1.ObjectIdentifier{2, 5, 29, 14}
+	authorityKeyIDOID = asn1.ObjectIdentifier{2, 5, 29, 35}
+)
+
+// tbsFields holds the DER encodings of the TBSCertificate fields the
+// prefilters look at.
+type tbsFields struct {
+	// serial is the whole serialNumber INTEGER
+	serial cryptobyte.String
+
+	// spki is the whole SubjectPublicKeyInfo
+	spki cryptobyte.String
+
+	// extensions holds the contents of the extensions SEQUENCE, and is empty
+	// if the certificate has none
+	extensions cryptobyte.String
+}
+
+// readTBS finds the fields of a DER-encoded certificate's TBSCertificate,
+// skipping over those in between, which is much cheaper than parsing it.
+func readTBS(der []byte) (tbsFields, bool) {
+	var fields tbsFields
+	var certificate, tbs cryptobyte.String
+	input := cryptobyte.String(der)
+	ok := input.ReadASN1(&certificate, cryptobyte_asn1.SEQUENCE) &&
+		certificate.ReadASN1(&tbs, cryptobyte_asn1.SEQUENCE) &&
+		tbs.SkipOptionalASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) && // version
+		tbs.ReadASN1Element(&fields.serial, cryptobyte_asn1.INTEGER) &&
+		tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) && // signature
+		tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) && // issuer
+		tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) && // validity
+		tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) && // subject
+		tbs.ReadASN1Element(&fields.spki, cryptobyte_asn1.SEQUENCE) &&
+		tbs.SkipOptionalASN1(cryptobyte_asn1.Tag(1).ContextSpecific()) && // issuerUniqueID
+		tbs.SkipOptionalASN1(cryptobyte_asn1.Tag(2).ContextSpecific()) // subjectUniqueID
+	if !ok {
+		return tbsFields{}, false
+	}
+
+	var wrapper cryptobyte.String
+	var present bool
+	if !tbs.ReadOptionalASN1(&wrapper, &present, cryptobyte_asn1.Tag(3).Constructed().ContextSpecific()) {
+		return tbsFields{}, false
+	}
+	if present && !wrapper.ReadASN1(&fields.extensions, cryptobyte_asn1.SEQUENCE) {
+		return tbsFields{}, false
+	}
+
+	return fields, true
+}
+
+// extensionValue returns the contents of the extnValue OCTET STRING of the
+// extension with the given OID, and whether it was found. It returns false if
+// the extensions are malformed.
+func extensionValue(extensions cryptobyte.String, oid asn1.ObjectIdentifier) (cryptobyte.String, bool) {
+	for !extensions.Empty() {
+		var extension cryptobyte.String
+		var id asn1.ObjectIdentifier
+		if !extensions.ReadASN1(&extension, cryptobyte_asn1.SEQUENCE) || !extension.ReadASN1ObjectIdentifier(&id) {
+			return nil, false
+		}
+		if !id.Equal(oid) {
+			continue
+		}
+
+		var value cryptobyte.String
+		if !extension.SkipOptionalASN1(cryptobyte_asn1.BOOLEAN) || !extension.ReadASN1(&value, cryptobyte_asn1.OCTET_STRING) {
+			return nil, false
+		}
+		return value, true
+	}
+	return nil, false
+}
+
+// SerialNumbers returns a prefilter matching certificates with one of the
+// given serial numbers. It compares the serial numbers' DER encodings, which
+// are unique, so a certificate with a non-minimally encoded serial number
+// isn't matched. Certificates too malformed for their serial numbers to be
+// found also match, so that they can be reported as parse errors.
+func SerialNumbers(serials ...*big.Int) (func([]byte) bool, error) {
+	if len(serials) == 0 {
+		return nil, errors.New("no serial numbers")
+	}
+
+	wanted := make(map[string]bool, len(serials))
+	for _, serial := range serials {
+		if serial == nil {
+			return nil, errors.New("nil serial number")
+		}
+
+		encoded, err := asn1.Marshal(serial)
+		if err != nil {
+			return nil, err
+		}
+		wanted[string(encoded)] = true
+	}
+
+	return func(der []byte) bool {
+		fields, ok := readTBS(der)
+		if !ok {
+			return true
+		}
+		return wanted[string(fields.serial)]
+	}, nil
+}
+
+// SubjectKeyIDs returns a prefilter matching certificates whose subject key
+// identifier is one of ids. Certificates too malformed for their key
+// identifiers to be found also match, so that they can be reported as parse
+// errors.
+func SubjectKeyIDs(ids ...[]byte) (func([]byte) bool, error) {
+	return keyIDFilter(ids, func(extensions cryptobyte.String) (cryptobyte.String, bool) {
+		value, ok := extensionValue(extensions, subjectKeyIDOID)
+		if !ok {
+			return nil, false
+		}
+
+		var id cryptobyte.String
+		if !value.ReadASN1(&id, cryptobyte_asn1.OCTET_STRING) {
+			return nil, false
+		}
+		return id, true
+	})
+}
+
+// AuthorityKeyIDs returns a prefilter matching certificates whose authority
+// key identifier is one of ids, that is, certificates issued by the CAs with
+// those subject key identifiers. Certificates too malformed for their key
+// identifiers to be found also match, so that they can be reported as parse
+// errors.
+func AuthorityKeyIDs(ids ...[]byte) (func([]byte) bool, error) {
+	return keyIDFilter(ids, func(extensions cryptobyte.String) (cryptobyte.String, bool) {
+		value, ok := extensionValue(extensions, authorityKeyIDOID)
+		if !ok {
+			return nil, false
+		}
+
+		var sequence, id cryptobyte.String
+		if !value.ReadASN1(&sequence, cryptobyte_asn1.SEQUENCE) || !sequence.ReadASN1(&id, cryptobyte_asn1.Tag(0).ContextSpecific()) {
+			return nil, false
+		}
+		return id, true
+	})
+}
+
+// keyIDFilter returns a prefilter matching certificates whose key identifier,
+// found in their extensions by find, is one of ids.
+func keyIDFilter(ids [][]byte, find func(cryptobyte.String) (cryptobyte.String, bool)) (func([]byte) bool, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("no key identifiers")
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[string(id)] = true
+	}
+
+	return func(der []byte) bool {
+		fields, ok := readTBS(der)
+		if !ok {
+			return true
+		}
+
+		id, ok := find(fields.extensions)
+		return ok && wanted[string(id)]
+	}, nil
+}
@@ -0,0 +1,79 @@
+package filter
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+)
+
+func TestSerialNumbers(t *testing.T) {
+	filter, err := SerialNumbers(big.NewInt(42), big.NewInt(128))
+	if err != nil {
+		t.Fatalf("creating prefilter: %s", err)
+	}
+
+	for _, tc := range []struct {
+		serial int64
+		want   bool
+	}{
+		{42, true},
+		// 128 is encoded with a leading zero byte
+		{128, true},
+		{43, false},
+	} {
+		cert := issue(t, &x509.Certificate{SerialNumber: big.NewInt(tc.serial)}, newKey(t), nil, nil)
+		if got := filter(cert.Raw); got != tc.want {
+			t.Errorf("serial %d: got %t, want %t", tc.serial, got, tc.want)
+		}
+	}
+
+	if !filter([]byte{0x30, 0x00}) {
+		t.Error("prefilter dropped a malformed certificate")
+	}
+
+	_, err = SerialNumbers()
+	if err == nil {
+		t.Error("got no error without serial numbers")
+	}
+	_, err = SerialNumbers(nil)
+	if err == nil {
+		t.Error("got no error for a nil serial number")
+	}
+}
+
+func TestKeyIDs(t *testing.T) {
+	caKey := newKey(t)
+	ca := issue(t, &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		Subject:               pkix.Name{CommonName: "Example CA"},
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}, caKey, nil, nil)
+	leaf := issue(t, &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "example.com"},
+		SubjectKeyId: []byte{5, 6, 7, 8},
+	}, newKey(t), ca, caKey)
+
+	subject, err := SubjectKeyIDs([]byte{1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("creating prefilter: %s", err)
+	}
+	if !subject(ca.Raw) || subject(leaf.Raw) {
+		t.Error("subject key ID prefilter matched the wrong certificates")
+	}
+
+	// The leaf's authority key ID is the CA's subject key ID
+	authority, err := AuthorityKeyIDs([]byte{1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("creating prefilter: %s", err)
+	}
+	if authority(ca.Raw) || !authority(leaf.Raw) {
+		t.Error("authority key ID prefilter matched the wrong certificates")
+	}
+
+	_, err = SubjectKeyIDs()
+	if err == nil {
+		t.Error("got no error without key identifiers")
+	}
+}
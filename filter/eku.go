@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// extKeyUsageOID is the OID of the extended key usage extension.
+var extKeyUsageOID = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+// extKeyUsages maps the names ParseExtKeyUsage accepts to their OIDs.
+var extKeyUsages = map[string]asn1.ObjectIdentifier{
+	"any":             {2, 5, 29, 37, 0},
+	"serverAuth":      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	"clientAuth":      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	"codeSigning":     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	"emailProtection": {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	"timeStamping":    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	"OCSPSigning":     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+}
+
+// ParseExtKeyUsage returns the OID of an extended key usage given by its name
+// in RFC 5280, such as "codeSigning" or "OCSPSigning", by "any" for
+// anyExtendedKeyUsage, or as a dotted OID.
+func ParseExtKeyUsage(usage string) (asn1.ObjectIdentifier, error) {
+	oid, ok := extKeyUsages[usage]
+	if ok {
+		return oid, nil
+	}
+
+	parts := strings.Split(usage, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("unknown extended key usage: %q", usage)
+	}
+
+	oid = make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.Atoi(part)
+		if err != nil || arc < 0 {
+			return nil, fmt.Errorf("unknown extended key usage: %q", usage)
+		}
+		oid[i] = arc
+	}
+	return oid, nil
+}
+
+// ExtKeyUsage returns a filter matching certificates whose extended key usage
+// extension asserts one of usages, such as certificates for code signing
+// logged alongside those for TLS servers. Certificates without the extension
+// don't match, even though RFC 5280 permits them any usage, as they aren't
+// what a search for particular usages is after.
+func ExtKeyUsage(usages ...asn1.ObjectIdentifier) (func(*x509.Certificate) bool, error) {
+	if len(usages) == 0 {
+		return nil, errors.New("no extended key usages")
+	}
+
+	wanted := make(map[string]bool, len(usages))
+	for _, usage := range usages {
+		wanted[usage.String()] = true
+	}
+
+	return func(cert *x509.Certificate) bool {
+		for _, extension := range cert.Extensions {
+			if !extension.Id.Equal(extKeyUsageOID) {
+				continue
+			}
+
+			var asserted []asn1.ObjectIdentifier
+			_, err := asn1.Unmarshal(extension.Value, &asserted)
+			if err != nil {
+				return false
+			}
+
+			for _, usage := range asserted {
+				if wanted[usage.String()] {
+					return true
+				}
+			}
+			return false
+		}
+		return false
+	}, nil
+}
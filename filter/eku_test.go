@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+)
+
+func TestParseExtKeyUsage(t *testing.T) {
+	for _, tc := range []struct {
+		usage string
+		want  asn1.ObjectIdentifier
+	}{
+		{"codeSigning", asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}},
+		{"any", asn1.ObjectIdentifier{2, 5, 29, 37, 0}},
+		{"1.3.6.1.4.1.311.10.3.4", asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 4}},
+	} {
+		got, err := ParseExtKeyUsage(tc.usage)
+		if err != nil {
+			t.Errorf("parsing %q: %s", tc.usage, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("parsed %q as %s, want %s", tc.usage, got, tc.want)
+		}
+	}
+
+	for _, usage := range []string{"signing", "1", "1.3.x", "1.-3"} {
+		_, err := ParseExtKeyUsage(usage)
+		if err == nil {
+			t.Errorf("got no error parsing %q", usage)
+		}
+	}
+}
+
+func TestExtKeyUsage(t *testing.T) {
+	codeSigning, err := ParseExtKeyUsage("codeSigning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	efs, err := ParseExtKeyUsage("1.3.6.1.4.1.311.10.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := ExtKeyUsage(codeSigning, efs)
+	if err != nil {
+		t.Fatalf("creating filter: %s", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		template *x509.Certificate
+		want     bool
+	}{
+		{"code signing", &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning}}, true},
+		{"server auth", &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, false},
+		{"dotted OID", &x509.Certificate{UnknownExtKeyUsage: []asn1.ObjectIdentifier{efs}}, true},
+		// Certificates without the extension may be used for anything, but
+		// aren't what the filter is after
+		{"no extension", &x509.Certificate{}, false},
+	} {
+		cert := issue(t, tc.template, newKey(t), nil, nil)
+		if got := filter(cert); got != tc.want {
+			t.Errorf("%s: got %t, want %t", tc.name, got, tc.want)
+		}
+	}
+
+	_, err = ExtKeyUsage()
+	if err == nil {
+		t.Error("got no error without usages")
+	}
+}
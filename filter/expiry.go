@@ -0,0 +1,18 @@
+package filter
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// ExpiringWithin returns a filter matching certificates that haven't yet
+// expired, but will within horizon, such as to sweep logs for the
+// certificates of a set of domains that are due for renewal. The time is read
+// as each certificate is filtered, so a long-running search keeps the horizon
+// relative to the present.
+func ExpiringWithin(horizon time.Duration) func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		now := time.Now()
+		return !cert.NotAfter.Before(now) && cert.NotAfter.Before(now.Add(horizon))
+	}
+}
@@ -0,0 +1,30 @@
+package filter
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestExpiringWithin(t *testing.T) {
+	filter := ExpiringWithin(24 * time.Hour)
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name     string
+		notAfter time.Time
+		want     bool
+	}{
+		{"expiring soon", now.Add(time.Hour), true},
+		{"expiring later", now.Add(48 * time.Hour), false},
+		{"expired", now.Add(-time.Hour), false},
+	} {
+		cert := issue(t, &x509.Certificate{
+			NotBefore: now.AddDate(0, -1, 0),
+			NotAfter:  tc.notAfter,
+		}, newKey(t), nil, nil)
+		if got := filter(cert); got != tc.want {
+			t.Errorf("%s: got %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// maxExampleSubjects is the number of subjects a KeyReuse remembers for each
+// key to report as examples.
+const maxExampleSubjects = 5
+
+// KeyReuse tracks the public keys of the certificates it observes, and finds
+// keys used by many distinct subjects or issuers. Keys shared between
+// unrelated subjects are a sign of shared hosting, key-generation flaws, or
+// infrastructure run by one party under many names, such as for phishing.
+//
+// A certificate's subject is its Subject DN, or if that's empty, its sorted
+// DNS names. Certificates are observed through Filter or Enrich, and each
+// observation counts, so a KeyReuse should be used in only one of those ways
+// per search. It keeps a hash of every distinct subject and issuer of every
+// key, so its memory grows with the number of certificates observed. It is
+// safe for concurrent use.
+type KeyReuse struct {
+	mu   sync.Mutex
+	keys map[[32]byte]*keyUse
+}
+
+type keyUse struct {
+	certificates int
+	subjects     map[[32]byte]struct{}
+	issuers      map[[32]byte]struct{}
+	examples     []string
+}
+
+// ReusedKey describes the use of a public key.
+type ReusedKey struct {
+	// SPKIHash is the SHA-256 hash of the key's DER-encoded
+	// SubjectPublicKeyInfo.
+	SPKIHash [32]byte
+
+	// Certificates is the number of certificates observed with the key.
+	Certificates int
+
+	// Subjects and Issuers are the numbers of distinct subjects and issuers
+	// of those certificates.
+	Subjects int
+	Issuers  int
+
+	// ExampleSubjects holds the first few distinct subjects observed.
+	ExampleSubjects []string
+}
+
+func NewKeyReuse() *KeyReuse {
+	return &KeyReuse{
+		keys: make(map[[32]byte]*keyUse),
+	}
+}
+
+// Observe records the certificate's key, subject, and issuer, and returns the
+// numbers of distinct subjects and issuers its key has been observed with,
+// including this certificate.
+func (k *KeyReuse) Observe(cert *x509.Certificate) (subjects, issuers int) {
+	key := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	subject := subjectName(cert)
+	subjectHash := sha256.Sum256([]byte(subject))
+	issuerHash := sha256.Sum256(cert.RawIssuer)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	use, ok := k.keys[key]
+	if !ok {
+		use = &keyUse{
+			subjects: make(map[[32]byte]struct{}, 1),
+			issuers:  make(map[[32]byte]struct{}, 1),
+		}
+		k.keys[key] = use
+	}
+
+	use.certificates++
+	_, seen := use.subjects[subjectHash]
+	if !seen {
+		use.subjects[subjectHash] = struct{}{}
+		if len(use.examples) < maxExampleSubjects {
+			use.examples = append(use.examples, subject)
+		}
+	}
+	use.issuers[issuerHash] = struct{}{}
+
+	return len(use.subjects), len(use.issuers)
+}
+
+// Filter returns a filter that observes each certificate, and matches those
+// whose key has been observed with at least minSubjects distinct subjects or
+// minIssuers distinct issuers. A threshold that isn't positive is ignored.
+// Certificates observed before their key reached a threshold don't match, but
+// their keys are still listed by Reused.
+func (k *KeyReuse) Filter(minSubjects, minIssuers int) func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		subjects, issuers := k.Observe(cert)
+		return (minSubjects > 0 && subjects >= minSubjects) || (minIssuers > 0 && issuers >= minIssuers)
+	}
+}
+
+// Enrich observes a match, and if its key has been observed with more than
+// one subject or issuer, annotates it with "keyReuse.subjects" and
+// "keyReuse.issuers", their numbers so far.
+func (k *KeyReuse) Enrich(_ context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	subjects, issuers := k.Observe(cert)
+	if subjects > 1 || issuers > 1 {
+		metadata.Annotate("keyReuse.subjects", strconv.Itoa(subjects))
+		metadata.Annotate("keyReuse.issuers", strconv.Itoa(issuers))
+	}
+	return nil
+}
+
+// Reused returns the keys observed with at least minSubjects distinct
+// subjects or minIssuers distinct issuers, ignoring a threshold that isn't
+// positive, or every key if neither is. They're ordered by the number of
+// subjects, then issuers, most first, with ties ordered by hash.
+func (k *KeyReuse) Reused(minSubjects, minIssuers int) []ReusedKey {
+	unbounded := minSubjects <= 0 && minIssuers <= 0
+
+	k.mu.Lock()
+	var reused []ReusedKey
+	for key, use := range k.keys {
+		enoughSubjects := minSubjects > 0 && len(use.subjects) >= minSubjects
+		enoughIssuers := minIssuers > 0 && len(use.issuers) >= minIssuers
+		if !unbounded && !enoughSubjects && !enoughIssuers {
+			continue
+		}
+
+		reused = append(reused, ReusedKey{
+			SPKIHash:        key,
+			Certificates:    use.certificates,
+			Subjects:        len(use.subjects),
+			Issuers:         len(use.issuers),
+			ExampleSubjects: slices.Clone(use.examples),
+		})
+	}
+	k.mu.Unlock()
+
+	sort.Slice(reused, func(i, j int) bool {
+		if reused[i].Subjects != reused[j].Subjects {
+			return reused[i].Subjects > reused[j].Subjects
+		}
+		if reused[i].Issuers != reused[j].Issuers {
+			return reused[i].Issuers > reused[j].Issuers
+		}
+		return bytes.Compare(reused[i].SPKIHash[:], reused[j].SPKIHash[:]) < 0
+	})
+
+	return reused
+}
+
+// subjectName returns the name KeyReuse identifies a certificate's subject by.
+func subjectName(cert *x509.Certificate) string {
+	subject := cert.Subject.String()
+	if subject != "" {
+		return subject
+	}
+
+	names := slices.Clone(cert.DNSNames)
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,79 @@
+package filter
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"slices"
+	"testing"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestKeyReuse(t *testing.T) {
+	shared, single := newKey(t), newKey(t)
+	caKey := newKey(t)
+	ca := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Other CA"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, caKey, nil, nil)
+
+	certs := []*x509.Certificate{
+		issue(t, &x509.Certificate{DNSNames: []string{"b.example", "a.example"}}, shared, nil, nil),
+		issue(t, &x509.Certificate{DNSNames: []string{"a.example", "b.example"}}, shared, nil, nil),
+		issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "c.example"}}, shared, ca, caKey),
+		issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "d.example"}}, single, nil, nil),
+	}
+
+	// The first two certificates have empty Subjects, so they share a
+	// subject, their sorted DNS names, and an issuer
+	reuse := NewKeyReuse()
+	filter := reuse.Filter(2, 0)
+	var matched []bool
+	for _, cert := range certs {
+		matched = append(matched, filter(cert))
+	}
+	if want := []bool{false, false, true, false}; !slices.Equal(matched, want) {
+		t.Errorf("filter matched %v, want %v", matched, want)
+	}
+
+	reused := reuse.Reused(2, 0)
+	if len(reused) != 1 {
+		t.Fatalf("got %d reused keys, want 1", len(reused))
+	}
+	if reused[0].Certificates != 3 || reused[0].Subjects != 2 || reused[0].Issuers != 2 {
+		t.Errorf("got reused key %+v", reused[0])
+	}
+	if want := []string{"a.example,b.example", "CN=c.example"}; !slices.Equal(reused[0].ExampleSubjects, want) {
+		t.Errorf("got example subjects %q, want %q", reused[0].ExampleSubjects, want)
+	}
+
+	if all := reuse.Reused(0, 0); len(all) != 2 {
+		t.Errorf("got %d keys without thresholds, want 2", len(all))
+	}
+}
+
+func TestKeyReuseEnrich(t *testing.T) {
+	key := newKey(t)
+	reuse := NewKeyReuse()
+
+	var metadata x509search.Metadata
+	first := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "a.example"}}, key, nil, nil)
+	err := reuse.Enrich(context.Background(), first, &metadata)
+	if err != nil {
+		t.Fatalf("enriching: %s", err)
+	}
+	if metadata.Annotations != nil {
+		t.Errorf("annotated the first use of a key: %v", metadata.Annotations)
+	}
+
+	second := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "b.example"}}, key, nil, nil)
+	err = reuse.Enrich(context.Background(), second, &metadata)
+	if err != nil {
+		t.Fatalf("enriching: %s", err)
+	}
+	if metadata.Annotations["keyReuse.subjects"] != "2" || metadata.Annotations["keyReuse.issuers"] != "2" {
+		t.Errorf("got annotations %v", metadata.Annotations)
+	}
+}
@@ -0,0 +1,195 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// NameConstraints detects certificates issued by a name-constrained CA whose
+// names violate its constraints, which is mis-issuance by the CA. Only
+// certificates issued, and signed, directly by the CA are checked; those from
+// its subordinate CAs aren't, as searches see certificates without their
+// chains. It checks DNS names, email addresses, IP addresses and URIs in the
+// subject alternative names, following RFC 5280, but not the Subject.
+//
+// NameConstraints is an x509search.Enricher, annotating each violating match
+// with the names that violate. It is safe for concurrent use.
+type NameConstraints struct {
+	ca *x509.Certificate
+}
+
+// NewNameConstraints returns a NameConstraints checking the certificates
+// issued by ca. It returns an error if ca has no name constraints.
+func NewNameConstraints(ca *x509.Certificate) (*NameConstraints, error) {
+	if ca == nil {
+		return nil, errors.New("nil CA certificate")
+	}
+
+	constrained := len(ca.PermittedDNSDomains) > 0 || len(ca.ExcludedDNSDomains) > 0 ||
+		len(ca.PermittedEmailAddresses) > 0 || len(ca.ExcludedEmailAddresses) > 0 ||
+		len(ca.PermittedIPRanges) > 0 || len(ca.ExcludedIPRanges) > 0 ||
+		len(ca.PermittedURIDomains) > 0 || len(ca.ExcludedURIDomains) > 0
+	if !constrained {
+		return nil, errors.New("CA certificate has no name constraints")
+	}
+
+	return &NameConstraints{ca: ca}, nil
+}
+
+// IssuedBy reports whether cert was issued by the CA: whether it names the CA
+// as its issuer and carries the CA's signature.
+func (n *NameConstraints) IssuedBy(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, n.ca.RawSubject) {
+		return false
+	}
+
+	// Comparing key identifiers cheaply rules out other CAs with the same
+	// name before checking the signature
+	if len(cert.AuthorityKeyId) > 0 && len(n.ca.SubjectKeyId) > 0 && !bytes.Equal(cert.AuthorityKeyId, n.ca.SubjectKeyId) {
+		return false
+	}
+
+	return cert.CheckSignatureFrom(n.ca) == nil
+}
+
+// Violations returns the names in cert that violate the CA's name
+// constraints, whether or not cert was issued by the CA.
+func (n *NameConstraints) Violations(cert *x509.Certificate) []string {
+	var violations []string
+
+	for _, name := range cert.DNSNames {
+		if violates(name, n.ca.PermittedDNSDomains, n.ca.ExcludedDNSDomains, matchDomain) {
+			violations = append(violations, name)
+		}
+	}
+
+	for _, address := range cert.EmailAddresses {
+		if violates(address, n.ca.PermittedEmailAddresses, n.ca.ExcludedEmailAddresses, matchEmail) {
+			violations = append(violations, address)
+		}
+	}
+
+	for _, ip := range cert.IPAddresses {
+		if violatesIP(ip, n.ca.PermittedIPRanges, n.ca.ExcludedIPRanges) {
+			violations = append(violations, ip.String())
+		}
+	}
+
+	for _, uri := range cert.URIs {
+		if violates(uri.Hostname(), n.ca.PermittedURIDomains, n.ca.ExcludedURIDomains, matchHost) {
+			violations = append(violations, uri.String())
+		}
+	}
+
+	return violations
+}
+
+// Filter returns a filter matching certificates issued by the CA that violate
+// its name constraints.
+func (n *NameConstraints) Filter() func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		return n.IssuedBy(cert) && len(n.Violations(cert)) > 0
+	}
+}
+
+// Enrich annotates a match issued by the CA with "nameConstraints.violations",
+// listing the names violating its constraints, separated by commas, if there
+// are any.
+func (n *NameConstraints) Enrich(_ context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	if !n.IssuedBy(cert) {
+		return nil
+	}
+
+	violations := n.Violations(cert)
+	if len(violations) > 0 {
+		metadata.Annotate("nameConstraints.violations", strings.Join(violations, ","))
+	}
+	return nil
+}
+
+// violates reports whether name is excluded, or isn't permitted, by the
+// constraints, as compared by match.
+func violates(name string, permitted, excluded []string, match func(name, constraint string) bool) bool {
+	for _, constraint := range excluded {
+		if match(name, constraint) {
+			return true
+		}
+	}
+
+	if len(permitted) == 0 {
+		return false
+	}
+	for _, constraint := range permitted {
+		if match(name, constraint) {
+			return false
+		}
+	}
+	return true
+}
+
+// violatesIP is violates for IP addresses.
+func violatesIP(ip net.IP, permitted, excluded []*net.IPNet) bool {
+	for _, constraint := range excluded {
+		if constraint.Contains(ip) {
+			return true
+		}
+	}
+
+	if len(permitted) == 0 {
+		return false
+	}
+	for _, constraint := range permitted {
+		if constraint.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchDomain reports whether a DNS name is within a dNSName constraint: the
+// domain itself or any subdomain of it. A constraint with a leading period
+// only includes subdomains.
+func matchDomain(name, constraint string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	constraint = strings.ToLower(constraint)
+
+	if constraint == "" {
+		return true
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(name, constraint)
+	}
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// matchHost reports whether a host is within a uniformResourceIdentifier or
+// host part of an rfc822Name constraint: that host exactly, or with a leading
+// period, any subdomain of the rest.
+func matchHost(host, constraint string) bool {
+	host = strings.ToLower(host)
+	constraint = strings.ToLower(constraint)
+
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint
+}
+
+// matchEmail reports whether an email address is within an rfc822Name
+// constraint: a whole mailbox, or the host part of one.
+func matchEmail(address, constraint string) bool {
+	if strings.Contains(constraint, "@") {
+		local, host, _ := strings.Cut(address, "@")
+		wantLocal, wantHost, _ := strings.Cut(constraint, "@")
+		return local == wantLocal && strings.EqualFold(host, wantHost)
+	}
+
+	_, host, ok := strings.Cut(address, "@")
+	return ok && matchHost(host, constraint)
+}
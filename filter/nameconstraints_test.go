@@ -0,0 +1,95 @@
+package filter
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestNameConstraints(t *testing.T) {
+	caKey := newKey(t)
+	caTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Constrained CA"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		PermittedDNSDomains:   []string{"example.com"},
+		ExcludedDNSDomains:    []string{"internal.example.com"},
+		PermittedIPRanges:     []*net.IPNet{{IP: net.IP{192, 0, 2, 0}, Mask: net.CIDRMask(24, 32)}},
+	}
+	ca := issue(t, caTemplate, caKey, nil, nil)
+
+	constraints, err := NewNameConstraints(ca)
+	if err != nil {
+		t.Fatalf("creating detector: %s", err)
+	}
+	filter := constraints.Filter()
+
+	within := issue(t, &x509.Certificate{
+		DNSNames:    []string{"example.com", "www.example.com"},
+		IPAddresses: []net.IP{{192, 0, 2, 1}},
+	}, newKey(t), ca, caKey)
+	if filter(within) {
+		t.Errorf("matched a certificate within the constraints")
+	}
+
+	outside := issue(t, &x509.Certificate{
+		DNSNames:    []string{"www.example.com", "www.example.org", "db.internal.example.com"},
+		IPAddresses: []net.IP{{198, 51, 100, 1}},
+	}, newKey(t), ca, caKey)
+	if !filter(outside) {
+		t.Errorf("didn't match a certificate violating the constraints")
+	}
+	want := []string{"www.example.org", "db.internal.example.com", "198.51.100.1"}
+	if got := constraints.Violations(outside); !slices.Equal(got, want) {
+		t.Errorf("got violations %q, want %q", got, want)
+	}
+
+	var metadata x509search.Metadata
+	err = constraints.Enrich(context.Background(), outside, &metadata)
+	if err != nil {
+		t.Fatalf("enriching: %s", err)
+	}
+	if got := metadata.Annotations["nameConstraints.violations"]; got != "www.example.org,db.internal.example.com,198.51.100.1" {
+		t.Errorf("annotated violations %q", got)
+	}
+
+	// A CA with the same name but a different key didn't issue it
+	impostorKey := newKey(t)
+	impostor := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Constrained CA"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, impostorKey, nil, nil)
+	other := issue(t, &x509.Certificate{DNSNames: []string{"www.example.org"}}, newKey(t), impostor, impostorKey)
+	if constraints.IssuedBy(other) || filter(other) {
+		t.Error("matched a certificate from another CA with the same name")
+	}
+
+	_, err = NewNameConstraints(impostor)
+	if err == nil {
+		t.Error("got no error for a CA without name constraints")
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	for _, tc := range []struct {
+		name, constraint string
+		want             bool
+	}{
+		{"example.com", "example.com", true},
+		{"WWW.Example.com.", "example.com", true},
+		{"badexample.com", "example.com", false},
+		{"example.com", ".example.com", false},
+		{"www.example.com", ".example.com", true},
+		{"anything.test", "", true},
+	} {
+		if got := matchDomain(tc.name, tc.constraint); got != tc.want {
+			t.Errorf("matchDomain(%q, %q) = %t, want %t", tc.name, tc.constraint, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package filter provides filters for x509search.Search: functions matching
+// parsed certificates, for Search.Filter, and prefilters matching their DER
+// encodings, for Search.DERFilter, which skip parsing the certificates that
+// can't match.
+package filter
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// PublicKeys matches certificates for any of a set of public keys, such as to
+// find every certificate issued for a compromised key. Keys are compared by
+// their DER-encoded SubjectPublicKeyInfo, so a certificate encoding its key
+// unusually, such as an RSA key without NULL parameters, isn't matched.
+type PublicKeys struct {
+	spkis map[string]bool
+}
+
+// NewPublicKeys returns a PublicKeys matching the given keys, each a public
+// key supported by x509.MarshalPKIXPublicKey, or a private key with a Public
+// method, such as a crypto.Signer.
+func NewPublicKeys(keys ...any) (*PublicKeys, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys")
+	}
+
+	p := &PublicKeys{
+		spkis: make(map[string]bool, len(keys)),
+	}
+	for i, key := range keys {
+		private, ok := key.(interface{ Public() crypto.PublicKey })
+		if ok {
+			key = private.Public()
+		}
+
+		spki, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("encoding key %d: %w", i, err)
+		}
+		p.spkis[string(spki)] = true
+	}
+	return p, nil
+}
+
+// ParsePublicKeysPEM returns a PublicKeys matching the keys in the given PEM
+// data, which may hold public keys, certificates, and unencrypted private keys.
+func ParsePublicKeysPEM(data []byte) (*PublicKeys, error) {
+	var keys []any
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		key, err := parsePEMKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s block: %w", block.Type, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return NewPublicKeys(keys...)
+}
+
+// parsePEMKey returns the key in a PEM block.
+func parsePEMKey(block *pem.Block) (any, error) {
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, errors.New("unsupported PEM block type")
+	}
+}
+
+// Len returns the number of distinct keys matched.
+func (p *PublicKeys) Len() int {
+	return len(p.spkis)
+}
+
+// Filter returns a filter matching certificates for one of the keys.
+func (p *PublicKeys) Filter() func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		return p.spkis[string(cert.RawSubjectPublicKeyInfo)]
+	}
+}
+
+// DERFilter returns a prefilter matching certificates for one of the keys
+// without parsing them. It also matches certificates too malformed for their
+// keys to be found, so that they can be reported as parse errors.
+func (p *PublicKeys) DERFilter() func([]byte) bool {
+	return func(der []byte) bool {
+		fields, ok := readTBS(der)
+		if !ok {
+			return true
+		}
+		return p.spkis[string(fields.spki)]
+	}
+}
@@ -0,0 +1,126 @@
+package filter
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// issue issues a certificate from template for key, signed by parent with
+// parentKey, or self-signed if parent is nil. A template without a serial
+// number or validity period is given them.
+func issue(t *testing.T, template *x509.Certificate, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(1)
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = template.NotBefore.AddDate(0, 3, 0)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestPublicKeys(t *testing.T) {
+	compromised, other := newKey(t), newKey(t)
+
+	// Private keys are matched by their public halves
+	keys, err := NewPublicKeys(compromised)
+	if err != nil {
+		t.Fatalf("creating filter: %s", err)
+	}
+	filter, derFilter := keys.Filter(), keys.DERFilter()
+
+	for _, tc := range []struct {
+		name string
+		key  crypto.Signer
+		want bool
+	}{
+		{"compromised key", compromised, true},
+		{"other key", other, false},
+	} {
+		cert := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: tc.name}}, tc.key, nil, nil)
+		if got := filter(cert); got != tc.want {
+			t.Errorf("%s: filter returned %t, want %t", tc.name, got, tc.want)
+		}
+		if got := derFilter(cert.Raw); got != tc.want {
+			t.Errorf("%s: prefilter returned %t, want %t", tc.name, got, tc.want)
+		}
+	}
+
+	// Malformed certificates pass the prefilter, to be reported when parsed
+	if !derFilter([]byte{0x30, 0x03, 0x02, 0x01, 0x01}) {
+		t.Error("prefilter dropped a malformed certificate")
+	}
+
+	_, err = NewPublicKeys()
+	if err == nil {
+		t.Error("got no error for an empty set of keys")
+	}
+}
+
+func TestParsePublicKeysPEM(t *testing.T) {
+	first, second := newKey(t), newKey(t)
+
+	spki, err := x509.MarshalPKIXPublicKey(first.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := x509.MarshalECPrivateKey(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := issue(t, &x509.Certificate{}, first, nil, nil)
+
+	var data []byte
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: private})...)
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+
+	keys, err := ParsePublicKeysPEM(data)
+	if err != nil {
+		t.Fatalf("parsing keys: %s", err)
+	}
+
+	// The certificate's key is the first key again
+	if keys.Len() != 2 {
+		t.Errorf("parsed %d distinct keys, want 2", keys.Len())
+	}
+
+	_, err = ParsePublicKeysPEM(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: []byte{0}}))
+	if err == nil {
+		t.Error("got no error for an unsupported PEM block")
+	}
+}
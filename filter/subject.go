@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// subjectAttributes maps the names Subject accepts to their OIDs.
+var subjectAttributes = map[string]asn1.ObjectIdentifier{
+	"CN":           {2, 5, 4, 3},
+	"serialNumber": {2, 5, 4, 5},
+	"C":            {2, 5, 4, 6},
+	"O":            {2, 5, 4, 10},
+	"OU":           {2, 5, 4, 11},
+}
+
+// SubjectMode selects how Subject compares attribute values.
+type SubjectMode int
+
+const (
+	// SubjectExact matches attribute values equal to one of the values.
+	SubjectExact SubjectMode = iota
+
+	// SubjectContains matches attribute values containing one of the values,
+	// ignoring case.
+	SubjectContains
+)
+
+// Subject returns a filter matching certificates with a Subject attribute,
+// named by attribute, that matches one of values. attribute is one of "CN",
+// "serialNumber", "C", "O", or "OU". Every instance of the attribute in the
+// Subject is compared, so a certificate with several organizational units
+// matches if any of them does.
+func Subject(attribute string, mode SubjectMode, values ...string) (func(*x509.Certificate) bool, error) {
+	oid, ok := subjectAttributes[attribute]
+	if !ok {
+		return nil, fmt.Errorf("unsupported subject attribute: %q", attribute)
+	}
+
+	if len(values) == 0 {
+		return nil, errors.New("no subject attribute values")
+	}
+
+	var matches func(string) bool
+	switch mode {
+	case SubjectExact:
+		wanted := make(map[string]bool, len(values))
+		for _, value := range values {
+			wanted[value] = true
+		}
+		matches = func(value string) bool {
+			return wanted[value]
+		}
+	case SubjectContains:
+		wanted := make([]string, len(values))
+		for i, value := range values {
+			wanted[i] = strings.ToLower(value)
+		}
+		matches = func(value string) bool {
+			value = strings.ToLower(value)
+			for _, substring := range wanted {
+				if strings.Contains(value, substring) {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		return nil, fmt.Errorf("unknown subject mode: %d", mode)
+	}
+
+	return func(cert *x509.Certificate) bool {
+		for _, name := range cert.Subject.Names {
+			if !name.Type.Equal(oid) {
+				continue
+			}
+
+			value, ok := name.Value.(string)
+			if ok && matches(value) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
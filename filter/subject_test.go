@@ -0,0 +1,47 @@
+package filter
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestSubject(t *testing.T) {
+	cert := issue(t, &x509.Certificate{Subject: pkix.Name{
+		CommonName:         "www.example.com",
+		Organization:       []string{"Example Corp"},
+		OrganizationalUnit: []string{"Operations", "Web"},
+	}}, newKey(t), nil, nil)
+
+	for _, tc := range []struct {
+		attribute string
+		mode      SubjectMode
+		values    []string
+		want      bool
+	}{
+		{"O", SubjectExact, []string{"Example Corp"}, true},
+		{"O", SubjectExact, []string{"example corp"}, false},
+		{"O", SubjectContains, []string{"EXAMPLE"}, true},
+		{"O", SubjectContains, []string{"Other", "corp"}, true},
+		{"OU", SubjectExact, []string{"Web"}, true},
+		{"CN", SubjectContains, []string{"example.org"}, false},
+		{"C", SubjectExact, []string{"US"}, false},
+	} {
+		filter, err := Subject(tc.attribute, tc.mode, tc.values...)
+		if err != nil {
+			t.Fatalf("%s %q: %s", tc.attribute, tc.values, err)
+		}
+		if got := filter(cert); got != tc.want {
+			t.Errorf("%s %q (mode %d): got %t, want %t", tc.attribute, tc.values, tc.mode, got, tc.want)
+		}
+	}
+
+	_, err := Subject("L", SubjectExact, "Springfield")
+	if err == nil {
+		t.Error("got no error for an unsupported attribute")
+	}
+	_, err = Subject("O", SubjectExact)
+	if err == nil {
+		t.Error("got no error without values")
+	}
+}
@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Skew returns the time between a certificate's notBefore and the time its
+// data source recorded it, such as its CT log entry timestamp, and whether
+// that time is known. It is positive if the certificate was recorded after
+// notBefore, as is usual, and negative if it was recorded before.
+func Skew(cert *x509.Certificate, metadata x509search.Metadata) (time.Duration, bool) {
+	if metadata.Timestamp.IsZero() {
+		return 0, false
+	}
+	return metadata.Timestamp.Sub(cert.NotBefore), true
+}
+
+// TimestampSkew flags certificates whose notBefore is far from the time their
+// data source recorded them. CAs usually log a certificate within moments of
+// issuing it, with notBefore at or shortly before issuance, so a long lag
+// points to a backdated certificate or one logged long after issuance, and a
+// lead, where the certificate was logged before its notBefore, to a
+// postdated one. Certificates from data sources without timestamps are never
+// flagged.
+//
+// TimestampSkew is an x509search.Enricher, annotating each match with its
+// skew, so that it can report skews without filtering on them.
+type TimestampSkew struct {
+	// MaxLag is the longest a certificate may be recorded after its
+	// notBefore without being flagged. If it's zero, lags aren't flagged.
+	MaxLag time.Duration
+
+	// MaxLead is the longest a certificate may be recorded before its
+	// notBefore without being flagged. If it's zero, leads aren't flagged.
+	MaxLead time.Duration
+}
+
+// Flagged reports whether the certificate's skew exceeds MaxLag or MaxLead.
+func (t TimestampSkew) Flagged(cert *x509.Certificate, metadata x509search.Metadata) bool {
+	skew, ok := Skew(cert, metadata)
+	if !ok {
+		return false
+	}
+
+	return (t.MaxLag > 0 && skew > t.MaxLag) || (t.MaxLead > 0 && -skew > t.MaxLead)
+}
+
+// Filter returns a filter, for Search.MetadataFilter, matching flagged
+// certificates.
+func (t TimestampSkew) Filter() func(*x509.Certificate, x509search.Metadata) bool {
+	return t.Flagged
+}
+
+// Enrich annotates a match with "timestamp.skew", its skew as a Go duration,
+// and with "timestamp.flagged" set to "true" if it's flagged. Matches from data
+// sources without timestamps aren't annotated.
+func (t TimestampSkew) Enrich(_ context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	skew, ok := Skew(cert, *metadata)
+	if !ok {
+		return nil
+	}
+
+	metadata.Annotate("timestamp.skew", skew.String())
+	if t.Flagged(cert, *metadata) {
+		metadata.Annotate("timestamp.flagged", "true")
+	}
+	return nil
+}
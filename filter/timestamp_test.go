@@ -0,0 +1,65 @@
+package filter
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestTimestampSkew(t *testing.T) {
+	notBefore := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	cert := issue(t, &x509.Certificate{NotBefore: notBefore}, newKey(t), nil, nil)
+	skew := TimestampSkew{MaxLag: time.Hour, MaxLead: 5 * time.Minute}
+
+	for _, tc := range []struct {
+		name      string
+		timestamp time.Time
+		flagged   bool
+	}{
+		{"logged on issuance", notBefore.Add(time.Minute), false},
+		{"backdated", notBefore.Add(2 * time.Hour), true},
+		{"slightly early", notBefore.Add(-time.Minute), false},
+		{"postdated", notBefore.Add(-10 * time.Minute), true},
+		{"no timestamp", time.Time{}, false},
+	} {
+		metadata := x509search.Metadata{Timestamp: tc.timestamp}
+		if got := skew.Filter()(cert, metadata); got != tc.flagged {
+			t.Errorf("%s: got %t, want %t", tc.name, got, tc.flagged)
+		}
+	}
+
+	// Lags and leads aren't flagged without a limit
+	if (TimestampSkew{}).Flagged(cert, x509search.Metadata{Timestamp: notBefore.AddDate(1, 0, 0)}) {
+		t.Error("flagged a lag without a limit")
+	}
+}
+
+func TestTimestampSkewEnrich(t *testing.T) {
+	notBefore := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	cert := issue(t, &x509.Certificate{NotBefore: notBefore}, newKey(t), nil, nil)
+	skew := TimestampSkew{MaxLag: time.Hour}
+
+	metadata := x509search.Metadata{Timestamp: notBefore.Add(90 * time.Minute)}
+	err := skew.Enrich(context.Background(), cert, &metadata)
+	if err != nil {
+		t.Fatalf("enriching: %s", err)
+	}
+	if got := metadata.Annotations["timestamp.skew"]; got != "1h30m0s" {
+		t.Errorf("annotated skew %q, want 1h30m0s", got)
+	}
+	if got := metadata.Annotations["timestamp.flagged"]; got != "true" {
+		t.Errorf("annotated flagged %q, want true", got)
+	}
+
+	metadata = x509search.Metadata{}
+	err = skew.Enrich(context.Background(), cert, &metadata)
+	if err != nil {
+		t.Fatalf("enriching: %s", err)
+	}
+	if metadata.Annotations != nil {
+		t.Errorf("annotated a match without a timestamp: %v", metadata.Annotations)
+	}
+}
@@ -0,0 +1,183 @@
+package filter
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// WatchlistEntry is a domain on a Watchlist, with the labels identifying who
+// is watching it, such as the customers to alert.
+type WatchlistEntry struct {
+	Domain string   `json:"domain"`
+	Labels []string `json:"labels"`
+}
+
+// Watchlist matches certificates for any of a list of labeled domains, and
+// attributes each match to the entries it hit, so that a monitor watching
+// domains on behalf of many parties can route each match to the right ones. A
+// certificate hits an entry if it has a DNS name equal to, or a subdomain of,
+// the entry's domain.
+//
+// Watchlist is an x509search.Enricher, annotating each match with the entries
+// it hit, so it's typically used both as a filter and as an enricher. It is
+// safe for concurrent use.
+type Watchlist struct {
+	// labels maps each domain, lowercased, to its labels
+	labels map[string][]string
+}
+
+// NewWatchlist returns a Watchlist of the given entries. Entries for the same
+// domain have their labels merged.
+func NewWatchlist(entries []WatchlistEntry) (*Watchlist, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("empty watchlist")
+	}
+
+	w := &Watchlist{
+		labels: make(map[string][]string, len(entries)),
+	}
+	for _, entry := range entries {
+		domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(entry.Domain), "."))
+		if domain == "" {
+			return nil, errors.New("watchlist entry without a domain")
+		}
+
+		labels := w.labels[domain]
+		for _, label := range entry.Labels {
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+		w.labels[domain] = labels
+	}
+	return w, nil
+}
+
+// LoadWatchlist reads a Watchlist from a file. A file named *.json holds an
+// array of WatchlistEntry objects. Any other file is CSV, one entry per
+// record: the domain followed by its labels, with records starting with "#"
+// ignored.
+func LoadWatchlist(path string) (*Watchlist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading watchlist: %w", err)
+	}
+	defer file.Close()
+
+	var entries []WatchlistEntry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.NewDecoder(file).Decode(&entries)
+		if err != nil {
+			return nil, fmt.Errorf("parsing watchlist %s: %w", path, err)
+		}
+	} else {
+		entries, err = readWatchlistCSV(file)
+		if err != nil {
+			return nil, fmt.Errorf("parsing watchlist %s: %w", path, err)
+		}
+	}
+
+	return NewWatchlist(entries)
+}
+
+// readWatchlistCSV reads watchlist entries from CSV records.
+func readWatchlistCSV(r io.Reader) ([]WatchlistEntry, error) {
+	records := csv.NewReader(r)
+	records.Comment = '#'
+	records.FieldsPerRecord = -1
+	records.TrimLeadingSpace = true
+
+	var entries []WatchlistEntry
+	for {
+		record, err := records.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := WatchlistEntry{Domain: record[0]}
+		for _, label := range record[1:] {
+			label = strings.TrimSpace(label)
+			if label != "" {
+				entry.Labels = append(entry.Labels, label)
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Len returns the number of domains on the watchlist.
+func (w *Watchlist) Len() int {
+	return len(w.labels)
+}
+
+// Hits returns the entries hit by the given DNS names, ordered by domain.
+func (w *Watchlist) Hits(names []string) []WatchlistEntry {
+	var hits []WatchlistEntry
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+		// Look up the name and each of its parent domains
+		for {
+			labels, ok := w.labels[name]
+			if ok && !slices.ContainsFunc(hits, func(hit WatchlistEntry) bool { return hit.Domain == name }) {
+				hits = append(hits, WatchlistEntry{Domain: name, Labels: slices.Clone(labels)})
+			}
+
+			_, parent, found := strings.Cut(name, ".")
+			if !found {
+				break
+			}
+			name = parent
+		}
+	}
+
+	slices.SortFunc(hits, func(a, b WatchlistEntry) int {
+		return strings.Compare(a.Domain, b.Domain)
+	})
+	return hits
+}
+
+// Filter returns a filter matching certificates that hit an entry.
+func (w *Watchlist) Filter() func(*x509.Certificate) bool {
+	return func(cert *x509.Certificate) bool {
+		return len(w.Hits(cert.DNSNames)) > 0
+	}
+}
+
+// Enrich annotates a match with the entries it hit: "watchlist.domains" lists
+// their domains, and "watchlist.labels" the distinct labels among them, each
+// sorted and separated by commas. Matches hitting no entries aren't annotated.
+func (w *Watchlist) Enrich(_ context.Context, cert *x509.Certificate, metadata *x509search.Metadata) error {
+	hits := w.Hits(cert.DNSNames)
+	if len(hits) == 0 {
+		return nil
+	}
+
+	var domains, labels []string
+	for _, hit := range hits {
+		domains = append(domains, hit.Domain)
+		labels = append(labels, hit.Labels...)
+	}
+	slices.Sort(labels)
+	labels = slices.Compact(labels)
+
+	metadata.Annotate("watchlist.domains", strings.Join(domains, ","))
+	if len(labels) > 0 {
+		metadata.Annotate("watchlist.labels", strings.Join(labels, ","))
+	}
+	return nil
+}
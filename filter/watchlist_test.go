@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"context"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestWatchlist(t *testing.T) {
+	watchlist, err := NewWatchlist([]WatchlistEntry{
+		{Domain: "Example.com.", Labels: []string{"alice"}},
+		{Domain: "example.com", Labels: []string{"bob", "alice"}},
+		{Domain: "shop.example.net", Labels: []string{"carol"}},
+	})
+	if err != nil {
+		t.Fatalf("creating watchlist: %s", err)
+	}
+	if watchlist.Len() != 2 {
+		t.Errorf("watchlist has %d domains, want 2", watchlist.Len())
+	}
+
+	hits := watchlist.Hits([]string{"www.shop.example.net", "www.example.com", "example.com", "example.net"})
+	want := []WatchlistEntry{
+		{Domain: "example.com", Labels: []string{"alice", "bob"}},
+		{Domain: "shop.example.net", Labels: []string{"carol"}},
+	}
+	if !reflect.DeepEqual(hits, want) {
+		t.Errorf("got hits %+v, want %+v", hits, want)
+	}
+
+	cert := issue(t, &x509.Certificate{DNSNames: []string{"www.example.com", "shop.example.net"}}, newKey(t), nil, nil)
+	if !watchlist.Filter()(cert) {
+		t.Error("filter didn't match a watched certificate")
+	}
+	unwatched := issue(t, &x509.Certificate{DNSNames: []string{"example.org"}}, newKey(t), nil, nil)
+	if watchlist.Filter()(unwatched) {
+		t.Error("filter matched an unwatched certificate")
+	}
+
+	var metadata x509search.Metadata
+	err = watchlist.Enrich(context.Background(), cert, &metadata)
+	if err != nil {
+		t.Fatalf("enriching: %s", err)
+	}
+	wantAnnotations := map[string]string{
+		"watchlist.domains": "example.com,shop.example.net",
+		"watchlist.labels":  "alice,bob,carol",
+	}
+	if !reflect.DeepEqual(metadata.Annotations, wantAnnotations) {
+		t.Errorf("got annotations %v, want %v", metadata.Annotations, wantAnnotations)
+	}
+
+	_, err = NewWatchlist([]WatchlistEntry{{Domain: " "}})
+	if err == nil {
+		t.Error("got no error for an entry without a domain")
+	}
+}
+
+func TestLoadWatchlist(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"watchlist.csv":  "# domain, labels\nexample.com, alice, bob\nexample.net\n",
+		"watchlist.json": `[{"domain": "example.com", "labels": ["alice", "bob"]}, {"domain": "example.net"}]`,
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(contents), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		watchlist, err := LoadWatchlist(path)
+		if err != nil {
+			t.Fatalf("loading %s: %s", name, err)
+		}
+
+		hits := watchlist.Hits([]string{"example.com", "example.net"})
+		want := []WatchlistEntry{
+			{Domain: "example.com", Labels: []string{"alice", "bob"}},
+			{Domain: "example.net", Labels: nil},
+		}
+		if !reflect.DeepEqual(hits, want) {
+			t.Errorf("%s: got hits %+v, want %+v", name, hits, want)
+		}
+	}
+}
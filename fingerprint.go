@@ -0,0 +1,199 @@
+package x509search
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// Fingerprinter computes the key a cacher de-duplicates a certificate on from
+// its DER encoding. Certificates with the same fingerprint are the same match.
+// Fingerprints shorter than 32 bytes are zero-padded, and begin with their
+// most uniformly distributed bytes, which cachers may use to partition them.
+type Fingerprinter func(der []byte) [32]byte
+
+// SHA256Fingerprint fingerprints a certificate with the SHA-256 hash of its
+// DER encoding. It's the default for every cacher.
+func SHA256Fingerprint(der []byte) [32]byte {
+	return sha256.Sum256(der)
+}
+
+// XXHash64Fingerprint fingerprints a certificate with the 64-bit xxHash of its
+// DER encoding, which is several times faster to compute than SHA-256. It
+// isn't collision-resistant, so a certificate crafted to collide with another
+// would be suppressed as a duplicate, and by chance about one in every few
+// billion pairs of certificates collide.
+func XXHash64Fingerprint(der []byte) [32]byte {
+	var fingerprint [32]byte
+	binary.BigEndian.PutUint64(fingerprint[:8], xxhash64(der))
+	return fingerprint
+}
+
+// TBSFingerprint fingerprints a certificate with the SHA-256 hash of its
+// TBSCertificate, so that certificates differing only in their signatures,
+// such as re-signed copies, are the same match. Malformed certificates are
+// fingerprinted with SHA256Fingerprint.
+func TBSFingerprint(der []byte) [32]byte {
+	tbs, err := rawTBS(der)
+	if err != nil {
+		return sha256.Sum256(der)
+	}
+	return sha256.Sum256(tbs)
+}
+
+// IssuerSerialFingerprint fingerprints a certificate with the SHA-256 hash of
+// its issuer and serial number, which RFC 5280 requires to identify it
+// uniquely. A precertificate and its final certificate share them, and so are
+// the same match, unless the precertificate was signed by a dedicated
+// precertificate signing certificate. Malformed certificates are fingerprinted
+// with SHA256Fingerprint.
+func IssuerSerialFingerprint(der []byte) [32]byte {
+	issuer, serial, err := issuerAndSerial(der)
+	if err != nil {
+		return sha256.Sum256(der)
+	}
+
+	// Both are whole DER elements, so their concatenation is unambiguous
+	h := sha256.New()
+	h.Write(issuer)
+	h.Write(serial)
+
+	var fingerprint [32]byte
+	h.Sum(fingerprint[:0])
+	return fingerprint
+}
+
+// issuerAndSerial returns the DER-encoded issuer and serial number of a
+// DER-encoded certificate.
+func issuerAndSerial(der []byte) (issuer, serial []byte, err error) {
+	tbs, err := rawTBS(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var body cryptobyte.String
+	var serialElement, issuerElement cryptobyte.String
+	input := cryptobyte.String(tbs)
+	if !input.ReadASN1(&body, cryptobyte_asn1.SEQUENCE) ||
+		!body.SkipOptionalASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) ||
+		!body.ReadASN1Element(&serialElement, cryptobyte_asn1.INTEGER) ||
+		!body.SkipASN1(cryptobyte_asn1.SEQUENCE) ||
+		!body.ReadASN1Element(&issuerElement, cryptobyte_asn1.SEQUENCE) {
+		return nil, nil, errors.New("malformed TBSCertificate")
+	}
+
+	return issuerElement, serialElement, nil
+}
+
+// CacherOption configures a cacher.
+type CacherOption func(*cacherConfig)
+
+type cacherConfig struct {
+	fingerprint Fingerprinter
+}
+
+// WithFingerprint makes a cacher de-duplicate certificates on the given
+// fingerprint rather than SHA256Fingerprint. Fingerprints from different
+// functions aren't comparable, so cachers sharing or persisting fingerprints,
+// such as a ShardedCacher restored with ReadFrom, must always use the same
+// one.
+func WithFingerprint(fingerprint Fingerprinter) CacherOption {
+	return func(c *cacherConfig) {
+		if fingerprint != nil {
+			c.fingerprint = fingerprint
+		}
+	}
+}
+
+// ApplyCacherOptions returns the fingerprint function selected by opts, for
+// cachers implemented outside this package.
+func ApplyCacherOptions(opts ...CacherOption) Fingerprinter {
+	return applyCacherOptions(opts).fingerprint
+}
+
+func applyCacherOptions(opts []CacherOption) cacherConfig {
+	config := cacherConfig{
+		fingerprint: SHA256Fingerprint,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// These are the primes of the xxHash64 algorithm. They're variables so that
+// arithmetic on them wraps around as it does at run time.
+var (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 returns the xxHash64 of b, with a seed of zero.
+func xxhash64(b []byte) uint64 {
+	n := len(b)
+
+	var h uint64
+	if n >= 32 {
+		v1 := xxPrime1 + xxPrime2
+		v2 := xxPrime2
+		v3 := uint64(0)
+		v4 := -xxPrime1
+		for len(b) >= 32 {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:32]))
+			b = b[32:]
+		}
+
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = xxPrime5
+	}
+
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	val = xxRound(0, val)
+	acc ^= val
+	return acc*xxPrime1 + xxPrime4
+}
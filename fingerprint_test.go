@@ -0,0 +1,43 @@
+package x509search
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// TestXXHash64 checks xxhash64 against the reference implementation's output,
+// with inputs covering each of its code paths: the tail of single bytes, of
+// four bytes, and of eight, and the 32-byte stripes.
+func TestXXHash64(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"as", 0x1c330fb2d66be179},
+		{"asd", 0x631c37ce72a97393},
+		{"asdf", 0x415872f599cea71e},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+		{"Call me Ishmael. Some years ago--never mind how long precisely-", 0x02a2e85470d6fd96},
+	} {
+		got := xxhash64([]byte(tc.input))
+		if got != tc.want {
+			t.Errorf("xxhash64(%q) = %#016x, want %#016x", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestXXHash64Fingerprint(t *testing.T) {
+	der := []byte("Nobody inspects the spammish repetition")
+	fingerprint := XXHash64Fingerprint(der)
+
+	// The hash leads, and the rest is zero-padded
+	if got := binary.BigEndian.Uint64(fingerprint[:8]); got != 0xfbcea83c8a378bf1 {
+		t.Errorf("fingerprint begins with %#016x, want %#016x", got, uint64(0xfbcea83c8a378bf1))
+	}
+	if [24]byte(fingerprint[8:]) != [24]byte{} {
+		t.Errorf("fingerprint isn't zero-padded: %x", fingerprint)
+	}
+}
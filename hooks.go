@@ -0,0 +1,75 @@
+package x509search
+
+import (
+	"context"
+	"crypto/x509"
+)
+
+// Hooks are functions called as a search progresses, so that applications
+// embedding a search can drive a UI or keep an audit log of it. Every hook is
+// optional.
+//
+// Data sources are identified by their name, or by "#" followed by their
+// position in Search.DataSources if they don't have one. See Namer.
+type Hooks struct {
+	// OnSourceStart is called when a data source starts, from the data
+	// source's goroutine.
+	OnSourceStart func(source string)
+
+	// OnSourceFinish is called when a data source finishes, with the error
+	// it failed with, if any, from the data source's goroutine.
+	OnSourceFinish func(source string, err error)
+
+	// OnBatch is called when a data source reports that it has fetched a
+	// batch of certificates, such as a tile of a CT log. Data sources report
+	// batches with ReportBatch, and may do so concurrently, so OnBatch must
+	// be safe for concurrent use.
+	OnBatch func(source string, batch Batch)
+
+	// OnMatch is called with each certificate matching the search filter that
+	// hasn't already been cached by MatchCacher, after it has been written to
+	// the sinks. It is called from the search's goroutine, like
+	// MatchCallback. Setting OnMatch means certificates are always parsed
+	// (see RawMatchCallback).
+	OnMatch func(cert *x509.Certificate, metadata Metadata)
+
+	// OnComplete is called once the search has finished, with the error
+	// Execute returns.
+	OnComplete func(err error)
+}
+
+// Batch describes a batch of certificates fetched by a data source.
+type Batch struct {
+	// Index identifies the batch within its data source, such as the index of
+	// a CT log tile.
+	Index int64
+
+	// Size is the number of entries in the batch, including any the data
+	// source didn't send to the search.
+	Size int
+}
+
+type batchReporterKey struct{}
+
+// ReportBatch reports that a data source has fetched a batch of certificates,
+// to the OnBatch hook of the search running it. ctx must be the context
+// passed to the data source, or derived from it. ReportBatch does nothing if
+// the search has no OnBatch hook.
+func ReportBatch(ctx context.Context, batch Batch) {
+	report, ok := ctx.Value(batchReporterKey{}).(func(Batch))
+	if ok {
+		report(batch)
+	}
+}
+
+// withBatchReporter returns a context that reports batches from the named
+// data source to hooks.
+func withBatchReporter(ctx context.Context, hooks Hooks, source string) context.Context {
+	if hooks.OnBatch == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, batchReporterKey{}, func(batch Batch) {
+		hooks.OnBatch(source, batch)
+	})
+}
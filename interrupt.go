@@ -0,0 +1,83 @@
+package x509search
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Interrupt turns SIGINT and SIGTERM into a two-phase shutdown of a search.
+// The first signal closes Stopping, which, set as Search.Stop, stops the data
+// sources while the certificates already found are still filtered and
+// delivered, so that Execute returns having lost nothing in flight. A second
+// signal cancels Context, stopping the search at once.
+type Interrupt struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	stopping chan struct{}
+	signals  chan os.Signal
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NotifyInterrupt starts handling SIGINT and SIGTERM until Release is called.
+// Its Context is derived from ctx.
+func NotifyInterrupt(ctx context.Context) *Interrupt {
+	ctx, cancel := context.WithCancel(ctx)
+
+	i := &Interrupt{
+		ctx:      ctx,
+		cancel:   cancel,
+		stopping: make(chan struct{}),
+		signals:  make(chan os.Signal, 2),
+		done:     make(chan struct{}),
+	}
+
+	signal.Notify(i.signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		defer close(i.done)
+
+		for received := 0; ; received++ {
+			select {
+			case <-i.signals:
+			case <-ctx.Done():
+				return
+			}
+
+			if received == 0 {
+				close(i.stopping)
+				continue
+			}
+
+			cancel()
+			return
+		}
+	}()
+
+	return i
+}
+
+// Context returns a context that is cancelled by the second signal, or once
+// Release is called.
+func (i *Interrupt) Context() context.Context {
+	return i.ctx
+}
+
+// Stopping returns a channel that is closed by the first signal.
+func (i *Interrupt) Stopping() <-chan struct{} {
+	return i.stopping
+}
+
+// Release stops handling signals, restoring their default behavior, and
+// cancels Context.
+func (i *Interrupt) Release() {
+	i.once.Do(func() {
+		signal.Stop(i.signals)
+		i.cancel()
+		<-i.done
+	})
+}
@@ -0,0 +1,156 @@
+package x509search
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+)
+
+// Metadata describes where and when a data source found a certificate.
+type Metadata struct {
+	// Source identifies the data source that produced the certificate, such
+	// as the URL of a CT log. It is empty if the data source doesn't provide
+	// metadata.
+	Source string
+
+	// SourceName is the name of the data source that produced the
+	// certificate, if it has one. See Namer.
+	SourceName string
+
+	// Index is the position of the certificate within its data source, such
+	// as a CT log leaf index, or -1 if the position is unknown.
+	Index int64
+
+	// Timestamp is the time the data source recorded the certificate, such as
+	// a CT log entry timestamp. It is the zero value if unknown.
+	Timestamp time.Time
+
+	// Precertificate is true if the certificate is a CT precertificate.
+	Precertificate bool
+
+	// Annotations holds information attached to a match by the search's
+	// Enrichers, such as its revocation status, keyed by a name prefixed with
+	// that of the enricher. It is nil if nothing has been attached.
+	Annotations map[string]string
+
+	// Payload is an arbitrary value attached by the data source, such as the
+	// ID of the database row or the scan target the certificate came from. It
+	// is passed through the search unchanged, so that it reaches the
+	// callbacks, enrichers, and sinks receiving the metadata. See PayloadAs.
+	Payload any
+}
+
+// PayloadAs returns the metadata's Payload as a T, and whether it holds one.
+func PayloadAs[T any](m Metadata) (T, bool) {
+	payload, ok := m.Payload.(T)
+	return payload, ok
+}
+
+// Annotate sets an annotation, creating the Annotations map if needed.
+func (m *Metadata) Annotate(key, value string) {
+	if m.Annotations == nil {
+		m.Annotations = make(map[string]string)
+	}
+	m.Annotations[key] = value
+}
+
+// Entry is a DER-encoded certificate along with the metadata describing where
+// it was found.
+type Entry struct {
+	DER []byte
+
+	// Certificate, if set, is the already-parsed form of DER, and the search
+	// uses it instead of parsing DER again. If Certificate is set, DER may be
+	// left nil, in which case Certificate.Raw is used in its place.
+	Certificate *x509.Certificate
+
+	Metadata Metadata
+}
+
+// EntrySourcer is a Sourcer that can also provide metadata for the
+// certificates it finds. Search uses SourceEntries instead of Source for data
+// sources that implement it.
+type EntrySourcer interface {
+	Sourcer
+
+	// SourceEntries behaves like Source, but sends each certificate along with
+	// its metadata over the entries channel. The same ownership rules apply to
+	// the DER bytes of each Entry.
+	SourceEntries(ctx context.Context, entries chan<- Entry) error
+}
+
+// SourcerParsed is a Sourcer for data sources that already hold parsed
+// certificates, such as APIs or databases that provide them, sparing the
+// search from parsing them again. Search uses SourceParsed in preference to
+// SourceEntries and Source for data sources that implement it.
+type SourcerParsed interface {
+	Sourcer
+
+	// SourceParsed behaves like SourceEntries, but the Certificate field of
+	// each Entry sent must be set.
+	SourceParsed(ctx context.Context, entries chan<- Entry) error
+}
+
+// sourceEntries runs dataSource, sending everything it finds over entries.
+// Certificates from data sources that don't implement EntrySourcer are sent
+// with metadata describing an unknown origin.
+func sourceEntries(ctx context.Context, dataSource Sourcer, entries chan<- Entry) error {
+	parsedSourcer, ok := dataSource.(SourcerParsed)
+	if ok {
+		return parsedSourcer.SourceParsed(ctx, entries)
+	}
+
+	entrySourcer, ok := dataSource.(EntrySourcer)
+	if ok {
+		return entrySourcer.SourceEntries(ctx, entries)
+	}
+
+	certs := make(chan []byte)
+	forwarded := make(chan struct{})
+
+	go func() {
+		defer close(forwarded)
+		for certBytes := range certs {
+			select {
+			case entries <- Entry{DER: certBytes, Metadata: Metadata{Index: -1}}:
+			case <-ctx.Done():
+				// Keep draining so that Source isn't blocked
+			}
+		}
+	}()
+
+	err := dataSource.Source(ctx, certs)
+	close(certs)
+	<-forwarded
+
+	return err
+}
+
+// sourceNamedEntries runs dataSource like sourceEntries, setting the
+// SourceName of everything it finds to name.
+func sourceNamedEntries(ctx context.Context, dataSource Sourcer, name string, entries chan<- Entry) error {
+	if name == "" {
+		return sourceEntries(ctx, dataSource, entries)
+	}
+
+	named := make(chan Entry)
+	forwarded := make(chan struct{})
+
+	go func() {
+		defer close(forwarded)
+		for entry := range named {
+			entry.Metadata.SourceName = name
+			select {
+			case entries <- entry:
+			case <-ctx.Done():
+				// Keep draining so that the data source isn't blocked
+			}
+		}
+	}()
+
+	err := sourceEntries(ctx, dataSource, named)
+	close(named)
+	<-forwarded
+
+	return err
+}
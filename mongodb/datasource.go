@@ -0,0 +1,358 @@
+// Package mongodb provides a data source reading certificates from a MongoDB
+// collection, for certificate inventories kept in a document database.
+//
+// The collection is opened by the caller, with a client from the official
+// driver, go.mongodb.org/mongo-driver/v2, configured as their deployment
+// requires.
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DefaultBatchSize is the number of documents a DataSource's cursor fetches at
+// a time when BatchSize is zero.
+const DefaultBatchSize = 1000
+
+// cursorNotFound is the code of the error a server returns for a cursor it
+// has discarded, such as after it was left idle for too long.
+const cursorNotFound = 43
+
+// Document identifies the document a certificate was read from, and is the
+// Payload of the metadata of each certificate a DataSource finds.
+type Document struct {
+	Collection string
+
+	// ID is the document's _id, such as a bson.ObjectID.
+	ID any
+}
+
+// DataSource is an x509search.Sourcer reading certificates from the documents
+// of a collection matching a filter.
+//
+// Documents are read by a cursor ordered by _id. If the cursor is lost, such
+// as when the server discards it or the connection fails, a new one is opened
+// after the last document read, and with ResumeFile set, a later read of the
+// collection also resumes where this one stopped. The documents' _ids must
+// therefore all be of one type, such as the default ObjectID, as MongoDB only
+// compares values of the same type.
+type DataSource struct {
+	Collection *mongo.Collection
+
+	// Filter is the query filter selecting the documents, such as
+	// bson.D{{"source", "scanner"}}. If nil, every document is read.
+	Filter any
+
+	// Field is the field of each document holding a certificate's DER bytes,
+	// as binary data, with the names of embedded documents separated by dots.
+	// Documents without it are skipped.
+	Field string
+
+	// TimestampField, if set, is the field of each document holding the time
+	// it was recorded, as a date or an RFC 3339 string, which is used as the
+	// Timestamp of its certificate's metadata.
+	TimestampField string
+
+	// ResumeFile, if set, is where the _id of the last document read is kept
+	// after each batch, so that a DataSource reading the same collection
+	// later resumes after it rather than starting over. Certificates are
+	// sent before their batch is recorded, so after a failure some may be
+	// sent again.
+	ResumeFile string
+
+	// BatchSize is the number of documents the cursor fetches at a time. If
+	// zero, DefaultBatchSize is used.
+	BatchSize int32
+
+	// SourceName identifies the data source. If empty, it's named after the
+	// database and collection.
+	SourceName string
+}
+
+func (d DataSource) Name() string {
+	if d.SourceName != "" {
+		return d.SourceName
+	}
+	if d.Collection == nil {
+		return "mongodb"
+	}
+	return "mongodb/" + d.Collection.Database().Name() + "." + d.Collection.Name()
+}
+
+// Source sends the DER bytes of the certificates found over certs.
+func (d DataSource) Source(ctx context.Context, certs chan<- []byte) error {
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.SourceEntries(ctx, entries)
+		close(entries)
+	}()
+
+	for entry := range entries {
+		select {
+		case certs <- entry.DER:
+		case <-ctx.Done():
+		}
+	}
+	return <-done
+}
+
+// SourceEntries sends the certificates found over entries, each with its
+// Document as its Payload. Documents whose Field isn't binary data are
+// reported on stderr and skipped.
+func (d DataSource) SourceEntries(ctx context.Context, entries chan<- x509search.Entry) error {
+	if d.Collection == nil {
+		return errors.New("no collection")
+	}
+
+	batchSize := d.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	projection := bson.D{{Key: d.Field, Value: 1}}
+	if d.TimestampField != "" {
+		projection = append(projection, bson.E{Key: d.TimestampField, Value: 1})
+	}
+
+	find := func(ctx context.Context, filter bson.D) (documents, error) {
+		cursor, err := d.Collection.Find(ctx, filter, options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetProjection(projection).
+			SetBatchSize(batchSize))
+		if err != nil {
+			return nil, err
+		}
+		return driverCursor{cursor}, nil
+	}
+
+	return d.sourceFrom(ctx, find, entries)
+}
+
+// documents is the part of a mongo.Cursor a DataSource uses.
+type documents interface {
+	Next(ctx context.Context) bool
+	Current() bson.Raw
+	RemainingBatchLength() int
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// driverCursor adapts a mongo.Cursor to documents.
+type driverCursor struct {
+	*mongo.Cursor
+}
+
+func (c driverCursor) Current() bson.Raw {
+	return c.Cursor.Current
+}
+
+// sourceFrom implements SourceEntries, reading documents from the cursors
+// opened by find, which returns the documents matching filter, ordered by
+// _id.
+func (d DataSource) sourceFrom(ctx context.Context, find func(context.Context, bson.D) (documents, error), entries chan<- x509search.Entry) error {
+	if d.Field == "" {
+		return errors.New("no field")
+	}
+
+	var lastID *bson.RawValue
+	if d.ResumeFile != "" {
+		var err error
+		lastID, err = readResumeFile(d.ResumeFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		cursor, err := find(ctx, d.filter(lastID))
+		if err != nil {
+			return fmt.Errorf("querying %s: %w", d.Name(), err)
+		}
+
+		progressed := false
+		for cursor.Next(ctx) {
+			id, err := d.sendDocument(ctx, cursor.Current(), entries)
+			if err != nil {
+				cursor.Close(context.WithoutCancel(ctx))
+				return err
+			}
+			lastID = &id
+			progressed = true
+
+			if d.ResumeFile != "" && cursor.RemainingBatchLength() == 0 {
+				err = writeResumeFile(d.ResumeFile, id)
+				if err != nil {
+					cursor.Close(context.WithoutCancel(ctx))
+					return err
+				}
+			}
+		}
+
+		err = cursor.Err()
+		cursor.Close(context.WithoutCancel(ctx))
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Resume after a lost cursor, unless it was lost before reading
+		// anything, in which case a new one is likely to be lost too
+		if !progressed || !cursorLost(err) {
+			return fmt.Errorf("reading %s: %w", d.Name(), err)
+		}
+		fmt.Fprintf(os.Stderr, "%s: resuming after lost cursor: %s\n", d.Name(), err.Error())
+	}
+}
+
+// filter returns the filter selecting the documents after lastID, if any.
+func (d DataSource) filter(lastID *bson.RawValue) bson.D {
+	var after bson.D
+	if lastID != nil {
+		after = bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: *lastID}}}}
+	}
+
+	switch {
+	case d.Filter == nil && after == nil:
+		return bson.D{}
+	case d.Filter == nil:
+		return after
+	case after == nil:
+		return bson.D{{Key: "$and", Value: bson.A{d.Filter}}}
+	default:
+		return bson.D{{Key: "$and", Value: bson.A{d.Filter, after}}}
+	}
+}
+
+// sendDocument sends the certificate in document over entries, if it has
+// one, and returns the document's _id.
+func (d DataSource) sendDocument(ctx context.Context, document bson.Raw, entries chan<- x509search.Entry) (bson.RawValue, error) {
+	id, err := document.LookupErr("_id")
+	if err != nil {
+		return bson.RawValue{}, fmt.Errorf("reading %s: document without _id", d.Name())
+	}
+
+	// The cursor may reuse the document's memory once it moves on
+	id = bson.RawValue{Type: id.Type, Value: append([]byte(nil), id.Value...)}
+
+	var payload Document
+	payload.ID = id
+	var decoded any
+	if id.Unmarshal(&decoded) == nil {
+		payload.ID = decoded
+	}
+	if d.Collection != nil {
+		payload.Collection = d.Collection.Name()
+	}
+
+	value, err := document.LookupErr(strings.Split(d.Field, ".")...)
+	if err != nil {
+		return id, nil
+	}
+
+	_, der, ok := value.BinaryOK()
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%s: document %v: %s isn't binary data\n", d.Name(), payload.ID, d.Field)
+		return id, nil
+	}
+
+	metadata := x509search.Metadata{
+		Source:  d.Name(),
+		Index:   -1,
+		Payload: payload,
+	}
+	if d.TimestampField != "" {
+		timestamp, err := document.LookupErr(strings.Split(d.TimestampField, ".")...)
+		if err == nil {
+			if t, ok := timestamp.TimeOK(); ok {
+				metadata.Timestamp = t
+			} else if s, ok := timestamp.StringValueOK(); ok {
+				metadata.Timestamp, _ = time.Parse(time.RFC3339Nano, s)
+			}
+		}
+	}
+
+	select {
+	case entries <- x509search.Entry{DER: append([]byte(nil), der...), Metadata: metadata}:
+	case <-ctx.Done():
+		return id, ctx.Err()
+	}
+	return id, nil
+}
+
+// cursorLost reports whether err means the cursor is gone but the collection
+// can still be read, so that a new cursor can take over.
+func cursorLost(err error) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(cursorNotFound) {
+		return true
+	}
+	return mongo.IsNetworkError(err)
+}
+
+// readResumeFile returns the _id stored in path, or nil if it doesn't exist.
+func readResumeFile(path string) (*bson.RawValue, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading resume file: %w", err)
+	}
+
+	err = bson.Raw(data).Validate()
+	if err != nil {
+		return nil, fmt.Errorf("parsing resume file %s: %w", path, err)
+	}
+
+	id, err := bson.Raw(data).LookupErr("_id")
+	if err != nil {
+		return nil, fmt.Errorf("parsing resume file %s: %w", path, err)
+	}
+	return &id, nil
+}
+
+// writeResumeFile stores id in path, as a BSON document so that it keeps its
+// type. The file is replaced atomically, so a crash leaves either the old or
+// the new position.
+func writeResumeFile(path string, id bson.RawValue) error {
+	data, err := bson.Marshal(bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return fmt.Errorf("encoding resume position: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing resume file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("writing resume file: %w", err)
+	}
+	return nil
+}
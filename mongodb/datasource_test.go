@@ -0,0 +1,311 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// fakeCollection holds documents, ordered by their int32 _ids, and serves
+// them like a mongo.Cursor would.
+type fakeCollection struct {
+	documents []bson.Raw
+	batchSize int
+
+	// failAfter, if positive, makes the next cursor opened fail with err
+	// after returning that many documents.
+	failAfter int
+	err       error
+
+	// filters records the filters of the cursors opened.
+	filters []bson.Raw
+}
+
+func (c *fakeCollection) add(t *testing.T, document bson.D) {
+	t.Helper()
+
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		t.Fatalf("encoding document: %s", err)
+	}
+	c.documents = append(c.documents, raw)
+}
+
+func (c *fakeCollection) find(ctx context.Context, filter bson.D) (documents, error) {
+	data, err := bson.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+	raw := bson.Raw(data)
+	c.filters = append(c.filters, raw)
+
+	// Only the _id condition the data source adds is evaluated
+	after := int32(-1)
+	for _, path := range [][]string{{"_id", "$gt"}, {"$and", "1", "_id", "$gt"}} {
+		value, err := raw.LookupErr(path...)
+		if err == nil {
+			after = value.Int32()
+		}
+	}
+
+	cursor := &fakeCursor{batchSize: c.batchSize, failAfter: c.failAfter, err: c.err}
+	for _, document := range c.documents {
+		if document.Lookup("_id").Int32() > after {
+			cursor.documents = append(cursor.documents, document)
+		}
+	}
+	c.failAfter = 0
+	return cursor, nil
+}
+
+type fakeCursor struct {
+	documents []bson.Raw
+	batchSize int
+	position  int
+
+	failAfter int
+	err       error
+	failed    bool
+}
+
+func (c *fakeCursor) Next(ctx context.Context) bool {
+	if c.failAfter > 0 && c.position == c.failAfter {
+		c.failed = true
+		return false
+	}
+	if c.position == len(c.documents) {
+		return false
+	}
+	c.position++
+	return true
+}
+
+func (c *fakeCursor) Current() bson.Raw {
+	return c.documents[c.position-1]
+}
+
+func (c *fakeCursor) RemainingBatchLength() int {
+	end := min(((c.position-1)/c.batchSize+1)*c.batchSize, len(c.documents))
+	return end - c.position
+}
+
+func (c *fakeCursor) Err() error {
+	if c.failed {
+		return c.err
+	}
+	return nil
+}
+
+func (c *fakeCursor) Close(ctx context.Context) error {
+	return nil
+}
+
+// read runs d against collection and returns the entries found.
+func read(t *testing.T, d DataSource, collection *fakeCollection) ([]x509search.Entry, error) {
+	t.Helper()
+
+	entries := make(chan x509search.Entry, len(collection.documents))
+	err := d.sourceFrom(context.Background(), collection.find, entries)
+	close(entries)
+
+	var found []x509search.Entry
+	for entry := range entries {
+		found = append(found, entry)
+	}
+	return found, err
+}
+
+// ids returns the _ids of the documents entries were read from.
+func ids(entries []x509search.Entry) []int32 {
+	var ids []int32
+	for _, entry := range entries {
+		ids = append(ids, entry.Metadata.Payload.(Document).ID.(int32))
+	}
+	return ids
+}
+
+func equalIDs(a []int32, b ...int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func binary(data ...byte) bson.Binary {
+	return bson.Binary{Data: data}
+}
+
+func TestSourceEntries(t *testing.T) {
+	recorded := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	collection := &fakeCollection{batchSize: 10}
+	collection.add(t, bson.D{{Key: "_id", Value: int32(1)}, {Key: "tls", Value: bson.D{{Key: "der", Value: binary(1, 2, 3)}}}, {Key: "seen", Value: bson.NewDateTimeFromTime(recorded)}})
+	collection.add(t, bson.D{{Key: "_id", Value: int32(2)}, {Key: "other", Value: "no certificate"}})
+	collection.add(t, bson.D{{Key: "_id", Value: int32(3)}, {Key: "tls", Value: bson.D{{Key: "der", Value: "not binary"}}}})
+	collection.add(t, bson.D{{Key: "_id", Value: int32(4)}, {Key: "tls", Value: bson.D{{Key: "der", Value: binary(4)}}}, {Key: "seen", Value: recorded.Format(time.RFC3339)}})
+
+	d := DataSource{Field: "tls.der", TimestampField: "seen", SourceName: "inventory"}
+	found, err := read(t, d, collection)
+	if err != nil {
+		t.Fatalf("reading: %s", err)
+	}
+
+	if !equalIDs(ids(found), 1, 4) {
+		t.Fatalf("got documents %v, want [1 4]", ids(found))
+	}
+	if !bytes.Equal(found[0].DER, []byte{1, 2, 3}) || !bytes.Equal(found[1].DER, []byte{4}) {
+		t.Errorf("got DER %x and %x, want 010203 and 04", found[0].DER, found[1].DER)
+	}
+	for _, entry := range found {
+		if !entry.Metadata.Timestamp.Equal(recorded) {
+			t.Errorf("document %v: got timestamp %s, want %s", entry.Metadata.Payload, entry.Metadata.Timestamp, recorded)
+		}
+		if entry.Metadata.Source != "inventory" {
+			t.Errorf("got source %q, want %q", entry.Metadata.Source, "inventory")
+		}
+	}
+}
+
+func TestSourceEntriesFilter(t *testing.T) {
+	collection := &fakeCollection{batchSize: 10}
+	collection.add(t, bson.D{{Key: "_id", Value: int32(1)}, {Key: "der", Value: binary(1)}})
+
+	d := DataSource{Field: "der", Filter: bson.D{{Key: "environment", Value: "production"}}}
+	_, err := read(t, d, collection)
+	if err != nil {
+		t.Fatalf("reading: %s", err)
+	}
+
+	value, err := collection.filters[0].LookupErr("$and", "0", "environment")
+	if err != nil || value.StringValue() != "production" {
+		t.Errorf("filter %s doesn't include the configured filter", collection.filters[0])
+	}
+}
+
+func TestResumeFile(t *testing.T) {
+	resumeFile := filepath.Join(t.TempDir(), "resume")
+
+	collection := &fakeCollection{batchSize: 2}
+	for id := int32(1); id <= 5; id++ {
+		collection.add(t, bson.D{{Key: "_id", Value: id}, {Key: "der", Value: binary(byte(id))}})
+	}
+
+	d := DataSource{Field: "der", ResumeFile: resumeFile, Filter: bson.D{{Key: "environment", Value: "production"}}}
+	found, err := read(t, d, collection)
+	if err != nil {
+		t.Fatalf("reading: %s", err)
+	}
+	if !equalIDs(ids(found), 1, 2, 3, 4, 5) {
+		t.Fatalf("got documents %v, want [1 2 3 4 5]", ids(found))
+	}
+
+	collection.add(t, bson.D{{Key: "_id", Value: int32(6)}, {Key: "der", Value: binary(6)}})
+	collection.add(t, bson.D{{Key: "_id", Value: int32(7)}, {Key: "der", Value: binary(7)}})
+
+	found, err = read(t, d, collection)
+	if err != nil {
+		t.Fatalf("resuming: %s", err)
+	}
+	if !equalIDs(ids(found), 6, 7) {
+		t.Fatalf("resumed with documents %v, want [6 7]", ids(found))
+	}
+
+	// The configured filter still applies when resuming
+	resumed := collection.filters[len(collection.filters)-1]
+	_, err = resumed.LookupErr("$and", "0", "environment")
+	if err != nil {
+		t.Errorf("resumed filter %s doesn't include the configured filter", resumed)
+	}
+
+	found, err = read(t, d, collection)
+	if err != nil {
+		t.Fatalf("resuming: %s", err)
+	}
+	if len(found) != 0 {
+		t.Errorf("resumed with documents %v, want none", ids(found))
+	}
+}
+
+func TestResumeFileMalformed(t *testing.T) {
+	resumeFile := filepath.Join(t.TempDir(), "resume")
+	err := os.WriteFile(resumeFile, []byte("not BSON"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection := &fakeCollection{batchSize: 2}
+	_, err = read(t, DataSource{Field: "der", ResumeFile: resumeFile}, collection)
+	if err == nil {
+		t.Error("got no error for a malformed resume file")
+	}
+}
+
+func TestLostCursor(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{"cursor not found", mongo.CommandError{Code: cursorNotFound, Message: "cursor id 1 not found"}},
+		{"network error", mongo.CommandError{Labels: []string{"NetworkError"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			collection := &fakeCollection{batchSize: 2, failAfter: 3, err: tc.err}
+			for id := int32(1); id <= 5; id++ {
+				collection.add(t, bson.D{{Key: "_id", Value: id}, {Key: "der", Value: binary(byte(id))}})
+			}
+
+			found, err := read(t, DataSource{Field: "der"}, collection)
+			if err != nil {
+				t.Fatalf("reading: %s", err)
+			}
+			if !equalIDs(ids(found), 1, 2, 3, 4, 5) {
+				t.Errorf("got documents %v, want [1 2 3 4 5]", ids(found))
+			}
+			if len(collection.filters) != 2 {
+				t.Errorf("opened %d cursors, want 2", len(collection.filters))
+			}
+		})
+	}
+}
+
+func TestLostCursorWithoutProgress(t *testing.T) {
+	lost := mongo.CommandError{Code: cursorNotFound}
+	collection := &fakeCollection{batchSize: 2, failAfter: -1, err: lost}
+	collection.add(t, bson.D{{Key: "_id", Value: int32(1)}, {Key: "der", Value: binary(1)}})
+
+	// A cursor lost before returning anything isn't resumed
+	cursor := &fakeCursor{batchSize: 2, failed: true, err: lost}
+	find := func(context.Context, bson.D) (documents, error) {
+		return cursor, nil
+	}
+
+	err := DataSource{Field: "der"}.sourceFrom(context.Background(), find, make(chan x509search.Entry, 1))
+	if !errors.As(err, new(mongo.CommandError)) {
+		t.Errorf("got error %v, want the lost cursor's", err)
+	}
+}
+
+func TestOtherCursorErrors(t *testing.T) {
+	failure := mongo.CommandError{Code: 13, Message: "unauthorized"}
+	collection := &fakeCollection{batchSize: 2, failAfter: 1, err: failure}
+	collection.add(t, bson.D{{Key: "_id", Value: int32(1)}, {Key: "der", Value: binary(1)}})
+	collection.add(t, bson.D{{Key: "_id", Value: int32(2)}, {Key: "der", Value: binary(2)}})
+
+	_, err := read(t, DataSource{Field: "der"}, collection)
+	if !errors.As(err, new(mongo.CommandError)) {
+		t.Errorf("got error %v, want the cursor's", err)
+	}
+}
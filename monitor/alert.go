@@ -0,0 +1,171 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/filter"
+	"github.com/letsencrypt/x509search/sink"
+)
+
+// Alert describes a new certificate for a watched domain.
+type Alert struct {
+	Certificate *x509.Certificate
+
+	// Metadata describes where the certificate was found.
+	Metadata x509search.Metadata
+
+	// Hits are the watchlist entries the certificate hit, with their labels.
+	Hits []filter.WatchlistEntry
+}
+
+// Domains returns the watched domains the certificate hit.
+func (a Alert) Domains() []string {
+	domains := make([]string, len(a.Hits))
+	for i, hit := range a.Hits {
+		domains[i] = hit.Domain
+	}
+	return domains
+}
+
+// Labels returns the distinct labels of the watchlist entries the certificate
+// hit, sorted.
+func (a Alert) Labels() []string {
+	var labels []string
+	for _, hit := range a.Hits {
+		labels = append(labels, hit.Labels...)
+	}
+	slices.Sort(labels)
+	return slices.Compact(labels)
+}
+
+// Alerter is notified of each new certificate for a watched domain. A single
+// goroutine is responsible for invoking Alert.
+type Alerter interface {
+	Alert(ctx context.Context, alert Alert) error
+}
+
+// AlerterFunc adapts a function to an Alerter.
+type AlerterFunc func(ctx context.Context, alert Alert) error
+
+func (f AlerterFunc) Alert(ctx context.Context, alert Alert) error {
+	return f(ctx, alert)
+}
+
+// WriterAlerter writes a line describing each alert to a writer, such as
+// stdout or a log file.
+type WriterAlerter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterAlerter(w io.Writer) *WriterAlerter {
+	return &WriterAlerter{w: w}
+}
+
+func (w *WriterAlerter) Alert(_ context.Context, alert Alert) error {
+	match := sink.NewMatch(alert.Certificate, alert.Metadata)
+
+	kind := "certificate"
+	if alert.Metadata.Precertificate {
+		kind = "precertificate"
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := fmt.Fprintf(w.w, "new %s for %s: %s, issued by %s, valid until %s, names %s\n",
+		kind, strings.Join(alert.Domains(), ","), match.Fingerprint, match.Issuer,
+		match.NotAfter.UTC().Format(time.RFC3339), strings.Join(match.SANs, ","))
+	return err
+}
+
+// Webhook posts each alert to a URL as a JSON object, such as to a chat
+// service or an incident management system. Responses other than 2xx are
+// errors.
+type Webhook struct {
+	URL string
+
+	// HTTPClient makes the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// UserAgent is sent with each request. If empty,
+	// x509search.DefaultUserAgent is used.
+	UserAgent string
+}
+
+// webhookPayload is the JSON object posted by a Webhook.
+type webhookPayload struct {
+	Fingerprint    string            `json:"fingerprint"`
+	Serial         string            `json:"serial"`
+	Subject        string            `json:"subject"`
+	Issuer         string            `json:"issuer"`
+	SANs           []string          `json:"sans"`
+	NotBefore      time.Time         `json:"not_before"`
+	NotAfter       time.Time         `json:"not_after"`
+	Precertificate bool              `json:"precertificate"`
+	Source         string            `json:"source"`
+	Domains        []string          `json:"domains"`
+	Labels         []string          `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+}
+
+func (w Webhook) Alert(ctx context.Context, alert Alert) error {
+	match := sink.NewMatch(alert.Certificate, alert.Metadata)
+	body, err := json.Marshal(webhookPayload{
+		Fingerprint:    match.Fingerprint,
+		Serial:         match.Serial,
+		Subject:        match.Subject,
+		Issuer:         match.Issuer,
+		SANs:           match.SANs,
+		NotBefore:      match.NotBefore.UTC(),
+		NotAfter:       match.NotAfter.UTC(),
+		Precertificate: alert.Metadata.Precertificate,
+		Source:         alert.Metadata.Source,
+		Domains:        alert.Domains(),
+		Labels:         alert.Labels(),
+		Annotations:    alert.Metadata.Annotations,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding alert: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	userAgent := w.UserAgent
+	if userAgent == "" {
+		userAgent = x509search.DefaultUserAgent
+	}
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set("Content-Type", "application/json")
+
+	client := w.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("posting alert: %w", err)
+	}
+	defer response.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status from %s: %s", request.URL.Host, response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package monitor watches CT logs for new certificates for a set of domains,
+// and alerts on each one, once. It assembles an x509search.Search from data
+// sources that follow their logs, a filter.Watchlist, a persistent record of
+// the certificates already alerted on, and a set of Alerters, for the common
+// case of wanting to be told about certificates for one's own domains.
+package monitor
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/cacher"
+	"github.com/letsencrypt/x509search/filter"
+	"github.com/letsencrypt/x509search/staticctapi"
+)
+
+// DefaultMaxConnections is the number of concurrent connections a Monitor
+// without DataSources makes to the logs it follows when MaxConnections is
+// zero.
+const DefaultMaxConnections = 16
+
+// Monitor follows CT logs, alerting on each new certificate, or
+// precertificate, for a domain on its watchlist.
+type Monitor struct {
+	// Watchlist holds the domains watched. A certificate is alerted on if it
+	// has a DNS name equal to, or a subdomain of, one of them.
+	Watchlist *filter.Watchlist
+
+	// Alerters are notified of each new certificate, in the order they're
+	// listed. An Alerter that fails is reported on stderr, and doesn't stop
+	// the Monitor or the Alerters after it.
+	Alerters []Alerter
+
+	// StateDir, if set, is a directory holding the fingerprints of the
+	// certificates already alerted on, so that a restarted Monitor doesn't
+	// alert on them again. It is created if it doesn't exist. If StateDir is
+	// empty, they're only remembered while the Monitor runs.
+	StateDir string
+
+	// Since is the time the logs are followed from. If it's zero, only
+	// certificates logged after the Monitor starts are alerted on. Setting it
+	// to the time a Monitor with the same StateDir last stopped catches up on
+	// the certificates logged in between, without repeating alerts.
+	Since time.Time
+
+	// DataSources are the data sources watched, which should follow their
+	// logs, as a Monitor runs until they're exhausted. If it's empty, every
+	// usable log in the log list at LogListURL is followed.
+	DataSources []x509search.Sourcer
+
+	// LogListURL is the v3 log list the logs are taken from if DataSources is
+	// empty. If it's empty, staticctapi.DefaultLogListURL is used.
+	LogListURL string
+
+	// MaxConnections bounds the concurrent connections made to the logs if
+	// DataSources is empty. If it's zero, DefaultMaxConnections is used.
+	MaxConnections int
+
+	// Progress, if set, is updated as the Monitor runs.
+	Progress *x509search.Progress
+}
+
+// Watch follows every usable CT log, calling fn with each certificate logged
+// from now on for one of the given domains, until ctx is done. It is the
+// simplest use of a Monitor, remembering the certificates alerted on only
+// while it runs.
+func Watch(ctx context.Context, domains []string, fn func(Alert)) error {
+	entries := make([]filter.WatchlistEntry, len(domains))
+	for i, domain := range domains {
+		entries[i] = filter.WatchlistEntry{Domain: domain}
+	}
+
+	watchlist, err := filter.NewWatchlist(entries)
+	if err != nil {
+		return err
+	}
+
+	m := Monitor{
+		Watchlist: watchlist,
+		Alerters: []Alerter{AlerterFunc(func(_ context.Context, alert Alert) error {
+			fn(alert)
+			return nil
+		})},
+	}
+	return m.Run(ctx)
+}
+
+// Run follows the logs until ctx is done, returning nil once it is, or until
+// the data sources fail or are exhausted.
+func (m *Monitor) Run(ctx context.Context) error {
+	if m.Watchlist == nil {
+		return errors.New("no watchlist")
+	}
+	if len(m.Alerters) == 0 {
+		return errors.New("no alerters")
+	}
+
+	dataSources := m.DataSources
+	errorBehavior := x509search.ErrorBehaviorCancel
+	if len(dataSources) == 0 {
+		var err error
+		dataSources, err = m.followLogs(ctx)
+		if err != nil {
+			return err
+		}
+
+		// One unreachable log shouldn't stop the others being watched
+		errorBehavior = x509search.ErrorBehaviorContinue
+	}
+
+	var seen x509search.Cacher = x509search.NewSha256MapCacher()
+	if m.StateDir != "" {
+		disk, err := cacher.OpenDisk(m.StateDir, cacher.DiskOptions{})
+		if err != nil {
+			return fmt.Errorf("opening state: %w", err)
+		}
+		defer func() {
+			err := disk.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "closing state: %s\n", err.Error())
+			}
+		}()
+		seen = disk
+	}
+
+	search := x509search.Search{
+		Filter:                  m.Watchlist.Filter(),
+		MatchCacher:             seen,
+		Sinks:                   []x509search.Sink{alertSink{ctx: ctx, monitor: m}},
+		DataSources:             dataSources,
+		DataSourceErrorBehavior: errorBehavior,
+		Progress:                m.Progress,
+	}
+
+	err := search.Execute(ctx)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil
+	}
+	return err
+}
+
+// followLogs returns data sources following every usable log in the log list.
+func (m *Monitor) followLogs(ctx context.Context) ([]x509search.Sourcer, error) {
+	listURL := m.LogListURL
+	if listURL == "" {
+		listURL = staticctapi.DefaultLogListURL
+	}
+
+	logs, err := staticctapi.FetchLogList(ctx, nil, listURL)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConnections := m.MaxConnections
+	if maxConnections == 0 {
+		maxConnections = DefaultMaxConnections
+	}
+
+	// Starting after the end of a log follows it from its next tile
+	since := m.Since
+	if since.IsZero() {
+		since = time.Now()
+	}
+
+	return staticctapi.UsableDataSources(logs, staticctapi.DataSource{
+		IncludePrecertificates: true,
+		IncludeCertificates:    true,
+		StartTimeInclusive:     since,
+		Clamp:                  true,
+		Follow:                 true,
+	}, maxConnections)
+}
+
+// alert notifies each of the Monitor's Alerters of a new certificate.
+func (m *Monitor) alert(ctx context.Context, cert *x509.Certificate, metadata x509search.Metadata) {
+	alert := Alert{
+		Certificate: cert,
+		Metadata:    metadata,
+		Hits:        m.Watchlist.Hits(cert.DNSNames),
+	}
+
+	for _, alerter := range m.Alerters {
+		err := alerter.Alert(ctx, alert)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "alerting on %s: %s\n", cert.Subject, err.Error())
+		}
+	}
+}
+
+// alertSink is the x509search.Sink passing a Monitor's matches to its
+// Alerters.
+type alertSink struct {
+	ctx     context.Context
+	monitor *Monitor
+}
+
+func (a alertSink) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	a.monitor.alert(a.ctx, cert, metadata)
+	return nil
+}
+
+func (a alertSink) Close() error {
+	return nil
+}
@@ -0,0 +1,214 @@
+package monitor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+	"github.com/letsencrypt/x509search/filter"
+)
+
+// issue returns a self-signed certificate for names.
+func issue(t *testing.T, serial int64, names ...string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// staticSource sends a fixed set of certificates.
+type staticSource []*x509.Certificate
+
+func (s staticSource) Source(ctx context.Context, certs chan<- []byte) error {
+	for _, cert := range s {
+		select {
+		case certs <- cert.Raw:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func newWatchlist(t *testing.T, entries ...filter.WatchlistEntry) *filter.Watchlist {
+	t.Helper()
+
+	watchlist, err := filter.NewWatchlist(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return watchlist
+}
+
+// collect returns an Alerter appending each alert to alerts.
+func collect(alerts *[]Alert) Alerter {
+	return AlerterFunc(func(_ context.Context, alert Alert) error {
+		*alerts = append(*alerts, alert)
+		return nil
+	})
+}
+
+func TestRun(t *testing.T) {
+	watched := issue(t, 1, "www.example.com")
+	other := issue(t, 2, "www.example.net")
+
+	var alerts []Alert
+	m := Monitor{
+		Watchlist:   newWatchlist(t, filter.WatchlistEntry{Domain: "example.com", Labels: []string{"prod"}}),
+		Alerters:    []Alerter{collect(&alerts)},
+		DataSources: []x509search.Sourcer{staticSource{watched, other, watched}},
+	}
+
+	err := m.Run(context.Background())
+	if err != nil {
+		t.Fatalf("running monitor: %s", err)
+	}
+
+	// The watched certificate is alerted on once, with the entry it hit
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if alerts[0].Certificate.SerialNumber.Int64() != 1 {
+		t.Errorf("alerted on certificate %s", alerts[0].Certificate.SerialNumber)
+	}
+	if !slices.Equal(alerts[0].Domains(), []string{"example.com"}) || !slices.Equal(alerts[0].Labels(), []string{"prod"}) {
+		t.Errorf("alert hit domains %q with labels %q", alerts[0].Domains(), alerts[0].Labels())
+	}
+}
+
+func TestRunStateDir(t *testing.T) {
+	stateDir := t.TempDir()
+	first := issue(t, 1, "a.example.com")
+	second := issue(t, 2, "b.example.com")
+
+	run := func(certs ...*x509.Certificate) []Alert {
+		var alerts []Alert
+		m := Monitor{
+			Watchlist:   newWatchlist(t, filter.WatchlistEntry{Domain: "example.com"}),
+			Alerters:    []Alerter{collect(&alerts)},
+			StateDir:    stateDir,
+			DataSources: []x509search.Sourcer{staticSource(certs)},
+		}
+
+		err := m.Run(context.Background())
+		if err != nil {
+			t.Fatalf("running monitor: %s", err)
+		}
+		return alerts
+	}
+
+	if alerts := run(first); len(alerts) != 1 {
+		t.Fatalf("first run raised %d alerts, want 1", len(alerts))
+	}
+
+	// A restarted Monitor remembers the certificate already alerted on
+	alerts := run(first, second)
+	if len(alerts) != 1 || alerts[0].Certificate.SerialNumber.Int64() != 2 {
+		t.Errorf("second run raised %d alerts, want one for the new certificate", len(alerts))
+	}
+}
+
+func TestRunRequiresWatchlistAndAlerters(t *testing.T) {
+	err := (&Monitor{Alerters: []Alerter{collect(new([]Alert))}}).Run(context.Background())
+	if err == nil {
+		t.Error("running without a watchlist succeeded")
+	}
+
+	err = (&Monitor{Watchlist: newWatchlist(t, filter.WatchlistEntry{Domain: "example.com"})}).Run(context.Background())
+	if err == nil {
+		t.Error("running without alerters succeeded")
+	}
+}
+
+func TestWriterAlerter(t *testing.T) {
+	var out strings.Builder
+	alert := Alert{
+		Certificate: issue(t, 1, "www.example.com"),
+		Metadata:    x509search.Metadata{Precertificate: true},
+		Hits:        []filter.WatchlistEntry{{Domain: "example.com"}},
+	}
+
+	err := NewWriterAlerter(&out).Alert(context.Background(), alert)
+	if err != nil {
+		t.Fatalf("writing alert: %s", err)
+	}
+
+	line := out.String()
+	if !strings.HasPrefix(line, "new precertificate for example.com: ") || !strings.HasSuffix(line, "names www.example.com\n") {
+		t.Errorf("wrote %q", line)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var payload webhookPayload
+	var userAgent string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		body, _ := io.ReadAll(r.Body)
+		err := json.Unmarshal(body, &payload)
+		if err != nil {
+			t.Errorf("decoding alert: %s", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	alert := Alert{
+		Certificate: issue(t, 1, "www.example.com"),
+		Metadata:    x509search.Metadata{Source: "log"},
+		Hits:        []filter.WatchlistEntry{{Domain: "example.com", Labels: []string{"prod", "web"}}},
+	}
+	webhook := Webhook{URL: server.URL}
+
+	err := webhook.Alert(context.Background(), alert)
+	if err != nil {
+		t.Fatalf("posting alert: %s", err)
+	}
+	if userAgent != x509search.DefaultUserAgent {
+		t.Errorf("sent User-Agent %q", userAgent)
+	}
+	if payload.Source != "log" || !slices.Equal(payload.Domains, []string{"example.com"}) ||
+		!slices.Equal(payload.Labels, []string{"prod", "web"}) || !slices.Equal(payload.SANs, []string{"www.example.com"}) {
+		t.Errorf("posted %+v", payload)
+	}
+
+	status = http.StatusInternalServerError
+	err = webhook.Alert(context.Background(), alert)
+	if err == nil {
+		t.Error("posting to a failing webhook succeeded")
+	}
+}
@@ -0,0 +1,51 @@
+package x509search
+
+import (
+	"context"
+)
+
+// Namer is implemented by data sources that have a name, such as the log a
+// staticctapi.DataSource searches. The name identifies the data source in
+// error messages, in Progress, and in the Metadata.SourceName of the
+// certificates it finds.
+type Namer interface {
+	Name() string
+}
+
+// SourceName returns the name of dataSource, or an empty string if it doesn't
+// implement Namer.
+func SourceName(dataSource Sourcer) string {
+	namer, ok := dataSource.(Namer)
+	if !ok {
+		return ""
+	}
+	return namer.Name()
+}
+
+// Named gives dataSource a name, replacing any name it already has. The
+// returned data source provides metadata and parsed certificates if
+// dataSource does.
+func Named(name string, dataSource Sourcer) Sourcer {
+	return namedSource{
+		name:    name,
+		Sourcer: dataSource,
+	}
+}
+
+// namedSource is a Sourcer wrapped by Named.
+type namedSource struct {
+	Sourcer
+
+	name string
+}
+
+// Name returns the name given to the data source.
+func (n namedSource) Name() string {
+	return n.name
+}
+
+// SourceEntries runs the wrapped data source, sending its certificates with
+// whatever metadata it provides.
+func (n namedSource) SourceEntries(ctx context.Context, entries chan<- Entry) error {
+	return sourceEntries(ctx, n.Sourcer, entries)
+}
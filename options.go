@@ -0,0 +1,240 @@
+package x509search
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+// Option configures a Search built by NewSearch.
+type Option func(*Search) error
+
+// NewSearch returns a Search configured by opts, which are applied in order.
+// It returns an error if an option is invalid, or if the resulting search
+// lacks a filter, a match handler, or a data source. Unlike the zero Search,
+// a Search built by NewSearch de-duplicates matches with a ShardedCacher
+// unless WithCacher says otherwise.
+func NewSearch(opts ...Option) (Search, error) {
+	var s Search
+	for _, opt := range opts {
+		err := opt(&s)
+		if err != nil {
+			return Search{}, err
+		}
+	}
+
+	if s.MatchCacher == nil {
+		s.MatchCacher = NewShardedCacher(0)
+	}
+
+	err := s.ValidateParameters()
+	if err != nil {
+		return Search{}, err
+	}
+
+	return s, nil
+}
+
+// WithSource adds a data source to the search.
+func WithSource(source Sourcer) Option {
+	return func(s *Search) error {
+		if source == nil {
+			return errors.New("nil data source")
+		}
+
+		s.DataSources = append(s.DataSources, source)
+		return nil
+	}
+}
+
+// WithConcurrency bounds how many data sources are read at once (see
+// Search.MaxConcurrentSources).
+func WithConcurrency(n int) Option {
+	return func(s *Search) error {
+		if n < 1 {
+			return errors.New("concurrency must be at least 1")
+		}
+
+		s.MaxConcurrentSources = n
+		return nil
+	}
+}
+
+// WithDERFilter adds a filter on the DER bytes of certificates. If it's used
+// more than once, certificates must pass every filter.
+func WithDERFilter(filter func([]byte) bool) Option {
+	return func(s *Search) error {
+		if filter == nil {
+			return errors.New("nil DER filter")
+		}
+
+		previous := s.DERFilter
+		if previous == nil {
+			s.DERFilter = filter
+			return nil
+		}
+
+		s.DERFilter = func(der []byte) bool {
+			return previous(der) && filter(der)
+		}
+		return nil
+	}
+}
+
+// WithFilter adds a filter on parsed certificates. If it's used more than
+// once, certificates must pass every filter.
+func WithFilter(filter func(*x509.Certificate) bool) Option {
+	return func(s *Search) error {
+		if filter == nil {
+			return errors.New("nil filter")
+		}
+
+		previous := s.Filter
+		if previous == nil {
+			s.Filter = filter
+			return nil
+		}
+
+		s.Filter = func(cert *x509.Certificate) bool {
+			return previous(cert) && filter(cert)
+		}
+		return nil
+	}
+}
+
+// WithMetadataFilter adds a filter on parsed certificates and their metadata.
+// If it's used more than once, certificates must pass every filter.
+func WithMetadataFilter(filter func(*x509.Certificate, Metadata) bool) Option {
+	return func(s *Search) error {
+		if filter == nil {
+			return errors.New("nil metadata filter")
+		}
+
+		previous := s.MetadataFilter
+		if previous == nil {
+			s.MetadataFilter = filter
+			return nil
+		}
+
+		s.MetadataFilter = func(cert *x509.Certificate, metadata Metadata) bool {
+			return previous(cert, metadata) && filter(cert, metadata)
+		}
+		return nil
+	}
+}
+
+// WithMatchCallback sets the search's MatchCallback.
+func WithMatchCallback(callback func(*x509.Certificate)) Option {
+	return func(s *Search) error {
+		if callback == nil {
+			return errors.New("nil match callback")
+		}
+		if s.MatchCallback != nil {
+			return errors.New("match callback already set")
+		}
+
+		s.MatchCallback = callback
+		return nil
+	}
+}
+
+// WithRawMatchCallback sets the search's RawMatchCallback.
+func WithRawMatchCallback(callback func([]byte, Metadata)) Option {
+	return func(s *Search) error {
+		if callback == nil {
+			return errors.New("nil raw match callback")
+		}
+		if s.RawMatchCallback != nil {
+			return errors.New("raw match callback already set")
+		}
+
+		s.RawMatchCallback = callback
+		return nil
+	}
+}
+
+// WithParseErrorCallback sets the search's ParseErrorCallback.
+func WithParseErrorCallback(callback func([]byte, Metadata, error)) Option {
+	return func(s *Search) error {
+		if callback == nil {
+			return errors.New("nil parse error callback")
+		}
+		if s.ParseErrorCallback != nil {
+			return errors.New("parse error callback already set")
+		}
+
+		s.ParseErrorCallback = callback
+		return nil
+	}
+}
+
+// WithEnricher adds an enricher to the search, after any already added.
+func WithEnricher(enricher Enricher) Option {
+	return func(s *Search) error {
+		if enricher == nil {
+			return errors.New("nil enricher")
+		}
+
+		s.Enrichers = append(s.Enrichers, enricher)
+		return nil
+	}
+}
+
+// WithSink adds a sink to the search, after any already added.
+func WithSink(sink Sink) Option {
+	return func(s *Search) error {
+		if sink == nil {
+			return errors.New("nil sink")
+		}
+
+		s.Sinks = append(s.Sinks, sink)
+		return nil
+	}
+}
+
+// WithCacher sets the cacher used to de-duplicate matches. Pass NopCacher{} to
+// disable de-duplication.
+func WithCacher(cacher Cacher) Option {
+	return func(s *Search) error {
+		if cacher == nil {
+			return errors.New("nil cacher")
+		}
+		if s.MatchCacher != nil {
+			return errors.New("cacher already set")
+		}
+
+		s.MatchCacher = cacher
+		return nil
+	}
+}
+
+// WithErrorBehavior sets what happens when a data source fails.
+func WithErrorBehavior(behavior ErrorBehavior) Option {
+	return func(s *Search) error {
+		if behavior != ErrorBehaviorCancel && behavior != ErrorBehaviorContinue {
+			return errors.New("unknown error behavior")
+		}
+
+		s.DataSourceErrorBehavior = behavior
+		return nil
+	}
+}
+
+// WithProgress sets the Progress updated as the search runs.
+func WithProgress(progress *Progress) Option {
+	return func(s *Search) error {
+		if progress == nil {
+			return errors.New("nil progress")
+		}
+
+		s.Progress = progress
+		return nil
+	}
+}
+
+// WithHooks sets the hooks called as the search runs.
+func WithHooks(hooks Hooks) Option {
+	return func(s *Search) error {
+		s.Hooks = hooks
+		return nil
+	}
+}
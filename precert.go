@@ -0,0 +1,150 @@
+package x509search
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+var (
+	// PoisonOID is the OID of the RFC 6962 precertificate poison extension.
+	PoisonOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+	// SCTListOID is the OID of the RFC 6962 embedded SCT list extension.
+	SCTListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+)
+
+// IsPrecertificate reports whether cert is a CT precertificate, that is,
+// whether it carries the poison extension.
+func IsPrecertificate(cert *x509.Certificate) bool {
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(PoisonOID) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTBS returns the DER-encoded TBSCertificate tbs with the CT poison
+// and embedded SCT list extensions removed. A precertificate and the final
+// certificate issued from it normalize to the same bytes, which is also the
+// TBSCertificate that CT logs record for the precertificate.
+//
+// Precertificates signed by a dedicated precertificate signing certificate
+// have a different issuer from their final certificates, and so don't
+// normalize to the same bytes.
+func NormalizeTBS(tbs []byte) ([]byte, error) {
+	var body cryptobyte.String
+	input := cryptobyte.String(tbs)
+	if !input.ReadASN1(&body, cryptobyte_asn1.SEQUENCE) || !input.Empty() {
+		return nil, errors.New("malformed TBSCertificate")
+	}
+
+	extensionsTag := cryptobyte_asn1.Tag(3).Constructed().ContextSpecific()
+
+	b := cryptobyte.NewBuilder(nil)
+	b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for !body.Empty() {
+			var element cryptobyte.String
+			var tag cryptobyte_asn1.Tag
+			if !body.ReadAnyASN1Element(&element, &tag) {
+				b.SetError(errors.New("malformed TBSCertificate field"))
+				return
+			}
+
+			if tag != extensionsTag {
+				b.AddBytes(element)
+				continue
+			}
+
+			var wrapper, extensions cryptobyte.String
+			if !element.ReadASN1(&wrapper, extensionsTag) || !wrapper.ReadASN1(&extensions, cryptobyte_asn1.SEQUENCE) {
+				b.SetError(errors.New("malformed extensions"))
+				return
+			}
+
+			b.AddASN1(extensionsTag, func(b *cryptobyte.Builder) {
+				b.AddASN1(cryptobyte_asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					for !extensions.Empty() {
+						var extension cryptobyte.String
+						if !extensions.ReadASN1Element(&extension, cryptobyte_asn1.SEQUENCE) {
+							b.SetError(errors.New("malformed extension"))
+							return
+						}
+
+						var fields cryptobyte.String
+						var oid asn1.ObjectIdentifier
+						input := extension
+						if !input.ReadASN1(&fields, cryptobyte_asn1.SEQUENCE) || !fields.ReadASN1ObjectIdentifier(&oid) {
+							b.SetError(errors.New("malformed extension"))
+							return
+						}
+
+						if !oid.Equal(PoisonOID) && !oid.Equal(SCTListOID) {
+							b.AddBytes(extension)
+						}
+					}
+				})
+			})
+		}
+	})
+
+	return b.Bytes()
+}
+
+// rawTBS returns the TBSCertificate of a DER-encoded certificate.
+func rawTBS(der []byte) ([]byte, error) {
+	var certificate cryptobyte.String
+	var tbs cryptobyte.String
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&certificate, cryptobyte_asn1.SEQUENCE) || !certificate.ReadASN1Element(&tbs, cryptobyte_asn1.SEQUENCE) {
+		return nil, errors.New("malformed certificate")
+	}
+	return tbs, nil
+}
+
+// NormalizedTBSFingerprint fingerprints a certificate with the SHA-256 hash of
+// its normalized TBSCertificate (see NormalizeTBS), falling back to the hash of
+// the whole certificate if it's malformed. With WithFingerprint, it makes any
+// cacher treat a precertificate and its final certificate as the same match.
+func NormalizedTBSFingerprint(der []byte) [32]byte {
+	tbs, err := rawTBS(der)
+	if err != nil {
+		return sha256.Sum256(der)
+	}
+
+	normalized, err := NormalizeTBS(tbs)
+	if err != nil {
+		return sha256.Sum256(der)
+	}
+
+	return sha256.Sum256(normalized)
+}
+
+// NewNormalizedTBSCacher returns a cacher de-duplicating certificates on their
+// normalized TBSCertificate (see NormalizeTBS), so a precertificate and the
+// final certificate issued from it count as a single match: whichever is
+// found first. It's a Sha256MapCacher using NormalizedTBSFingerprint, which
+// other cachers can use with WithFingerprint to de-duplicate the same way.
+func NewNormalizedTBSCacher() *Sha256MapCacher {
+	return NewSha256MapCacher(WithFingerprint(NormalizedTBSFingerprint))
+}
+
+// MatchNormalizedTBS returns a filter matching certificates whose normalized
+// TBSCertificate equals that of one of certs. A list of final certificates
+// therefore also matches the precertificates they were issued from, and vice
+// versa.
+func MatchNormalizedTBS(certs []*x509.Certificate) func(*x509.Certificate) bool {
+	wanted := make(map[[32]byte]bool, len(certs))
+	for _, cert := range certs {
+		wanted[NormalizedTBSFingerprint(cert.Raw)] = true
+	}
+
+	return func(cert *x509.Certificate) bool {
+		return wanted[NormalizedTBSFingerprint(cert.Raw)]
+	}
+}
@@ -0,0 +1,91 @@
+package x509search
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// issuePair issues a precertificate and the final certificate issued from
+// it, which embeds an SCT list in place of the poison.
+func issuePair(t *testing.T) (precert, final *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(extension pkix.Extension) *x509.Certificate {
+		template := &x509.Certificate{
+			SerialNumber:    big.NewInt(42),
+			Subject:         pkix.Name{CommonName: "example.com"},
+			DNSNames:        []string{"example.com"},
+			NotBefore:       time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:        time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+			ExtraExtensions: []pkix.Extension{extension},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	precert = issue(pkix.Extension{Id: PoisonOID, Critical: true, Value: []byte{0x05, 0x00}})
+	final = issue(pkix.Extension{Id: SCTListOID, Value: []byte{0x04, 0x02, 0x00, 0x00}})
+	return precert, final
+}
+
+func TestNormalizeTBS(t *testing.T) {
+	precert, final := issuePair(t)
+
+	if !IsPrecertificate(precert) || IsPrecertificate(final) {
+		t.Fatal("poison extension not recognized")
+	}
+
+	normalizedPrecert, err := NormalizeTBS(precert.RawTBSCertificate)
+	if err != nil {
+		t.Fatalf("normalizing precertificate: %s", err)
+	}
+	normalizedFinal, err := NormalizeTBS(final.RawTBSCertificate)
+	if err != nil {
+		t.Fatalf("normalizing final certificate: %s", err)
+	}
+
+	if !bytes.Equal(normalizedPrecert, normalizedFinal) {
+		t.Error("precertificate and final certificate normalize differently")
+	}
+	if NormalizedTBSFingerprint(precert.Raw) != NormalizedTBSFingerprint(final.Raw) {
+		t.Error("precertificate and final certificate fingerprint differently")
+	}
+}
+
+func TestNormalizeTBSMalformed(t *testing.T) {
+	_, err := NormalizeTBS([]byte{0x30, 0x05, 0x01})
+	if err == nil {
+		t.Error("got no error for a malformed TBSCertificate")
+	}
+}
+
+func TestNormalizedTBSCacher(t *testing.T) {
+	precert, final := issuePair(t)
+
+	cacher := NewNormalizedTBSCacher()
+	if cacher.Cache(precert) {
+		t.Error("precertificate reported as cached before it was added")
+	}
+	if !cacher.Cache(final) {
+		t.Error("final certificate not treated as a duplicate of its precertificate")
+	}
+}
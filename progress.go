@@ -0,0 +1,59 @@
+package x509search
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Progress counts the certificates processed and matched by a running search.
+// Its methods are safe to call concurrently with Execute, so a Progress can be
+// polled to drive a progress display.
+type Progress struct {
+	certificates atomic.Int64
+	matches      atomic.Int64
+
+	mu            sync.Mutex
+	sourceMatches map[string]int64
+}
+
+// Certificates returns the number of certificates received from the search's
+// data sources so far, including those rejected by the filters.
+func (p *Progress) Certificates() int64 {
+	return p.certificates.Load()
+}
+
+// Matches returns the number of certificates passed to MatchCallback so far.
+func (p *Progress) Matches() int64 {
+	return p.matches.Load()
+}
+
+// MatchesBySource returns the number of matches found so far from each named
+// data source, keyed by name. Matches from data sources without a name aren't
+// counted.
+func (p *Progress) MatchesBySource() map[string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	counts := make(map[string]int64, len(p.sourceMatches))
+	for name, count := range p.sourceMatches {
+		counts[name] = count
+	}
+	return counts
+}
+
+// match records a match from the named data source.
+func (p *Progress) match(sourceName string) {
+	p.matches.Add(1)
+
+	if sourceName == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sourceMatches == nil {
+		p.sourceMatches = make(map[string]int64)
+	}
+	p.sourceMatches[sourceName]++
+}
@@ -0,0 +1,114 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// CoverageReport describes how many of the logs searched each issued
+// certificate was found in.
+type CoverageReport struct {
+	// Issued is the number of certificates issued, and Covered the number of
+	// them found in at least MinLogs logs.
+	Issued  int `json:"issued"`
+	Covered int `json:"covered"`
+	MinLogs int `json:"minLogs"`
+
+	// Uncovered lists the issued certificates found in fewer than MinLogs
+	// logs, ordered by serial number.
+	Uncovered []Uncovered `json:"uncovered"`
+}
+
+// Uncovered is an issued certificate found in too few logs.
+type Uncovered struct {
+	Entry
+
+	// Logs lists the logs it was found in, if any.
+	Logs []string `json:"logs"`
+}
+
+// VerifyLogged runs both sides' searches concurrently, and checks that every
+// certificate the issued side finds, such as a DataSource reading a CA's
+// database, is found by at least minLogs of the logs side's data sources.
+// Certificates are paired as by Reconcile, so with
+// x509search.IssuerSerialFingerprint, a certificate is covered by logs holding
+// its precertificate.
+//
+// Logs are told apart by the names of their data sources, which must
+// therefore be distinct, and each must find every copy of a certificate: the
+// logs side's MatchCacher is ignored, and its data sources mustn't share a
+// staticctapi.Deduplicator.
+func VerifyLogged(ctx context.Context, issued Side, logs Side, minLogs int, fingerprint x509search.Fingerprinter) (CoverageReport, error) {
+	if minLogs <= 0 {
+		return CoverageReport{}, errors.New("minLogs must be positive")
+	}
+
+	if fingerprint == nil {
+		fingerprint = x509search.SHA256Fingerprint
+	}
+
+	logs.Search.MatchCacher = nil
+
+	issuedCollector, logsCollector, err := collect(ctx, issued, logs, fingerprint)
+	if err != nil {
+		return CoverageReport{}, err
+	}
+
+	report := CoverageReport{
+		Issued:    len(issuedCollector.entries),
+		MinLogs:   minLogs,
+		Uncovered: []Uncovered{},
+	}
+	for key, entry := range issuedCollector.entries {
+		found := logsCollector.sources[key]
+		if len(found) >= minLogs {
+			report.Covered++
+			continue
+		}
+
+		report.Uncovered = append(report.Uncovered, Uncovered{
+			Entry: entry,
+			Logs:  append([]string{}, found...),
+		})
+	}
+
+	sort.Slice(report.Uncovered, func(i, j int) bool {
+		a, b := report.Uncovered[i], report.Uncovered[j]
+		if len(a.Serial) != len(b.Serial) {
+			return len(a.Serial) < len(b.Serial)
+		}
+		return a.Serial < b.Serial
+	})
+
+	return report, nil
+}
+
+// WriteText writes a line for each uncovered certificate, giving its serial
+// number and the logs it was found in, followed by a summary.
+func (r CoverageReport) WriteText(w io.Writer) error {
+	for _, uncovered := range r.Uncovered {
+		kind := "certificate"
+		if uncovered.Precertificate {
+			kind = "precertificate"
+		}
+
+		logs := "no logs"
+		if len(uncovered.Logs) > 0 {
+			logs = strings.Join(uncovered.Logs, ", ")
+		}
+
+		_, err := fmt.Fprintf(w, "%s %s, issued by %q: found in %d logs, of %d required: %s\n", kind, uncovered.Serial, uncovered.Issuer, len(uncovered.Logs), r.MinLogs, logs)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d of %d issued certificates found in at least %d logs\n", r.Covered, r.Issued, r.MinLogs)
+	return err
+}
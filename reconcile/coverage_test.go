@@ -0,0 +1,99 @@
+package reconcile
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// issue returns the DER bytes of a self-signed certificate with the given
+// serial number.
+func issue(t *testing.T, serial int64) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// certSource is a data source sending the certificates it holds.
+type certSource [][]byte
+
+func (s certSource) Source(ctx context.Context, certs chan<- []byte) error {
+	for _, der := range s {
+		select {
+		case certs <- der:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// side returns a Side searching every certificate from dataSources.
+func side(name string, dataSources ...x509search.Sourcer) Side {
+	return Side{
+		Name: name,
+		Search: x509search.Search{
+			DERFilter:   func([]byte) bool { return true },
+			DataSources: dataSources,
+		},
+	}
+}
+
+func TestVerifyLogged(t *testing.T) {
+	a, b, c := issue(t, 1), issue(t, 2), issue(t, 3)
+
+	issued := side("boulder", x509search.Named("boulder", certSource{a, b, c}))
+	logs := side("ct",
+		x509search.Named("log-a", certSource{a, b}),
+		x509search.Named("log-b", certSource{a}),
+	)
+
+	report, err := VerifyLogged(context.Background(), issued, logs, 2, nil)
+	if err != nil {
+		t.Fatalf("verifying logging: %s", err)
+	}
+
+	if report.Issued != 3 || report.Covered != 1 || report.MinLogs != 2 {
+		t.Errorf("got %d of %d covered by %d logs, want 1 of 3 covered by 2", report.Covered, report.Issued, report.MinLogs)
+	}
+	if len(report.Uncovered) != 2 {
+		t.Fatalf("got %d uncovered certificates, want 2", len(report.Uncovered))
+	}
+
+	// Uncovered certificates are ordered by serial number
+	if got := report.Uncovered[0]; got.Serial != "02" || !slices.Equal(got.Logs, []string{"log-a"}) {
+		t.Errorf("got serial %s found in %q, want serial 02 found in log-a", got.Serial, got.Logs)
+	}
+	if got := report.Uncovered[1]; got.Serial != "03" || len(got.Logs) != 0 {
+		t.Errorf("got serial %s found in %q, want serial 03 found in no logs", got.Serial, got.Logs)
+	}
+
+	_, err = VerifyLogged(context.Background(), issued, logs, 0, nil)
+	if err == nil {
+		t.Error("got no error for a minLogs of 0")
+	}
+}
@@ -0,0 +1,259 @@
+// Package reconcile compares the certificates found by two searches over the
+// same window, such as a CA's issuance database and the CT logs it submits
+// to, and reports those found by only one of them. This is the core of
+// checking that every certificate issued was logged, or that every
+// certificate logged was issued.
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Side is one of the two searches reconciled.
+type Side struct {
+	// Name identifies the side in reports, such as "boulder" or "ct".
+	Name string
+
+	// Search finds the side's certificates. Its filters should select the
+	// same certificates, and its data sources cover the same window, as the
+	// other side's. Like any search, it needs a filter, though one matching
+	// every certificate will do. Its matches are collected by adding a sink,
+	// so it needs no match callback or sinks of its own, though any it has
+	// are still called.
+	Search x509search.Search
+}
+
+// Entry is a certificate found by one side.
+type Entry struct {
+	// Key is the hex-encoded fingerprint the certificate was paired by.
+	Key string `json:"key"`
+
+	// Fingerprint is the hex-encoded SHA-256 hash of the certificate.
+	Fingerprint string `json:"fingerprint"`
+
+	Serial         string `json:"serial"`
+	Subject        string `json:"subject"`
+	Issuer         string `json:"issuer"`
+	Precertificate bool   `json:"precertificate"`
+
+	// Source and Index locate the certificate in the data source it was
+	// first found in.
+	Source string `json:"source,omitempty"`
+	Index  int64  `json:"index,omitempty"`
+
+	// Payload is the data source's payload for the certificate, such as a
+	// database row ID. See x509search.Metadata.Payload.
+	Payload any `json:"-"`
+}
+
+// Report describes the differences between two sides.
+type Report struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
+
+	// Common is the number of certificates found by both sides.
+	Common int `json:"common"`
+
+	// OnlyLeft and OnlyRight list the certificates found by only the left or
+	// right side, ordered by key.
+	OnlyLeft  []Entry `json:"onlyLeft"`
+	OnlyRight []Entry `json:"onlyRight"`
+}
+
+// Reconcile runs both sides' searches concurrently, and pairs the
+// certificates they find by fingerprint, reporting those without a pair. If
+// fingerprint is nil, x509search.SHA256Fingerprint is used, which pairs
+// identical certificates; x509search.IssuerSerialFingerprint also pairs
+// precertificates with their final certificates.
+//
+// If either search fails, Reconcile returns its error once both have
+// stopped.
+func Reconcile(ctx context.Context, left Side, right Side, fingerprint x509search.Fingerprinter) (Report, error) {
+	if fingerprint == nil {
+		fingerprint = x509search.SHA256Fingerprint
+	}
+
+	leftCollector, rightCollector, err := collect(ctx, left, right, fingerprint)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return diff(left.Name, leftCollector.entries, right.Name, rightCollector.entries), nil
+}
+
+// collect runs both sides' searches concurrently, collecting their matches.
+func collect(ctx context.Context, left Side, right Side, fingerprint x509search.Fingerprinter) (*collector, *collector, error) {
+	leftCollector := newCollector(fingerprint)
+	rightCollector := newCollector(fingerprint)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var leftErr, rightErr error
+	for _, side := range []struct {
+		Side
+		collector *collector
+		err       *error
+	}{
+		{left, leftCollector, &leftErr},
+		{right, rightCollector, &rightErr},
+	} {
+		search := side.Search
+		search.Sinks = append(slices.Clip(search.Sinks), side.collector)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := search.Execute(ctx)
+			if err != nil {
+				*side.err = fmt.Errorf("searching %s: %w", side.Name, err)
+
+				// The other side's results are useless without these
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	err := errors.Join(leftErr, rightErr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return leftCollector, rightCollector, nil
+}
+
+// diff pairs the entries of two sides by key.
+func diff(leftName string, left map[[32]byte]Entry, rightName string, right map[[32]byte]Entry) Report {
+	report := Report{
+		Left:      leftName,
+		Right:     rightName,
+		OnlyLeft:  []Entry{},
+		OnlyRight: []Entry{},
+	}
+
+	for key, entry := range left {
+		if _, ok := right[key]; ok {
+			report.Common++
+			continue
+		}
+		report.OnlyLeft = append(report.OnlyLeft, entry)
+	}
+	for key, entry := range right {
+		if _, ok := left[key]; !ok {
+			report.OnlyRight = append(report.OnlyRight, entry)
+		}
+	}
+
+	byKey := func(entries []Entry) func(int, int) bool {
+		return func(i, j int) bool {
+			return entries[i].Key < entries[j].Key
+		}
+	}
+	sort.Slice(report.OnlyLeft, byKey(report.OnlyLeft))
+	sort.Slice(report.OnlyRight, byKey(report.OnlyRight))
+
+	return report
+}
+
+// WriteDiff writes the report in a form resembling a unified diff: a line
+// starting with "-" for each certificate found only by the left side, one
+// starting with "+" for each found only by the right side, and a summary.
+func (r Report) WriteDiff(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", r.Left, r.Right)
+
+	for _, side := range []struct {
+		prefix  string
+		entries []Entry
+	}{
+		{"-", r.OnlyLeft},
+		{"+", r.OnlyRight},
+	} {
+		for _, entry := range side.entries {
+			kind := "certificate"
+			if entry.Precertificate {
+				kind = "precertificate"
+			}
+
+			fmt.Fprintf(&buf, "%s %s %s serial %s, %q, issued by %q", side.prefix, entry.Key, kind, entry.Serial, entry.Subject, entry.Issuer)
+			if entry.Source != "" {
+				fmt.Fprintf(&buf, ", in %s at %d", entry.Source, entry.Index)
+			}
+			buf.WriteString("\n")
+		}
+	}
+
+	fmt.Fprintf(&buf, "%d in common, %d only in %s, %d only in %s\n", r.Common, len(r.OnlyLeft), r.Left, len(r.OnlyRight), r.Right)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// collector is an x509search.Sink recording the certificates found by one
+// side.
+type collector struct {
+	fingerprint x509search.Fingerprinter
+	entries     map[[32]byte]Entry
+
+	// sources lists the distinct data sources each certificate was found in
+	sources map[[32]byte][]string
+}
+
+func newCollector(fingerprint x509search.Fingerprinter) *collector {
+	return &collector{
+		fingerprint: fingerprint,
+		entries:     make(map[[32]byte]Entry),
+		sources:     make(map[[32]byte][]string),
+	}
+}
+
+// Write records cert and the data source it was found in. Only the first
+// certificate found with each key has its details recorded.
+func (c *collector) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	key := c.fingerprint(cert.Raw)
+
+	source := metadata.SourceName
+	if source == "" {
+		source = metadata.Source
+	}
+	if !slices.Contains(c.sources[key], source) {
+		c.sources[key] = append(c.sources[key], source)
+	}
+
+	if _, ok := c.entries[key]; ok {
+		return nil
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	c.entries[key] = Entry{
+		Key:            hex.EncodeToString(key[:]),
+		Fingerprint:    hex.EncodeToString(fingerprint[:]),
+		Serial:         hex.EncodeToString(cert.SerialNumber.Bytes()),
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		Precertificate: metadata.Precertificate,
+		Source:         metadata.Source,
+		Index:          metadata.Index,
+		Payload:        metadata.Payload,
+	}
+	return nil
+}
+
+func (c *collector) Close() error {
+	return nil
+}
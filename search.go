@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 )
 
 type ErrorBehavior int
@@ -28,6 +29,11 @@ type Sourcer interface {
 	// of closing the certs channel once Source has returned and must not close
 	// the channel until it does.
 	//
+	// Ownership of each slice sent over certs passes to the receiver, and the
+	// data source must not modify it afterwards: the search may retain it, as
+	// the Raw field of a parsed certificate refers to the bytes it was parsed
+	// from.
+	//
 	// If ctx is cancelled before the data source is exhausted, Source returns
 	// ctx.Err().
 	Source(ctx context.Context, certs chan<- []byte) error
@@ -57,18 +63,77 @@ type Search struct {
 	// access memory outside of the function scope if desired.
 	Filter func(*x509.Certificate) bool
 
+	// MetadataFilter, if set, is called like Filter for each certificate
+	// Filter matches, along with the metadata describing where it was found,
+	// for filters that depend on its origin, such as comparing a CT log
+	// entry's timestamp with the certificate's validity.
+	//
+	// A single goroutine is responsible for invoking MetadataFilter, so it is
+	// safe to access memory outside of the function scope if desired.
+	MetadataFilter func(*x509.Certificate, Metadata) bool
+
 	// MatchCallback is called for each certificate matching the search filter
-	// that hasn't already been cached by MatchCacher.
+	// that hasn't already been cached by MatchCacher. It is optional if at
+	// least one Sink is configured.
 	//
 	// A single goroutine is responsible for invoking MatchCallback, so it is
 	// safe to access memory outside of the function scope if desired.
 	MatchCallback func(*x509.Certificate)
 
+	// RawMatchCallback is called with the DER bytes and metadata of each
+	// certificate matching the search filter that hasn't already been cached
+	// by MatchCacher. It is called before MatchCallback.
+	//
+	// If RawMatchCallback is the only match handler, Filter is nil, and
+	// MatchCacher implements RawCacher (as all of the cachers in this package
+	// do), certificates are never parsed. This suits filtering purely with
+	// DERFilter, such as when archiving raw certificates in bulk. In that
+	// case, certificates aren't checked for parseability either.
+	//
+	// A single goroutine is responsible for invoking RawMatchCallback, so it
+	// is safe to access memory outside of the function scope if desired.
+	RawMatchCallback func([]byte, Metadata)
+
+	// ParseErrorCallback, if set, is called with the DER bytes and metadata of
+	// each certificate that passes DERFilter but can't be parsed, along with
+	// the parse error. Malformed certificates are often the most interesting
+	// ones when hunting for mis-issuance, so this allows them to be kept (see
+	// sink.FailureDirectory) rather than only reported on stderr.
+	//
+	// A single goroutine is responsible for invoking ParseErrorCallback, so it
+	// is safe to access memory outside of the function scope if desired.
+	ParseErrorCallback func([]byte, Metadata, error)
+
+	// Enrichers attach additional information to the metadata of each
+	// certificate matching the search filter that hasn't already been cached
+	// by MatchCacher. They're called in the order they're listed, before
+	// RawMatchCallback. As enrichers usually query other services, they slow
+	// the search down for every match, so are best paired with a selective
+	// filter.
+	//
+	// A single goroutine is responsible for invoking Enrichers.
+	Enrichers []Enricher
+
+	// Sinks receive each certificate matching the search filter that hasn't
+	// already been cached by MatchCacher, along with its metadata. Sinks are
+	// written to after MatchCallback is called, in the order they're listed.
+	Sinks []Sink
+
 	// DataSources contains all the data sources to be used in the search. For
 	// each data source, a dedicated goroutine will be created where its Source
-	// method will be invoked.
+	// method will be invoked, or its SourceParsed or SourceEntries method if it
+	// implements SourcerParsed or EntrySourcer. Data sources implementing
+	// Namer, or wrapped with Named, are identified by name in errors.
 	DataSources []Sourcer
 
+	// MaxConcurrentSources bounds how many data sources are read at once,
+	// with the rest waiting for a running one to finish. A search over many
+	// logs, such as those in a log list, otherwise holds connections and
+	// prefetched tiles open for all of them at once. Each data source's own
+	// connection limit still applies. By default, every data source is read
+	// at once.
+	MaxConcurrentSources int
+
 	// MatchCacher handles de-duplication of matches. Performance and behavioral
 	// characteristics are determined by the chosen implementation.
 	//
@@ -78,6 +143,21 @@ type Search struct {
 	// DataSourceErrorBehavior determines what happens when one of the data
 	// sources encounters an unrecoverable error.
 	DataSourceErrorBehavior ErrorBehavior
+
+	// Progress, if set, is updated as the search runs.
+	Progress *Progress
+
+	// Hooks are called as the search runs.
+	Hooks Hooks
+
+	// Budget bounds the time the search may take. By default, it runs until
+	// its data sources are exhausted.
+	Budget Budget
+
+	// Stop, if set, stops the search gracefully once it's closed: the data
+	// sources are stopped, and the certificates they've already sent are
+	// still processed before Execute returns. See NotifyInterrupt.
+	Stop <-chan struct{}
 }
 
 // Execute runs the search, blocking until all data sources have been exhausted.
@@ -86,7 +166,44 @@ type Search struct {
 // continue even if one or more data sources encounter an unrecoverable error.
 // If DataSourceErrorBehavior is set to ErrorBehaviorCancel and a data source
 // encounters an unrecoverable error, Execute will return the encountered error.
+//
+// If a budget runs out, or the search is stopped via Stop, Execute returns nil
+// once the search has stopped; see ExecuteSummary to tell whether the search
+// was complete.
 func (s Search) Execute(ctx context.Context) error {
+	_, err := s.ExecuteSummary(ctx)
+	return err
+}
+
+// ExecuteSummary runs the search like Execute, and also returns a summary of
+// how it ended.
+func (s Search) ExecuteSummary(ctx context.Context) (Summary, error) {
+	started := time.Now()
+
+	var summary Summary
+	err := s.execute(ctx, &summary)
+	summary.Duration = time.Since(started)
+
+	switch {
+	case summary.Status == StatusDeadlineExceeded || summary.Status == StatusInterrupted:
+	case err == nil:
+		summary.Status = StatusComplete
+	case ctx.Err() != nil:
+		summary.Status = StatusCancelled
+	default:
+		summary.Status = StatusFailed
+	}
+
+	if s.Hooks.OnComplete != nil {
+		s.Hooks.OnComplete(err)
+	}
+
+	return summary, err
+}
+
+// execute implements ExecuteSummary, counting the certificates processed in
+// summary, and setting its status if a budget runs out.
+func (s Search) execute(ctx context.Context, summary *Summary) error {
 	err := s.ValidateParameters()
 	if err != nil {
 		return err
@@ -111,6 +228,24 @@ func (s Search) Execute(ctx context.Context) error {
 		}
 	}
 
+	// Skip parsing entirely when nothing needs a parsed certificate
+	rawCacher, rawCacheable := matches.(RawCacher)
+	sourceCacher, _ := matches.(SourceCacher)
+
+	// cached adds a match to the cache, reporting whether it was already
+	// there. cert is nil if the match hasn't been parsed.
+	cached := func(der []byte, cert *x509.Certificate, metadata Metadata) bool {
+		switch {
+		case sourceCacher != nil:
+			return sourceCacher.CacheFrom(der, metadata)
+		case cert == nil:
+			return rawCacher.CacheRaw(der)
+		default:
+			return matches.Cache(cert)
+		}
+	}
+	rawOnly := s.Filter == nil && s.MetadataFilter == nil && s.MatchCallback == nil && len(s.Sinks) == 0 && len(s.Enrichers) == 0 && s.Hooks.OnMatch == nil && rawCacheable
+
 	// Default to matching all certificates
 	filter := s.Filter
 	if filter == nil {
@@ -119,82 +254,258 @@ func (s Search) Execute(ctx context.Context) error {
 		}
 	}
 
+	// Cancelling the context once the search returns releases it, and any
+	// goroutines data sources left watching it
 	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if s.Budget.Total > 0 {
+		var cancelTotal context.CancelFunc
+		ctx, cancelTotal = context.WithTimeoutCause(ctx, s.Budget.Total, errTotalBudget)
+		defer cancelTotal()
+	}
+
+	// The data sources are stopped when their budget runs out, while the
+	// certificates they've already sent are still processed
+	sourceCtx := ctx
+	if s.Budget.Sources > 0 {
+		var cancelSources context.CancelFunc
+		sourceCtx, cancelSources = context.WithTimeoutCause(ctx, s.Budget.Sources, errSourcesBudget)
+		defer cancelSources()
+	}
+
+	sourceCtx, stopSources := context.WithCancelCause(sourceCtx)
+	defer stopSources(nil)
+
+	if s.Stop != nil {
+		go func() {
+			select {
+			case <-s.Stop:
+				stopSources(errStopped)
+			case <-sourceCtx.Done():
+			}
+		}()
+	}
 
 	var wg sync.WaitGroup
-	certs := make(chan []byte, len(s.DataSources))
+	entries := make(chan Entry, len(s.DataSources))
+
+	var slots chan struct{}
+	if s.MaxConcurrentSources > 0 {
+		slots = make(chan struct{}, s.MaxConcurrentSources)
+	}
 
 	// Allow each data source to send certificates concurrently
-	for _, dataSource := range s.DataSources {
+	for i, dataSource := range s.DataSources {
+		name := SourceName(dataSource)
+
+		// Unnamed data sources are identified by their position
+		label := name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i)
+		}
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 
-			err := dataSource.Source(ctx, certs)
-			if err != nil && s.DataSourceErrorBehavior == ErrorBehaviorCancel {
-				fmt.Fprintf(os.Stderr, "data source encountered error: %s\n", err.Error())
+			// Data sources waiting for a slot when the search stops are
+			// never started
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+				case <-sourceCtx.Done():
+					return
+				}
+				defer func() { <-slots }()
+			}
+
+			if s.Hooks.OnSourceStart != nil {
+				s.Hooks.OnSourceStart(label)
+			}
+
+			err := sourceNamedEntries(withBatchReporter(sourceCtx, s.Hooks, label), dataSource, name, entries)
+
+			if s.Hooks.OnSourceFinish != nil {
+				s.Hooks.OnSourceFinish(label, err)
+			}
+
+			// Data sources stopped by a budget or via Stop haven't failed
+			cause := context.Cause(sourceCtx)
+			if err == nil || cause == errTotalBudget || cause == errSourcesBudget || cause == errStopped {
+				return
+			}
+			err = fmt.Errorf("data source %s: %w", label, err)
+
+			if s.DataSourceErrorBehavior == ErrorBehaviorCancel {
+				fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 				cancel(err)
+			} else if !errors.Is(err, context.Canceled) {
+				fmt.Fprintf(os.Stderr, "%s, continuing without it\n", err.Error())
 			}
 		}()
 	}
 
 	go func() {
 		wg.Wait()
-		close(certs)
+		close(entries)
 	}()
 
+	sourcesDone := sourceCtx.Done()
+	var drainDeadline <-chan time.Time
+
 	for {
 		select {
 		case <-ctx.Done():
+			if context.Cause(ctx) == errTotalBudget {
+				summary.Status, summary.Stage = StatusDeadlineExceeded, StageTotal
+				return nil
+			}
 			return context.Cause(ctx)
-		case certBytes, ok := <-certs:
-			// If the channel is closed, the search has finished
+		case <-sourcesDone:
+			sourcesDone = nil
+			if context.Cause(sourceCtx) == errStopped {
+				summary.Status = StatusInterrupted
+				continue
+			}
+			if context.Cause(sourceCtx) != errSourcesBudget {
+				continue
+			}
+
+			// Carry on until the data sources have stopped, or the Drain
+			// budget runs out
+			summary.Status, summary.Stage = StatusDeadlineExceeded, StageSources
+			if s.Budget.Drain > 0 {
+				timer := time.NewTimer(s.Budget.Drain)
+				defer timer.Stop()
+				drainDeadline = timer.C
+			}
+		case <-drainDeadline:
+			summary.Stage = StageDrain
+			return nil
+		case entry, ok := <-entries:
+			// If the channel is closed, the search has finished, though the
+			// data sources may have been stopped early
 			if !ok {
+				switch context.Cause(sourceCtx) {
+				case errStopped:
+					summary.Status = StatusInterrupted
+				case errSourcesBudget:
+					summary.Status, summary.Stage = StatusDeadlineExceeded, StageSources
+				}
 				return nil
 			}
 
+			summary.Certificates++
+			if s.Progress != nil {
+				s.Progress.certificates.Add(1)
+			}
+
+			// Pre-parsed certificates carry their own DER data
+			if entry.DER == nil && entry.Certificate != nil {
+				entry.DER = entry.Certificate.Raw
+			}
+
 			// If the certificate doesn't match the pre-parse filter function,
 			// ignore it
-			if !derFilter(certBytes) {
+			if !derFilter(entry.DER) {
 				continue
 			}
 
-			// Certificates must be parseable ASN.1 DER data
-			cert, err := x509.ParseCertificate(certBytes)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "parsing certificate: %s\n", err.Error())
+			if rawOnly {
+				if cached(entry.DER, nil, entry.Metadata) {
+					continue
+				}
+
+				s.RawMatchCallback(entry.DER, entry.Metadata)
+
+				summary.Matches++
+				if s.Progress != nil {
+					s.Progress.match(entry.Metadata.SourceName)
+				}
 				continue
 			}
 
+			// Certificates must be parseable ASN.1 DER data, unless the data
+			// source has already parsed them
+			cert := entry.Certificate
+			if cert == nil {
+				var err error
+				cert, err = x509.ParseCertificate(entry.DER)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "parsing certificate: %s\n", err.Error())
+					if s.ParseErrorCallback != nil {
+						s.ParseErrorCallback(entry.DER, entry.Metadata, err)
+					}
+					continue
+				}
+			}
+
 			// If the certificate doesn't match the filter function, ignore it
 			if !filter(cert) {
 				continue
 			}
+			if s.MetadataFilter != nil && !s.MetadataFilter(cert, entry.Metadata) {
+				continue
+			}
 
 			// Add this match to the cache. If it has been seen before, skip
-			// running MatchCallback
-			if matches.Cache(cert) {
+			// running the callbacks and writing to the sinks
+			if cached(cert.Raw, cert, entry.Metadata) {
 				continue
 			}
 
-			s.MatchCallback(cert)
+			for _, enricher := range s.Enrichers {
+				err := enricher.Enrich(ctx, cert, &entry.Metadata)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "enriching match: %s\n", err.Error())
+				}
+			}
+
+			if s.RawMatchCallback != nil {
+				s.RawMatchCallback(cert.Raw, entry.Metadata)
+			}
+
+			if s.MatchCallback != nil {
+				s.MatchCallback(cert)
+			}
+
+			for _, sink := range s.Sinks {
+				err := sink.Write(cert, entry.Metadata)
+				if err != nil {
+					return fmt.Errorf("writing match to sink: %w", err)
+				}
+			}
+
+			if s.Hooks.OnMatch != nil {
+				s.Hooks.OnMatch(cert, entry.Metadata)
+			}
+
+			summary.Matches++
+			if s.Progress != nil {
+				s.Progress.match(entry.Metadata.SourceName)
+			}
 		}
 	}
 }
 
 func (s Search) ValidateParameters() error {
-	// You must supply either DERFilter or Filter, or both
-	if s.DERFilter == nil && s.Filter == nil {
+	// You must supply at least one of the filters
+	if s.DERFilter == nil && s.Filter == nil && s.MetadataFilter == nil {
 		return errors.New("nil filter functions")
 	}
 
-	if s.MatchCallback == nil {
-		return errors.New("nil match callback function")
+	if s.MatchCallback == nil && s.RawMatchCallback == nil && len(s.Sinks) == 0 {
+		return errors.New("nil match callback functions and no sinks")
 	}
 
 	if len(s.DataSources) == 0 {
 		return errors.New("no data sources")
 	}
 
+	if s.MaxConcurrentSources < 0 {
+		return errors.New("negative MaxConcurrentSources")
+	}
+
 	return nil
 }
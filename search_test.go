@@ -0,0 +1,123 @@
+package x509search
+
+import (
+	"context"
+	"crypto/x509"
+	"sync"
+	"testing"
+	"time"
+)
+
+// watchingSource sends one certificate and returns, leaving a goroutine
+// watching its context, as a data source with background work might.
+type watchingSource struct {
+	released chan struct{}
+}
+
+func (s watchingSource) Source(ctx context.Context, certs chan<- []byte) error {
+	go func() {
+		<-ctx.Done()
+		close(s.released)
+	}()
+
+	select {
+	case certs <- []byte("certificate"):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// TestExecuteReleasesContext checks that the context a search gives its data
+// sources is cancelled once the search returns, even when the caller's never
+// is, so that goroutines watching it don't leak.
+func TestExecuteReleasesContext(t *testing.T) {
+	source := watchingSource{released: make(chan struct{})}
+
+	// The certificate isn't one, so it's filtered out before it's parsed
+	search := Search{
+		DERFilter:     func([]byte) bool { return false },
+		MatchCallback: func(*x509.Certificate) {},
+		DataSources:   []Sourcer{source},
+	}
+
+	err := search.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("executing search: %s", err)
+	}
+
+	select {
+	case <-source.released:
+	case <-time.After(5 * time.Second):
+		t.Fatal("data source's context still live after the search returned")
+	}
+}
+
+// countingSource sends one certificate, recording how many sources ran and
+// the most running at once.
+type countingSource struct {
+	mu      *sync.Mutex
+	started *int
+	running *int
+	most    *int
+}
+
+func (s countingSource) Source(ctx context.Context, certs chan<- []byte) error {
+	s.mu.Lock()
+	*s.started++
+	*s.running++
+	*s.most = max(*s.most, *s.running)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		*s.running--
+		s.mu.Unlock()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	select {
+	case certs <- []byte("certificate"):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+func TestWithConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var started, running, most int
+	source := countingSource{mu: &mu, started: &started, running: &running, most: &most}
+
+	opts := []Option{
+		WithDERFilter(func([]byte) bool { return true }),
+		WithRawMatchCallback(func([]byte, Metadata) {}),
+		WithConcurrency(2),
+	}
+	for range 6 {
+		opts = append(opts, WithSource(source))
+	}
+
+	search, err := NewSearch(opts...)
+	if err != nil {
+		t.Fatalf("building search: %s", err)
+	}
+
+	err = search.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("executing search: %s", err)
+	}
+
+	if started != 6 {
+		t.Errorf("got %d data sources run, want 6", started)
+	}
+	if most != 2 {
+		t.Errorf("got %d data sources running at once, want 2", most)
+	}
+
+	_, err = NewSearch(append(opts, WithConcurrency(0))...)
+	if err == nil {
+		t.Error("expected an error for a concurrency of 0")
+	}
+}
@@ -0,0 +1,19 @@
+package x509search
+
+import (
+	"crypto/x509"
+)
+
+// Sink receives the certificates matched by a search. Implementations for
+// common output formats are provided by the sink package.
+type Sink interface {
+	// Write records a matching certificate along with the metadata describing
+	// where it was found. A single goroutine is responsible for invoking Write.
+	// If Write returns an error, the search is stopped and the error returned
+	// from Execute.
+	Write(cert *x509.Certificate, metadata Metadata) error
+
+	// Close flushes any buffered output and releases the sink's resources.
+	// Execute does not close sinks; callers must do so once it returns.
+	Close() error
+}
@@ -0,0 +1,205 @@
+package sink
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Dimension is a property of a match by which Aggregate groups its counts.
+type Dimension struct {
+	// Name labels the dimension in the summary table.
+	Name string
+
+	// Value returns the group a match belongs to along this dimension.
+	Value func(*x509.Certificate, x509search.Metadata) string
+}
+
+var (
+	// DimensionIssuer groups matches by issuer distinguished name.
+	DimensionIssuer = Dimension{
+		Name: "issuer",
+		Value: func(cert *x509.Certificate, _ x509search.Metadata) string {
+			return cert.Issuer.String()
+		},
+	}
+
+	// DimensionKeyAlgorithm groups matches by public key algorithm and size,
+	// such as "RSA-2048" or "ECDSA-P-256".
+	DimensionKeyAlgorithm = Dimension{
+		Name: "key algorithm",
+		Value: func(cert *x509.Certificate, _ x509search.Metadata) string {
+			return keyAlgorithm(cert)
+		},
+	}
+
+	// DimensionValidity groups matches by validity period, rounded to the
+	// nearest day.
+	DimensionValidity = Dimension{
+		Name: "validity",
+		Value: func(cert *x509.Certificate, _ x509search.Metadata) string {
+			// The validity period is inclusive of NotAfter
+			validity := cert.NotAfter.Sub(cert.NotBefore) + time.Second
+			return fmt.Sprintf("%dd", (validity+12*time.Hour)/(24*time.Hour))
+		},
+	}
+
+	// DimensionSignatureAlgorithm groups matches by signature algorithm.
+	DimensionSignatureAlgorithm = Dimension{
+		Name: "signature algorithm",
+		Value: func(cert *x509.Certificate, _ x509search.Metadata) string {
+			return cert.SignatureAlgorithm.String()
+		},
+	}
+
+	// DimensionSource groups matches by the data source they were found in,
+	// such as a CT log.
+	DimensionSource = Dimension{
+		Name: "source",
+		Value: func(_ *x509.Certificate, metadata x509search.Metadata) string {
+			return metadata.Source
+		},
+	}
+)
+
+// Dimensions maps the short names used in configuration files and flags to
+// the predefined dimensions.
+var Dimensions = map[string]Dimension{
+	"issuer":             DimensionIssuer,
+	"keyAlgorithm":       DimensionKeyAlgorithm,
+	"validity":           DimensionValidity,
+	"signatureAlgorithm": DimensionSignatureAlgorithm,
+	"source":             DimensionSource,
+}
+
+// ParseDimensions looks up each of names in Dimensions.
+func ParseDimensions(names []string) ([]Dimension, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no dimensions given")
+	}
+
+	dimensions := make([]Dimension, len(names))
+	for i, name := range names {
+		dimension, ok := Dimensions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown dimension: %q", name)
+		}
+		dimensions[i] = dimension
+	}
+
+	return dimensions, nil
+}
+
+// Group is a set of matches sharing the same value along each dimension.
+type Group struct {
+	// Values holds the group's value for each dimension, in the order the
+	// dimensions were given to NewAggregate.
+	Values []string
+
+	// Count is the number of matches in the group.
+	Count int64
+}
+
+// Aggregate counts matches grouped by one or more dimensions instead of
+// writing each match, and writes a summary table once closed. This turns a
+// search into a quick measurement over the certificates it matches.
+type Aggregate struct {
+	w          io.Writer
+	dimensions []Dimension
+	groups     map[string]*Group
+	total      int64
+}
+
+// NewAggregate returns an Aggregate sink which writes its summary to w.
+func NewAggregate(w io.Writer, dimensions ...Dimension) *Aggregate {
+	return &Aggregate{
+		w:          w,
+		dimensions: dimensions,
+		groups:     make(map[string]*Group),
+	}
+}
+
+// Write counts cert in its group.
+func (a *Aggregate) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	values := make([]string, len(a.dimensions))
+	for i, dimension := range a.dimensions {
+		values[i] = dimension.Value(cert, metadata)
+	}
+
+	key := strings.Join(values, "\x00")
+	group, ok := a.groups[key]
+	if !ok {
+		group = &Group{Values: values}
+		a.groups[key] = group
+	}
+
+	group.Count++
+	a.total++
+	return nil
+}
+
+// Groups returns the groups counted so far, largest first.
+func (a *Aggregate) Groups() []Group {
+	groups := make([]Group, 0, len(a.groups))
+	for _, group := range a.groups {
+		groups = append(groups, *group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return strings.Join(groups[i].Values, "\x00") < strings.Join(groups[j].Values, "\x00")
+	})
+
+	return groups
+}
+
+// Close writes the summary table.
+func (a *Aggregate) Close() error {
+	table := tabwriter.NewWriter(a.w, 0, 8, 2, ' ', 0)
+
+	header := make([]string, 0, len(a.dimensions)+2)
+	for _, dimension := range a.dimensions {
+		header = append(header, strings.ToUpper(dimension.Name))
+	}
+	header = append(header, "COUNT", "PERCENT")
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+
+	for _, group := range a.Groups() {
+		row := append([]string{}, group.Values...)
+		row = append(row,
+			fmt.Sprintf("%d", group.Count),
+			fmt.Sprintf("%.2f%%", float64(group.Count)/float64(a.total)*100),
+		)
+		fmt.Fprintln(table, strings.Join(row, "\t"))
+	}
+
+	fmt.Fprintf(table, "TOTAL%s\t%d\t\n", strings.Repeat("\t", max(len(a.dimensions)-1, 0)), a.total)
+
+	return table.Flush()
+}
+
+// keyAlgorithm describes the algorithm and size of cert's public key.
+func keyAlgorithm(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA-%s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
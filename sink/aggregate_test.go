@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestAggregate(t *testing.T) {
+	dimensions, err := ParseDimensions([]string{"source", "keyAlgorithm", "validity"})
+	if err != nil {
+		t.Fatalf("parsing dimensions: %s", err)
+	}
+
+	var output bytes.Buffer
+	sink := NewAggregate(&output, dimensions...)
+	for i, source := range []string{"https://b.example/", "https://a.example/", "https://b.example/"} {
+		err = sink.Write(newTestCertificate(t, int64(i)), x509search.Metadata{Source: source})
+		if err != nil {
+			t.Fatalf("writing match: %s", err)
+		}
+	}
+
+	want := []Group{
+		{Values: []string{"https://b.example/", "ECDSA-P-256", "90d"}, Count: 2},
+		{Values: []string{"https://a.example/", "ECDSA-P-256", "90d"}, Count: 1},
+	}
+	if groups := sink.Groups(); !reflect.DeepEqual(groups, want) {
+		t.Errorf("got groups %+v, want %+v", groups, want)
+	}
+
+	err = sink.Close()
+	if err != nil {
+		t.Fatalf("closing sink: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got summary %q, want a header, two groups and a total", output.String())
+	}
+	for i, fields := range [][]string{
+		{"SOURCE", "KEY ALGORITHM", "VALIDITY", "COUNT", "PERCENT"},
+		{"https://b.example/", "ECDSA-P-256", "90d", "2", "66.67%"},
+		{"https://a.example/", "ECDSA-P-256", "90d", "1", "33.33%"},
+		{"TOTAL", "3"},
+	} {
+		for _, field := range fields {
+			if !strings.Contains(lines[i], field) {
+				t.Errorf("summary line %q doesn't contain %q", lines[i], field)
+			}
+		}
+	}
+
+	_, err = ParseDimensions([]string{"issuer", "colour"})
+	if err == nil {
+		t.Error("got no error for an unknown dimension")
+	}
+}
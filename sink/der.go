@@ -0,0 +1,81 @@
+package sink
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// DER writes matches to a single stream as raw DER, suitable for piping into
+// other tools or for archiving very large numbers of certificates without a
+// file per certificate. DER is self-delimiting, so by default certificates are
+// written back to back; length-prefixed framing, where each certificate is
+// preceded by its length as a 4-byte big-endian integer, is easier for other
+// tools to split.
+//
+// Besides being a sink, DER's WriteRaw method is suitable for use as
+// x509search.Search.RawMatchCallback, so that matches are streamed without
+// ever being parsed.
+type DER struct {
+	w              *bufio.Writer
+	lengthPrefixed bool
+
+	// err is the first error writing to w, which stops further writes
+	err error
+}
+
+// NewDER returns a DER sink writing to w. If lengthPrefixed is set, each
+// certificate is preceded by its length.
+func NewDER(w io.Writer, lengthPrefixed bool) *DER {
+	return &DER{
+		w:              bufio.NewWriter(w),
+		lengthPrefixed: lengthPrefixed,
+	}
+}
+
+// Write writes cert's DER encoding to the stream.
+func (d *DER) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	d.WriteRaw(cert.Raw, metadata)
+	return d.err
+}
+
+// WriteRaw writes der to the stream. As it can't return an error, the first
+// error is kept, and returned by Write and Close.
+func (d *DER) WriteRaw(der []byte, _ x509search.Metadata) {
+	if d.err != nil {
+		return
+	}
+
+	if d.lengthPrefixed {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(der)))
+		_, d.err = d.w.Write(length[:])
+		if d.err != nil {
+			d.err = fmt.Errorf("writing DER stream: %w", d.err)
+			return
+		}
+	}
+
+	_, d.err = d.w.Write(der)
+	if d.err != nil {
+		d.err = fmt.Errorf("writing DER stream: %w", d.err)
+	}
+}
+
+// Close flushes buffered output, returning the first error encountered while
+// writing if there was one.
+func (d *DER) Close() error {
+	if d.err != nil {
+		return d.err
+	}
+
+	err := d.w.Flush()
+	if err != nil {
+		return fmt.Errorf("writing DER stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestDER(t *testing.T) {
+	certs := []*x509.Certificate{newTestCertificate(t, 1), newTestCertificate(t, 2)}
+
+	for _, lengthPrefixed := range []bool{false, true} {
+		var output bytes.Buffer
+		sink := NewDER(&output, lengthPrefixed)
+		err := sink.Write(certs[0], x509search.Metadata{})
+		if err != nil {
+			t.Fatalf("writing match: %s", err)
+		}
+		sink.WriteRaw(certs[1].Raw, x509search.Metadata{})
+		err = sink.Close()
+		if err != nil {
+			t.Fatalf("closing sink: %s", err)
+		}
+
+		// Split the stream back into certificates
+		rest := output.Bytes()
+		for i, cert := range certs {
+			var der []byte
+			if lengthPrefixed {
+				length := binary.BigEndian.Uint32(rest)
+				der, rest = rest[4:4+length], rest[4+length:]
+			} else {
+				var value asn1.RawValue
+				next, err := asn1.Unmarshal(rest, &value)
+				if err != nil {
+					t.Fatalf("splitting stream: %s", err)
+				}
+				der, rest = value.FullBytes, next
+			}
+			if !bytes.Equal(der, cert.Raw) {
+				t.Errorf("certificate %d (length prefixed: %t) doesn't round-trip", i, lengthPrefixed)
+			}
+		}
+		if len(rest) != 0 {
+			t.Errorf("got %d bytes after the certificates", len(rest))
+		}
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestDERWriteError(t *testing.T) {
+	sink := NewDER(failingWriter{}, false)
+
+	// The error surfaces once the buffer is flushed, and sticks
+	sink.WriteRaw(newTestCertificate(t, 1).Raw, x509search.Metadata{})
+	if err := sink.Close(); err == nil {
+		t.Fatal("got no error closing a sink that couldn't write")
+	}
+
+	large := bytes.Repeat([]byte{0}, 8192)
+	sink = NewDER(failingWriter{}, true)
+	sink.WriteRaw(large, x509search.Metadata{})
+	if err := sink.Write(newTestCertificate(t, 2), x509search.Metadata{}); err == nil {
+		t.Error("got no error writing after a failed write")
+	}
+}
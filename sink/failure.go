@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// FailureDirectory keeps certificates that couldn't be parsed, for later
+// analysis. Its Capture method is suitable for use as
+// x509search.Search.ParseErrorCallback.
+//
+// Each certificate is written to a file named after its SHA-256 fingerprint
+// with a .der extension, alongside a .json file holding its provenance and the
+// parse error. A certificate found more than once is written once, with the
+// provenance of the last copy found.
+type FailureDirectory struct {
+	dir string
+}
+
+// failureRecord is the content of the .json file describing a failure.
+type failureRecord struct {
+	Fingerprint string              `json:"fingerprint"`
+	Error       string              `json:"error"`
+	Provenance  x509search.Metadata `json:"provenance"`
+}
+
+// NewFailureDirectory returns a FailureDirectory writing to dir, which is
+// created if needed.
+func NewFailureDirectory(dir string) (*FailureDirectory, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating failure directory: %w", err)
+	}
+
+	return &FailureDirectory{dir: dir}, nil
+}
+
+// Capture writes der and a description of why it couldn't be parsed. Errors
+// writing the files are reported on stderr, as they shouldn't interrupt the
+// search.
+func (d *FailureDirectory) Capture(der []byte, metadata x509search.Metadata, parseErr error) {
+	err := d.write(der, metadata, parseErr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "capturing unparseable certificate: %s\n", err.Error())
+	}
+}
+
+func (d *FailureDirectory) write(der []byte, metadata x509search.Metadata, parseErr error) error {
+	fingerprint := fmt.Sprintf("%x", sha256.Sum256(der))
+	base := filepath.Join(d.dir, fingerprint)
+
+	err := os.WriteFile(base+".der", der, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing certificate: %w", err)
+	}
+
+	record, err := json.MarshalIndent(failureRecord{
+		Fingerprint: fingerprint,
+		Error:       parseErr.Error(),
+		Provenance:  metadata,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding failure record: %w", err)
+	}
+
+	err = os.WriteFile(base+".json", append(record, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf("writing failure record: %w", err)
+	}
+
+	return nil
+}
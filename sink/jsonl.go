@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// jsonlFields maps the name of each field a JSONL sink can write to a function
+// returning its value.
+var jsonlFields = map[string]func(Match, x509search.Metadata) any{
+	"fingerprint": func(m Match, _ x509search.Metadata) any { return m.Fingerprint },
+	"serial":      func(m Match, _ x509search.Metadata) any { return m.Serial },
+	"subject":     func(m Match, _ x509search.Metadata) any { return m.Subject },
+	"issuer":      func(m Match, _ x509search.Metadata) any { return m.Issuer },
+	"sans":        func(m Match, _ x509search.Metadata) any { return m.SANs },
+	"not_before":  func(m Match, _ x509search.Metadata) any { return m.NotBefore.UTC().Format(time.RFC3339) },
+	"not_after":   func(m Match, _ x509search.Metadata) any { return m.NotAfter.UTC().Format(time.RFC3339) },
+	"source":      func(_ Match, md x509search.Metadata) any { return md.Source },
+	"source_name": func(_ Match, md x509search.Metadata) any { return md.SourceName },
+	"index":       func(_ Match, md x509search.Metadata) any { return md.Index },
+	"timestamp": func(_ Match, md x509search.Metadata) any {
+		if md.Timestamp.IsZero() {
+			return nil
+		}
+		return md.Timestamp.UTC().Format(time.RFC3339Nano)
+	},
+	"precertificate": func(_ Match, md x509search.Metadata) any { return md.Precertificate },
+	"annotations":    func(_ Match, md x509search.Metadata) any { return md.Annotations },
+	"der": func(m Match, _ x509search.Metadata) any {
+		return base64.StdEncoding.EncodeToString(m.Certificate.Raw)
+	},
+	"pem": func(m Match, _ x509search.Metadata) any {
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: m.Certificate.Raw}))
+	},
+}
+
+// DefaultJSONLFields are the fields a JSONL sink writes if none are given.
+// The certificate itself is omitted, as it makes up most of the output.
+var DefaultJSONLFields = []string{
+	"fingerprint",
+	"serial",
+	"subject",
+	"issuer",
+	"sans",
+	"not_before",
+	"not_after",
+	"source",
+	"index",
+	"timestamp",
+	"precertificate",
+}
+
+// JSONL writes each match as a line of JSON, with a chosen set of fields in a
+// fixed order, for downstream pipelines to consume without parsing PEM. The
+// available fields are those in DefaultJSONLFields, along with "annotations",
+// the annotations made by the search's enrichers, "der", the base64-encoded
+// certificate, and "pem", the PEM-encoded certificate.
+type JSONL struct {
+	w      io.Writer
+	fields []string
+}
+
+// NewJSONL returns a JSONL sink writing the given fields to w. If fields is
+// empty, DefaultJSONLFields are written.
+func NewJSONL(w io.Writer, fields []string) (*JSONL, error) {
+	if len(fields) == 0 {
+		fields = DefaultJSONLFields
+	}
+
+	for _, field := range fields {
+		_, ok := jsonlFields[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown JSONL field: %q", field)
+		}
+	}
+
+	return &JSONL{
+		w:      w,
+		fields: fields,
+	}, nil
+}
+
+// ParseJSONLFields splits a comma-separated list of field names.
+func ParseJSONLFields(list string) []string {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Write writes cert's selected fields as a line of JSON.
+func (j *JSONL) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	match := NewMatch(cert, metadata)
+
+	var line bytes.Buffer
+	line.WriteByte('{')
+	for i, field := range j.fields {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+
+		key, err := json.Marshal(field)
+		if err != nil {
+			return fmt.Errorf("encoding JSONL field: %w", err)
+		}
+
+		value, err := json.Marshal(jsonlFields[field](match, metadata))
+		if err != nil {
+			return fmt.Errorf("encoding JSONL field %q: %w", field, err)
+		}
+
+		line.Write(key)
+		line.WriteByte(':')
+		line.Write(value)
+	}
+	line.WriteString("}\n")
+
+	_, err := j.w.Write(line.Bytes())
+	if err != nil {
+		return fmt.Errorf("writing JSONL: %w", err)
+	}
+	return nil
+}
+
+// Close does nothing, as JSONL doesn't buffer output.
+func (j *JSONL) Close() error {
+	return nil
+}
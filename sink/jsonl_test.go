@@ -0,0 +1,78 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestJSONL(t *testing.T) {
+	cert := newTestCertificate(t, 0x2a)
+	metadata := x509search.Metadata{
+		Source:      "https://log.example/",
+		Index:       7,
+		Timestamp:   time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		Annotations: map[string]string{"ocsp.status": "good"},
+	}
+
+	var output bytes.Buffer
+	sink, err := NewJSONL(&output, nil)
+	if err != nil {
+		t.Fatalf("creating sink: %s", err)
+	}
+	err = sink.Write(cert, metadata)
+	if err != nil {
+		t.Fatalf("writing match: %s", err)
+	}
+
+	var line map[string]any
+	err = json.Unmarshal(output.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("decoding %q: %s", output.String(), err)
+	}
+	if len(line) != len(DefaultJSONLFields) {
+		t.Errorf("got fields %v, want the defaults", line)
+	}
+	if line["serial"] != "2a" || line["index"] != 7.0 || line["timestamp"] != "2025-01-01T12:00:00Z" || line["precertificate"] != false {
+		t.Errorf("got line %v", line)
+	}
+
+	// Chosen fields are written in the order given
+	output.Reset()
+	sink, err = NewJSONL(&output, ParseJSONLFields(" serial, ,annotations,der "))
+	if err != nil {
+		t.Fatalf("creating sink: %s", err)
+	}
+	err = sink.Write(cert, metadata)
+	if err != nil {
+		t.Fatalf("writing match: %s", err)
+	}
+	if !strings.HasPrefix(output.String(), `{"serial":"2a","annotations":{"ocsp.status":"good"},"der":`) || !strings.HasSuffix(output.String(), "}\n") {
+		t.Errorf("got line %q", output.String())
+	}
+
+	var selected struct {
+		DER []byte `json:"der"`
+	}
+	err = json.Unmarshal(output.Bytes(), &selected)
+	if err != nil || !bytes.Equal(selected.DER, cert.Raw) {
+		t.Errorf("DER doesn't round-trip: %v", err)
+	}
+
+	_, err = NewJSONL(&output, []string{"serial", "colour"})
+	if err == nil {
+		t.Error("got no error for an unknown field")
+	}
+}
+
+func TestParseJSONLFields(t *testing.T) {
+	fields := ParseJSONLFields("fingerprint, sans,,pem ")
+	if want := []string{"fingerprint", "sans", "pem"}; !slices.Equal(fields, want) {
+		t.Errorf("got fields %q, want %q", fields, want)
+	}
+}
@@ -0,0 +1,72 @@
+// Package sink provides x509search.Sink implementations for writing search
+// matches in various formats.
+//
+// Sinks never close the writers they're given; closing a sink only flushes the
+// output it has buffered.
+package sink
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Match holds the fields of a matched certificate most commonly needed in
+// search output.
+type Match struct {
+	// Fingerprint is the hex-encoded SHA-256 hash of the certificate's DER
+	// encoding.
+	Fingerprint string
+
+	// Serial is the hex-encoded serial number of the certificate.
+	Serial string
+
+	// Subject is the certificate's subject distinguished name.
+	Subject string
+
+	// Issuer is the certificate's issuer distinguished name.
+	Issuer string
+
+	// SANs lists the certificate's DNS names, IP addresses, email addresses,
+	// and URIs.
+	SANs []string
+
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// Provenance describes where the certificate was found.
+	Provenance x509search.Metadata
+
+	// Certificate is the parsed certificate, for access to any other fields.
+	Certificate *x509.Certificate
+}
+
+// NewMatch extracts the commonly needed fields from a matched certificate.
+func NewMatch(cert *x509.Certificate, metadata x509search.Metadata) Match {
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.EmailAddresses)+len(cert.URIs))
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	return Match{
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+		Serial:      hex.EncodeToString(cert.SerialNumber.Bytes()),
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		SANs:        sans,
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		Provenance:  metadata,
+		Certificate: cert,
+	}
+}
@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"container/heap"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Ordered buffers matches and passes them on to another sink ordered by their
+// metadata timestamp. Data sources search concurrently and so deliver matches
+// out of order; Ordered restores chronological order for output such as
+// incident timelines.
+//
+// Ordering is only guaranteed within a bounded window: a match is released
+// once a match at least Window newer has been seen, or once more than
+// MaxBuffered matches are held. A match arriving later than that is still
+// delivered, but out of order.
+type Ordered struct {
+	next        x509search.Sink
+	window      time.Duration
+	maxBuffered int
+	buffer      matchHeap
+	newest      time.Time
+	sequence    uint64
+}
+
+// NewOrdered returns an Ordered sink delivering to next. If maxBuffered is less
+// than 1, the number of buffered matches is bounded only by window.
+func NewOrdered(next x509search.Sink, window time.Duration, maxBuffered int) (*Ordered, error) {
+	if next == nil {
+		return nil, errors.New("nil sink")
+	}
+
+	if window <= 0 {
+		return nil, errors.New("ordering window must be positive")
+	}
+
+	return &Ordered{
+		next:        next,
+		window:      window,
+		maxBuffered: maxBuffered,
+	}, nil
+}
+
+// Write buffers cert, then delivers any matches that have left the ordering
+// window.
+func (o *Ordered) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	heap.Push(&o.buffer, bufferedMatch{cert: cert, metadata: metadata, sequence: o.sequence})
+	o.sequence++
+
+	if metadata.Timestamp.After(o.newest) {
+		o.newest = metadata.Timestamp
+	}
+
+	cutoff := o.newest.Add(-o.window)
+	for o.buffer.Len() > 0 {
+		oldest := o.buffer[0]
+		overfull := o.maxBuffered > 0 && o.buffer.Len() > o.maxBuffered
+		if !overfull && !oldest.metadata.Timestamp.Before(cutoff) {
+			break
+		}
+
+		err := o.release()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close delivers all buffered matches in order, then closes the next sink.
+func (o *Ordered) Close() error {
+	for o.buffer.Len() > 0 {
+		err := o.release()
+		if err != nil {
+			return errors.Join(err, o.next.Close())
+		}
+	}
+
+	return o.next.Close()
+}
+
+// release delivers the oldest buffered match.
+func (o *Ordered) release() error {
+	match := heap.Pop(&o.buffer).(bufferedMatch)
+	return o.next.Write(match.cert, match.metadata)
+}
+
+type bufferedMatch struct {
+	cert     *x509.Certificate
+	metadata x509search.Metadata
+
+	// sequence breaks timestamp ties in arrival order
+	sequence uint64
+}
+
+// matchHeap is a min-heap of matches ordered by timestamp.
+type matchHeap []bufferedMatch
+
+func (h matchHeap) Len() int { return len(h) }
+
+func (h matchHeap) Less(i, j int) bool {
+	if h[i].metadata.Timestamp.Equal(h[j].metadata.Timestamp) {
+		return h[i].sequence < h[j].sequence
+	}
+	return h[i].metadata.Timestamp.Before(h[j].metadata.Timestamp)
+}
+
+func (h matchHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *matchHeap) Push(x any) { *h = append(*h, x.(bufferedMatch)) }
+
+func (h *matchHeap) Pop() any {
+	old := *h
+	n := len(old)
+	match := old[n-1]
+	old[n-1] = bufferedMatch{}
+	*h = old[:n-1]
+	return match
+}
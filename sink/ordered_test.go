@@ -0,0 +1,91 @@
+package sink
+
+import (
+	"crypto/x509"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// recorder is a sink recording the indexes of the matches written to it.
+type recorder struct {
+	indexes []int64
+	closed  bool
+}
+
+func (r *recorder) Write(_ *x509.Certificate, metadata x509search.Metadata) error {
+	r.indexes = append(r.indexes, metadata.Index)
+	return nil
+}
+
+func (r *recorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestOrdered(t *testing.T) {
+	next := &recorder{}
+	ordered, err := NewOrdered(next, time.Minute, 0)
+	if err != nil {
+		t.Fatalf("creating sink: %s", err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(index int64, offset time.Duration) {
+		t.Helper()
+		err := ordered.Write(&x509.Certificate{}, x509search.Metadata{Index: index, Timestamp: start.Add(offset)})
+		if err != nil {
+			t.Fatalf("writing match %d: %s", index, err)
+		}
+	}
+
+	// Matches within the window are held until it has passed, then released
+	// in order, with ties kept in arrival order
+	write(3, 30*time.Second)
+	write(1, 10*time.Second)
+	write(2, 10*time.Second)
+	write(0, 0)
+	if len(next.indexes) != 0 {
+		t.Errorf("released %v before the window passed", next.indexes)
+	}
+
+	write(5, 75*time.Second)
+	if want := []int64{0, 1, 2}; !slices.Equal(next.indexes, want) {
+		t.Errorf("released %v, want %v", next.indexes, want)
+	}
+
+	write(4, 60*time.Second)
+	err = ordered.Close()
+	if err != nil {
+		t.Fatalf("closing sink: %s", err)
+	}
+	if want := []int64{0, 1, 2, 3, 4, 5}; !slices.Equal(next.indexes, want) {
+		t.Errorf("delivered %v, want %v", next.indexes, want)
+	}
+	if !next.closed {
+		t.Error("next sink not closed")
+	}
+}
+
+func TestOrderedMaxBuffered(t *testing.T) {
+	next := &recorder{}
+	ordered, err := NewOrdered(next, time.Hour, 2)
+	if err != nil {
+		t.Fatalf("creating sink: %s", err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, offset := range []time.Duration{2, 1, 3} {
+		err := ordered.Write(&x509.Certificate{}, x509search.Metadata{Index: int64(i), Timestamp: start.Add(offset * time.Second)})
+		if err != nil {
+			t.Fatalf("writing match %d: %s", i, err)
+		}
+	}
+
+	// Holding a third match releases the oldest
+	if want := []int64{1}; !slices.Equal(next.indexes, want) {
+		t.Errorf("released %v, want %v", next.indexes, want)
+	}
+}
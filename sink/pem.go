@@ -0,0 +1,29 @@
+package sink
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// PEM writes each match as a PEM-encoded CERTIFICATE block.
+type PEM struct {
+	w io.Writer
+}
+
+// NewPEM returns a PEM sink writing to w.
+func NewPEM(w io.Writer) *PEM {
+	return &PEM{w: w}
+}
+
+// Write encodes cert as a PEM block.
+func (p *PEM) Write(cert *x509.Certificate, _ x509search.Metadata) error {
+	return pem.Encode(p.w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// Close does nothing, as PEM doesn't buffer output.
+func (p *PEM) Close() error {
+	return nil
+}
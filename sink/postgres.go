@@ -0,0 +1,228 @@
+package sink
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// DefaultPostgresBatchSize is the number of matches a Postgres sink buffers
+// before copying them into the database, if no batch size is given.
+const DefaultPostgresBatchSize = 5000
+
+// postgresColumns lists the columns a Postgres sink writes, in order, along
+// with their types.
+var postgresColumns = []struct {
+	name, dataType string
+}{
+	{"fingerprint", "TEXT"},
+	{"serial", "TEXT"},
+	{"issuer", "TEXT"},
+	{"subject", "TEXT"},
+	{"sans", "TEXT[]"},
+	{"not_before", "TIMESTAMPTZ"},
+	{"not_after", "TIMESTAMPTZ"},
+	{"precertificate", "BOOLEAN"},
+	{"source", "TEXT"},
+	{"log_index", "BIGINT"},
+	{"logged_at", "TIMESTAMPTZ"},
+	{"der", "BYTEA"},
+}
+
+// Postgres bulk-inserts matches into a PostgreSQL table, for feeding search
+// results into an existing certificate inventory. The table is created if it
+// doesn't exist, with the columns:
+//
+//	fingerprint TEXT PRIMARY KEY
+//	serial TEXT
+//	issuer TEXT
+//	subject TEXT
+//	sans TEXT[]
+//	not_before TIMESTAMPTZ
+//	not_after TIMESTAMPTZ
+//	precertificate BOOLEAN
+//	source TEXT
+//	log_index BIGINT
+//	logged_at TIMESTAMPTZ
+//	der BYTEA
+//
+// An existing table must have at least these columns, and a unique
+// constraint on fingerprint. The table name is quoted as a single identifier,
+// so a table outside the default schema is selected with the connection's
+// search_path.
+//
+// Matches are buffered and written in batches, each copied into a temporary
+// table with COPY and then inserted into the target table, ignoring
+// certificates whose fingerprint is already present. The database must be
+// opened with the "postgres" driver registered by github.com/lib/pq, which
+// supports COPY through database/sql.
+type Postgres struct {
+	db        *sql.DB
+	table     string
+	batchSize int
+	rows      [][]any
+}
+
+// NewPostgres returns a Postgres sink inserting into table in db, creating the
+// table if needed. If batchSize is less than 1, DefaultPostgresBatchSize is
+// used.
+func NewPostgres(db *sql.DB, table string, batchSize int) (*Postgres, error) {
+	if db == nil {
+		return nil, errors.New("nil database")
+	}
+
+	if table == "" {
+		return nil, errors.New("empty table name")
+	}
+
+	if batchSize < 1 {
+		batchSize = DefaultPostgresBatchSize
+	}
+
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		fingerprint TEXT PRIMARY KEY,
+		serial TEXT NOT NULL,
+		issuer TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		sans TEXT[] NOT NULL,
+		not_before TIMESTAMPTZ NOT NULL,
+		not_after TIMESTAMPTZ NOT NULL,
+		precertificate BOOLEAN NOT NULL,
+		source TEXT NOT NULL,
+		log_index BIGINT NOT NULL,
+		logged_at TIMESTAMPTZ,
+		der BYTEA NOT NULL
+	)`, pq.QuoteIdentifier(table)))
+	if err != nil {
+		return nil, fmt.Errorf("creating table: %w", err)
+	}
+
+	return &Postgres{
+		db:        db,
+		table:     table,
+		batchSize: batchSize,
+	}, nil
+}
+
+// Write buffers cert, writing the buffered matches once a batch is full.
+func (p *Postgres) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	match := NewMatch(cert, metadata)
+
+	var loggedAt any
+	if !metadata.Timestamp.IsZero() {
+		loggedAt = metadata.Timestamp.UTC()
+	}
+
+	p.rows = append(p.rows, []any{
+		match.Fingerprint,
+		match.Serial,
+		match.Issuer,
+		match.Subject,
+		pq.Array(match.SANs),
+		match.NotBefore.UTC(),
+		match.NotAfter.UTC(),
+		metadata.Precertificate,
+		metadata.Source,
+		metadata.Index,
+		loggedAt,
+		cert.Raw,
+	})
+
+	if len(p.rows) >= p.batchSize {
+		return p.flush()
+	}
+
+	return nil
+}
+
+// flush copies the buffered matches into the table in a single transaction.
+func (p *Postgres) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	names := make([]string, len(postgresColumns))
+	definitions := make([]string, len(postgresColumns))
+	for i, column := range postgresColumns {
+		names[i] = column.name
+		definitions[i] = pq.QuoteIdentifier(column.name) + " " + column.dataType
+	}
+
+	// The staging table lets COPY be used while skipping duplicates, which
+	// COPY can't do on its own
+	staging := "x509search_staging"
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TEMPORARY TABLE %s (%s) ON COMMIT DROP",
+		pq.QuoteIdentifier(staging), strings.Join(definitions, ", "),
+	))
+	if err != nil {
+		return fmt.Errorf("creating staging table: %w", err)
+	}
+
+	copyIn, err := tx.PrepareContext(ctx, pq.CopyIn(staging, names...))
+	if err != nil {
+		return fmt.Errorf("preparing copy: %w", err)
+	}
+
+	for _, row := range p.rows {
+		_, err = copyIn.ExecContext(ctx, row...)
+		if err != nil {
+			copyIn.Close()
+			return fmt.Errorf("copying matches: %w", err)
+		}
+	}
+
+	// Executing the statement without arguments completes the copy
+	_, err = copyIn.ExecContext(ctx)
+	if err != nil {
+		copyIn.Close()
+		return fmt.Errorf("copying matches: %w", err)
+	}
+
+	err = copyIn.Close()
+	if err != nil {
+		return fmt.Errorf("copying matches: %w", err)
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pq.QuoteIdentifier(name)
+	}
+	columns := strings.Join(quoted, ", ")
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT (fingerprint) DO NOTHING",
+		pq.QuoteIdentifier(p.table), columns, columns, pq.QuoteIdentifier(staging),
+	))
+	if err != nil {
+		return fmt.Errorf("inserting matches: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing matches: %w", err)
+	}
+
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// Close writes any buffered matches. It doesn't close the database.
+func (p *Postgres) Close() error {
+	return p.flush()
+}
@@ -0,0 +1,81 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestPostgres(t *testing.T) {
+	recording, db := newRecordingDB(t)
+	sink, err := NewPostgres(db, "matches", 2)
+	if err != nil {
+		t.Fatalf("creating sink: %s", err)
+	}
+	if created := recording.matching(`CREATE TABLE IF NOT EXISTS "matches"`); len(created) != 1 {
+		t.Errorf("created the table %d times, want once", len(created))
+	}
+
+	certs := []*x509.Certificate{newTestCertificate(t, 1), newTestCertificate(t, 2), newTestCertificate(t, 3)}
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, cert := range certs {
+		err = sink.Write(cert, x509search.Metadata{Source: "https://log.example/", Index: int64(i), Timestamp: timestamp})
+		if err != nil {
+			t.Fatalf("writing match: %s", err)
+		}
+	}
+
+	// The first batch is full, and the rest is written on closing
+	if recording.commits != 1 {
+		t.Errorf("committed %d batches before closing, want 1", recording.commits)
+	}
+	err = sink.Close()
+	if err != nil {
+		t.Fatalf("closing sink: %s", err)
+	}
+	if recording.commits != 2 {
+		t.Errorf("committed %d batches, want 2", recording.commits)
+	}
+
+	// Each batch is copied into a staging table, with an empty execution
+	// ending each copy, and inserted from there
+	copies := recording.matching("COPY")
+	var copied []recordedExec
+	for _, exec := range copies {
+		if len(exec.args) > 0 {
+			copied = append(copied, exec)
+		}
+	}
+	if len(copies) != len(certs)+2 || len(copied) != len(certs) {
+		t.Fatalf("got %d copy executions, %d with rows, want %d rows and 2 ends", len(copies), len(copied), len(certs))
+	}
+	for i, cert := range certs {
+		match := NewMatch(cert, x509search.Metadata{})
+		args := copied[i].args
+		if args[0] != match.Fingerprint || args[4] != "{"+`"`+strings.Join(match.SANs, `","`)+`"`+"}" || args[9] != int64(i) {
+			t.Errorf("copied certificate %d as %v", i, args[:10])
+		}
+		if !args[10].(time.Time).Equal(timestamp) || !bytes.Equal(args[11].([]byte), cert.Raw) {
+			t.Errorf("certificate %d: copied logged_at %v, and DER that doesn't round-trip", i, args[10])
+		}
+	}
+
+	inserts := recording.matching(`INSERT INTO "matches"`)
+	if len(inserts) != 2 || !strings.HasSuffix(inserts[0].query, "ON CONFLICT (fingerprint) DO NOTHING") {
+		t.Errorf("got inserts %+v, want one per batch skipping duplicates", inserts)
+	}
+	for _, exec := range append(copies, inserts...) {
+		if exec.tx == 0 {
+			t.Errorf("%q ran outside of a transaction", exec.query)
+		}
+	}
+
+	_, err = NewPostgres(db, "", 0)
+	if err == nil {
+		t.Error("got no error for an empty table name")
+	}
+}
@@ -0,0 +1,154 @@
+package sink
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// sqliteBatchSize is the number of matches a SQLite sink inserts per
+// transaction.
+const sqliteBatchSize = 1000
+
+// sqliteSchema creates the tables and indexes a SQLite sink writes to. Times
+// are stored as RFC 3339 text, which SQLite's date and time functions accept.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS certificates (
+		fingerprint TEXT PRIMARY KEY,
+		serial TEXT NOT NULL,
+		issuer TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		not_before TEXT NOT NULL,
+		not_after TEXT NOT NULL,
+		precertificate INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		log_index INTEGER NOT NULL,
+		logged_at TEXT,
+		der BLOB NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS sans (
+		fingerprint TEXT NOT NULL REFERENCES certificates (fingerprint),
+		name TEXT NOT NULL,
+		PRIMARY KEY (fingerprint, name)
+	)`,
+	`CREATE INDEX IF NOT EXISTS certificates_serial ON certificates (serial)`,
+	`CREATE INDEX IF NOT EXISTS certificates_issuer ON certificates (issuer)`,
+	`CREATE INDEX IF NOT EXISTS certificates_not_before ON certificates (not_before)`,
+	`CREATE INDEX IF NOT EXISTS certificates_not_after ON certificates (not_after)`,
+	`CREATE INDEX IF NOT EXISTS sans_name ON sans (name)`,
+}
+
+// SQLite writes matches to a SQLite database for ad-hoc querying. Matches are
+// stored in a certificates table holding the fields of Match along with the
+// DER encoding and provenance of each certificate, and their SANs in a sans
+// table keyed by fingerprint. A certificate found more than once is stored
+// once, with the provenance of the first copy found.
+//
+// The database is opened by the caller, with a SQLite driver of their choice
+// registered with database/sql. Matches are inserted in batches, each in its
+// own transaction, so some may not be stored until the sink is closed.
+type SQLite struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	pending int
+}
+
+// NewSQLite returns a SQLite sink writing to db, creating the schema if it
+// doesn't already exist.
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	if db == nil {
+		return nil, errors.New("nil database")
+	}
+
+	for _, statement := range sqliteSchema {
+		_, err := db.Exec(statement)
+		if err != nil {
+			return nil, fmt.Errorf("creating schema: %w", err)
+		}
+	}
+
+	return &SQLite{db: db}, nil
+}
+
+// Write inserts cert, unless a certificate with the same fingerprint has
+// already been stored.
+func (s *SQLite) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	if s.tx == nil {
+		tx, err := s.db.BeginTx(context.Background(), nil)
+		if err != nil {
+			return fmt.Errorf("beginning transaction: %w", err)
+		}
+		s.tx = tx
+	}
+
+	match := NewMatch(cert, metadata)
+
+	var loggedAt sql.NullString
+	if !metadata.Timestamp.IsZero() {
+		loggedAt = sql.NullString{String: metadata.Timestamp.UTC().Format(time.RFC3339Nano), Valid: true}
+	}
+
+	result, err := s.tx.Exec(
+		`INSERT OR IGNORE INTO certificates (fingerprint, serial, issuer, subject, not_before, not_after, precertificate, source, log_index, logged_at, der) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		match.Fingerprint,
+		match.Serial,
+		match.Issuer,
+		match.Subject,
+		match.NotBefore.UTC().Format(time.RFC3339),
+		match.NotAfter.UTC().Format(time.RFC3339),
+		metadata.Precertificate,
+		metadata.Source,
+		metadata.Index,
+		loggedAt,
+		cert.Raw,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting certificate: %w", err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("inserting certificate: %w", err)
+	}
+
+	if inserted > 0 {
+		for _, name := range match.SANs {
+			_, err := s.tx.Exec(`INSERT OR IGNORE INTO sans (fingerprint, name) VALUES (?, ?)`, match.Fingerprint, name)
+			if err != nil {
+				return fmt.Errorf("inserting SAN: %w", err)
+			}
+		}
+	}
+
+	s.pending++
+	if s.pending >= sqliteBatchSize {
+		return s.commit()
+	}
+
+	return nil
+}
+
+// commit commits the current batch.
+func (s *SQLite) commit() error {
+	if s.tx == nil {
+		return nil
+	}
+
+	err := s.tx.Commit()
+	s.tx = nil
+	s.pending = 0
+	if err != nil {
+		return fmt.Errorf("committing matches: %w", err)
+	}
+	return nil
+}
+
+// Close commits any matches not yet committed. It doesn't close the database.
+func (s *SQLite) Close() error {
+	return s.commit()
+}
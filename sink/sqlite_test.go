@@ -0,0 +1,203 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// recordingDB is a database/sql driver recording the statements executed
+// against it, along with their arguments and the transaction they ran in.
+// Inserts into certificates with INSERT OR IGNORE only affect a row if its
+// fingerprint hasn't been inserted before, as in SQLite.
+type recordingDB struct {
+	mu        sync.Mutex
+	execs     []recordedExec
+	commits   int
+	inserted  map[string]bool
+	currentTx int
+}
+
+// recordedExec is a statement executed against a recordingDB.
+type recordedExec struct {
+	query string
+	args  []driver.Value
+
+	// tx is the number of the transaction the statement ran in, counting
+	// from 1, or 0 if it ran outside of one.
+	tx int
+}
+
+func newRecordingDB(t *testing.T) (*recordingDB, *sql.DB) {
+	t.Helper()
+
+	recording := &recordingDB{inserted: make(map[string]bool)}
+	db := sql.OpenDB(recording)
+	t.Cleanup(func() { db.Close() })
+	return recording, db
+}
+
+func (r *recordingDB) Connect(context.Context) (driver.Conn, error) {
+	return recordingConn{r}, nil
+}
+
+func (r *recordingDB) Driver() driver.Driver {
+	return nil
+}
+
+// matching returns the statements executed that begin with prefix.
+func (r *recordingDB) matching(prefix string) []recordedExec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var execs []recordedExec
+	for _, exec := range r.execs {
+		if strings.HasPrefix(strings.TrimSpace(exec.query), prefix) {
+			execs = append(execs, exec)
+		}
+	}
+	return execs
+}
+
+type recordingConn struct {
+	db *recordingDB
+}
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{db: c.db, query: query}, nil
+}
+
+func (c recordingConn) Close() error {
+	return nil
+}
+
+func (c recordingConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.currentTx = c.db.commits + 1
+	return recordingTx{c.db}, nil
+}
+
+type recordingTx struct {
+	db *recordingDB
+}
+
+func (t recordingTx) Commit() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	t.db.commits++
+	t.db.currentTx = 0
+	return nil
+}
+
+func (t recordingTx) Rollback() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+
+	t.db.currentTx = 0
+	return nil
+}
+
+type recordingStmt struct {
+	db    *recordingDB
+	query string
+}
+
+func (s recordingStmt) Close() error {
+	return nil
+}
+
+func (s recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.execs = append(s.db.execs, recordedExec{query: s.query, args: args, tx: s.db.currentTx})
+
+	if strings.HasPrefix(s.query, "INSERT OR IGNORE INTO certificates") {
+		fingerprint := args[0].(string)
+		if s.db.inserted[fingerprint] {
+			return driver.RowsAffected(0), nil
+		}
+		s.db.inserted[fingerprint] = true
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("queries aren't supported")
+}
+
+func TestSQLite(t *testing.T) {
+	recording, db := newRecordingDB(t)
+	sink, err := NewSQLite(db)
+	if err != nil {
+		t.Fatalf("creating sink: %s", err)
+	}
+	if schema := recording.matching("CREATE"); len(schema) != len(sqliteSchema) {
+		t.Errorf("ran %d schema statements, want %d", len(schema), len(sqliteSchema))
+	}
+
+	first, second := newTestCertificate(t, 1), newTestCertificate(t, 2)
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, cert := range []*x509.Certificate{first, second, first} {
+		err = sink.Write(cert, x509search.Metadata{Source: "https://log.example/", Index: int64(i), Timestamp: timestamp})
+		if err != nil {
+			t.Fatalf("writing match: %s", err)
+		}
+	}
+
+	// Nothing is committed until the batch fills or the sink is closed
+	if recording.commits != 0 {
+		t.Errorf("committed %d times before closing", recording.commits)
+	}
+	err = sink.Close()
+	if err != nil {
+		t.Fatalf("closing sink: %s", err)
+	}
+	if recording.commits != 1 {
+		t.Errorf("committed %d times, want once", recording.commits)
+	}
+
+	inserts := recording.matching("INSERT OR IGNORE INTO certificates")
+	if len(inserts) != 3 {
+		t.Fatalf("inserted %d certificates, want 3", len(inserts))
+	}
+	for i, cert := range []*x509.Certificate{first, second} {
+		match := NewMatch(cert, x509search.Metadata{})
+		args := inserts[i].args
+		if args[0] != match.Fingerprint || args[1] != match.Serial || args[8] != int64(i) {
+			t.Errorf("inserted certificate %d as %v", i, args[:9])
+		}
+		if args[9] != "2025-01-01T12:00:00Z" || !bytes.Equal(args[10].([]byte), cert.Raw) {
+			t.Errorf("certificate %d: inserted logged_at %v, and DER that doesn't round-trip", i, args[9])
+		}
+		if inserts[i].tx != 1 {
+			t.Errorf("certificate %d was inserted outside the batch's transaction", i)
+		}
+	}
+
+	// The duplicate's SANs aren't inserted again
+	if sans := recording.matching("INSERT OR IGNORE INTO sans"); len(sans) != 2*len(NewMatch(first, x509search.Metadata{}).SANs) {
+		t.Errorf("inserted %d SANs, want those of two certificates", len(sans))
+	}
+
+	_, err = NewSQLite(nil)
+	if err == nil {
+		t.Error("got no error for a nil database")
+	}
+}
@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Template renders each match through a text/template, so that output can be
+// tailored to whatever downstream scripts expect. The template is executed
+// with a Match as its data, and a newline is written after each rendering
+// that doesn't already end with one. For example:
+//
+//	{{.Fingerprint}} {{join .SANs ","}} {{.Provenance.Source}} {{.Provenance.Index}}
+//
+// In addition to the standard template functions, join is available, which
+// calls strings.Join.
+type Template struct {
+	w        io.Writer
+	template *template.Template
+	buffer   bytes.Buffer
+}
+
+// NewTemplate parses text as a template and returns a Template sink writing to
+// w.
+func NewTemplate(w io.Writer, text string) (*Template, error) {
+	tmpl, err := template.New("match").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+
+	return &Template{w: w, template: tmpl}, nil
+}
+
+// Write renders the template for cert.
+func (t *Template) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	// Render into a buffer first, so a failed execution doesn't leave a
+	// partial line in the output
+	t.buffer.Reset()
+
+	err := t.template.Execute(&t.buffer, NewMatch(cert, metadata))
+	if err != nil {
+		return fmt.Errorf("executing template: %w", err)
+	}
+
+	if !bytes.HasSuffix(t.buffer.Bytes(), []byte("\n")) {
+		t.buffer.WriteByte('\n')
+	}
+
+	_, err = t.w.Write(t.buffer.Bytes())
+	return err
+}
+
+// Close does nothing, as Template doesn't buffer output between matches.
+func (t *Template) Close() error {
+	return nil
+}
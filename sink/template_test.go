@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// newTestCertificate issues a self-signed certificate for serial with a SAN
+// of each type.
+func newTestCertificate(t *testing.T, serial int64) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(serial),
+		Subject:        pkix.Name{CommonName: "example.com"},
+		DNSNames:       []string{"example.com", "www.example.com"},
+		IPAddresses:    []net.IP{{192, 0, 2, 1}},
+		EmailAddresses: []string{"admin@example.com"},
+		URIs:           []*url.URL{{Scheme: "https", Host: "example.com"}},
+		NotBefore:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:       time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestNewMatch(t *testing.T) {
+	cert := newTestCertificate(t, 0x2a)
+	metadata := x509search.Metadata{Source: "https://log.example/", Index: 7}
+
+	match := NewMatch(cert, metadata)
+	if match.Serial != "2a" || match.Subject != "CN=example.com" || match.Issuer != "CN=example.com" {
+		t.Errorf("got match %+v", match)
+	}
+	if want := []string{"example.com", "www.example.com", "192.0.2.1", "admin@example.com", "https://example.com"}; !slices.Equal(match.SANs, want) {
+		t.Errorf("got SANs %q, want %q", match.SANs, want)
+	}
+	if len(match.Fingerprint) != 64 || match.Provenance.Index != 7 || match.Certificate != cert {
+		t.Errorf("got match %+v", match)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	var output bytes.Buffer
+	sink, err := NewTemplate(&output, `{{.Serial}} {{join .SANs ","}} {{.Provenance.Source}} {{.Provenance.Index}}`)
+	if err != nil {
+		t.Fatalf("creating sink: %s", err)
+	}
+
+	for i := range int64(2) {
+		err = sink.Write(newTestCertificate(t, 0x2a+i), x509search.Metadata{Source: "https://log.example/", Index: i})
+		if err != nil {
+			t.Fatalf("writing match: %s", err)
+		}
+	}
+	err = sink.Close()
+	if err != nil {
+		t.Fatalf("closing sink: %s", err)
+	}
+
+	want := "2a example.com,www.example.com,192.0.2.1,admin@example.com,https://example.com https://log.example/ 0\n" +
+		"2b example.com,www.example.com,192.0.2.1,admin@example.com,https://example.com https://log.example/ 1\n"
+	if output.String() != want {
+		t.Errorf("got output %q, want %q", output.String(), want)
+	}
+
+	// A rendering that fails partway through writes nothing
+	output.Reset()
+	failing, err := NewTemplate(&output, `{{.Serial}} {{index .SANs 10}}`)
+	if err != nil {
+		t.Fatalf("creating sink: %s", err)
+	}
+	err = failing.Write(newTestCertificate(t, 1), x509search.Metadata{})
+	if err == nil || output.Len() != 0 {
+		t.Errorf("failed rendering returned %v, and wrote %q", err, output.String())
+	}
+
+	_, err = NewTemplate(&output, `{{.Serial`)
+	if err == nil {
+		t.Error("got no error for a malformed template")
+	}
+}
+
+func TestPEM(t *testing.T) {
+	certs := []*x509.Certificate{newTestCertificate(t, 1), newTestCertificate(t, 2)}
+
+	var output bytes.Buffer
+	sink := NewPEM(&output)
+	for _, cert := range certs {
+		err := sink.Write(cert, x509search.Metadata{})
+		if err != nil {
+			t.Fatalf("writing match: %s", err)
+		}
+	}
+
+	rest := output.Bytes()
+	for i, cert := range certs {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil || block.Type != "CERTIFICATE" || !bytes.Equal(block.Bytes, cert.Raw) {
+			t.Fatalf("block %d doesn't hold the certificate: %v", i, block)
+		}
+	}
+	if len(rest) != 0 {
+		t.Errorf("got %d bytes after the certificates", len(rest))
+	}
+}
@@ -0,0 +1,129 @@
+package sink
+
+import (
+	"archive/zip"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// zipManifestHeader lists the columns of a Zip sink's index.csv.
+var zipManifestHeader = []string{
+	"file",
+	"fingerprint",
+	"serial",
+	"subject",
+	"issuer",
+	"sans",
+	"not_before",
+	"not_after",
+	"source",
+	"index",
+	"timestamp",
+	"precertificate",
+}
+
+// Zip writes matches into a zip archive, giving a single portable artifact
+// per search. Each match is stored as <sha256>.pem, or <sha256>.der if the
+// sink was created for DER, and an index.csv manifest describing every match
+// and where it was found is added when the sink is closed. A certificate found
+// more than once is stored once, with the provenance of the first copy found.
+type Zip struct {
+	archive   *zip.Writer
+	der       bool
+	manifest  [][]string
+	fileNames map[string]bool
+}
+
+// NewZip returns a Zip sink writing an archive to w. If der is set,
+// certificates are stored in DER rather than PEM form.
+func NewZip(w io.Writer, der bool) *Zip {
+	return &Zip{
+		archive:   zip.NewWriter(w),
+		der:       der,
+		fileNames: make(map[string]bool),
+	}
+}
+
+// Write adds cert to the archive and records it in the manifest.
+func (z *Zip) Write(cert *x509.Certificate, metadata x509search.Metadata) error {
+	match := NewMatch(cert, metadata)
+
+	name := match.Fingerprint + ".pem"
+	if z.der {
+		name = match.Fingerprint + ".der"
+	}
+
+	if z.fileNames[name] {
+		return nil
+	}
+
+	file, err := z.archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("adding %s to archive: %w", name, err)
+	}
+
+	if z.der {
+		_, err = file.Write(cert.Raw)
+	} else {
+		err = pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s to archive: %w", name, err)
+	}
+
+	z.fileNames[name] = true
+
+	var timestamp string
+	if !metadata.Timestamp.IsZero() {
+		timestamp = metadata.Timestamp.UTC().Format(time.RFC3339)
+	}
+
+	z.manifest = append(z.manifest, []string{
+		name,
+		match.Fingerprint,
+		match.Serial,
+		match.Subject,
+		match.Issuer,
+		strings.Join(match.SANs, " "),
+		match.NotBefore.UTC().Format(time.RFC3339),
+		match.NotAfter.UTC().Format(time.RFC3339),
+		metadata.Source,
+		strconv.FormatInt(metadata.Index, 10),
+		timestamp,
+		strconv.FormatBool(metadata.Precertificate),
+	})
+
+	return nil
+}
+
+// Close adds the manifest and finishes the archive.
+func (z *Zip) Close() error {
+	file, err := z.archive.Create("index.csv")
+	if err != nil {
+		return errors.Join(fmt.Errorf("adding manifest to archive: %w", err), z.archive.Close())
+	}
+
+	writer := csv.NewWriter(file)
+	err = writer.Write(zipManifestHeader)
+	if err == nil {
+		err = writer.WriteAll(z.manifest)
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("writing manifest: %w", err), z.archive.Close())
+	}
+
+	return z.archive.Close()
+}
@@ -0,0 +1,85 @@
+package sink
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/pem"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+func TestZip(t *testing.T) {
+	first, second := newTestCertificate(t, 1), newTestCertificate(t, 2)
+	timestamp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, der := range []bool{false, true} {
+		var archive bytes.Buffer
+		sink := NewZip(&archive, der)
+
+		// The second copy of the first certificate is left out
+		for i, cert := range []*x509.Certificate{first, second, first} {
+			err := sink.Write(cert, x509search.Metadata{Source: "https://log.example/", Index: int64(i), Timestamp: timestamp})
+			if err != nil {
+				t.Fatalf("writing match: %s", err)
+			}
+		}
+		err := sink.Close()
+		if err != nil {
+			t.Fatalf("closing sink: %s", err)
+		}
+
+		reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+		if err != nil {
+			t.Fatalf("reading archive: %s", err)
+		}
+		files := make(map[string][]byte)
+		for _, file := range reader.File {
+			contents, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[file.Name], err = io.ReadAll(contents)
+			contents.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(files) != 3 {
+			t.Errorf("archive holds %d files, want two certificates and the manifest", len(files))
+		}
+
+		manifest, err := csv.NewReader(bytes.NewReader(files["index.csv"])).ReadAll()
+		if err != nil {
+			t.Fatalf("reading manifest: %s", err)
+		}
+		if len(manifest) != 3 || manifest[0][0] != "file" {
+			t.Fatalf("got manifest %q, want a header and two rows", manifest)
+		}
+
+		for i, cert := range []*x509.Certificate{first, second} {
+			row := manifest[i+1]
+			match := NewMatch(cert, x509search.Metadata{})
+			if row[1] != match.Fingerprint || row[9] != strconv.Itoa(i) || row[10] != "2025-01-01T12:00:00Z" {
+				t.Errorf("got manifest row %q", row)
+			}
+
+			contents := files[row[0]]
+			if !der {
+				block, _ := pem.Decode(contents)
+				if block == nil {
+					t.Fatalf("%s isn't PEM", row[0])
+				}
+				contents = block.Bytes
+			}
+			if !bytes.Equal(contents, cert.Raw) {
+				t.Errorf("%s doesn't hold the certificate", row[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package staticctapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// maxCheckpointSize bounds the size of checkpoints accepted by ParseCheckpoint.
+const maxCheckpointSize = 1e6
+
+// Checkpoint is a parsed log checkpoint, as defined by c2sp.org/tlog-checkpoint.
+type Checkpoint struct {
+	// Origin is the first line of the checkpoint, which uniquely identifies
+	// the log.
+	Origin string
+
+	// TreeSize is the number of entries in the tree the checkpoint commits to.
+	TreeSize int64
+
+	// RootHash is the Merkle tree hash of the tree.
+	RootHash tlog.Hash
+
+	// Extensions holds any extension lines following the root hash, without
+	// their trailing newlines.
+	Extensions []string
+
+	// Note is the checkpoint exactly as it was parsed, including any
+	// signatures, for callers that verify or persist it.
+	Note []byte
+}
+
+// Tree returns the tree the checkpoint commits to.
+func (c Checkpoint) Tree() tlog.Tree {
+	return tlog.Tree{N: c.TreeSize, Hash: c.RootHash}
+}
+
+// ParseCheckpoint parses a checkpoint, which may be either a bare checkpoint
+// body or a signed note. Signatures aren't verified; see GetVerifiedTree.
+func ParseCheckpoint(data []byte) (Checkpoint, error) {
+	if len(data) > maxCheckpointSize {
+		return Checkpoint{}, errors.New("malformed checkpoint: incorrect size")
+	}
+
+	// The body of a signed note is separated from its signatures by a blank
+	// line
+	body := data
+	if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		body = data[:i+1]
+	}
+
+	if !bytes.HasSuffix(body, []byte("\n")) || bytes.Count(body, []byte("\n")) < 3 {
+		return Checkpoint{}, errors.New("malformed checkpoint: incorrect size")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+
+	if lines[0] == "" {
+		return Checkpoint{}, errors.New("malformed checkpoint: empty origin")
+	}
+
+	treeSize, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil || treeSize < 0 || lines[1] != strconv.FormatInt(treeSize, 10) {
+		return Checkpoint{}, errors.New("malformed checkpoint: invalid tree size")
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || len(hash) != tlog.HashSize {
+		return Checkpoint{}, errors.New("malformed checkpoint: invalid root hash")
+	}
+
+	checkpoint := Checkpoint{
+		Origin:     lines[0],
+		TreeSize:   treeSize,
+		Extensions: lines[3:],
+		Note:       data,
+	}
+	copy(checkpoint.RootHash[:], hash)
+
+	return checkpoint, nil
+}
+
+// TreeSizeFromCheckpoint verifies the given checkpoint is parseable, then
+// returns the parsed tree size.
+//
+// Deprecated: Use ParseCheckpoint, which returns the rest of the checkpoint
+// too.
+func TreeSizeFromCheckpoint(text string) (int64, error) {
+	checkpoint, err := ParseCheckpoint([]byte(text))
+	if err != nil {
+		return -1, err
+	}
+
+	return checkpoint.TreeSize, nil
+}
@@ -0,0 +1,102 @@
+package staticctapi
+
+import (
+	"context"
+	"sync"
+
+	"filippo.io/sunlight"
+)
+
+// tileKey identifies a data tile of a log across every Log in the process.
+type tileKey struct {
+	log       string
+	tileIndex int64
+
+	// limit is the Log's limit on the size of the tile, as a tile one Log
+	// rejects as too large mustn't be handed to another that accepts it, nor
+	// the other way around
+	limit int64
+}
+
+// tileFlight is a fetch of a data tile that is in progress. done is closed
+// once the other fields are set.
+type tileFlight struct {
+	done    chan struct{}
+	entries []*sunlight.LogEntry
+	err     error
+}
+
+// tileFlights holds the data tile fetches in progress in the process, so that
+// concurrent requests for the same tile, whether from DataSources sharing a
+// Log or from Logs for the same log, wait for a single download rather than
+// each making their own.
+var tileFlights = struct {
+	mu      sync.Mutex
+	flights map[tileKey]*tileFlight
+}{
+	flights: make(map[tileKey]*tileFlight),
+}
+
+// coalesceTile returns the result of fetch for the tile identified by key,
+// sharing the entries with every concurrent call for the same key. Failures
+// aren't shared, as Logs for the same log may differ in their credentials,
+// headers, limiters, and mirrors, so one Log's failure says nothing about
+// another's: the waiting callers whose contexts are still live run fetch
+// again themselves instead.
+func coalesceTile(ctx context.Context, key tileKey, fetch func(context.Context) ([]*sunlight.LogEntry, error)) ([]*sunlight.LogEntry, error) {
+	for {
+		tileFlights.mu.Lock()
+		flight, ok := tileFlights.flights[key]
+		if !ok {
+			flight = &tileFlight{done: make(chan struct{})}
+			tileFlights.flights[key] = flight
+		}
+		tileFlights.mu.Unlock()
+
+		if !ok {
+			flight.entries, flight.err = fetch(ctx)
+
+			tileFlights.mu.Lock()
+			delete(tileFlights.flights, key)
+			tileFlights.mu.Unlock()
+
+			close(flight.done)
+			return flight.entries, flight.err
+		}
+
+		select {
+		case <-flight.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if flight.err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+
+		return flight.entries, nil
+	}
+}
+
+// tileKey returns the key identifying a data tile of the log. Logs are
+// identified by the origin of a checkpoint whose signature they've verified,
+// so that Logs with different URLs for the same log share fetches. Any other
+// origin could have been served by the wrong log, or a malicious one, so until
+// then Logs are identified by their URL.
+func (l *Log) tileKey(tileIndex int64) tileKey {
+	l.originMu.Lock()
+	origin := l.origin
+	l.originMu.Unlock()
+	if origin == "" {
+		origin = l.MetricsEndpoint.String()
+	}
+
+	return tileKey{
+		log:       origin,
+		tileIndex: tileIndex,
+		limit:     l.ResponseLimits.withDefaults().Tile,
+	}
+}
@@ -0,0 +1,89 @@
+package staticctapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight"
+)
+
+// TestCoalesceTileFailure checks that a failed fetch isn't shared with the
+// callers waiting on it, which fetch the tile themselves instead.
+func TestCoalesceTileFailure(t *testing.T) {
+	key := tileKey{log: "coalesce.example/failure", tileIndex: 7}
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	failed := make(chan error, 1)
+	go func() {
+		_, err := coalesceTile(context.Background(), key, func(context.Context) ([]*sunlight.LogEntry, error) {
+			close(started)
+			<-release
+			return nil, errors.New("401 Unauthorized")
+		})
+		failed <- err
+	}()
+	<-started
+
+	entries := []*sunlight.LogEntry{{LeafIndex: 7}}
+	fetched := make(chan struct{})
+	waited := make(chan error, 1)
+	go func() {
+		got, err := coalesceTile(context.Background(), key, func(context.Context) ([]*sunlight.LogEntry, error) {
+			close(fetched)
+			return entries, nil
+		})
+		if err == nil && (len(got) != 1 || got[0].LeafIndex != 7) {
+			err = errors.New("wrong entries")
+		}
+		waited <- err
+	}()
+
+	// Give the second caller time to start waiting on the first's fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-failed; err == nil {
+		t.Error("expected the first fetch to fail")
+	}
+	if err := <-waited; err != nil {
+		t.Errorf("waiting caller: %s", err)
+	}
+
+	select {
+	case <-fetched:
+	default:
+		t.Error("waiting caller didn't fetch the tile itself")
+	}
+}
+
+// TestTileKey checks that Logs only share tiles through their origin once
+// they've verified it, and never when their tile size limits differ.
+func TestTileKey(t *testing.T) {
+	first := newTestLog(t, 256)
+	second := newTestLog(t, 256)
+	a, b := first.newLog(t), second.newLog(t)
+
+	// Both serve checkpoints for example.com/test, but neither is verified
+	for _, log := range []*Log{a, b} {
+		_, err := log.GetCheckpoint(context.Background())
+		if err != nil {
+			t.Fatalf("fetching checkpoint: %s", err)
+		}
+	}
+	if a.tileKey(0) == b.tileKey(0) {
+		t.Error("Logs with unverified checkpoints share tiles")
+	}
+
+	a.origin, b.origin = "example.com/test", "example.com/test"
+	if a.tileKey(0) != b.tileKey(0) {
+		t.Error("Logs with the same verified origin don't share tiles")
+	}
+
+	b.ResponseLimits.Tile = 1 << 10
+	if a.tileKey(0) == b.tileKey(0) {
+		t.Error("Logs with different tile size limits share tiles")
+	}
+}
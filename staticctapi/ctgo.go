@@ -0,0 +1,134 @@
+package staticctapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"filippo.io/sunlight"
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// The helpers below convert between this package's types and those of
+// github.com/google/certificate-transparency-go, so tooling built on the
+// latter can consume entries found here, and vice versa.
+
+// CTMerkleTreeLeaf converts entry to a certificate-transparency-go
+// MerkleTreeLeaf, including the leaf index extension used by Static CT API
+// logs.
+func CTMerkleTreeLeaf(entry *sunlight.LogEntry) (*ct.MerkleTreeLeaf, error) {
+	extensions, err := sunlight.MarshalExtensions(sunlight.Extensions{LeafIndex: entry.LeafIndex})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling extensions: %w", err)
+	}
+
+	timestampedEntry := &ct.TimestampedEntry{
+		Timestamp:  uint64(entry.Timestamp),
+		Extensions: extensions,
+	}
+
+	if entry.IsPrecert {
+		timestampedEntry.EntryType = ct.PrecertLogEntryType
+		timestampedEntry.PrecertEntry = &ct.PreCert{
+			IssuerKeyHash:  entry.IssuerKeyHash,
+			TBSCertificate: entry.Certificate,
+		}
+	} else {
+		timestampedEntry.EntryType = ct.X509LogEntryType
+		timestampedEntry.X509Entry = &ct.ASN1Cert{Data: entry.Certificate}
+	}
+
+	return &ct.MerkleTreeLeaf{
+		Version:          ct.V1,
+		LeafType:         ct.TimestampedEntryLeafType,
+		TimestampedEntry: timestampedEntry,
+	}, nil
+}
+
+// CTRawLogEntry converts entry to a certificate-transparency-go RawLogEntry.
+// Static CT API entries only reference their issuers by fingerprint, so the
+// issuer chain must be supplied separately, such as from GetIssuer; it may be
+// nil if not needed. The result's ToLogEntry method parses it further.
+func CTRawLogEntry(entry *sunlight.LogEntry, chain [][]byte) (*ct.RawLogEntry, error) {
+	leaf, err := CTMerkleTreeLeaf(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := &ct.RawLogEntry{
+		Index: entry.LeafIndex,
+		Leaf:  *leaf,
+		Cert:  ct.ASN1Cert{Data: entry.Certificate},
+	}
+
+	if entry.IsPrecert {
+		raw.Cert = ct.ASN1Cert{Data: entry.PreCertificate}
+	}
+
+	for _, issuer := range chain {
+		raw.Chain = append(raw.Chain, ct.ASN1Cert{Data: issuer})
+	}
+
+	return raw, nil
+}
+
+// LogEntryFromCT converts a certificate-transparency-go RawLogEntry, such as
+// one fetched from an RFC 6962 log, to a sunlight LogEntry. The chain
+// fingerprints are computed from the raw entry's chain.
+func LogEntryFromCT(raw *ct.RawLogEntry) (*sunlight.LogEntry, error) {
+	timestampedEntry := raw.Leaf.TimestampedEntry
+	if raw.Leaf.LeafType != ct.TimestampedEntryLeafType || timestampedEntry == nil {
+		return nil, errors.New("leaf is not a timestamped entry")
+	}
+
+	entry := &sunlight.LogEntry{
+		LeafIndex: raw.Index,
+		Timestamp: int64(timestampedEntry.Timestamp),
+	}
+
+	switch timestampedEntry.EntryType {
+	case ct.X509LogEntryType:
+		if timestampedEntry.X509Entry == nil {
+			return nil, errors.New("x509 entry has no certificate")
+		}
+		entry.Certificate = timestampedEntry.X509Entry.Data
+
+	case ct.PrecertLogEntryType:
+		if timestampedEntry.PrecertEntry == nil {
+			return nil, errors.New("precert entry has no precertificate")
+		}
+		entry.IsPrecert = true
+		entry.IssuerKeyHash = timestampedEntry.PrecertEntry.IssuerKeyHash
+		entry.Certificate = timestampedEntry.PrecertEntry.TBSCertificate
+		entry.PreCertificate = raw.Cert.Data
+
+	default:
+		return nil, fmt.Errorf("unsupported entry type: %s", timestampedEntry.EntryType)
+	}
+
+	for _, issuer := range raw.Chain {
+		entry.ChainFingerprints = append(entry.ChainFingerprints, sha256.Sum256(issuer.Data))
+	}
+
+	return entry, nil
+}
+
+// SCTFromCT converts a certificate-transparency-go SCT to an SCT.
+func SCTFromCT(sct *ct.SignedCertificateTimestamp) SCT {
+	return SCT{
+		LogID:      sct.LogID.KeyID,
+		Timestamp:  int64(sct.Timestamp),
+		Extensions: sct.Extensions,
+	}
+}
+
+// GetEntryByCTSCT is like GetEntryBySCT, but accepts a
+// certificate-transparency-go SCT.
+func (l *Log) GetEntryByCTSCT(ctx context.Context, sct *ct.SignedCertificateTimestamp) (*sunlight.LogEntry, error) {
+	if sct.SCTVersion != ct.V1 {
+		return nil, fmt.Errorf("unsupported SCT version: %s", sct.SCTVersion)
+	}
+
+	return l.GetEntryBySCT(ctx, SCTFromCT(sct))
+}
@@ -0,0 +1,131 @@
+package staticctapi
+
+import (
+	"slices"
+	"sync"
+)
+
+// Cursor tracks which of a DataSource's tiles have been searched, so that an
+// interrupted search can be resumed where it left off rather than from the
+// start. Tiles are searched concurrently and finish out of order, so a Cursor
+// records the first tile that hasn't been searched; tiles after it that had
+// already been searched are searched again when resuming.
+//
+// Tiles that couldn't be fetched don't hold the Cursor back, or a single bad
+// tile would stop it for good. They're recorded in Failed instead, and a
+// search resumed from the Cursor retries them before carrying on.
+//
+// A Cursor is safe for concurrent use.
+type Cursor struct {
+	mu   sync.Mutex
+	next int64
+
+	// done holds the tiles after next that have finished. Every tile a
+	// search is given either is searched or fails, so it only holds as many
+	// as are being searched at once.
+	done   map[int64]bool
+	failed map[int64]bool
+}
+
+// NewCursor returns a Cursor resuming from the tile with the given index, and
+// retrying the failed tiles, as returned by Failed. A new search starts from a
+// zero Cursor, or NewCursor(0).
+func NewCursor(next int64, failed ...int64) *Cursor {
+	c := &Cursor{
+		next:   next,
+		done:   make(map[int64]bool),
+		failed: make(map[int64]bool),
+	}
+	for _, tileIndex := range failed {
+		c.failed[tileIndex] = true
+	}
+	return c
+}
+
+// Next returns the index of the first tile that hasn't been searched.
+func (c *Cursor) Next() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.next
+}
+
+// Failed returns the indexes of the tiles that couldn't be fetched, and
+// haven't been searched since, in order.
+func (c *Cursor) Failed() []int64 {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failed := make([]int64, 0, len(c.failed))
+	for tileIndex := range c.failed {
+		failed = append(failed, tileIndex)
+	}
+	slices.Sort(failed)
+	return failed
+}
+
+// resume returns the tile a search starting at start should begin from. A nil
+// Cursor begins from start.
+func (c *Cursor) resume(start int64) int64 {
+	if c == nil {
+		return start
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next < start {
+		c.next = start
+	}
+	return c.next
+}
+
+// complete records that a tile has been searched. A nil Cursor records
+// nothing.
+func (c *Cursor) complete(tileIndex int64) {
+	c.finish(tileIndex, false)
+}
+
+// fail records that a tile couldn't be fetched, so that it's retried when
+// resuming. A nil Cursor records nothing.
+func (c *Cursor) fail(tileIndex int64) {
+	c.finish(tileIndex, true)
+}
+
+// finish records that a tile has finished, and whether it failed, moving the
+// cursor past every finished tile.
+func (c *Cursor) finish(tileIndex int64, failed bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failed == nil {
+		c.failed = make(map[int64]bool)
+	}
+	if failed {
+		c.failed[tileIndex] = true
+	} else {
+		delete(c.failed, tileIndex)
+	}
+
+	if tileIndex < c.next {
+		return
+	}
+
+	if c.done == nil {
+		c.done = make(map[int64]bool)
+	}
+	c.done[tileIndex] = true
+
+	for c.done[c.next] {
+		delete(c.done, c.next)
+		c.next++
+	}
+}
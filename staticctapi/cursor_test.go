@@ -0,0 +1,79 @@
+package staticctapi
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := NewCursor(0)
+	if got := cursor.resume(10); got != 10 {
+		t.Errorf("new cursor resumes from %d, want the search's start, 10", got)
+	}
+
+	// Tiles finishing out of order only move the cursor once every tile
+	// before them has finished
+	for _, tile := range []int64{11, 13, 10} {
+		cursor.complete(tile)
+	}
+	if got := cursor.Next(); got != 12 {
+		t.Errorf("got next tile %d, want 12", got)
+	}
+
+	cursor.complete(12)
+	if got := cursor.Next(); got != 14 {
+		t.Errorf("got next tile %d, want 14", got)
+	}
+
+	// A resumed search skips the tiles already searched
+	resumed := NewCursor(cursor.Next())
+	if got := resumed.resume(10); got != 14 {
+		t.Errorf("resumed cursor resumes from %d, want 14", got)
+	}
+
+	var none *Cursor
+	none.complete(10)
+	if got := none.resume(10); got != 10 {
+		t.Errorf("nil cursor resumes from %d, want 10", got)
+	}
+}
+
+func TestCursorFailedTiles(t *testing.T) {
+	cursor := NewCursor(0)
+	cursor.resume(10)
+
+	// A failed tile doesn't hold the cursor back, as following a log would
+	// otherwise pile up every tile searched after it
+	cursor.fail(10)
+	for tile := int64(11); tile < 1000; tile++ {
+		cursor.complete(tile)
+	}
+	if got := cursor.Next(); got != 1000 {
+		t.Errorf("got next tile %d, want 1000", got)
+	}
+	if len(cursor.done) != 0 {
+		t.Errorf("cursor holds %d finished tiles, want none", len(cursor.done))
+	}
+	if got := cursor.Failed(); !slices.Equal(got, []int64{10}) {
+		t.Errorf("got failed tiles %v, want [10]", got)
+	}
+
+	// A resumed search retries it, and forgets it once it's searched
+	resumed := NewCursor(cursor.Next(), cursor.Failed()...)
+	if got := resumed.Failed(); !slices.Equal(got, []int64{10}) {
+		t.Errorf("resumed cursor has failed tiles %v, want [10]", got)
+	}
+	resumed.complete(10)
+	if got := resumed.Failed(); len(got) != 0 {
+		t.Errorf("retried tile still failed: %v", got)
+	}
+	if got := resumed.Next(); got != 1000 {
+		t.Errorf("retrying moved the cursor to %d, want 1000", got)
+	}
+
+	var none *Cursor
+	none.fail(10)
+	if got := none.Failed(); got != nil {
+		t.Errorf("nil cursor has failed tiles %v", got)
+	}
+}
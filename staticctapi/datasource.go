@@ -1,18 +1,29 @@
 package staticctapi
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"os"
 	"sync"
 	"time"
+
+	"filippo.io/sunlight"
+
+	"github.com/letsencrypt/x509search"
 )
 
 type DataSource struct {
 	// Log is the tiled log that should be searched.
 	Log *Log
 
+	// SourceName, if set, is the name of the data source, which identifies
+	// it in messages and in the metadata of the certificates it finds. If
+	// SourceName is empty, the data source is named after the log's URL. See
+	// Name.
+	SourceName string
+
 	// IncludePrecertificates causes precertificates to be included in the
 	// output of this data source.
 	IncludePrecertificates bool
@@ -24,22 +35,160 @@ type DataSource struct {
 	// StartTimeInclusive is the timestamp used to determine the starting data
 	// tile for the search. It must fall within the timespan that the log was
 	// accepting entries (not the submission window, which is the timespan
-	// describing the notAfter timestamps accepted by a temporally-sharded log).
+	// describing the notAfter timestamps accepted by a temporally-sharded log),
+	// unless Clamp is set.
 	StartTimeInclusive time.Time
 
 	// EndTimeInclusive is the timestamp used to determine the ending data tile
 	// for the search. It must fall within the timespan that the log was
 	// accepting entries (not the submission window, which is the timespan
-	// describing the notAfter timestamps accepted by a temporally-sharded log).
+	// describing the notAfter timestamps accepted by a temporally-sharded log),
+	// unless Clamp is set.
 	EndTimeInclusive time.Time
 
 	// MaxConnections is the number of concurrent requests that should be used
 	// to download data tiles from the log. If MaxConnections is less than 1,
-	// then the requests are made sequentially.
+	// then the requests are made sequentially. The log's HTTP transport is
+	// resized as needed to allow this many connections to the log's endpoint.
 	MaxConnections int
+
+	// Progress, if set, is updated as tiles are processed. A single Progress
+	// may be shared by multiple DataSources to track their combined progress.
+	Progress *Progress
+
+	// Clamp truncates the time window to the entries the log actually holds.
+	// Without it, a window starting before the log's first entry or ending
+	// after its last full tile is an error. With it, a window that doesn't
+	// overlap the log at all searches nothing, which suits searching a long
+	// period across many log shards.
+	Clamp bool
+
+	// WindowByNotBefore makes StartTimeInclusive and EndTimeInclusive bound
+	// the notBefore timestamps of the certificates found, rather than the
+	// times they were logged. Certificates aren't logged at the instant
+	// they're issued, and older certificates are sometimes submitted long
+	// afterwards, so the tiles searched are those spanning the window widened
+	// by NotBeforeSlack on either side, and entries whose notBefore falls
+	// outside of the window are dropped. Certificates logged later than
+	// NotBeforeSlack after issuance are missed.
+	WindowByNotBefore bool
+
+	// NotBeforeSlack widens the window searched when WindowByNotBefore is
+	// set. If NotBeforeSlack is zero, DefaultNotBeforeSlack is used.
+	NotBeforeSlack time.Duration
+
+	// FailFast aborts the search of the log with an error when a tile can't be
+	// fetched, once its retries are exhausted. By default, the failure is
+	// reported on stderr and the search moves on, leaving a gap in the
+	// results.
+	FailFast bool
+
+	// Deduplicator, if set, drops certificates that it has already seen. It is
+	// typically shared by the DataSources of logs with overlapping contents.
+	Deduplicator *Deduplicator
+
+	// Cursor, if set, records the tiles searched, and the search skips tiles
+	// that it records as having already been searched, after retrying those
+	// it records as failed. Persisting the Cursor's position and failed tiles
+	// allows an interrupted search to be resumed.
+	Cursor *Cursor
+
+	// Follow keeps the search running once it reaches the end of the log,
+	// searching new tiles as the log fills them until the context is
+	// cancelled. EndTimeInclusive is ignored, and if StartTimeInclusive is
+	// zero, only tiles filled after the search starts are searched. Only full
+	// tiles are searched, so entries are found once the tile holding them
+	// has been filled. Following can't be combined with WindowByNotBefore.
+	Follow bool
+
+	// PollInterval is how often a DataSource that is following its log checks
+	// for new tiles. If PollInterval is zero, DefaultPollInterval is used.
+	PollInterval time.Duration
+
+	// Prefetch is the number of downloaded tiles that may wait to be searched,
+	// in addition to those the connections are downloading. By default, each
+	// connection downloads a tile and then waits for the search to take its
+	// entries before downloading the next, so a slow filter leaves the
+	// connections idle and slow downloads leave the filter idle. Prefetching
+	// keeps both busy, at the cost of holding more tiles in memory.
+	Prefetch int
+
+	// PrefetchBytes, if positive, caps the bytes of certificates held in
+	// prefetched tiles, so that logs of unusually large certificates don't
+	// exhaust memory.
+	PrefetchBytes int64
+
+	// DERFilter, if set, is applied to the DER bytes of each certificate as
+	// tiles are parsed, and only those it returns true for are sent. Tiles
+	// are then parsed into reused EntrySlabs, and the DER bytes of the
+	// certificates sent are copied out of them, so that the entries and
+	// tile data are freed as soon as each tile has been searched. This
+	// greatly reduces garbage collection on scans of whole logs. It is
+	// typically the search's DERFilter. It is called concurrently from
+	// multiple goroutines, and must be safe for concurrent use.
+	DERFilter func([]byte) bool
+
+	// BoundsTimeout, if positive, bounds the time spent determining which
+	// tiles to search, after which the search of the log fails. On a slow or
+	// overloaded log, finding the tiles spanning the window can take many
+	// requests. See x509search.Budget for bounding the rest of the search.
+	BoundsTimeout time.Duration
 }
 
+// Name returns SourceName, or the log's URL if SourceName is empty.
+func (b DataSource) Name() string {
+	if b.SourceName != "" {
+		return b.SourceName
+	}
+	if b.Log == nil {
+		return ""
+	}
+	return b.Log.MetricsEndpoint.String()
+}
+
+// Source sends the DER bytes of the selected certificates and precertificates
+// from the log over certs.
 func (b DataSource) Source(ctx context.Context, certs chan<- []byte) error {
+	return b.run(ctx, func(_ *sunlight.LogEntry, certBytes []byte) {
+		select {
+		case certs <- certBytes:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// SourceEntries sends the selected certificates and precertificates from the
+// log over entries, along with metadata identifying the log entry each was
+// found in.
+func (b DataSource) SourceEntries(ctx context.Context, entries chan<- x509search.Entry) error {
+	if b.Log == nil {
+		return errors.New("nil log")
+	}
+
+	source := b.Log.MetricsEndpoint.String()
+	return b.run(ctx, func(entry *sunlight.LogEntry, certBytes []byte) {
+		select {
+		case entries <- x509search.Entry{
+			DER: certBytes,
+			Metadata: x509search.Metadata{
+				Source:         source,
+				Index:          entry.LeafIndex,
+				Timestamp:      time.UnixMilli(entry.Timestamp),
+				Precertificate: entry.IsPrecert,
+			},
+		}:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// run searches the log, calling emit with each selected log entry and the DER
+// bytes of its certificate or precertificate. emit is called concurrently from
+// multiple goroutines, and must return promptly once ctx is done.
+//
+// When ctx is done, the workers stop without starting any further requests,
+// and run returns ctx.Err().
+func (b DataSource) run(ctx context.Context, emit func(*sunlight.LogEntry, []byte)) error {
 	if b.Log == nil {
 		return errors.New("nil log")
 	}
@@ -53,49 +202,300 @@ func (b DataSource) Source(ctx context.Context, certs chan<- []byte) error {
 		concurrency = b.MaxConnections
 	}
 
-	startIndex, endIndex, err := b.Log.GetBoundingTilesFromTimes(ctx, b.StartTimeInclusive, b.EndTimeInclusive)
+	// Make sure the log's transport doesn't throttle the workers
+	b.Log.reserveConnections(concurrency)
+
+	boundsCtx := ctx
+	if b.BoundsTimeout > 0 {
+		var cancelBounds context.CancelFunc
+		boundsCtx, cancelBounds = context.WithTimeout(ctx, b.BoundsTimeout)
+		defer cancelBounds()
+	}
+
+	var bounds tileBounds
+	var err error
+	if b.Follow {
+		bounds, err = b.followBounds(boundsCtx)
+	} else {
+		startTime, endTime := b.StartTimeInclusive, b.EndTimeInclusive
+		if b.WindowByNotBefore {
+			slack := b.NotBeforeSlack
+			if slack == 0 {
+				slack = DefaultNotBeforeSlack
+			}
+			startTime, endTime = startTime.Add(-slack), endTime.Add(slack)
+		}
+
+		bounds, err = b.Log.boundingTiles(boundsCtx, startTime, endTime, b.Clamp)
+	}
 	if err != nil {
 		return fmt.Errorf("determining search bounds: %w", err)
 	}
 
-	fmt.Fprintf(os.Stderr, "determined search bounds, start tile: %d end tile: %d\n", startIndex, endIndex)
+	if bounds.empty {
+		fmt.Fprintf(os.Stderr, "%s: search window doesn't overlap log\n", b.Name())
+		return nil
+	}
+
+	startIndex, endIndex := bounds.startIndex, bounds.endIndex
+
+	// The boundary tiles are usually fetched while searching for them
+	prefetched := make(map[int64][]*sunlight.LogEntry)
+	if bounds.startEntries != nil {
+		prefetched[startIndex] = bounds.startEntries
+	}
+	if bounds.endEntries != nil {
+		prefetched[endIndex] = bounds.endEntries
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: determined search bounds, start tile: %d end tile: %d\n", b.Name(), startIndex, endIndex)
+
+	// Tiles that failed before are retried first, if they're still within
+	// the bounds
+	var retries []int64
+	for _, tileIndex := range b.Cursor.Failed() {
+		if tileIndex >= startIndex && tileIndex <= endIndex {
+			retries = append(retries, tileIndex)
+		}
+	}
+
+	startIndex = b.Cursor.resume(startIndex)
+	if startIndex > endIndex && len(retries) == 0 && !b.Follow {
+		fmt.Fprintf(os.Stderr, "%s: already searched log\n", b.Name())
+		return nil
+	}
+
+	if b.Progress != nil {
+		b.Progress.totalTiles.Add(int64(len(retries)))
+		if endIndex >= startIndex {
+			b.Progress.totalTiles.Add(endIndex - startIndex + 1)
+		}
+	}
+
+	// A tile failure cancels the remaining work when failing fast
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var failure error
+	var failOnce sync.Once
 
 	var wg sync.WaitGroup
 	workChan := make(chan int64, concurrency)
 
 	go func(ch chan<- int64) {
-		for currentIndex := startIndex; currentIndex <= endIndex; currentIndex++ {
-			ch <- currentIndex
+		defer close(ch)
+		for _, tileIndex := range retries {
+			select {
+			case ch <- tileIndex:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for currentIndex := startIndex; ; currentIndex++ {
+			if currentIndex > endIndex {
+				if !b.Follow {
+					return
+				}
+
+				// Wait for the log to grow, then search the new tiles
+				lastTile, err := b.waitForTiles(ctx, currentIndex)
+				if err != nil {
+					return
+				}
+				if b.Progress != nil {
+					b.Progress.totalTiles.Add(lastTile - currentIndex + 1)
+				}
+				endIndex = lastTile
+			}
+
+			select {
+			case ch <- currentIndex:
+			case <-ctx.Done():
+				return
+			}
 		}
-		close(ch)
 	}(workChan)
 
+	// search searches the entries of a fetched tile, reporting whether it got
+	// through all of them before ctx was done
+	search := func(tileIndex int64, entries []*sunlight.LogEntry) bool {
+		x509search.ReportBatch(ctx, x509search.Batch{Index: tileIndex, Size: len(entries)})
+
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return false
+			}
+
+			der := entry.Certificate
+			if entry.IsPrecert {
+				if !b.IncludePrecertificates {
+					continue
+				}
+				der = entry.PreCertificate
+			} else if !b.IncludeCertificates {
+				continue
+			}
+
+			if !b.inWindow(der) || !b.keep(der) || b.Deduplicator.seen(der) {
+				continue
+			}
+
+			// Entries parsed into a slab are about to be overwritten
+			if b.DERFilter != nil {
+				der = bytes.Clone(der)
+			}
+
+			emit(entry, der)
+		}
+
+		b.Cursor.complete(tileIndex)
+		b.completeTile()
+		return true
+	}
+
+	// When prefetching, the workers only download tiles, and hand them to a
+	// separate goroutine to be searched, so that downloads carry on while the
+	// search is busy filtering matches
+	var fetched chan fetchedTile
+	var budget *byteBudget
+	var searcher sync.WaitGroup
+	if b.Prefetch > 0 {
+		fetched = make(chan fetchedTile, b.Prefetch)
+		budget = newByteBudget(b.PrefetchBytes)
+
+		searcher.Add(1)
+		go func() {
+			defer searcher.Done()
+			for tile := range fetched {
+				// Once cancelled, keep draining so that no worker is blocked
+				if ctx.Err() == nil {
+					search(tile.index, tile.entries)
+				}
+				budget.release(tile.size)
+				releaseSlab(tile.slab)
+			}
+		}()
+	}
+
 	for worker := 0; worker < concurrency; worker++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for tileIndex := range workChan {
-				entries, err := b.Log.GetTileEntriesWithBackoff(ctx, tileIndex)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "getting entries for tile: %s\n", err.Error())
-					continue
+			for {
+				var tileIndex int64
+				select {
+				case index, ok := <-workChan:
+					if !ok {
+						return
+					}
+					tileIndex = index
+				case <-ctx.Done():
+					return
 				}
 
-				for _, entry := range entries {
-					if entry.IsPrecert {
-						if b.IncludePrecertificates {
-							certs <- entry.PreCertificate
-						}
+				// Filtering as tiles are parsed means parsing them into a
+				// slab, which is returned once the tile has been searched
+				var slab *EntrySlab
+
+				entries, ok := prefetched[tileIndex]
+				if !ok {
+					var err error
+					if b.DERFilter != nil {
+						slab = slabPool.Get().(*EntrySlab)
+						entries, err = b.Log.GetTileEntriesInto(ctx, tileIndex, slab)
+					} else {
+						entries, err = b.Log.GetTileEntriesWithBackoff(ctx, tileIndex)
+					}
+
+					if err != nil {
+						releaseSlab(slab)
+					}
+
+					// Failures caused by cancellation aren't worth reporting
+					if ctx.Err() != nil {
+						return
+					}
+
+					if err != nil && b.FailFast {
+						failOnce.Do(func() {
+							failure = fmt.Errorf("getting entries for tile %d: %w", tileIndex, err)
+							cancel()
+						})
+						return
+					}
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "%s: getting entries for tile: %s\n", b.Name(), err.Error())
+						b.Cursor.fail(tileIndex)
+						b.completeTile()
 						continue
 					}
-					if b.IncludeCertificates {
-						certs <- entry.Certificate
+				}
+
+				if fetched == nil {
+					ok := search(tileIndex, entries)
+					releaseSlab(slab)
+					if !ok {
+						return
 					}
+					continue
+				}
+
+				size := tileSize(entries)
+				if budget.acquire(ctx, size) != nil {
+					releaseSlab(slab)
+					return
+				}
+
+				select {
+				case fetched <- fetchedTile{index: tileIndex, entries: entries, size: size, slab: slab}:
+				case <-ctx.Done():
+					budget.release(size)
+					releaseSlab(slab)
+					return
 				}
 			}
 		}()
 	}
 
 	wg.Wait()
-	return nil
+
+	if fetched != nil {
+		close(fetched)
+		searcher.Wait()
+	}
+
+	if failure != nil {
+		return failure
+	}
+	return parent.Err()
+}
+
+// inWindow reports whether the certificate should be sent when windowing by
+// notBefore. Certificates whose notBefore can't be read are sent, so that the
+// search reports them as it would any other malformed certificate.
+func (b DataSource) inWindow(der []byte) bool {
+	if !b.WindowByNotBefore {
+		return true
+	}
+
+	notBefore, err := readNotBefore(der)
+	if err != nil {
+		return true
+	}
+
+	return !notBefore.Before(b.StartTimeInclusive) && !notBefore.After(b.EndTimeInclusive)
+}
+
+// keep reports whether the certificate passes DERFilter, if it's set.
+func (b DataSource) keep(der []byte) bool {
+	return b.DERFilter == nil || b.DERFilter(der)
+}
+
+// completeTile records that a tile has been processed.
+func (b DataSource) completeTile() {
+	if b.Progress != nil {
+		b.Progress.completedTiles.Add(1)
+	}
 }
@@ -0,0 +1,60 @@
+package staticctapi
+
+import (
+	"sync"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// Deduplicator drops certificates already sent by any DataSource that shares
+// it. Logs accept submissions from the same CAs, so searching several logs
+// over the same period finds most certificates several times; deduplicating
+// at the source keeps the copies from being parsed and filtered by the search
+// at all, rather than only dropping duplicate matches via the search's
+// MatchCacher.
+//
+// Only the first copy found is sent, so the metadata of the others is lost.
+//
+// A Deduplicator is safe for concurrent use.
+type Deduplicator struct {
+	mu     sync.Mutex
+	cacher x509search.RawCacher
+
+	// concurrent is true if cacher is safe for concurrent use, so mu needn't
+	// be held
+	concurrent bool
+}
+
+// NewDeduplicator returns a Deduplicator that records the certificates it has
+// seen in cacher. If cacher is nil, a ShardedCacher is used. A BloomCacher
+// bounds memory use on long scans, at the cost of occasionally dropping a
+// certificate that wasn't a duplicate.
+func NewDeduplicator(cacher x509search.RawCacher) *Deduplicator {
+	if cacher == nil {
+		cacher = x509search.NewShardedCacher(0)
+	}
+
+	_, concurrent := cacher.(*x509search.ShardedCacher)
+
+	return &Deduplicator{
+		cacher:     cacher,
+		concurrent: concurrent,
+	}
+}
+
+// seen records der and reports whether it had already been recorded. A nil
+// Deduplicator has seen nothing.
+func (d *Deduplicator) seen(der []byte) bool {
+	if d == nil {
+		return false
+	}
+
+	if d.concurrent {
+		return d.cacher.CacheRaw(der)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cacher.CacheRaw(der)
+}
@@ -0,0 +1,141 @@
+package staticctapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding is sent with every request made to a log. Encodings are listed
+// in order of preference; zstd and brotli both compress data tiles noticeably
+// better than gzip.
+const acceptEncoding = "zstd, br, gzip, identity"
+
+// maxPooledBufferSize is the capacity beyond which a read buffer is left for
+// the garbage collector instead of being returned to bufferPool, so that one
+// unusually large response doesn't pin its memory indefinitely.
+const maxPooledBufferSize = 16 << 20
+
+// bufferPool holds the buffers used to read response bodies. Uncompressed data
+// tiles run to megabytes, and reading each into a freshly grown slice
+// allocates several times that while the slice is resized.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// gzipReaderPool holds gzip readers for reuse. A gzip.Reader allocates its
+// decompression state, tens of kilobytes, when it's created, and a search
+// decompresses dozens of tiles a second.
+var gzipReaderPool sync.Pool
+
+// getGzipReader returns a gzip reader for r, reusing one from gzipReaderPool
+// if there is one. The reader should be returned with putGzipReader.
+func getGzipReader(r io.Reader) (*gzip.Reader, error) {
+	reader, ok := gzipReaderPool.Get().(*gzip.Reader)
+	if !ok {
+		return gzip.NewReader(r)
+	}
+
+	err := reader.Reset(r)
+	if err != nil {
+		gzipReaderPool.Put(reader)
+		return nil, err
+	}
+	return reader, nil
+}
+
+// putGzipReader closes reader and returns it to gzipReaderPool.
+func putGzipReader(reader *gzip.Reader) {
+	reader.Close()
+	gzipReaderPool.Put(reader)
+}
+
+// readAll reads r to completion using a pooled buffer, and returns a copy of
+// the data sized exactly to fit. The copy is needed because entries parsed
+// from a tile refer to the tile data, and are handed off to the search. It
+// fails without reading further once more than limit bytes have been read.
+func readAll(r io.Reader, limit int64) ([]byte, error) {
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+
+	defer func() {
+		if buffer.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(buffer)
+		}
+	}()
+
+	_, err := buffer.ReadFrom(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(buffer.Len()) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", errResponseTooLarge, limit)
+	}
+
+	data := make([]byte, buffer.Len())
+	copy(data, buffer.Bytes())
+	return data, nil
+}
+
+// readResponseBody reads the full body of response, decoding it according to
+// its Content-Encoding header. The decoded body may be at most limit bytes.
+func readResponseBody(response *http.Response, limit int64) ([]byte, error) {
+	encoding := strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding")))
+
+	switch {
+	case encoding == "" || encoding == "identity":
+		data, err := readAll(response.Body, limit)
+		if err != nil {
+			return nil, fmt.Errorf("reading response body: %w", err)
+		}
+		return data, nil
+
+	case strings.HasPrefix(encoding, "gzip"):
+		reader, err := getGzipReader(response.Body)
+		if err != nil {
+			return nil, fmt.Errorf("creating gzip reader: %w", err)
+		}
+
+		defer putGzipReader(reader)
+
+		data, err := readAll(reader, limit)
+		if err != nil {
+			return nil, fmt.Errorf("reading data from gzipped response body: %w", err)
+		}
+		return data, nil
+
+	case encoding == "zstd":
+		decoder, err := zstd.NewReader(response.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("creating zstd reader: %w", err)
+		}
+
+		defer decoder.Close()
+
+		data, err := readAll(decoder, limit)
+		if err != nil {
+			return nil, fmt.Errorf("reading data from zstd response body: %w", err)
+		}
+		return data, nil
+
+	case encoding == "br":
+		data, err := readAll(brotli.NewReader(response.Body), limit)
+		if err != nil {
+			return nil, fmt.Errorf("reading data from brotli response body: %w", err)
+		}
+		return data, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
@@ -0,0 +1,214 @@
+package staticctapi
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"filippo.io/sunlight"
+	"golang.org/x/mod/sumdb/tlog"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// maxCachedExportTiles is the number of source data tiles TileWriter keeps in
+// memory. Matches from concurrently-fetched tiles arrive interleaved, so a few
+// tiles are kept rather than only the most recent one.
+const maxCachedExportTiles = 16
+
+// TileWriter is an x509search.Sink that writes matches into a directory laid
+// out as a Static CT API log, so a filtered subset of one or more logs can be
+// served locally by a static file server and searched again offline.
+//
+// Matches must come from a DataSource searching one of the logs TileWriter was
+// created with; each match's log entry is fetched again from its source log
+// (matches don't carry the full entry), along with its issuer chain. Entries
+// are renumbered sequentially in the order they're written, keeping their
+// original timestamps, so writing matches in timestamp order (see
+// sink.Ordered) keeps the output searchable by time.
+//
+// The directory has no checkpoint, since TileWriter can't sign one on the
+// log's behalf. The final partial data tile is written when TileWriter is
+// closed.
+type TileWriter struct {
+	ctx  context.Context
+	dir  string
+	logs map[string]*Log
+
+	tiles     map[exportTileKey][]*sunlight.LogEntry
+	tileOrder []exportTileKey
+
+	issuers map[[32]byte]bool
+
+	tile     []byte
+	treeSize int64
+}
+
+type exportTileKey struct {
+	source    string
+	tileIndex int64
+}
+
+// NewTileWriter returns a TileWriter writing to dir, which is created if
+// needed. ctx is used for requests made to the source logs.
+func NewTileWriter(ctx context.Context, dir string, logs ...*Log) (*TileWriter, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating tile directory: %w", err)
+	}
+
+	w := &TileWriter{
+		ctx:     ctx,
+		dir:     dir,
+		logs:    make(map[string]*Log),
+		tiles:   make(map[exportTileKey][]*sunlight.LogEntry),
+		issuers: make(map[[32]byte]bool),
+	}
+
+	for _, log := range logs {
+		w.logs[log.MetricsEndpoint.String()] = log
+	}
+
+	return w, nil
+}
+
+// TreeSize returns the number of entries written so far.
+func (w *TileWriter) TreeSize() int64 {
+	return w.treeSize
+}
+
+// Write appends the log entry cert was found in to the output, along with any
+// issuers not already written.
+func (w *TileWriter) Write(_ *x509.Certificate, metadata x509search.Metadata) error {
+	log, ok := w.logs[metadata.Source]
+	if !ok {
+		return fmt.Errorf("match from unknown source %q", metadata.Source)
+	}
+
+	if metadata.Index < 0 {
+		return errors.New("match has no leaf index")
+	}
+
+	entry, err := w.entry(log, metadata.Source, metadata.Index)
+	if err != nil {
+		return err
+	}
+
+	for _, fingerprint := range entry.ChainFingerprints {
+		err := w.writeIssuer(log, fingerprint)
+		if err != nil {
+			return err
+		}
+	}
+
+	exported := *entry
+	exported.LeafIndex = w.treeSize
+	w.tile = sunlight.AppendTileLeaf(w.tile, &exported)
+	w.treeSize++
+
+	if w.treeSize%256 == 0 {
+		err := w.writeTile()
+		if err != nil {
+			return err
+		}
+		w.tile = nil
+	}
+
+	return nil
+}
+
+// Close writes the final partial data tile, if there is one.
+func (w *TileWriter) Close() error {
+	if w.treeSize%256 == 0 {
+		return nil
+	}
+
+	return w.writeTile()
+}
+
+// entry returns the entry at leafIndex in log, fetching its data tile if it
+// isn't cached.
+func (w *TileWriter) entry(log *Log, source string, leafIndex int64) (*sunlight.LogEntry, error) {
+	key := exportTileKey{source: source, tileIndex: leafIndex / 256}
+
+	entries, ok := w.tiles[key]
+	if !ok {
+		var err error
+		entries, err = log.GetTileEntriesWithBackoff(w.ctx, key.tileIndex)
+		if err != nil {
+			return nil, fmt.Errorf("getting entries for tile: %w", err)
+		}
+
+		if len(w.tileOrder) == maxCachedExportTiles {
+			delete(w.tiles, w.tileOrder[0])
+			w.tileOrder = w.tileOrder[1:]
+		}
+		w.tiles[key] = entries
+		w.tileOrder = append(w.tileOrder, key)
+	}
+
+	entry := entries[leafIndex%256]
+	if entry.LeafIndex != leafIndex {
+		return nil, fmt.Errorf("tile entry has leaf index %d, expected %d", entry.LeafIndex, leafIndex)
+	}
+
+	return entry, nil
+}
+
+// writeIssuer fetches the issuer with the given fingerprint from log and
+// writes it to the output, unless it has already been written.
+func (w *TileWriter) writeIssuer(log *Log, fingerprint [32]byte) error {
+	if w.issuers[fingerprint] {
+		return nil
+	}
+
+	issuer, err := log.GetIssuer(w.ctx, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	err = w.writeFile(fmt.Sprintf("issuer/%x", fingerprint), issuer)
+	if err != nil {
+		return err
+	}
+
+	w.issuers[fingerprint] = true
+	return nil
+}
+
+// writeTile writes the current data tile, which is partial if it holds fewer
+// than 256 entries.
+func (w *TileWriter) writeTile() error {
+	width := w.treeSize % 256
+	if width == 0 {
+		width = 256
+	}
+
+	tile := tlog.Tile{
+		H: sunlight.TileHeight,
+		L: -1,
+		N: (w.treeSize - 1) / 256,
+		W: int(width),
+	}
+
+	return w.writeFile(sunlight.TilePath(tile), w.tile)
+}
+
+func (w *TileWriter) writeFile(name string, data []byte) error {
+	path := filepath.Join(w.dir, filepath.FromSlash(name))
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("creating directory for %s: %w", name, err)
+	}
+
+	err = os.WriteFile(path, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+
+	return nil
+}
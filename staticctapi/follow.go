@@ -0,0 +1,128 @@
+package staticctapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultPollInterval is how often a following DataSource checks its log for
+// new tiles when DataSource.PollInterval is zero. Logs typically publish a new
+// checkpoint every second, and a busy log fills a tile every few seconds, so
+// polling every minute keeps up without making needless requests.
+const DefaultPollInterval = time.Minute
+
+// fullTiles returns the number of full data tiles currently available in the
+// log.
+func (l *Log) fullTiles(ctx context.Context) (int64, error) {
+	checkpoint, err := l.GetCheckpoint(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	return checkpoint.TreeSize / 256, nil
+}
+
+// followBounds returns the tiles a following DataSource searches before it
+// waits for the log to grow. The search starts from the tile containing
+// StartTimeInclusive, or from the next tile to be filled if StartTimeInclusive
+// is zero or after the log's last entry. endIndex is before startIndex if
+// there are no tiles to search yet.
+func (b DataSource) followBounds(ctx context.Context) (tileBounds, error) {
+	if b.WindowByNotBefore {
+		return tileBounds{}, errors.New("following a log can't be combined with windowing by notBefore")
+	}
+
+	tiles, err := b.Log.fullTiles(ctx)
+	if err != nil {
+		return tileBounds{}, fmt.Errorf("getting number of full tiles: %w", err)
+	}
+
+	if b.StartTimeInclusive.IsZero() || tiles == 0 {
+		return tileBounds{startIndex: tiles, endIndex: tiles - 1}, nil
+	}
+
+	bounds := tileBounds{endIndex: tiles - 1}
+
+	var gap gapError
+	bounds.startIndex, bounds.startEntries, err = b.Log.tileFromTime(ctx, b.StartTimeInclusive, 0, tiles-1)
+	switch {
+	case errors.As(err, &gap):
+		bounds.startIndex = gap.before + 1
+	case errors.Is(err, errTimeBeforeTiles):
+		bounds.startIndex = 0
+	case errors.Is(err, errTimeAfterTiles):
+		bounds.startIndex = tiles
+	case err != nil:
+		return tileBounds{}, fmt.Errorf("getting index of start tile: %w", err)
+	}
+
+	return bounds, nil
+}
+
+// WatchCheckpoint polls the log's checkpoint every interval until ctx is done,
+// calling fn with the first checkpoint fetched and then with each checkpoint
+// that grows the tree. Checkpoints that don't grow the tree are skipped.
+// Failures to fetch the checkpoint are reported on stderr and retried at the
+// next poll. If fn returns an error, watching stops and WatchCheckpoint
+// returns it; otherwise, it returns ctx.Err() once ctx is done. If interval
+// isn't positive, DefaultPollInterval is used.
+func (l *Log) WatchCheckpoint(ctx context.Context, interval time.Duration, fn func(Checkpoint) error) error {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	treeSize := int64(-1)
+	for {
+		checkpoint, err := l.GetCheckpoint(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: polling checkpoint: %s\n", l.MetricsEndpoint, err.Error())
+		} else if checkpoint.TreeSize > treeSize {
+			treeSize = checkpoint.TreeSize
+
+			err = fn(checkpoint)
+			if err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// errTilesFilled stops the WatchCheckpoint in waitForTiles.
+var errTilesFilled = errors.New("tiles filled")
+
+// waitForTiles polls the log every PollInterval until the tile with index next
+// has been filled, and returns the index of the last full tile. It returns
+// ctx.Err() if ctx is done first.
+func (b DataSource) waitForTiles(ctx context.Context, next int64) (int64, error) {
+	var lastTile int64
+	err := b.Log.WatchCheckpoint(ctx, b.PollInterval, func(checkpoint Checkpoint) error {
+		tiles := checkpoint.TreeSize / 256
+		if tiles <= next {
+			return nil
+		}
+
+		lastTile = tiles - 1
+		return errTilesFilled
+	})
+	if !errors.Is(err, errTilesFilled) {
+		return -1, err
+	}
+
+	return lastTile, nil
+}
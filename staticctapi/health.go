@@ -0,0 +1,145 @@
+package staticctapi
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// DefaultMaxCheckpointAge is the checkpoint age beyond which CheckHealth
+// reports a log as stale when Log.MaxCheckpointAge is unset. It matches the
+// 24 hour maximum merge delay required by CT log policies.
+const DefaultMaxCheckpointAge = 24 * time.Hour
+
+// Health describes the state of a log as observed by CheckHealth.
+type Health struct {
+	// CheckedAt is the time the check was performed.
+	CheckedAt time.Time
+
+	// Reachable is true if a checkpoint was successfully fetched from the log.
+	Reachable bool
+
+	// Err describes why the check could not be completed, if it couldn't. The
+	// remaining fields are only meaningful if Err is nil.
+	Err error
+
+	// TreeSize is the tree size of the fetched checkpoint.
+	TreeSize int64
+
+	// CheckpointTime is the timestamp from the checkpoint's RFC 6962 signature.
+	// The signature is not verified.
+	CheckpointTime time.Time
+
+	// CheckpointAge is the difference between CheckedAt and CheckpointTime.
+	CheckpointAge time.Duration
+
+	// Stale is true if CheckpointAge exceeds the log's maximum checkpoint age.
+	Stale bool
+
+	// TreeGrowth is the number of entries added to the log since the previous
+	// successful call to CheckHealth on the same Log, or -1 if there was no
+	// previous call.
+	TreeGrowth int64
+}
+
+// CheckHealth fetches the log's checkpoint and reports on its freshness and on
+// the log's growth since the previous check. It is intended for monitoring
+// deployments, which can use it to alert on stalled logs before searches begin
+// silently operating on stale bounds.
+//
+// An unreachable log or malformed checkpoint is reported through Health.Err
+// rather than as a returned error.
+func (l *Log) CheckHealth(ctx context.Context) Health {
+	health := Health{
+		CheckedAt:  time.Now(),
+		TreeGrowth: -1,
+	}
+
+	checkpointData, err := l.get(ctx, "/checkpoint", l.ResponseLimits.withDefaults().Checkpoint)
+	if err != nil {
+		health.Err = fmt.Errorf("fetching checkpoint: %w", err)
+		return health
+	}
+
+	health.Reachable = true
+
+	checkpoint, err := ParseCheckpoint(checkpointData)
+	if err != nil {
+		health.Err = fmt.Errorf("parsing checkpoint: %w", err)
+		return health
+	}
+
+	err = l.checkOrigin(checkpoint)
+	if err != nil {
+		health.Err = err
+		return health
+	}
+
+	treeSize := checkpoint.TreeSize
+
+	checkpointTime, err := checkpointTimestamp(checkpoint.Note)
+	if err != nil {
+		health.Err = fmt.Errorf("reading checkpoint timestamp: %w", err)
+		return health
+	}
+
+	maxAge := l.MaxCheckpointAge
+	if maxAge <= 0 {
+		maxAge = DefaultMaxCheckpointAge
+	}
+
+	health.TreeSize = treeSize
+	health.CheckpointTime = checkpointTime
+	health.CheckpointAge = health.CheckedAt.Sub(checkpointTime)
+	health.Stale = health.CheckpointAge > maxAge
+
+	l.healthMu.Lock()
+	defer l.healthMu.Unlock()
+
+	if l.hasHealthySample {
+		health.TreeGrowth = treeSize - l.lastHealthyTreeSize
+	}
+	l.hasHealthySample = true
+	l.lastHealthyTreeSize = treeSize
+
+	return health
+}
+
+// checkpointTimestamp returns the timestamp of the first RFC 6962 signature
+// found on the signed checkpoint note. No signatures are verified.
+func checkpointTimestamp(signedNote []byte) (time.Time, error) {
+	var unverified *note.UnverifiedNoteError
+
+	_, err := note.Open(signedNote, note.VerifierList())
+	if !errors.As(err, &unverified) {
+		return time.Time{}, fmt.Errorf("malformed checkpoint note: %w", err)
+	}
+
+	for _, sig := range unverified.Note.UnverifiedSigs {
+		sigBytes, err := base64.StdEncoding.DecodeString(sig.Base64)
+		if err != nil {
+			continue
+		}
+
+		// RFC6962NoteSignature, prefixed with the note key hash
+		var timestamp uint64
+		var hashAlg, sigAlg uint8
+		var signature cryptobyte.String
+		s := cryptobyte.String(sigBytes)
+		if !s.Skip(4) || !s.ReadUint64(&timestamp) || timestamp > math.MaxInt64 ||
+			!s.ReadUint8(&hashAlg) || !s.ReadUint8(&sigAlg) ||
+			!s.ReadUint16LengthPrefixed(&signature) || !s.Empty() {
+			continue
+		}
+
+		return time.UnixMilli(int64(timestamp)), nil
+	}
+
+	return time.Time{}, errors.New("no RFC 6962 signature on checkpoint")
+}
@@ -0,0 +1,122 @@
+package staticctapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// signedCheckpoint returns a checkpoint note for a tree of treeSize entries,
+// with an RFC 6962 signature timestamped at signed. The signature itself is
+// garbage, as CheckHealth doesn't verify it.
+func signedCheckpoint(treeSize int64, signed time.Time) string {
+	sig := make([]byte, 4, 4+8+2+2+4)
+	sig = binary.BigEndian.AppendUint64(sig, uint64(signed.UnixMilli()))
+	sig = append(sig, 4, 3, 0, 4, 1, 2, 3, 4)
+
+	return fmt.Sprintf("example.com/test\n%d\n%s\n\n— example.com/test %s\n",
+		treeSize, base64.StdEncoding.EncodeToString(make([]byte, 32)), base64.StdEncoding.EncodeToString(sig))
+}
+
+func TestCheckHealth(t *testing.T) {
+	var treeSize atomic.Int64
+	var signed atomic.Int64
+	treeSize.Store(1000)
+	signed.Store(time.Now().UnixMilli())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/checkpoint" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, signedCheckpoint(treeSize.Load(), time.UnixMilli(signed.Load())))
+	}))
+	defer server.Close()
+
+	log, err := NewLog(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	health := log.CheckHealth(context.Background())
+	if health.Err != nil {
+		t.Fatalf("checking health: %s", health.Err)
+	}
+	if !health.Reachable || health.TreeSize != 1000 || health.TreeGrowth != -1 {
+		t.Errorf("first check: got %+v, want a reachable log of 1000 entries with no growth", health)
+	}
+	if health.Stale {
+		t.Errorf("fresh checkpoint reported stale, aged %s", health.CheckpointAge)
+	}
+
+	// A log that has grown but stopped signing new checkpoints is stale
+	treeSize.Store(1300)
+	signed.Store(time.Now().Add(-2 * DefaultMaxCheckpointAge).UnixMilli())
+
+	health = log.CheckHealth(context.Background())
+	if health.Err != nil {
+		t.Fatalf("checking health: %s", health.Err)
+	}
+	if health.TreeGrowth != 300 {
+		t.Errorf("second check: got growth %d, want 300", health.TreeGrowth)
+	}
+	if !health.Stale {
+		t.Errorf("checkpoint aged %s not reported stale", health.CheckpointAge)
+	}
+
+	server.Close()
+	health = log.CheckHealth(context.Background())
+	if health.Err == nil || health.Reachable {
+		t.Errorf("unreachable log reported reachable: %+v", health)
+	}
+}
+
+// TestCheckHealthZeroLog checks that a Log not created with NewLog reports
+// growth only from its second check.
+func TestCheckHealthZeroLog(t *testing.T) {
+	var treeSize atomic.Int64
+	treeSize.Store(1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/checkpoint" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, signedCheckpoint(treeSize.Load(), time.Now()))
+	}))
+	defer server.Close()
+
+	endpoint, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &Log{MetricsEndpoint: endpoint}
+
+	health := log.CheckHealth(context.Background())
+	if health.Err != nil {
+		t.Fatalf("checking health: %s", health.Err)
+	}
+	if health.TreeGrowth != -1 {
+		t.Errorf("first check: got growth %d, want -1", health.TreeGrowth)
+	}
+
+	treeSize.Store(1300)
+
+	health = log.CheckHealth(context.Background())
+	if health.Err != nil {
+		t.Fatalf("checking health: %s", health.Err)
+	}
+	if health.TreeGrowth != 300 {
+		t.Errorf("second check: got growth %d, want 300", health.TreeGrowth)
+	}
+	if health.Stale {
+		t.Errorf("fresh checkpoint reported stale, aged %s", health.CheckpointAge)
+	}
+}
@@ -0,0 +1,131 @@
+package staticctapi
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+
+	"filippo.io/sunlight"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// GetVerifiedTree fetches the log's current checkpoint, verifies its RFC 6962
+// signature using key, and returns the tree it describes. From then on, the
+// Log shares data tile fetches with other Logs for the same log.
+func (l *Log) GetVerifiedTree(ctx context.Context, key crypto.PublicKey) (tlog.Tree, error) {
+	checkpoint, err := l.GetCheckpoint(ctx)
+	if err != nil {
+		return tlog.Tree{}, err
+	}
+
+	// The note verifier is named after the origin line of the checkpoint
+	verifier, err := sunlight.NewRFC6962Verifier(checkpoint.Origin, key)
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("creating checkpoint verifier: %w", err)
+	}
+
+	// The checkpoint was parsed from the note's text, so only the signature
+	// needs checking
+	_, err = note.Open(checkpoint.Note, note.VerifierList(verifier))
+	if err != nil {
+		return tlog.Tree{}, fmt.Errorf("verifying checkpoint signature: %w", err)
+	}
+
+	l.originMu.Lock()
+	l.origin = checkpoint.Origin
+	l.originMu.Unlock()
+
+	return checkpoint.Tree(), nil
+}
+
+// GetEntry fetches the log entry at the given leaf index. The entry must be
+// part of a full data tile.
+func (l *Log) GetEntry(ctx context.Context, leafIndex int64) (*sunlight.LogEntry, error) {
+	if leafIndex < 0 {
+		return nil, errors.New("negative leaf index")
+	}
+
+	entries, err := l.GetTileEntriesWithBackoff(ctx, leafIndex/256)
+	if err != nil {
+		return nil, fmt.Errorf("getting entries for tile: %w", err)
+	}
+
+	entry := entries[leafIndex%256]
+	if entry.LeafIndex != leafIndex {
+		return nil, fmt.Errorf("tile entry has leaf index %d, expected %d", entry.LeafIndex, leafIndex)
+	}
+
+	return entry, nil
+}
+
+// GetEntryBySCT fetches the log entry that sct was issued for, using the leaf
+// index carried in the SCT's extensions.
+func (l *Log) GetEntryBySCT(ctx context.Context, sct SCT) (*sunlight.LogEntry, error) {
+	leafIndex, err := sct.LeafIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := l.GetEntry(ctx, leafIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Timestamp != sct.Timestamp {
+		return nil, fmt.Errorf("entry timestamp %d doesn't match SCT timestamp %d", entry.Timestamp, sct.Timestamp)
+	}
+
+	return entry, nil
+}
+
+// ProveInclusion fetches the hash tiles needed to build an inclusion proof for
+// the entry at leafIndex, and checks that the proof ties leafHash to the root
+// hash of tree. The tree should come from a verified checkpoint, such as one
+// returned by GetVerifiedTree.
+func (l *Log) ProveInclusion(ctx context.Context, tree tlog.Tree, leafIndex int64, leafHash tlog.Hash) error {
+	if leafIndex < 0 || leafIndex >= tree.N {
+		return fmt.Errorf("leaf index %d outside of tree of size %d", leafIndex, tree.N)
+	}
+
+	hashReader := tlog.TileHashReader(tree, tileReader{ctx: ctx, log: l})
+
+	proof, err := tlog.ProveRecord(tree.N, leafIndex, hashReader)
+	if err != nil {
+		return fmt.Errorf("building inclusion proof: %w", err)
+	}
+
+	err = tlog.CheckRecord(proof, tree.N, tree.Hash, leafIndex, leafHash)
+	if err != nil {
+		return fmt.Errorf("checking inclusion proof: %w", err)
+	}
+
+	return nil
+}
+
+// tileReader adapts a Log to tlog.TileReader, fetching Merkle tree tiles over
+// HTTP as they're needed.
+type tileReader struct {
+	ctx context.Context
+	log *Log
+}
+
+func (r tileReader) Height() int {
+	return sunlight.TileHeight
+}
+
+func (r tileReader) ReadTiles(tiles []tlog.Tile) ([][]byte, error) {
+	data := make([][]byte, len(tiles))
+	for i, tile := range tiles {
+		// A hash tile holds exactly W hashes
+		tileData, err := r.log.get(r.ctx, sunlight.TilePath(tile), int64(tile.W)*tlog.HashSize)
+		if err != nil {
+			return nil, fmt.Errorf("fetching hash tile: %w", err)
+		}
+		data[i] = tileData
+	}
+	return data, nil
+}
+
+func (r tileReader) SaveTiles(_ []tlog.Tile, _ [][]byte) {}
@@ -0,0 +1,53 @@
+package staticctapi
+
+import (
+	"context"
+)
+
+// Limiter caps the number of requests in flight across every Log that
+// references it. Log shards are frequently served from the same origin, so
+// when several DataSources search shards on one host, their MaxConnections
+// settings add up; sharing a Limiter between those Logs bounds the total load
+// placed on the origin instead.
+//
+// A Limiter is safe for concurrent use.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter returns a Limiter that allows at most maxRequests concurrent
+// requests. If maxRequests is less than 1, a single request is allowed at a
+// time.
+func NewLimiter(maxRequests int) *Limiter {
+	if maxRequests < 1 {
+		maxRequests = 1
+	}
+
+	return &Limiter{
+		slots: make(chan struct{}, maxRequests),
+	}
+}
+
+// acquire blocks until a request slot is available or ctx is cancelled. A nil
+// Limiter never blocks.
+func (l *Limiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a request slot obtained by acquire.
+func (l *Limiter) release() {
+	if l == nil {
+		return
+	}
+
+	<-l.slots
+}
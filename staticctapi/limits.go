@@ -0,0 +1,50 @@
+package staticctapi
+
+import (
+	"errors"
+)
+
+// DefaultResponseLimits are the response size limits used for any field of
+// Log.ResponseLimits that is zero. Checkpoints are a few hundred bytes and
+// issuers a few kilobytes, while uncompressed data tiles of precertificates
+// with long SAN lists run to several megabytes.
+var DefaultResponseLimits = ResponseLimits{
+	Checkpoint: 1 << 20,
+	Tile:       64 << 20,
+	Issuer:     1 << 20,
+}
+
+// ResponseLimits cap the size of the responses read from a log, so that a
+// misbehaving or malicious endpoint can't exhaust memory with an enormous
+// body. Limits apply to the decoded body, so they also catch compressed
+// responses that expand to an enormous size.
+type ResponseLimits struct {
+	// Checkpoint is the maximum size of a checkpoint, in bytes.
+	Checkpoint int64
+
+	// Tile is the maximum size of a data tile, in bytes.
+	Tile int64
+
+	// Issuer is the maximum size of an issuer certificate, in bytes.
+	Issuer int64
+}
+
+// withDefaults returns the limits with each unset field replaced by its
+// default.
+func (r ResponseLimits) withDefaults() ResponseLimits {
+	if r.Checkpoint <= 0 {
+		r.Checkpoint = DefaultResponseLimits.Checkpoint
+	}
+	if r.Tile <= 0 {
+		r.Tile = DefaultResponseLimits.Tile
+	}
+	if r.Issuer <= 0 {
+		r.Issuer = DefaultResponseLimits.Issuer
+	}
+	return r
+}
+
+// errResponseTooLarge is wrapped by errors returned when a response exceeds
+// its limit. Such responses aren't retried, as the log would only send the
+// same response again.
+var errResponseTooLarge = errors.New("response too large")
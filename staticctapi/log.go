@@ -1,20 +1,22 @@
 package staticctapi
 
 import (
-	"compress/gzip"
 	"context"
-	"encoding/base64"
+	"crypto/sha256"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"filippo.io/sunlight"
 	"github.com/cenkalti/backoff/v4"
+
+	"github.com/letsencrypt/x509search"
 )
 
 // TilePathFromIndex converts an integer index to a tile path string.
@@ -30,31 +32,12 @@ func TilePathFromIndex(tileIndex int64) string {
 	return path
 }
 
-// TreeSizeFromCheckpoint verifies the given checkpoint is parseable, then
-// returns the parsed tree size.
-func TreeSizeFromCheckpoint(text string) (int64, error) {
-	if strings.Count(text, "\n") < 3 || len(text) > 1e6 {
-		return -1, errors.New("malformed checkpoint: incorrect size")
-	}
-
-	lines := strings.SplitN(text, "\n", 4)
-
-	treeSize, err := strconv.ParseInt(lines[1], 10, 64)
-	if err != nil || treeSize < 0 || lines[1] != strconv.FormatInt(treeSize, 10) {
-		return -1, errors.New("malformed checkpoint: invalid tree size")
-	}
-
-	hash, err := base64.StdEncoding.DecodeString(lines[2])
-	if err != nil || len(hash) != 32 {
-		return -1, errors.New("malformed checkpoint: invalid root hash")
-	}
-
-	return treeSize, nil
-}
-
 // Log represents a tiled CT log implementing the Static CT API spec.
 type Log struct {
-	httpClient *http.Client
+	clientMu        sync.Mutex
+	httpClient      *http.Client
+	maxConnections  int
+	clientTLSConfig *tls.Config
 
 	// MetricsEndpoint is the URL for the metrics endpoint of the log, as
 	// defined by the Static CT API specification.
@@ -64,6 +47,86 @@ type Log struct {
 	// GetTileEntriesWithBackoff. If TileRetry is the empty value,
 	// DefaultTileRetry is used.
 	TileRetry Retry
+
+	// Limiter, if set, caps the number of concurrent requests made to the log.
+	// The same Limiter may be shared by multiple Logs, in which case the cap
+	// applies to all of them combined.
+	Limiter *Limiter
+
+	// MaxCheckpointAge is the checkpoint age beyond which CheckHealth reports
+	// the log as stale. If MaxCheckpointAge is zero, DefaultMaxCheckpointAge
+	// is used.
+	MaxCheckpointAge time.Duration
+
+	// ExpectedOrigin, if set, is the origin line every checkpoint fetched from
+	// the log must have. Checkpoints from any other log are rejected, which
+	// catches a URL pointing at the wrong log shard before a long search is
+	// run against it.
+	ExpectedOrigin string
+
+	// TileCacheSize is the number of recently fetched data tiles kept in
+	// memory, so that tiles probed while determining a search's bounds aren't
+	// downloaded again when the search reaches them. If TileCacheSize is
+	// zero, DefaultTileCacheSize is used; if it's negative, tiles aren't
+	// cached. Cached entries are shared by every caller that fetches the
+	// tile, and must not be modified.
+	TileCacheSize int
+
+	// Observer, if set, is called after every request made to the log, such
+	// as to export request metrics. It is called concurrently from multiple
+	// goroutines. Counts of the same requests are also available from
+	// RequestCounts.
+	Observer func(Request)
+
+	// Header holds additional headers sent with every request to the log,
+	// such as credentials required by a private mirror.
+	Header http.Header
+
+	// BearerToken, if set, is sent with every request to the log in an
+	// Authorization header.
+	BearerToken string
+
+	// UserAgent is sent with every request to the log. Log operators ask
+	// monitors to identify themselves, ideally with contact details. If
+	// UserAgent is empty, x509search.DefaultUserAgent is used.
+	UserAgent string
+
+	// Mirrors lists alternative monitoring prefixes serving the same log, such
+	// as the origin bucket behind a CDN or a local mirror. Requests go to
+	// MetricsEndpoint first, then to each mirror in turn if it fails. An
+	// endpoint that fails is tried after the healthy ones for a while, so a
+	// flaky endpoint doesn't slow down every request. Headers, credentials,
+	// and TLSConfig are sent to every endpoint.
+	Mirrors []*url.URL
+
+	// ResponseLimits caps the size of the responses read from the log. Any
+	// limit left at zero is taken from DefaultResponseLimits. A tile that
+	// exceeds its limit is reported as a failure to fetch it.
+	ResponseLimits ResponseLimits
+
+	// TLSConfig, if set, configures TLS connections to the log. Client
+	// certificates for mirrors requiring mutual TLS go in its Certificates
+	// field, and a private CA in its RootCAs field. It must not be modified
+	// once requests have been made with it.
+	TLSConfig *tls.Config
+
+	// lastHealthyTreeSize is the tree size seen by the last successful
+	// CheckHealth, if hasHealthySample is set
+	healthMu            sync.Mutex
+	hasHealthySample    bool
+	lastHealthyTreeSize int64
+
+	mirrorMu       sync.Mutex
+	unhealthyUntil map[*url.URL]time.Time
+
+	// origin is the origin line of the last checkpoint fetched from the log
+	// whose signature was verified
+	originMu sync.Mutex
+	origin   string
+
+	tiles *tileCache
+
+	stats requestStats
 }
 
 func NewLog(metricsEndpoint string) (*Log, error) {
@@ -73,67 +136,248 @@ func NewLog(metricsEndpoint string) (*Log, error) {
 	}
 
 	log := &Log{
-		httpClient:      &http.Client{},
+		httpClient:      &http.Client{Transport: newTransport(defaultMaxConnections, nil)},
+		maxConnections:  defaultMaxConnections,
 		MetricsEndpoint: endpointUrl,
+		tiles:           newTileCache(),
 	}
 	return log, nil
 }
 
-// GetTileEntries fetches the data tile at the given index and parses the
-// entries from it.
-func (l *Log) GetTileEntries(ctx context.Context, tileIndex int64) ([]*sunlight.LogEntry, error) {
-	tilePath := fmt.Sprintf("/tile/data/%s", TilePathFromIndex(tileIndex))
-	tileUrl := l.MetricsEndpoint.JoinPath(tilePath).String()
+// get fetches the resource at path, relative to the log's monitoring prefix,
+// and returns the decoded response body, which may be at most limit bytes. If
+// the log has mirrors, they're tried in turn when an endpoint fails; see
+// Mirrors.
+func (l *Log) get(ctx context.Context, path string, limit int64) ([]byte, error) {
+	var errs []error
+	for _, endpoint := range l.endpoints() {
+		data, err := l.getFrom(ctx, endpoint, path, limit)
+		if err == nil {
+			l.markEndpoint(endpoint, true)
+			return data, nil
+		}
+
+		// There's no point trying another endpoint once the caller gives up
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		l.markEndpoint(endpoint, false)
+		errs = append(errs, err)
+	}
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, tileUrl, nil)
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("all endpoints failed: %w", errors.Join(errs...))
+}
+
+// getFrom fetches the resource at path relative to the given endpoint, and
+// records the outcome of the request.
+func (l *Log) getFrom(ctx context.Context, endpoint *url.URL, path string, limit int64) ([]byte, error) {
+	request := Request{
+		Endpoint: endpoint,
+		Path:     path,
+		Attempt:  attemptFrom(ctx),
+	}
+
+	started := time.Now()
+	data, err := l.fetch(ctx, endpoint, path, limit, &request.StatusCode)
+
+	request.Duration = time.Since(started)
+	request.Err = err
+	request.Timeout = err != nil && isTimeout(err)
+
+	// Waiting for a request slot isn't a request
+	if !errors.Is(err, errNoRequestSlot) {
+		l.observe(request)
+	}
+
+	return data, err
+}
+
+// errNoRequestSlot is wrapped by errors returned from fetch when the request
+// couldn't be made because no Limiter slot became free.
+var errNoRequestSlot = errors.New("waiting for request slot")
+
+// fetch makes a request for the resource at path relative to the given
+// endpoint, storing the response status in statusCode if a response is
+// received. path may end in a query string. The decoded response body may be
+// at most limit bytes.
+func (l *Log) fetch(ctx context.Context, endpoint *url.URL, path string, limit int64, statusCode *int) ([]byte, error) {
+	path, query, _ := strings.Cut(path, "?")
+	resource := endpoint.JoinPath(path)
+	resource.RawQuery = query
+	resourceUrl := resource.String()
+
+	// Cancelled if the response headers take longer than the header timeout
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, resourceUrl, nil)
 	if err != nil {
 		return nil, fmt.Errorf("building http request: %w", err)
 	}
 
-	request.Header.Add("Accept-Encoding", "gzip, identity")
+	for name, values := range l.Header {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+
+	if l.BearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+l.BearerToken)
+	}
+
+	request.Header.Set("Accept-Encoding", acceptEncoding)
+
+	userAgent := l.UserAgent
+	if userAgent == "" {
+		userAgent = x509search.DefaultUserAgent
+	}
+	request.Header.Set("User-Agent", userAgent)
+
+	err = l.Limiter.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoRequestSlot, err)
+	}
+
+	defer l.Limiter.release()
+
+	headerTimeout := headerTimeoutFrom(ctx)
+	var headerTimer *time.Timer
+	if headerTimeout > 0 {
+		headerTimer = time.AfterFunc(headerTimeout, cancel)
+	}
+
+	response, err := l.client().Do(request)
 
-	response, err := l.httpClient.Do(request)
+	// A timer that already fired has cancelled the request, even if the
+	// headers arrived in the meantime
+	if headerTimer != nil && !headerTimer.Stop() {
+		if response != nil {
+			response.Body.Close()
+		}
+		return nil, fmt.Errorf("requesting %s: no response headers within %s: %w", path, headerTimeout, context.DeadlineExceeded)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("requesting tile: %w", err)
+		return nil, fmt.Errorf("requesting %s: %w", path, err)
 	}
 
 	defer response.Body.Close()
 
+	*statusCode = response.StatusCode
+
 	if response.StatusCode != 200 {
-		return nil, fmt.Errorf("unexpected response status: %s", response.Status)
+		return nil, statusError{host: endpoint.Host, status: response.Status, code: response.StatusCode}
 	}
 
-	var tileData []byte
-
-	// Tile data may be gzip-compressed
-	if strings.HasPrefix(response.Header.Get("Content-Encoding"), "gzip") {
-		reader, err := gzip.NewReader(response.Body)
-		if err != nil {
-			return nil, fmt.Errorf("creating gzip reader: %w", err)
+	// Uncompressed responses can be resumed if the connection drops, while
+	// compressed ones must be decoded
+	if isIdentityEncoded(response) {
+		// There's no need to read a body that's already known to be too large
+		if response.ContentLength > limit {
+			return nil, fmt.Errorf("%w: %d bytes from %s", errResponseTooLarge, response.ContentLength, endpoint.Host)
 		}
+		return l.readResumable(ctx, request, response, limit)
+	}
+	return readResponseBody(response, limit)
+}
 
-		defer reader.Close()
+// statusError is returned by fetch when the response status isn't 200.
+type statusError struct {
+	host   string
+	status string
+	code   int
+}
 
-		tileData, err = io.ReadAll(reader)
-		if err != nil {
-			return nil, fmt.Errorf("reading data from gzipped response body: %w", err)
-		}
-	} else {
-		tileData, err = io.ReadAll(response.Body)
-		if err != nil {
-			return nil, fmt.Errorf("reading response body: %w", err)
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected response status from %s: %s", e.host, e.status)
+}
+
+// GetTileEntries fetches the data tile at the given index and parses the
+// entries from it. Recently fetched tiles are served from memory; see
+// TileCacheSize.
+func (l *Log) GetTileEntries(ctx context.Context, tileIndex int64) ([]*sunlight.LogEntry, error) {
+	cacheSize := l.TileCacheSize
+	if cacheSize == 0 {
+		cacheSize = DefaultTileCacheSize
+	}
+
+	if cacheSize > 0 {
+		entries, ok := l.tiles.get(tileIndex)
+		if ok {
+			return entries, nil
 		}
 	}
 
-	entries := make([]*sunlight.LogEntry, 256)
+	// Concurrent requests for the tile, from any Log for the same log, share
+	// a single download
+	entries, err := coalesceTile(ctx, l.tileKey(tileIndex), func(ctx context.Context) ([]*sunlight.LogEntry, error) {
+		return l.fetchTileEntries(ctx, tileIndex)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheSize > 0 {
+		l.tiles.add(tileIndex, entries, cacheSize)
+	}
+
+	return entries, nil
+}
+
+// fetchTileEntries downloads the data tile at the given index and parses the
+// entries from it.
+func (l *Log) fetchTileEntries(ctx context.Context, tileIndex int64) ([]*sunlight.LogEntry, error) {
+	tileData, err := l.get(ctx, fmt.Sprintf("/tile/data/%s", TilePathFromIndex(tileIndex)), l.ResponseLimits.withDefaults().Tile)
+	if err != nil {
+		return nil, fmt.Errorf("fetching tile: %w", err)
+	}
+
+	entries, err := ParseDataTile(tileData)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, checkFullTile(entries)
+}
+
+// checkFullTile returns an error if entries, parsed from a tile fetched as a
+// full tile, fall short of one. A response cut off between entries parses
+// cleanly, so this catches truncation that ParseDataTile can't.
+func checkFullTile(entries []*sunlight.LogEntry) error {
+	if len(entries) != 256 {
+		return fmt.Errorf("full tile holds only %d entries", len(entries))
+	}
+
+	return nil
+}
+
+// ParseDataTile parses the entries from a data tile, as served by a log at
+// /tile/data/<N>. It allows tiles obtained by other means, such as from a
+// dump of a log's bucket, to be read without a Log. Entries are read until
+// tileData is exhausted, so partial tiles, holding fewer than 256 entries,
+// are parsed too; a tile truncated partway through an entry is an error. The
+// entries refer to tileData rather than copying from it.
+func ParseDataTile(tileData []byte) ([]*sunlight.LogEntry, error) {
+	if len(tileData) == 0 {
+		return nil, errors.New("empty tile")
+	}
+
+	entries := make([]*sunlight.LogEntry, 0, 256)
+
+	for len(tileData) > 0 {
+		if len(entries) == 256 {
+			return nil, errors.New("tile holds more than 256 entries")
+		}
 
-	for entryIndex := 0; entryIndex < 256; entryIndex++ {
 		entry, rest, err := sunlight.ReadTileLeaf(tileData)
 		if err != nil {
-			return nil, fmt.Errorf("reading entry from tile: %w", err)
+			return nil, fmt.Errorf("reading entry %d from tile: %w", len(entries), err)
 		}
 
-		entries[entryIndex] = entry
+		entries = append(entries, entry)
 		tileData = rest
 	}
 
@@ -144,111 +388,298 @@ func (l *Log) GetTileEntries(ctx context.Context, tileIndex int64) ([]*sunlight.
 // the entries from it, retrying the request upon failure according to the
 // settings in TileRetry.
 func (l *Log) GetTileEntriesWithBackoff(ctx context.Context, tileIndex int64) ([]*sunlight.LogEntry, error) {
-	bo := DefaultTileRetry.createBackoff()
+	return l.retryTile(ctx, func(ctx context.Context) ([]*sunlight.LogEntry, error) {
+		return l.GetTileEntries(ctx, tileIndex)
+	})
+}
+
+// GetTileEntriesInto fetches the data tile at the given index and parses the
+// entries from it into slab, retrying the request upon failure according to
+// the settings in TileRetry. The entries are only valid until slab is next
+// used; see EntrySlab. The tile is always downloaded, bypassing the tile cache
+// and the sharing of concurrent fetches, since its entries can't be shared.
+func (l *Log) GetTileEntriesInto(ctx context.Context, tileIndex int64, slab *EntrySlab) ([]*sunlight.LogEntry, error) {
+	return l.retryTile(ctx, func(ctx context.Context) ([]*sunlight.LogEntry, error) {
+		tileData, err := l.get(ctx, fmt.Sprintf("/tile/data/%s", TilePathFromIndex(tileIndex)), l.ResponseLimits.withDefaults().Tile)
+		if err != nil {
+			return nil, fmt.Errorf("fetching tile: %w", err)
+		}
+
+		entries, err := slab.Parse(tileData)
+		if err != nil {
+			return nil, err
+		}
+
+		return entries, checkFullTile(entries)
+	})
+}
+
+// retryTile calls operation until it succeeds, according to the settings in
+// TileRetry.
+func (l *Log) retryTile(ctx context.Context, operation func(context.Context) ([]*sunlight.LogEntry, error)) ([]*sunlight.LogEntry, error) {
+	retry := DefaultTileRetry
 	if l.TileRetry.Validate() == nil {
-		bo = l.TileRetry.createBackoff()
+		retry = l.TileRetry
 	}
 
-	var operation backoff.OperationWithData[[]*sunlight.LogEntry] = func() ([]*sunlight.LogEntry, error) {
-		return l.GetTileEntries(ctx, tileIndex)
-	}
+	attempt := 0
+	return backoff.RetryWithData(func() ([]*sunlight.LogEntry, error) {
+		attempt++
+
+		attemptCtx := withHeaderTimeout(withAttempt(ctx, attempt), retry.AttemptTimeout)
 
-	return backoff.RetryWithData(operation, backoff.WithContext(bo, ctx))
+		entries, err := operation(attemptCtx)
+		if errors.Is(err, errResponseTooLarge) {
+			return nil, backoff.Permanent(err)
+		}
+		return entries, err
+	}, backoff.WithContext(retry.createBackoff(), ctx))
 }
 
-// GetLastFullTileIndex returns the index of the last full tile currently
-// available in the log.
-func (l *Log) GetLastFullTileIndex(ctx context.Context) (int64, error) {
-	checkpointUrl := l.MetricsEndpoint.JoinPath("/checkpoint").String()
+// GetCheckpoint fetches and parses the log's current checkpoint. The signed
+// note it was parsed from is kept in its Note field, so that monitors can
+// persist or gossip it, or verify it against their own policy; its
+// signatures aren't verified here. See GetVerifiedTree to verify them against
+// the log's key. If ExpectedOrigin is set, checkpoints from other logs are
+// rejected.
+func (l *Log) GetCheckpoint(ctx context.Context) (Checkpoint, error) {
+	checkpointData, err := l.get(ctx, "/checkpoint", l.ResponseLimits.withDefaults().Checkpoint)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("fetching checkpoint: %w", err)
+	}
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, checkpointUrl, nil)
+	checkpoint, err := ParseCheckpoint(checkpointData)
 	if err != nil {
-		return -1, fmt.Errorf("building http request: %w", err)
+		return Checkpoint{}, fmt.Errorf("parsing checkpoint: %w", err)
 	}
 
-	response, err := l.httpClient.Do(request)
+	err = l.checkOrigin(checkpoint)
 	if err != nil {
-		return -1, fmt.Errorf("requesting checkpoint: %w", err)
+		return Checkpoint{}, err
 	}
 
-	defer response.Body.Close()
+	return checkpoint, nil
+}
 
-	if response.StatusCode != 200 {
-		return -1, fmt.Errorf("unexpected response status: %s", response.Status)
+// checkOrigin returns an error if checkpoint isn't from the log named by
+// ExpectedOrigin.
+func (l *Log) checkOrigin(checkpoint Checkpoint) error {
+	if l.ExpectedOrigin != "" && checkpoint.Origin != l.ExpectedOrigin {
+		return fmt.Errorf("checkpoint origin %q doesn't match expected origin %q", checkpoint.Origin, l.ExpectedOrigin)
 	}
 
-	checkpointData, err := io.ReadAll(response.Body)
+	return nil
+}
+
+// GetLastFullTileIndex returns the index of the last full tile currently
+// available in the log. It returns an error if the log hasn't filled a tile
+// yet.
+func (l *Log) GetLastFullTileIndex(ctx context.Context) (int64, error) {
+	checkpoint, err := l.GetCheckpoint(ctx)
 	if err != nil {
-		return -1, fmt.Errorf("reading response body: %w", err)
+		return -1, err
 	}
 
-	treeSize, err := TreeSizeFromCheckpoint(string(checkpointData))
-	if err != nil {
-		return -1, fmt.Errorf("parsing tree size from checkpoint: %w", err)
+	if checkpoint.TreeSize < 256 {
+		return -1, errors.New("log has no full tiles")
 	}
 
-	return treeSize / 256, nil
+	return checkpoint.TreeSize/256 - 1, nil
 }
 
-// GetTileIndexFromTime performs a binary search against the log to find the
-// index of the data tile containing the given timestamp. The search is bounded
-// between startTile and endTile. This method takes advantage of the fact that
-// in practice, logs implementing the Static CT API store their entries in
-// sequential order.
+// GetTileIndexFromTime searches the log to find the index of the data tile
+// containing the given timestamp. The search is bounded between startTile and
+// endTile. This method takes advantage of the fact that in practice, logs
+// implementing the Static CT API store their entries in sequential order.
+//
+// Logs grow at a roughly steady rate, so rather than bisecting the range, the
+// search interpolates the likely position of the timestamp between the
+// timestamps of the tiles bounding the range. On a large log this typically
+// needs a handful of tile fetches instead of a few dozen. Whenever an
+// interpolated guess fails to halve the range, the next step bisects instead,
+// so the search is never much slower than a binary search.
 func (l *Log) GetTileIndexFromTime(ctx context.Context, t time.Time, startTile int64, endTile int64) (int64, error) {
+	tileIndex, _, err := l.tileFromTime(ctx, t, startTile, endTile)
+	return tileIndex, err
+}
+
+// tileFromTime implements GetTileIndexFromTime, additionally returning the
+// entries of the tile it found.
+func (l *Log) tileFromTime(ctx context.Context, t time.Time, startTile int64, endTile int64) (int64, []*sunlight.LogEntry, error) {
 	if startTile < 0 {
-		return -1, errors.New("negative startTile")
+		return -1, nil, errors.New("negative startTile")
 	}
 
+	// lowTime and highTime bound the timestamps of the entries in the tiles
+	// between startIndex and endIndex, once they're known
+	var lowTime, highTime time.Time
+
 	startIndex := startTile
 	endIndex := endTile
+	interpolated := false
 	for startIndex <= endIndex {
-		pivotIndex := (startIndex + endIndex) / 2
+		width := endIndex - startIndex
+
+		var pivotIndex int64
+		switch {
+		case lowTime.IsZero():
+			pivotIndex = startIndex
+		case highTime.IsZero():
+			pivotIndex = endIndex
+		case interpolated || !highTime.After(lowTime):
+			// The previous guess was poor, so bisect
+			pivotIndex = (startIndex + endIndex) / 2
+			interpolated = false
+		default:
+			fraction := float64(t.Sub(lowTime)) / float64(highTime.Sub(lowTime))
+			fraction = math.Max(0, math.Min(1, fraction))
+			pivotIndex = startIndex + int64(fraction*float64(width))
+			interpolated = true
+		}
+
 		tileEntries, err := l.GetTileEntries(ctx, pivotIndex)
 		if err != nil {
-			return -1, fmt.Errorf("getting entries for tile: %w", err)
+			return -1, nil, fmt.Errorf("getting entries for tile: %w", err)
 		}
 
 		firstTime := time.UnixMilli(tileEntries[0].Timestamp)
-		if t.Before(firstTime) {
+		lastTime := time.UnixMilli(tileEntries[len(tileEntries)-1].Timestamp)
+
+		switch {
+		case t.Before(firstTime):
 			endIndex = pivotIndex - 1
-			continue
+			highTime = firstTime
+		case t.After(lastTime):
+			startIndex = pivotIndex + 1
+			lowTime = lastTime
+		default:
+			return pivotIndex, tileEntries, nil
 		}
 
-		lastTime := time.UnixMilli(tileEntries[255].Timestamp)
-		if t.After(lastTime) {
-			startIndex = pivotIndex + 1
-			continue
+		// Only count a guess as good if it at least halved the range
+		if interpolated && endIndex-startIndex <= width/2 {
+			interpolated = false
 		}
 
-		return pivotIndex, nil
+		// The range's endpoints are probed first, and if the timestamp lies
+		// outside of them, it isn't in the range at all
+		if pivotIndex == startTile && t.Before(firstTime) {
+			return -1, nil, errTimeBeforeTiles
+		}
+		if pivotIndex == endTile && t.After(lastTime) {
+			return -1, nil, errTimeAfterTiles
+		}
 	}
 
-	return -1, errors.New("timestamp doesn't fall within the time bounds of the log entries")
+	// The timestamp lies between the last entry of one tile and the first
+	// entry of the next
+	return -1, nil, gapError{before: endIndex}
+}
+
+var (
+	errTimeBeforeTiles = errors.New("timestamp is before the first entry in the searched tiles")
+	errTimeAfterTiles  = errors.New("timestamp is after the last entry in the searched tiles")
+)
+
+// gapError is returned by tileFromTime when the timestamp falls between two
+// adjacent tiles, the first of which has the index before.
+type gapError struct {
+	before int64
+}
+
+func (e gapError) Error() string {
+	return fmt.Sprintf("timestamp falls between tiles %d and %d", e.before, e.before+1)
 }
 
 // GetBoundingTilesFromTimes finds the indexes of the data tiles bounding the
 // timespan described by startTime and endTime.
 func (l *Log) GetBoundingTilesFromTimes(ctx context.Context, startTime time.Time, endTime time.Time) (int64, int64, error) {
+	bounds, err := l.boundingTiles(ctx, startTime, endTime, false)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	if bounds.empty {
+		return -1, -1, errors.New("no entries fall within the timespan")
+	}
+
+	return bounds.startIndex, bounds.endIndex, nil
+}
+
+// tileBounds describes the data tiles bounding a timespan, along with their
+// entries if they were fetched while searching for them.
+type tileBounds struct {
+	startIndex   int64
+	startEntries []*sunlight.LogEntry
+	endIndex     int64
+	endEntries   []*sunlight.LogEntry
+
+	// empty is true if the timespan doesn't overlap the log at all, which is
+	// only reported when clamping
+	empty bool
+}
+
+// boundingTiles implements GetBoundingTilesFromTimes, additionally returning
+// the entries of the bounding tiles so they needn't be fetched again. If clamp
+// is true, a timespan extending beyond the log's entries is truncated to them
+// instead of causing an error.
+//
+// A timestamp falling between two tiles bounds the timespan with the tile on
+// its inner side.
+func (l *Log) boundingTiles(ctx context.Context, startTime time.Time, endTime time.Time, clamp bool) (tileBounds, error) {
 	if !startTime.Before(endTime) {
-		return -1, -1, errors.New("start time is not before end time")
+		return tileBounds{}, errors.New("start time is not before end time")
 	}
 
 	lastTile, err := l.GetLastFullTileIndex(ctx)
 	if err != nil {
-		return -1, -1, fmt.Errorf("getting index of current final tile: %w", err)
+		return tileBounds{}, fmt.Errorf("getting index of current final tile: %w", err)
 	}
 
-	startIndex, err := l.GetTileIndexFromTime(ctx, startTime, 0, lastTile)
-	if err != nil {
-		return -1, -1, fmt.Errorf("getting index of start tile: %w", err)
+	var bounds tileBounds
+	var gap gapError
+
+	bounds.startIndex, bounds.startEntries, err = l.tileFromTime(ctx, startTime, 0, lastTile)
+	switch {
+	case errors.As(err, &gap):
+		bounds.startIndex = gap.before + 1
+	case clamp && errors.Is(err, errTimeBeforeTiles):
+		bounds.startIndex = 0
+	case clamp && errors.Is(err, errTimeAfterTiles):
+		return tileBounds{empty: true}, nil
+	case err != nil:
+		return tileBounds{}, fmt.Errorf("getting index of start tile: %w", err)
 	}
 
 	// Use the index that was already found to bound the next search
-	endIndex, err := l.GetTileIndexFromTime(ctx, endTime, startIndex, lastTile)
+	bounds.endIndex, bounds.endEntries, err = l.tileFromTime(ctx, endTime, bounds.startIndex, lastTile)
+	switch {
+	case errors.As(err, &gap):
+		bounds.endIndex = gap.before
+	case clamp && errors.Is(err, errTimeAfterTiles):
+		bounds.endIndex = lastTile
+	case errors.Is(err, errTimeBeforeTiles):
+		// The start tile was found, so the end time can only precede it if
+		// the start time was clamped or fell in a gap
+		return tileBounds{empty: true}, nil
+	case err != nil:
+		return tileBounds{}, fmt.Errorf("getting index of end tile: %w", err)
+	}
+
+	return bounds, nil
+}
+
+// GetIssuer fetches the issuer certificate with the given SHA-256 fingerprint,
+// as referenced by the ChainFingerprints of a log entry.
+func (l *Log) GetIssuer(ctx context.Context, fingerprint [32]byte) ([]byte, error) {
+	issuer, err := l.get(ctx, fmt.Sprintf("/issuer/%x", fingerprint), l.ResponseLimits.withDefaults().Issuer)
 	if err != nil {
-		return -1, -1, fmt.Errorf("getting index of end tile: %w", err)
+		return nil, fmt.Errorf("fetching issuer: %w", err)
+	}
+
+	if sha256.Sum256(issuer) != fingerprint {
+		return nil, errors.New("issuer doesn't match its fingerprint")
 	}
 
-	return startIndex, endIndex, nil
+	return issuer, nil
 }
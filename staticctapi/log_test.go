@@ -0,0 +1,319 @@
+package staticctapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"filippo.io/sunlight"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// testLogStart is the timestamp of the first entry of a test log. Each
+// following entry is logged a second later.
+var testLogStart = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testLog serves a log of treeSize entries over HTTP. Only full data tiles are
+// served, as a log only publishes partial tiles under a different path.
+// Requested paths are recorded in requests.
+type testLog struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newTestLog(t *testing.T, treeSize int64) *testLog {
+	t.Helper()
+
+	tiles := make(map[string][]byte)
+	for tile := int64(0); tile < treeSize/256; tile++ {
+		tiles["/tile/data/"+TilePathFromIndex(tile)] = testTileData(tile)
+	}
+
+	checkpoint := fmt.Sprintf("example.com/test\n%d\n%s\n", treeSize, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+
+	log := &testLog{}
+	log.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.mu.Lock()
+		log.requests = append(log.requests, r.URL.Path)
+		log.mu.Unlock()
+
+		if r.URL.Path == "/checkpoint" {
+			fmt.Fprint(w, checkpoint)
+			return
+		}
+
+		tile, ok := tiles[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(tile)
+	}))
+	t.Cleanup(log.server.Close)
+
+	return log
+}
+
+// testTileData returns the contents of the full data tile with the given
+// index of a test log.
+func testTileData(tile int64) []byte {
+	var data []byte
+	for i := tile * 256; i < (tile+1)*256; i++ {
+		data = sunlight.AppendTileLeaf(data, &sunlight.LogEntry{
+			Certificate: []byte{byte(i)},
+			LeafIndex:   i,
+			Timestamp:   entryTime(i).UnixMilli(),
+		})
+	}
+	return data
+}
+
+func (l *testLog) newLog(t *testing.T) *Log {
+	t.Helper()
+
+	log, err := NewLog(l.server.URL + "/")
+	if err != nil {
+		t.Fatalf("creating log: %s", err)
+	}
+	return log
+}
+
+// entryTime returns the timestamp of the entry with the given index.
+func entryTime(index int64) time.Time {
+	return testLogStart.Add(time.Duration(index) * time.Second)
+}
+
+// TestEncodedResponses checks that checkpoints and tiles are decoded when the
+// log compresses them with zstd or brotli.
+func TestEncodedResponses(t *testing.T) {
+	zstdEncoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zstdEncoder.Close()
+
+	for _, tc := range []struct {
+		encoding string
+		encode   func([]byte) []byte
+	}{
+		{"zstd", func(data []byte) []byte {
+			return zstdEncoder.EncodeAll(data, nil)
+		}},
+		{"br", func(data []byte) []byte {
+			var buf bytes.Buffer
+			w := brotli.NewWriter(&buf)
+			w.Write(data)
+			w.Close()
+			return buf.Bytes()
+		}},
+	} {
+		t.Run(tc.encoding, func(t *testing.T) {
+			checkpoint := fmt.Sprintf("example.com/test\n512\n%s\n", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.Contains(r.Header.Get("Accept-Encoding"), tc.encoding) {
+					http.Error(w, "encoding not accepted", http.StatusNotAcceptable)
+					return
+				}
+
+				var data []byte
+				switch r.URL.Path {
+				case "/checkpoint":
+					data = []byte(checkpoint)
+				case "/tile/data/" + TilePathFromIndex(1):
+					data = testTileData(1)
+				default:
+					http.NotFound(w, r)
+					return
+				}
+
+				w.Header().Set("Content-Encoding", tc.encoding)
+				w.Write(tc.encode(data))
+			}))
+			defer server.Close()
+
+			log, err := NewLog(server.URL + "/")
+			if err != nil {
+				t.Fatalf("creating log: %s", err)
+			}
+
+			last, err := log.GetLastFullTileIndex(context.Background())
+			if err != nil {
+				t.Fatalf("reading checkpoint: %s", err)
+			}
+			if last != 1 {
+				t.Errorf("got last full tile %d, want 1", last)
+			}
+
+			entries, err := log.GetTileEntries(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("reading tile: %s", err)
+			}
+			if len(entries) != 256 || entries[0].LeafIndex != 256 {
+				t.Errorf("got %d entries starting at %d, want 256 starting at 256", len(entries), entries[0].LeafIndex)
+			}
+		})
+	}
+}
+
+// TestResumeInterruptedTile checks that an uncompressed tile whose download
+// is cut off is resumed with a Range request from the last byte received,
+// rather than fetched again from the start.
+func TestResumeInterruptedTile(t *testing.T) {
+	tile := testTileData(0)
+	half := len(tile) / 2
+
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"tile"`)
+		if r.Header.Get("Range") == "" {
+			// Drop the connection halfway through the tile
+			w.Header().Set("Content-Length", strconv.Itoa(len(tile)))
+			w.Write(tile[:half])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", half, len(tile)-1, len(tile)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(tile[half:])
+	}))
+	defer server.Close()
+
+	log, err := NewLog(server.URL + "/")
+	if err != nil {
+		t.Fatalf("creating log: %s", err)
+	}
+
+	entries, err := log.GetTileEntries(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("reading interrupted tile: %s", err)
+	}
+	if len(entries) != 256 {
+		t.Errorf("got %d entries, want 256", len(entries))
+	}
+
+	want := []string{"", fmt.Sprintf("bytes=%d-", half)}
+	if !slices.Equal(ranges, want) {
+		t.Errorf("requested ranges %q, want %q", ranges, want)
+	}
+}
+
+// TestGetTileIndexFromTime checks that the search finds the tile holding each
+// timestamp, and that on a log growing at a steady rate, interpolating takes
+// a few fetches where bisecting 64 tiles would take around eight.
+func TestGetTileIndexFromTime(t *testing.T) {
+	server := newTestLog(t, 64*256)
+
+	for _, want := range []int64{0, 5, 40, 63} {
+		server.requests = nil
+		log := server.newLog(t)
+
+		got, err := log.GetTileIndexFromTime(context.Background(), entryTime(want*256+100), 0, 63)
+		if err != nil {
+			t.Errorf("tile %d: %s", want, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("got tile %d, want %d", got, want)
+		}
+
+		fetches := 0
+		for _, path := range server.requests {
+			if strings.HasPrefix(path, "/tile/data/") {
+				fetches++
+			}
+		}
+		if fetches > 4 {
+			t.Errorf("tile %d: took %d fetches, want at most 4", want, fetches)
+		}
+	}
+
+	_, err := server.newLog(t).GetTileIndexFromTime(context.Background(), entryTime(64*256+10), 0, 63)
+	if err == nil {
+		t.Error("got no error for a timestamp after the last tile")
+	}
+}
+
+func TestGetLastFullTileIndex(t *testing.T) {
+	for _, tc := range []struct {
+		treeSize int64
+		want     int64
+		wantErr  bool
+	}{
+		{treeSize: 0, wantErr: true},
+		{treeSize: 255, wantErr: true},
+		{treeSize: 256, want: 0},
+		{treeSize: 8 * 256, want: 7},
+		{treeSize: 8*256 + 10, want: 7},
+	} {
+		log := newTestLog(t, tc.treeSize).newLog(t)
+
+		got, err := log.GetLastFullTileIndex(context.Background())
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("tree size %d: got %d, want error", tc.treeSize, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tree size %d: %s", tc.treeSize, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("tree size %d: got %d, want %d", tc.treeSize, got, tc.want)
+		}
+	}
+}
+
+// TestGetBoundingTilesPartialLastTile searches a log whose last tile is
+// partial, which the search must not fetch as a full tile.
+func TestGetBoundingTilesPartialLastTile(t *testing.T) {
+	server := newTestLog(t, 8*256+10)
+	log := server.newLog(t)
+
+	start, end, err := log.GetBoundingTilesFromTimes(context.Background(), entryTime(300), entryTime(7*256+5))
+	if err != nil {
+		t.Fatalf("getting bounding tiles: %s", err)
+	}
+	if start != 1 || end != 7 {
+		t.Errorf("got tiles %d-%d, want 1-7", start, end)
+	}
+
+	for _, path := range server.requests {
+		if strings.HasSuffix(path, "/"+TilePathFromIndex(8)) {
+			t.Errorf("fetched partial tile %s", path)
+		}
+	}
+}
+
+// TestGetBoundingTilesBeyondLog checks that a timespan running past the last
+// full tile is reported, rather than searched for in the partial tile.
+func TestGetBoundingTilesBeyondLog(t *testing.T) {
+	log := newTestLog(t, 8*256+10).newLog(t)
+
+	_, _, err := log.GetBoundingTilesFromTimes(context.Background(), entryTime(300), entryTime(10*256))
+	if err == nil {
+		t.Fatal("got no error for a timespan ending after the last full tile")
+	}
+	if strings.Contains(err.Error(), "404") {
+		t.Errorf("fetched a tile that isn't full: %s", err)
+	}
+}
@@ -0,0 +1,246 @@
+package staticctapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// DefaultLogListURL is the address of the log list maintained for Chrome's CT
+// policy, in the v3 format.
+const DefaultLogListURL = "https://www.gstatic.com/ct/log_list/v3/log_list.json"
+
+// MaxLogListSize is the largest log list FetchLogList reads, in bytes. The
+// list at DefaultLogListURL is a few hundred kilobytes.
+const MaxLogListSize = 16 << 20
+
+// LogListEntry describes a log listed in a v3 log list, either a tiled log or
+// an RFC 6962 log.
+type LogListEntry struct {
+	Description string
+
+	// Operator is the name of the organization operating the log.
+	Operator string
+
+	// MonitoringURL is a tiled log's monitoring prefix, suitable for NewLog.
+	// It's empty for RFC 6962 logs.
+	MonitoringURL string
+
+	// URL is an RFC 6962 log's URL, suitable for NewLog and searched with an
+	// RFC6962DataSource. It's empty for tiled logs.
+	URL string
+
+	// Key is the DER-encoded public key of the log.
+	Key []byte
+
+	// Usable is true if the log is in the usable state.
+	Usable bool
+
+	// TemporalStart and TemporalEnd bound the notAfter timestamps accepted by
+	// a temporally-sharded log, inclusively and exclusively respectively. Both
+	// are the zero value if the log isn't sharded.
+	TemporalStart time.Time
+	TemporalEnd   time.Time
+}
+
+// logListLog mirrors a log in the v3 log list JSON format. Tiled logs have a
+// monitoring URL, and RFC 6962 logs a URL.
+type logListLog struct {
+	Description      string `json:"description"`
+	Key              []byte `json:"key"`
+	MonitoringURL    string `json:"monitoring_url"`
+	URL              string `json:"url"`
+	TemporalInterval *struct {
+		StartInclusive time.Time `json:"start_inclusive"`
+		EndExclusive   time.Time `json:"end_exclusive"`
+	} `json:"temporal_interval"`
+	State map[string]json.RawMessage `json:"state"`
+}
+
+// logList mirrors the parts of the v3 log list JSON format used here.
+type logList struct {
+	Operators []struct {
+		Name      string       `json:"name"`
+		Logs      []logListLog `json:"logs"`
+		TiledLogs []logListLog `json:"tiled_logs"`
+	} `json:"operators"`
+}
+
+// ParseLogList parses the tiled and RFC 6962 logs from a v3 log list. The
+// list's signature isn't checked.
+func ParseLogList(data []byte) ([]LogListEntry, error) {
+	var list logList
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, fmt.Errorf("parsing log list: %w", err)
+	}
+
+	entries := []LogListEntry{}
+	for _, operator := range list.Operators {
+		for _, log := range operator.TiledLogs {
+			entries = append(entries, log.entry(operator.Name, true))
+		}
+		for _, log := range operator.Logs {
+			entries = append(entries, log.entry(operator.Name, false))
+		}
+	}
+
+	return entries, nil
+}
+
+// entry converts log, operated by operator, to a LogListEntry.
+func (log logListLog) entry(operator string, tiled bool) LogListEntry {
+	_, usable := log.State["usable"]
+	entry := LogListEntry{
+		Description: log.Description,
+		Operator:    operator,
+		Key:         log.Key,
+		Usable:      usable,
+	}
+
+	if tiled {
+		entry.MonitoringURL = log.MonitoringURL
+	} else {
+		entry.URL = log.URL
+	}
+
+	if log.TemporalInterval != nil {
+		entry.TemporalStart = log.TemporalInterval.StartInclusive
+		entry.TemporalEnd = log.TemporalInterval.EndExclusive
+	}
+
+	return entry
+}
+
+// FetchLogList fetches and parses the v3 log list at listUrl, such as
+// DefaultLogListURL, using client, or http.DefaultClient if client is nil. A
+// list larger than MaxLogListSize is rejected.
+func FetchLogList(ctx context.Context, client *http.Client, listUrl string) ([]LogListEntry, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, listUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building http request: %w", err)
+	}
+
+	request.Header.Set("User-Agent", x509search.DefaultUserAgent)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("requesting log list: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+
+	data, err := readAll(response.Body, MaxLogListSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading log list: %w", err)
+	}
+
+	return ParseLogList(data)
+}
+
+// UsableDataSources returns a DataSource for each usable log in logs that may
+// hold entries logged within template's time window, so that a search can
+// cover every log in a list.
+//
+// Each tiled log's DataSource is a copy of template with its Log set. Each RFC
+// 6962 log is searched with an RFC6962DataSource taking the settings of
+// template that apply to it. RFC 6962 logs are skipped if template has Follow
+// set, as they can't be followed. All of the Logs share a single Limiter
+// allowing maxConnections concurrent requests, so the combined load stays
+// within that budget however many logs are searched.
+//
+// A temporal shard is skipped if it only accepts certificates that expired
+// before the window starts, as nothing can have been logged to it within the
+// window. Logs that began accepting entries after the window started fail to
+// determine their search bounds unless template has Clamp set, which searches
+// spanning many logs generally should.
+//
+// Each data source is named after its log's URL, and a Cursor can only follow
+// a single log, so template must have neither a SourceName nor a Cursor. Set
+// the Cursor of each returned DataSource instead.
+//
+// If template has no Deduplicator, one is created for the returned data
+// sources to share, since the same certificates are generally submitted to
+// several logs.
+func UsableDataSources(logs []LogListEntry, template DataSource, maxConnections int) ([]x509search.Sourcer, error) {
+	if template.StartTimeInclusive.IsZero() {
+		return nil, errors.New("template has no start time")
+	}
+
+	if template.SourceName != "" {
+		return nil, errors.New("template has a source name, which would name every log")
+	}
+
+	if template.Cursor != nil {
+		return nil, errors.New("template has a cursor, which can only follow a single log")
+	}
+
+	limiter := NewLimiter(maxConnections)
+
+	if template.Deduplicator == nil {
+		template.Deduplicator = NewDeduplicator(nil)
+	}
+
+	sources := []x509search.Sourcer{}
+	for _, entry := range logs {
+		if !entry.Usable {
+			continue
+		}
+
+		if !entry.TemporalEnd.IsZero() && !entry.TemporalEnd.After(template.StartTimeInclusive) {
+			continue
+		}
+
+		tiled := entry.MonitoringURL != ""
+		if !tiled && template.Follow {
+			continue
+		}
+
+		logUrl := entry.MonitoringURL
+		if !tiled {
+			logUrl = entry.URL
+		}
+
+		log, err := NewLog(logUrl)
+		if err != nil {
+			return nil, fmt.Errorf("creating log for %s: %w", entry.Description, err)
+		}
+		log.Limiter = limiter
+
+		if !tiled {
+			sources = append(sources, RFC6962DataSource{
+				Log:                    log,
+				IncludePrecertificates: template.IncludePrecertificates,
+				IncludeCertificates:    template.IncludeCertificates,
+				StartTimeInclusive:     template.StartTimeInclusive,
+				EndTimeInclusive:       template.EndTimeInclusive,
+				Clamp:                  template.Clamp,
+				WindowByNotBefore:      template.WindowByNotBefore,
+				NotBeforeSlack:         template.NotBeforeSlack,
+				MaxConnections:         template.MaxConnections,
+				Deduplicator:           template.Deduplicator,
+				DERFilter:              template.DERFilter,
+			})
+			continue
+		}
+
+		source := template
+		source.Log = log
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
@@ -0,0 +1,109 @@
+package staticctapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUsableDataSources(t *testing.T) {
+	list := []byte(`{"operators": [{
+		"name": "Example",
+		"tiled_logs": [
+			{"description": "Example 2025h1", "monitoring_url": "https://tiles.example.com/2025h1/", "state": {"usable": {}},
+			 "temporal_interval": {"start_inclusive": "2025-01-01T00:00:00Z", "end_exclusive": "2025-07-01T00:00:00Z"}},
+			{"description": "Example 2026h1", "monitoring_url": "https://tiles.example.com/2026h1/", "state": {"usable": {}},
+			 "temporal_interval": {"start_inclusive": "2026-01-01T00:00:00Z", "end_exclusive": "2026-07-01T00:00:00Z"}},
+			{"description": "Example pending", "monitoring_url": "https://tiles.example.com/pending/", "state": {"pending": {}}}
+		]
+	}]}`)
+
+	logs, err := ParseLogList(list)
+	if err != nil {
+		t.Fatalf("parsing log list: %s", err)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("parsed %d logs, want 3", len(logs))
+	}
+	if logs[0].Operator != "Example" || !logs[0].Usable || logs[2].Usable {
+		t.Errorf("parsed logs %+v", logs)
+	}
+
+	// The 2025h1 shard only accepts certificates that expired before the
+	// window, and the pending log isn't usable
+	template := DataSource{
+		IncludeCertificates: true,
+		StartTimeInclusive:  time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		EndTimeInclusive:    time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	sources, err := UsableDataSources(logs, template, 4)
+	if err != nil {
+		t.Fatalf("building data sources: %s", err)
+	}
+	if len(sources) != 1 {
+		t.Fatalf("got %d data sources, want 1", len(sources))
+	}
+	source, ok := sources[0].(DataSource)
+	if !ok {
+		t.Fatalf("got a %T, want a DataSource", sources[0])
+	}
+	if source.Log.MetricsEndpoint.String() != "https://tiles.example.com/2026h1/" {
+		t.Errorf("got a data source for %s, want the 2026h1 shard", source.Log.MetricsEndpoint)
+	}
+	if !source.IncludeCertificates || source.Log.Limiter == nil {
+		t.Errorf("data source doesn't take the template's settings: %+v", source)
+	}
+
+	_, err = UsableDataSources(logs, DataSource{}, 4)
+	if err == nil {
+		t.Error("got no error for a template without a start time")
+	}
+}
+
+// TestFetchLogList checks that the list is fetched with the given client,
+// and that a list too large to be real is rejected.
+func TestFetchLogList(t *testing.T) {
+	list := []byte(`{"operators": [{"name": "Example", "tiled_logs": [
+		{"description": "Example 2026h1", "monitoring_url": "https://tiles.example.com/2026h1/", "state": {"usable": {}}}
+	]}]}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/huge.json" {
+			w.Write(bytes.Repeat([]byte(" "), MaxLogListSize+1))
+			return
+		}
+		w.Write(list)
+	}))
+	defer server.Close()
+
+	var requests int
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	logs, err := FetchLogList(context.Background(), client, server.URL+"/list.json")
+	if err != nil {
+		t.Fatalf("fetching log list: %s", err)
+	}
+	if len(logs) != 1 || logs[0].Description != "Example 2026h1" {
+		t.Errorf("fetched logs %+v", logs)
+	}
+	if requests != 1 {
+		t.Errorf("client made %d requests, want 1", requests)
+	}
+
+	_, err = FetchLogList(context.Background(), nil, server.URL+"/huge.json")
+	if !errors.Is(err, errResponseTooLarge) {
+		t.Errorf("fetching an oversized log list returned %v", err)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,141 @@
+package staticctapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Request describes the outcome of a single HTTP request made to a log.
+type Request struct {
+	// Endpoint is the monitoring prefix the request was sent to, which is
+	// either the log's MetricsEndpoint or one of its Mirrors.
+	Endpoint *url.URL
+
+	// Path is the requested resource, relative to Endpoint.
+	Path string
+
+	// Attempt is the 1-based attempt number of the request, which is greater
+	// than 1 when GetTileEntriesWithBackoff retries a tile.
+	Attempt int
+
+	// StatusCode is the HTTP status of the response, or 0 if no response was
+	// received.
+	StatusCode int
+
+	// Timeout is true if the request failed because it timed out.
+	Timeout bool
+
+	// Duration is the time taken by the request, including reading the
+	// response body.
+	Duration time.Duration
+
+	// Err is the error the request failed with, if it failed.
+	Err error
+}
+
+// RequestCounts holds the number of requests a log has made, broken down by
+// outcome. It helps tell whether a slow search is being rate limited (429),
+// hitting server errors (5xx), or timing out, and so how MaxConnections should
+// be tuned.
+type RequestCounts struct {
+	// ByStatus counts the requests that received a response, by HTTP status.
+	ByStatus map[int]int64
+
+	// Timeouts counts the requests that timed out without a response.
+	Timeouts int64
+
+	// NetworkErrors counts the other requests that failed without a response.
+	NetworkErrors int64
+
+	// ByAttempt counts requests by their attempt number.
+	ByAttempt map[int]int64
+}
+
+// requestStats accumulates RequestCounts. It is safe for concurrent use.
+type requestStats struct {
+	mu     sync.Mutex
+	counts RequestCounts
+}
+
+func (s *requestStats) record(request Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts.ByStatus == nil {
+		s.counts.ByStatus = make(map[int]int64)
+		s.counts.ByAttempt = make(map[int]int64)
+	}
+
+	switch {
+	case request.StatusCode != 0:
+		s.counts.ByStatus[request.StatusCode]++
+	case request.Timeout:
+		s.counts.Timeouts++
+	default:
+		s.counts.NetworkErrors++
+	}
+
+	s.counts.ByAttempt[request.Attempt]++
+}
+
+// RequestCounts returns the number of requests made by the log so far, by
+// outcome.
+func (l *Log) RequestCounts() RequestCounts {
+	l.stats.mu.Lock()
+	defer l.stats.mu.Unlock()
+
+	counts := RequestCounts{
+		ByStatus:      make(map[int]int64, len(l.stats.counts.ByStatus)),
+		Timeouts:      l.stats.counts.Timeouts,
+		NetworkErrors: l.stats.counts.NetworkErrors,
+		ByAttempt:     make(map[int]int64, len(l.stats.counts.ByAttempt)),
+	}
+	for status, count := range l.stats.counts.ByStatus {
+		counts.ByStatus[status] = count
+	}
+	for attempt, count := range l.stats.counts.ByAttempt {
+		counts.ByAttempt[attempt] = count
+	}
+
+	return counts
+}
+
+// observe records the outcome of a request, and passes it to the Observer.
+func (l *Log) observe(request Request) {
+	l.stats.record(request)
+
+	if l.Observer != nil {
+		l.Observer(request)
+	}
+}
+
+type attemptKey struct{}
+
+// withAttempt returns a context recording the attempt number of the requests
+// made with it.
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// attemptFrom returns the attempt number recorded in ctx, or 1.
+func attemptFrom(ctx context.Context) int {
+	attempt, ok := ctx.Value(attemptKey{}).(int)
+	if !ok {
+		return 1
+	}
+	return attempt
+}
+
+// isTimeout reports whether err was caused by a timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
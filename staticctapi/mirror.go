@@ -0,0 +1,57 @@
+package staticctapi
+
+import (
+	"net/url"
+	"time"
+)
+
+// mirrorCooldown is how long an endpoint that failed a request is tried only
+// after the log's healthy endpoints.
+const mirrorCooldown = 30 * time.Second
+
+// endpoints returns the log's endpoints in the order they should be tried:
+// healthy endpoints first, in configured order, followed by those that failed
+// recently. Failed endpoints are kept as a last resort, since the failure may
+// have been with the request rather than the endpoint.
+func (l *Log) endpoints() []*url.URL {
+	if len(l.Mirrors) == 0 {
+		return []*url.URL{l.MetricsEndpoint}
+	}
+
+	l.mirrorMu.Lock()
+	defer l.mirrorMu.Unlock()
+
+	now := time.Now()
+	healthy := make([]*url.URL, 0, len(l.Mirrors)+1)
+	unhealthy := []*url.URL{}
+
+	for _, endpoint := range append([]*url.URL{l.MetricsEndpoint}, l.Mirrors...) {
+		if now.Before(l.unhealthyUntil[endpoint]) {
+			unhealthy = append(unhealthy, endpoint)
+			continue
+		}
+		healthy = append(healthy, endpoint)
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+// markEndpoint records the outcome of a request to endpoint.
+func (l *Log) markEndpoint(endpoint *url.URL, ok bool) {
+	if len(l.Mirrors) == 0 {
+		return
+	}
+
+	l.mirrorMu.Lock()
+	defer l.mirrorMu.Unlock()
+
+	if ok {
+		delete(l.unhealthyUntil, endpoint)
+		return
+	}
+
+	if l.unhealthyUntil == nil {
+		l.unhealthyUntil = make(map[*url.URL]time.Time)
+	}
+	l.unhealthyUntil[endpoint] = time.Now().Add(mirrorCooldown)
+}
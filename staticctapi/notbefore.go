@@ -0,0 +1,47 @@
+package staticctapi
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cryptobyte_asn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// DefaultNotBeforeSlack is the slack used when windowing by notBefore and
+// DataSource.NotBeforeSlack is zero. CAs commonly backdate notBefore by up to
+// an hour, and certificates are usually logged within a day of issuance.
+const DefaultNotBeforeSlack = 24 * time.Hour
+
+// readNotBefore extracts the notBefore timestamp from a DER-encoded
+// certificate or precertificate without fully parsing it.
+func readNotBefore(der []byte) (time.Time, error) {
+	input := cryptobyte.String(der)
+
+	var certificate, tbs, validity cryptobyte.String
+	if !input.ReadASN1(&certificate, cryptobyte_asn1.SEQUENCE) ||
+		!certificate.ReadASN1(&tbs, cryptobyte_asn1.SEQUENCE) ||
+		!tbs.SkipOptionalASN1(cryptobyte_asn1.Tag(0).Constructed().ContextSpecific()) ||
+		!tbs.SkipASN1(cryptobyte_asn1.INTEGER) ||
+		!tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) ||
+		!tbs.SkipASN1(cryptobyte_asn1.SEQUENCE) ||
+		!tbs.ReadASN1(&validity, cryptobyte_asn1.SEQUENCE) {
+		return time.Time{}, errors.New("malformed certificate")
+	}
+
+	var notBefore time.Time
+	switch {
+	case validity.PeekASN1Tag(cryptobyte_asn1.UTCTime):
+		if !validity.ReadASN1UTCTime(&notBefore) {
+			return time.Time{}, errors.New("malformed notBefore")
+		}
+	case validity.PeekASN1Tag(cryptobyte_asn1.GeneralizedTime):
+		if !validity.ReadASN1GeneralizedTime(&notBefore) {
+			return time.Time{}, errors.New("malformed notBefore")
+		}
+	default:
+		return time.Time{}, errors.New("malformed notBefore")
+	}
+
+	return notBefore, nil
+}
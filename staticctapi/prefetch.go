@@ -0,0 +1,95 @@
+package staticctapi
+
+import (
+	"context"
+	"sync"
+
+	"filippo.io/sunlight"
+)
+
+// fetchedTile is a data tile that has been downloaded, waiting to be searched.
+type fetchedTile struct {
+	index   int64
+	entries []*sunlight.LogEntry
+
+	// size is the number of bytes of certificates in the tile, as counted
+	// against the prefetch budget
+	size int64
+
+	// slab holds the entries if they were parsed into one, and is returned
+	// to slabPool once they've been searched
+	slab *EntrySlab
+}
+
+// tileSize returns the number of bytes of certificates held by entries.
+func tileSize(entries []*sunlight.LogEntry) int64 {
+	var size int64
+	for _, entry := range entries {
+		size += int64(len(entry.Certificate) + len(entry.PreCertificate))
+	}
+	return size
+}
+
+// byteBudget bounds the bytes of tiles held by a prefetching DataSource. A
+// nil byteBudget is unlimited. It is safe for concurrent use.
+type byteBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+
+	// freed is closed, and replaced, whenever bytes are released
+	freed chan struct{}
+}
+
+// newByteBudget returns a budget of limit bytes, or nil if limit isn't
+// positive.
+func newByteBudget(limit int64) *byteBudget {
+	if limit <= 0 {
+		return nil
+	}
+
+	return &byteBudget{
+		limit: limit,
+		freed: make(chan struct{}),
+	}
+}
+
+// acquire waits until n bytes are available, then takes them. A tile larger
+// than the whole budget is let through once nothing else is held, so that it
+// can't stall the search. It returns ctx.Err() if ctx is done first.
+func (b *byteBudget) acquire(ctx context.Context, n int64) error {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		if b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return nil
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns n bytes to the budget.
+func (b *byteBudget) release(n int64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+}
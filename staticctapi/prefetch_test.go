@@ -0,0 +1,54 @@
+package staticctapi
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestByteBudget(t *testing.T) {
+	budget := newByteBudget(100)
+
+	ctx := context.Background()
+	if err := budget.acquire(ctx, 60); err != nil {
+		t.Fatalf("acquiring within the budget: %s", err)
+	}
+
+	// Another 60 bytes must wait until the first are released
+	acquired := make(chan error)
+	go func() {
+		acquired <- budget.acquire(ctx, 60)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired more than the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	budget.release(60)
+	if err := <-acquired; err != nil {
+		t.Fatalf("acquiring released bytes: %s", err)
+	}
+
+	// Waiting gives up when the context is done
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := budget.acquire(cancelled, 60); err == nil {
+		t.Error("acquired more than the budget with a cancelled context")
+	}
+
+	// A tile larger than the whole budget is let through once nothing else
+	// is held
+	budget.release(60)
+	if err := budget.acquire(ctx, 500); err != nil {
+		t.Errorf("acquiring an oversized tile: %s", err)
+	}
+
+	if newByteBudget(0) != nil {
+		t.Error("got a budget for a limit of 0, want none")
+	}
+	var unlimited *byteBudget
+	if err := unlimited.acquire(ctx, 1<<40); err != nil {
+		t.Errorf("acquiring from a nil budget: %s", err)
+	}
+}
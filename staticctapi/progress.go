@@ -0,0 +1,19 @@
+package staticctapi
+
+import (
+	"sync/atomic"
+)
+
+// Progress counts the data tiles processed by one or more DataSources. Its
+// methods are safe to call while the DataSources are running.
+type Progress struct {
+	totalTiles     atomic.Int64
+	completedTiles atomic.Int64
+}
+
+// Tiles returns the number of tiles processed so far and the total number of
+// tiles to be processed. The total grows as each DataSource sharing the
+// Progress determines its search bounds.
+func (p *Progress) Tiles() (completed int64, total int64) {
+	return p.completedTiles.Load(), p.totalTiles.Load()
+}
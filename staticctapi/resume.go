@@ -0,0 +1,112 @@
+package staticctapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxResumeAttempts is the number of times readResumable resumes an
+// interrupted download before giving up.
+const maxResumeAttempts = 3
+
+// isIdentityEncoded reports whether response's body is sent as-is, without a
+// content encoding. Only such bodies are resumed, as a range of an encoded
+// body can't be decoded on its own.
+func isIdentityEncoded(response *http.Response) bool {
+	encoding := strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding")))
+	return encoding == "" || encoding == "identity"
+}
+
+// readResumable reads the identity-encoded body of response, which was
+// returned for request. If the connection fails partway through, the download
+// is resumed from the last byte received with a Range request, rather than
+// starting over, which matters for megabyte-sized uncompressed tiles on slow
+// or lossy links. The body may be at most limit bytes.
+func (l *Log) readResumable(ctx context.Context, request *http.Request, response *http.Response, limit int64) ([]byte, error) {
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+
+	defer func() {
+		if buffer.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(buffer)
+		}
+	}()
+
+	// Resumed ranges must come from the same version of the resource
+	validator := response.Header.Get("ETag")
+	if validator == "" {
+		validator = response.Header.Get("Last-Modified")
+	}
+
+	body := response.Body
+	for attempt := 0; ; attempt++ {
+		_, err := buffer.ReadFrom(io.LimitReader(body, limit+1-int64(buffer.Len())))
+		if body != response.Body {
+			body.Close()
+		}
+		if int64(buffer.Len()) > limit {
+			return nil, fmt.Errorf("%w: more than %d bytes", errResponseTooLarge, limit)
+		}
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil || attempt == maxResumeAttempts || buffer.Len() == 0 {
+			return nil, fmt.Errorf("reading response body: %w", err)
+		}
+
+		body, err = l.resume(ctx, request, int64(buffer.Len()), validator)
+		if errors.Is(err, errRangeIgnored) {
+			// The server sent the whole resource again instead
+			buffer.Reset()
+		} else if err != nil {
+			return nil, fmt.Errorf("resuming response body: %w", err)
+		}
+	}
+
+	data := make([]byte, buffer.Len())
+	copy(data, buffer.Bytes())
+	return data, nil
+}
+
+// errRangeIgnored is returned alongside the full body by resume when the
+// server ignores the Range header.
+var errRangeIgnored = errors.New("range ignored")
+
+// resume requests the remainder of request's resource from offset onwards,
+// returning the response body. If the server responds with the whole resource
+// instead, its body is returned along with errRangeIgnored.
+func (l *Log) resume(ctx context.Context, request *http.Request, offset int64, validator string) (io.ReadCloser, error) {
+	resumed := request.Clone(ctx)
+	resumed.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	resumed.Header.Set("Accept-Encoding", "identity")
+	if validator != "" {
+		resumed.Header.Set("If-Range", validator)
+	}
+
+	response, err := l.client().Do(resumed)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case response.StatusCode == http.StatusPartialContent && isIdentityEncoded(response):
+		if !strings.HasPrefix(response.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			response.Body.Close()
+			return nil, fmt.Errorf("unexpected content range: %q", response.Header.Get("Content-Range"))
+		}
+		return response.Body, nil
+
+	case response.StatusCode == http.StatusOK && isIdentityEncoded(response):
+		return response.Body, errRangeIgnored
+
+	default:
+		response.Body.Close()
+		return nil, fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+}
@@ -1,6 +1,7 @@
 package staticctapi
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -8,9 +9,10 @@ import (
 )
 
 var DefaultTileRetry = Retry{
-	MaxAttempts: 5,
-	MaxInterval: 1 * time.Second,
-	Timeout:     5 * time.Second,
+	MaxAttempts:    5,
+	MaxInterval:    1 * time.Second,
+	Timeout:        5 * time.Second,
+	AttemptTimeout: 3 * time.Second,
 }
 
 type Retry struct {
@@ -23,6 +25,13 @@ type Retry struct {
 
 	// Timeout is the maximum time to spend on a request, including retries.
 	Timeout time.Duration
+
+	// AttemptTimeout is the maximum time a single attempt waits for the
+	// response headers. Without it, one hung connection can consume the
+	// entire Timeout budget. It doesn't bound reading the response body, so
+	// that large tiles aren't cut off on slow connections. If AttemptTimeout
+	// is zero, individual attempts are only bounded by Timeout.
+	AttemptTimeout time.Duration
 }
 
 func (r Retry) Validate() error {
@@ -42,6 +51,14 @@ func (r Retry) Validate() error {
 		return errors.New("timeout less than or equal to max interval")
 	}
 
+	if r.AttemptTimeout < 0 {
+		return errors.New("attempt timeout less than zero")
+	}
+
+	if r.AttemptTimeout > r.Timeout {
+		return errors.New("attempt timeout greater than timeout")
+	}
+
 	return nil
 }
 
@@ -52,3 +69,17 @@ func (r Retry) createBackoff() backoff.BackOff {
 	)
 	return backoff.WithMaxRetries(bo, uint64(r.MaxAttempts)-1)
 }
+
+type headerTimeoutKey struct{}
+
+// withHeaderTimeout returns a context bounding how long the requests made
+// with it wait for response headers. A timeout of zero leaves them unbounded.
+func withHeaderTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, headerTimeoutKey{}, timeout)
+}
+
+// headerTimeoutFrom returns the header timeout recorded in ctx, or zero.
+func headerTimeoutFrom(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(headerTimeoutKey{}).(time.Duration)
+	return timeout
+}
@@ -0,0 +1,99 @@
+package staticctapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testTileRetry = Retry{
+	MaxAttempts:    3,
+	MaxInterval:    10 * time.Millisecond,
+	Timeout:        5 * time.Second,
+	AttemptTimeout: 100 * time.Millisecond,
+}
+
+// TestAttemptTimeoutSlowBody checks that a tile whose body takes longer than
+// AttemptTimeout to arrive is still read, as the timeout only bounds the
+// wait for the response headers.
+func TestAttemptTimeoutSlowBody(t *testing.T) {
+	tile := testTileData(0)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		w.Write(tile[:len(tile)/2])
+		w.(http.Flusher).Flush()
+		time.Sleep(3 * testTileRetry.AttemptTimeout)
+		w.Write(tile[len(tile)/2:])
+	}))
+	defer server.Close()
+
+	log, err := NewLog(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.TileRetry = testTileRetry
+
+	entries, err := log.GetTileEntriesWithBackoff(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("fetching slow tile: %s", err)
+	}
+	if len(entries) != 256 {
+		t.Errorf("got %d entries, want 256", len(entries))
+	}
+	if requests.Load() != 1 {
+		t.Errorf("made %d requests, want 1", requests.Load())
+	}
+}
+
+// TestAttemptTimeoutSlowHeaders checks that an attempt whose response headers
+// don't arrive within AttemptTimeout is abandoned and retried.
+func TestAttemptTimeoutSlowHeaders(t *testing.T) {
+	tile := testTileData(0)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		w.Write(tile)
+	}))
+	defer server.Close()
+
+	log, err := NewLog(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.TileRetry = testTileRetry
+
+	var timeouts atomic.Int32
+	log.Observer = func(request Request) {
+		if request.Timeout {
+			timeouts.Add(1)
+		}
+	}
+
+	started := time.Now()
+	_, err = log.GetTileEntriesWithBackoff(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("fetching tile: %s", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("took %s, so the hung attempt wasn't abandoned", elapsed)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("made %d requests, want 2", requests.Load())
+	}
+	if timeouts.Load() != 1 {
+		t.Errorf("observed %d timeouts, want 1", timeouts.Load())
+	}
+}
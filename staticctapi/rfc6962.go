@@ -0,0 +1,378 @@
+package staticctapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"filippo.io/sunlight"
+	"github.com/cenkalti/backoff/v4"
+	ct "github.com/google/certificate-transparency-go"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// DefaultRFC6962BatchSize is the number of entries an RFC6962DataSource first
+// requests at a time when BatchSize is zero. Logs commonly cap get-entries
+// responses at this many entries or fewer.
+const DefaultRFC6962BatchSize = 256
+
+// RFC6962DataSource searches an RFC 6962 log, one that predates the Static CT
+// API, through its get-sth and get-entries endpoints. Entries are selected the
+// same way as by a DataSource, within the same kind of time window.
+//
+// RFC 6962 logs don't index their entries by time, so the entries bounding the
+// window are found by bisecting the log, fetching one entry per step. Entries
+// are only roughly in timestamp order, as logs sequence them up to their
+// maximum merge delay after they're submitted, so entries near the edges of
+// the window may be missed or included.
+type RFC6962DataSource struct {
+	// Log is the log to search, created with NewLog from the log's URL, such
+	// as https://ct.googleapis.com/logs/us1/argon2025h1/. Its HTTP client,
+	// headers, Limiter, and TileRetry are used for every request.
+	Log *Log
+
+	// SourceName, if set, names the data source, as for DataSource.
+	SourceName string
+
+	// IncludePrecertificates and IncludeCertificates select the entries
+	// searched, as for DataSource.
+	IncludePrecertificates bool
+	IncludeCertificates    bool
+
+	// StartTimeInclusive and EndTimeInclusive bound the times the entries
+	// searched were logged. They must fall within the timespan of the log's
+	// entries, unless Clamp is set.
+	StartTimeInclusive time.Time
+	EndTimeInclusive   time.Time
+
+	// Clamp truncates the time window to the entries the log holds, as for
+	// DataSource.
+	Clamp bool
+
+	// WindowByNotBefore and NotBeforeSlack bound the notBefore timestamps of
+	// the certificates found rather than the times they were logged, as for
+	// DataSource.
+	WindowByNotBefore bool
+	NotBeforeSlack    time.Duration
+
+	// BatchSize is the number of entries requested at a time. Logs may return
+	// fewer, in which case the rest are requested again. If BatchSize is zero,
+	// it's tuned to the log, starting from DefaultRFC6962BatchSize: it grows
+	// while the log returns every entry requested, settles at the most the
+	// log returns once it returns fewer, and halves when the log rejects or
+	// fails a request, with a 4xx or 5xx status, or a response that's too
+	// large.
+	BatchSize int64
+
+	// MaxConnections is the number of batches requested concurrently. If
+	// MaxConnections is less than 1, batches are requested sequentially.
+	MaxConnections int
+
+	// Deduplicator and DERFilter drop certificates before they're sent, as for
+	// DataSource.
+	Deduplicator *Deduplicator
+	DERFilter    func([]byte) bool
+}
+
+// Name returns SourceName, or the log's URL if SourceName is empty.
+func (r RFC6962DataSource) Name() string {
+	if r.SourceName != "" {
+		return r.SourceName
+	}
+	if r.Log == nil {
+		return ""
+	}
+	return r.Log.MetricsEndpoint.String()
+}
+
+// Source sends the DER bytes of the selected certificates and precertificates
+// from the log over certs.
+func (r RFC6962DataSource) Source(ctx context.Context, certs chan<- []byte) error {
+	return r.run(ctx, func(_ *sunlight.LogEntry, certBytes []byte) {
+		select {
+		case certs <- certBytes:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// SourceEntries sends the selected certificates and precertificates from the
+// log over entries, along with metadata identifying the log entry each was
+// found in.
+func (r RFC6962DataSource) SourceEntries(ctx context.Context, entries chan<- x509search.Entry) error {
+	if r.Log == nil {
+		return errors.New("nil log")
+	}
+
+	source := r.Log.MetricsEndpoint.String()
+	return r.run(ctx, func(entry *sunlight.LogEntry, certBytes []byte) {
+		select {
+		case entries <- x509search.Entry{
+			DER: certBytes,
+			Metadata: x509search.Metadata{
+				Source:         source,
+				Index:          entry.LeafIndex,
+				Timestamp:      time.UnixMilli(entry.Timestamp),
+				Precertificate: entry.IsPrecert,
+			},
+		}:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// run searches the log, calling emit with each selected log entry and the DER
+// bytes of its certificate or precertificate. emit is called concurrently from
+// multiple goroutines, and must return promptly once ctx is done.
+func (r RFC6962DataSource) run(ctx context.Context, emit func(*sunlight.LogEntry, []byte)) error {
+	if r.Log == nil {
+		return errors.New("nil log")
+	}
+
+	if !(r.IncludeCertificates || r.IncludePrecertificates) {
+		return errors.New("neither precertficates nor certificates are selected")
+	}
+
+	concurrency := 1
+	if r.MaxConnections > 1 {
+		concurrency = r.MaxConnections
+	}
+	r.Log.reserveConnections(concurrency)
+
+	startTime, endTime := r.StartTimeInclusive, r.EndTimeInclusive
+	if r.WindowByNotBefore {
+		slack := r.NotBeforeSlack
+		if slack == 0 {
+			slack = DefaultNotBeforeSlack
+		}
+		startTime, endTime = startTime.Add(-slack), endTime.Add(slack)
+	}
+
+	startIndex, endIndex, err := r.bounds(ctx, startTime, endTime)
+	if err != nil {
+		return fmt.Errorf("determining search bounds: %w", err)
+	}
+
+	if startIndex > endIndex {
+		fmt.Fprintf(os.Stderr, "%s: search window doesn't overlap log\n", r.Name())
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: determined search bounds, start entry: %d end entry: %d\n", r.Name(), startIndex, endIndex)
+
+	batches := newRFC6962Batches(startIndex, endIndex, r.BatchSize)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				start, end, ok := batches.claim()
+				if !ok {
+					return
+				}
+				err := r.searchBatch(ctx, batches, start, end, emit)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: getting entries %d-%d: %s\n", r.Name(), start, end, err.Error())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// searchBatch searches the entries from start to end inclusive, requesting
+// the rest again whenever the log returns fewer than asked for, and tuning
+// the batches as it goes.
+func (r RFC6962DataSource) searchBatch(ctx context.Context, batches *rfc6962Batches, start, end int64, emit func(*sunlight.LogEntry, []byte)) error {
+	for start <= end {
+		requested := min(end-start+1, batches.current())
+		entries, err := r.Log.getRFC6962Entries(ctx, start, start+requested-1)
+		if err != nil && batches.shrink(requested, err) {
+			fmt.Fprintf(os.Stderr, "%s: requesting %d entries at a time: %s\n", r.Name(), batches.current(), err.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		batches.observe(requested, int64(len(entries)))
+
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			der := entry.Certificate
+			if entry.IsPrecert {
+				if !r.IncludePrecertificates {
+					continue
+				}
+				der = entry.PreCertificate
+			} else if !r.IncludeCertificates {
+				continue
+			}
+
+			if !r.inWindow(der) || !r.keep(der) || r.Deduplicator.seen(der) {
+				continue
+			}
+
+			emit(entry, der)
+		}
+
+		start += int64(len(entries))
+	}
+	return nil
+}
+
+// bounds returns the indexes of the first and last entries logged within the
+// window. If the window doesn't overlap the log's entries and Clamp is set, the
+// start index is greater than the end index.
+func (r RFC6962DataSource) bounds(ctx context.Context, startTime, endTime time.Time) (int64, int64, error) {
+	if endTime.Before(startTime) {
+		return -1, -1, errors.New("end time is before start time")
+	}
+
+	treeSize, err := r.Log.getRFC6962TreeSize(ctx)
+	if err != nil {
+		return -1, -1, err
+	}
+	if treeSize == 0 {
+		return -1, -1, errors.New("log has no entries")
+	}
+
+	// search returns the index of the first entry logged after t, or
+	// treeSize if there's none
+	var searchErr error
+	search := func(t time.Time) int64 {
+		return int64(sort.Search(int(treeSize), func(i int) bool {
+			if searchErr != nil {
+				return true
+			}
+			var timestamp time.Time
+			timestamp, searchErr = r.Log.getRFC6962EntryTime(ctx, int64(i))
+			return timestamp.After(t)
+		}))
+	}
+
+	// The first entry at or after the start is the first after the instant
+	// before it
+	startIndex := search(startTime.Add(-time.Millisecond))
+	endIndex := search(endTime) - 1
+	if searchErr != nil {
+		return -1, -1, searchErr
+	}
+
+	if !r.Clamp {
+		if startIndex == 0 {
+			return -1, -1, errors.New("start time is before the log's first entry")
+		}
+		if endIndex == treeSize-1 {
+			return -1, -1, errors.New("end time is after the log's last entry")
+		}
+	}
+
+	return startIndex, endIndex, nil
+}
+
+// inWindow reports whether the certificate should be sent when windowing by
+// notBefore, as for DataSource.
+func (r RFC6962DataSource) inWindow(der []byte) bool {
+	if !r.WindowByNotBefore {
+		return true
+	}
+
+	notBefore, err := readNotBefore(der)
+	if err != nil {
+		return true
+	}
+
+	return !notBefore.Before(r.StartTimeInclusive) && !notBefore.After(r.EndTimeInclusive)
+}
+
+// keep reports whether the certificate passes DERFilter, if it's set.
+func (r RFC6962DataSource) keep(der []byte) bool {
+	return r.DERFilter == nil || r.DERFilter(der)
+}
+
+// getRFC6962TreeSize fetches the size of an RFC 6962 log's current tree.
+func (l *Log) getRFC6962TreeSize(ctx context.Context) (int64, error) {
+	data, err := l.get(ctx, ct.GetSTHPath, l.ResponseLimits.withDefaults().Checkpoint)
+	if err != nil {
+		return -1, fmt.Errorf("fetching tree head: %w", err)
+	}
+
+	var sth ct.GetSTHResponse
+	err = json.Unmarshal(data, &sth)
+	if err != nil {
+		return -1, fmt.Errorf("parsing tree head: %w", err)
+	}
+
+	return int64(sth.TreeSize), nil
+}
+
+// getRFC6962EntryTime fetches the timestamp of the entry at index of an RFC
+// 6962 log.
+func (l *Log) getRFC6962EntryTime(ctx context.Context, index int64) (time.Time, error) {
+	entries, err := l.getRFC6962Entries(ctx, index, index)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(entries[0].Timestamp), nil
+}
+
+// getRFC6962Entries fetches entries of an RFC 6962 log from start to end
+// inclusive, retrying according to TileRetry. The log may return fewer
+// entries than requested, but always at least one.
+func (l *Log) getRFC6962Entries(ctx context.Context, start, end int64) ([]*sunlight.LogEntry, error) {
+	return l.retryTile(ctx, func(ctx context.Context) ([]*sunlight.LogEntry, error) {
+		path := fmt.Sprintf("%s?start=%d&end=%d", ct.GetEntriesPath, start, end)
+		data, err := l.get(ctx, path, l.ResponseLimits.withDefaults().Tile)
+
+		// A request the log rejects may succeed for fewer entries, which
+		// is left to the caller rather than retried
+		if end > start && rejected(err) {
+			return nil, backoff.Permanent(fmt.Errorf("fetching entries: %w", err))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetching entries: %w", err)
+		}
+
+		var response ct.GetEntriesResponse
+		err = json.Unmarshal(data, &response)
+		if err != nil {
+			return nil, fmt.Errorf("parsing entries: %w", err)
+		}
+		if len(response.Entries) == 0 {
+			return nil, fmt.Errorf("log returned no entries from %d", start)
+		}
+		if int64(len(response.Entries)) > end-start+1 {
+			return nil, fmt.Errorf("log returned %d entries, more than the %d requested", len(response.Entries), end-start+1)
+		}
+
+		entries := make([]*sunlight.LogEntry, len(response.Entries))
+		for i := range response.Entries {
+			raw, err := ct.RawLogEntryFromLeaf(start+int64(i), &response.Entries[i])
+			if err != nil {
+				return nil, fmt.Errorf("parsing entry %d: %w", start+int64(i), err)
+			}
+
+			entries[i], err = LogEntryFromCT(raw)
+			if err != nil {
+				return nil, fmt.Errorf("parsing entry %d: %w", start+int64(i), err)
+			}
+		}
+		return entries, nil
+	})
+}
@@ -0,0 +1,377 @@
+package staticctapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
+
+	"github.com/letsencrypt/x509search"
+)
+
+// maxRFC6962Entries is the most entries the test log returns at a time, so
+// that batches are only partly served.
+const maxRFC6962Entries = 10
+
+// newRFC6962TestLog serves an RFC 6962 log of treeSize entries over HTTP,
+// logged a second apart from testLogStart. Odd entries are precertificates.
+func newRFC6962TestLog(t *testing.T, treeSize int64) *httptest.Server {
+	t.Helper()
+
+	leaves := make([]ct.LeafEntry, treeSize)
+	for i := range leaves {
+		timestamped := &ct.TimestampedEntry{
+			Timestamp: uint64(entryTime(int64(i)).UnixMilli()),
+			EntryType: ct.X509LogEntryType,
+			X509Entry: &ct.ASN1Cert{Data: []byte(fmt.Sprintf("certificate %d", i))},
+		}
+		var extraData any = ct.CertificateChain{}
+		if i%2 == 1 {
+			timestamped.EntryType = ct.PrecertLogEntryType
+			timestamped.X509Entry = nil
+			timestamped.PrecertEntry = &ct.PreCert{TBSCertificate: []byte(fmt.Sprintf("tbs %d", i))}
+			extraData = ct.PrecertChainEntry{PreCertificate: ct.ASN1Cert{Data: []byte(fmt.Sprintf("precertificate %d", i))}}
+		}
+
+		leafInput, err := cttls.Marshal(ct.MerkleTreeLeaf{
+			Version:          ct.V1,
+			LeafType:         ct.TimestampedEntryLeafType,
+			TimestampedEntry: timestamped,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		extra, err := cttls.Marshal(extraData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves[i] = ct.LeafEntry{LeafInput: leafInput, ExtraData: extra}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ct.GetSTHPath:
+			json.NewEncoder(w).Encode(ct.GetSTHResponse{TreeSize: uint64(treeSize)})
+		case ct.GetEntriesPath:
+			start, err1 := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+			end, err2 := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+			if err1 != nil || err2 != nil || start < 0 || end < start || start >= treeSize {
+				http.Error(w, "bad range", http.StatusBadRequest)
+				return
+			}
+			end = min(end, treeSize-1, start+maxRFC6962Entries-1)
+			json.NewEncoder(w).Encode(ct.GetEntriesResponse{Entries: leaves[start : end+1]})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newRFC6962DataSource(t *testing.T, server *httptest.Server, start, end time.Time) RFC6962DataSource {
+	t.Helper()
+
+	log, err := NewLog(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return RFC6962DataSource{
+		Log:                    log,
+		IncludeCertificates:    true,
+		IncludePrecertificates: true,
+		StartTimeInclusive:     start,
+		EndTimeInclusive:       end,
+		BatchSize:              32,
+		MaxConnections:         3,
+	}
+}
+
+// sourceRFC6962 runs source and returns the entries it found, by index.
+func sourceRFC6962(t *testing.T, source RFC6962DataSource) (map[int64]x509search.Entry, error) {
+	t.Helper()
+
+	entries := make(chan x509search.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- source.SourceEntries(context.Background(), entries)
+		close(entries)
+	}()
+
+	found := make(map[int64]x509search.Entry)
+	for entry := range entries {
+		if _, ok := found[entry.Metadata.Index]; ok {
+			t.Errorf("entry %d found twice", entry.Metadata.Index)
+		}
+		found[entry.Metadata.Index] = entry
+	}
+	return found, <-done
+}
+
+func TestRFC6962DataSource(t *testing.T) {
+	server := newRFC6962TestLog(t, 1000)
+	source := newRFC6962DataSource(t, server, entryTime(100), entryTime(299))
+
+	found, err := sourceRFC6962(t, source)
+	if err != nil {
+		t.Fatalf("searching log: %s", err)
+	}
+
+	if len(found) != 200 {
+		t.Errorf("found %d entries, want 200", len(found))
+	}
+	for index := int64(100); index < 300; index++ {
+		entry, ok := found[index]
+		if !ok {
+			t.Errorf("entry %d not found", index)
+			continue
+		}
+
+		want := fmt.Sprintf("certificate %d", index)
+		if index%2 == 1 {
+			want = fmt.Sprintf("precertificate %d", index)
+		}
+		if string(entry.DER) != want {
+			t.Errorf("entry %d: got %q, want %q", index, entry.DER, want)
+		}
+		if entry.Metadata.Precertificate != (index%2 == 1) {
+			t.Errorf("entry %d: got precertificate %t", index, entry.Metadata.Precertificate)
+		}
+		if !entry.Metadata.Timestamp.Equal(entryTime(index)) {
+			t.Errorf("entry %d: got timestamp %s, want %s", index, entry.Metadata.Timestamp, entryTime(index))
+		}
+	}
+}
+
+func TestRFC6962DataSourceSelection(t *testing.T) {
+	server := newRFC6962TestLog(t, 1000)
+	source := newRFC6962DataSource(t, server, entryTime(100), entryTime(199))
+	source.IncludePrecertificates = false
+
+	found, err := sourceRFC6962(t, source)
+	if err != nil {
+		t.Fatalf("searching log: %s", err)
+	}
+
+	if len(found) != 50 {
+		t.Errorf("found %d entries, want 50", len(found))
+	}
+	for index, entry := range found {
+		if entry.Metadata.Precertificate {
+			t.Errorf("entry %d: precertificate found", index)
+		}
+	}
+}
+
+func TestRFC6962DataSourceClamp(t *testing.T) {
+	server := newRFC6962TestLog(t, 1000)
+
+	for _, tc := range []struct {
+		name       string
+		start, end time.Time
+		want       int
+	}{
+		{"before log", entryTime(-100), entryTime(49), 50},
+		{"after log", entryTime(950), entryTime(2000), 50},
+		{"outside log", entryTime(2000), entryTime(3000), 0},
+	} {
+		source := newRFC6962DataSource(t, server, tc.start, tc.end)
+
+		_, err := sourceRFC6962(t, source)
+		if err == nil && tc.want > 0 {
+			t.Errorf("%s: got no error without Clamp", tc.name)
+		}
+
+		source.Clamp = true
+		found, err := sourceRFC6962(t, source)
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		if len(found) != tc.want {
+			t.Errorf("%s: found %d entries, want %d", tc.name, len(found), tc.want)
+		}
+	}
+}
+
+func TestRFC6962DataSourceTunedBatches(t *testing.T) {
+	backend := newRFC6962TestLog(t, 1000)
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(backendURL)
+
+	// The log rejects requests for more than 5 entries
+	var rejected atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+		if r.URL.Path == ct.GetEntriesPath && end-start+1 > 5 {
+			rejected.Add(1)
+			http.Error(w, "too many entries", http.StatusBadRequest)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	source := newRFC6962DataSource(t, server, entryTime(100), entryTime(299))
+	source.BatchSize = 0
+
+	found, err := sourceRFC6962(t, source)
+	if err != nil {
+		t.Fatalf("searching log: %s", err)
+	}
+	if len(found) != 200 {
+		t.Errorf("found %d entries, want 200", len(found))
+	}
+
+	// Once the batches have shrunk to fit, they stay that way
+	if rejected.Load() == 0 || rejected.Load() > 10 {
+		t.Errorf("log rejected %d requests, want a few", rejected.Load())
+	}
+}
+
+func TestRFC6962Batches(t *testing.T) {
+	fixed := newRFC6962Batches(0, 999, 100)
+	fixed.observe(100, 100)
+	fixed.observe(100, 10)
+	if fixed.current() != 100 || fixed.shrink(100, statusError{code: http.StatusBadRequest}) {
+		t.Errorf("fixed batch size changed to %d", fixed.current())
+	}
+
+	batches := newRFC6962Batches(0, 99999, 0)
+
+	// Full responses grow the batches
+	batches.observe(DefaultRFC6962BatchSize, DefaultRFC6962BatchSize)
+	if batches.current() != 2*DefaultRFC6962BatchSize {
+		t.Errorf("grew to %d, want %d", batches.current(), 2*DefaultRFC6962BatchSize)
+	}
+
+	// Short responses cap them at the most the log returns
+	batches.observe(512, 100)
+	batches.observe(100, 70)
+	if batches.current() != 100 {
+		t.Errorf("capped at %d, want 100", batches.current())
+	}
+	batches.observe(100, 100)
+	if batches.current() != 100 {
+		t.Errorf("grew past the log's cap to %d", batches.current())
+	}
+
+	// Rate limiting doesn't shrink them, but rejection and server errors do
+	if batches.shrink(100, statusError{code: http.StatusTooManyRequests}) {
+		t.Error("shrank after rate limiting")
+	}
+	if !batches.shrink(100, statusError{code: http.StatusBadRequest}) || batches.current() != 50 {
+		t.Errorf("shrank to %d after rejection, want 50", batches.current())
+	}
+	if !batches.shrink(50, statusError{code: http.StatusServiceUnavailable}) || batches.current() != 25 {
+		t.Errorf("shrank to %d after a server error, want 25", batches.current())
+	}
+
+	// Batches are handed out at the current size
+	start, end, ok := batches.claim()
+	if !ok || start != 0 || end != 24 {
+		t.Errorf("claimed %d-%d, want 0-24", start, end)
+	}
+}
+
+func TestUsableDataSourcesRFC6962(t *testing.T) {
+	list := []byte(`{"operators": [{
+		"name": "Example",
+		"logs": [
+			{"description": "Example 6962", "url": "https://ct.example.com/2025/", "state": {"usable": {}}},
+			{"description": "Example retired", "url": "https://ct.example.com/2020/", "state": {"retired": {}}}
+		],
+		"tiled_logs": [
+			{"description": "Example tiled", "monitoring_url": "https://tiles.example.com/2025/", "state": {"usable": {}}}
+		]
+	}]}`)
+
+	logs, err := ParseLogList(list)
+	if err != nil {
+		t.Fatalf("parsing log list: %s", err)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("parsed %d logs, want 3", len(logs))
+	}
+
+	template := DataSource{IncludeCertificates: true, StartTimeInclusive: testLogStart, EndTimeInclusive: entryTime(100), MaxConnections: 2, Clamp: true, WindowByNotBefore: true}
+	sources, err := UsableDataSources(logs, template, 4)
+	if err != nil {
+		t.Fatalf("building data sources: %s", err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("got %d data sources, want 2", len(sources))
+	}
+
+	var rfc6962 RFC6962DataSource
+	var tiled DataSource
+	for _, source := range sources {
+		switch s := source.(type) {
+		case RFC6962DataSource:
+			rfc6962 = s
+		case DataSource:
+			tiled = s
+		}
+	}
+	if rfc6962.Log == nil || rfc6962.Log.MetricsEndpoint.String() != "https://ct.example.com/2025/" {
+		t.Fatalf("no data source for the usable RFC 6962 log in %v", sources)
+	}
+	if tiled.Log == nil || tiled.Log.MetricsEndpoint.String() != "https://tiles.example.com/2025/" {
+		t.Fatalf("no data source for the usable tiled log in %v", sources)
+	}
+	if !rfc6962.Clamp || !rfc6962.WindowByNotBefore || !rfc6962.IncludeCertificates || rfc6962.MaxConnections != 2 || rfc6962.Log.Limiter != tiled.Log.Limiter || rfc6962.Deduplicator != tiled.Deduplicator {
+		t.Errorf("RFC 6962 data source doesn't take the template's settings: %+v", rfc6962)
+	}
+
+	// Each log is named after its own URL
+	var names []string
+	for _, source := range sources {
+		names = append(names, source.(interface{ Name() string }).Name())
+	}
+	slices.Sort(names)
+	if want := []string{"https://ct.example.com/2025/", "https://tiles.example.com/2025/"}; !slices.Equal(names, want) {
+		t.Errorf("data sources named %q, want %q", names, want)
+	}
+
+	// Following only covers tiled logs
+	followed := template
+	followed.Follow = true
+	sources, err = UsableDataSources(logs, followed, 4)
+	if err != nil {
+		t.Fatalf("building data sources: %s", err)
+	}
+	if len(sources) != 1 {
+		t.Errorf("got %d data sources when following, want 1", len(sources))
+	}
+
+	// A name or cursor in the template would be shared by every log
+	named := template
+	named.SourceName = "logs"
+	_, err = UsableDataSources(logs, named, 4)
+	if err == nil {
+		t.Error("got no error for a template with a source name")
+	}
+	resumed := template
+	resumed.Cursor = NewCursor(0)
+	_, err = UsableDataSources(logs, resumed, 4)
+	if err == nil {
+		t.Error("got no error for a template with a cursor")
+	}
+}
@@ -0,0 +1,118 @@
+package staticctapi
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// maxRFC6962BatchSize bounds the number of entries a tuned RFC6962DataSource
+// requests at a time.
+const maxRFC6962BatchSize = 4096
+
+// rfc6962Batches hands out the ranges of entries an RFC6962DataSource's
+// workers request, sized to what the log returns, unless the size is fixed. It
+// is safe for concurrent use.
+type rfc6962Batches struct {
+	mu sync.Mutex
+
+	// next and end are the indexes of the next entry to hand out and the last.
+	next, end int64
+
+	size  int64
+	fixed bool
+
+	// limit is the most entries the log is known to return at a time, or 0
+	// before it has returned fewer than were requested.
+	limit int64
+}
+
+// newRFC6962Batches returns rfc6962Batches of the entries from start to end
+// inclusive, fixed at size, or tuned from DefaultRFC6962BatchSize if size
+// isn't positive.
+func newRFC6962Batches(start, end, size int64) *rfc6962Batches {
+	if size > 0 {
+		return &rfc6962Batches{next: start, end: end, size: size, fixed: true}
+	}
+	return &rfc6962Batches{next: start, end: end, size: DefaultRFC6962BatchSize}
+}
+
+// claim returns the next range of entries to search, from start to end
+// inclusive, or false once all of them have been handed out.
+func (b *rfc6962Batches) claim() (int64, int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.next > b.end {
+		return 0, 0, false
+	}
+	start := b.next
+	end := min(start+b.size-1, b.end)
+	b.next = end + 1
+	return start, end, true
+}
+
+// current returns the number of entries to request at a time.
+func (b *rfc6962Batches) current() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size
+}
+
+// observe tunes the batch size after the log returned returned entries when
+// requested were asked for. A log returning fewer caps its responses, so the
+// size drops to the most it has returned; until then, the size grows, to
+// find that cap.
+func (b *rfc6962Batches) observe(requested, returned int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.fixed {
+		return
+	}
+
+	if returned < requested {
+		b.limit = max(b.limit, returned)
+		b.size = b.limit
+		return
+	}
+	if b.limit == 0 && requested == b.size {
+		b.size = min(b.size*2, maxRFC6962BatchSize)
+	}
+}
+
+// shrink halves the batch size after a request for requested entries failed
+// in a way fewer entries may not, and reports whether the request should be
+// retried with the smaller size. The size won't grow past the smaller size
+// again. A fixed size, or a request for a single entry, can't shrink.
+func (b *rfc6962Batches) shrink(requested int64, err error) bool {
+	if !shrinkable(err) {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.fixed || requested <= 1 {
+		return false
+	}
+	b.size = max(min(b.size, requested)/2, 1)
+	b.limit = b.size
+	return true
+}
+
+// shrinkable reports whether a get-entries request may have failed because it
+// asked for too many entries: the log rejected it, or failed it with a 5xx
+// status, or its response was too large.
+func shrinkable(err error) bool {
+	var status statusError
+	return rejected(err) || errors.Is(err, errResponseTooLarge) || (errors.As(err, &status) && status.code >= 500)
+}
+
+// rejected reports whether the log rejected a request with a 4xx status, other
+// than for rate limiting.
+func rejected(err error) bool {
+	var status statusError
+	return errors.As(err, &status) && status.code >= 400 && status.code < 500 && status.code != http.StatusTooManyRequests
+}
@@ -0,0 +1,111 @@
+package staticctapi
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"filippo.io/sunlight"
+	"github.com/letsencrypt/x509search"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// SCT holds the parts of an RFC 6962 SignedCertificateTimestamp needed to
+// locate the corresponding entry in a log.
+type SCT struct {
+	// LogID is the SHA-256 hash of the issuing log's public key.
+	LogID [32]byte
+
+	// Timestamp is the SCT timestamp, in milliseconds since the Unix epoch.
+	Timestamp int64
+
+	// Extensions holds the raw SCT extensions. Logs implementing the Static CT
+	// API use them to carry the index of the entry.
+	Extensions []byte
+}
+
+// LeafIndex returns the index of the log entry the SCT was issued for.
+func (s SCT) LeafIndex() (int64, error) {
+	extensions, err := sunlight.ParseExtensions(s.Extensions)
+	if err != nil {
+		return -1, fmt.Errorf("parsing SCT extensions: %w", err)
+	}
+
+	return extensions.LeafIndex, nil
+}
+
+// LogIDFromKey returns the RFC 6962 log ID of the log with the given public
+// key.
+func LogIDFromKey(key crypto.PublicKey) ([32]byte, error) {
+	spki, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("marshaling public key: %w", err)
+	}
+
+	return sha256.Sum256(spki), nil
+}
+
+// EmbeddedSCTs returns the SCTs embedded in cert. If cert has no embedded SCTs,
+// an empty slice is returned.
+func EmbeddedSCTs(cert *x509.Certificate) ([]SCT, error) {
+	var listBytes []byte
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(x509search.SCTListOID) {
+			listBytes = extension.Value
+			break
+		}
+	}
+
+	if listBytes == nil {
+		return []SCT{}, nil
+	}
+
+	// The extension value is an OCTET STRING wrapping the TLS-encoded list
+	var tlsList []byte
+	rest, err := asn1.Unmarshal(listBytes, &tlsList)
+	if err != nil || len(rest) != 0 {
+		return nil, errors.New("malformed SCT list extension")
+	}
+
+	var list cryptobyte.String
+	s := cryptobyte.String(tlsList)
+	if !s.ReadUint16LengthPrefixed(&list) || !s.Empty() {
+		return nil, errors.New("malformed SCT list")
+	}
+
+	scts := []SCT{}
+	for !list.Empty() {
+		var serialized cryptobyte.String
+		if !list.ReadUint16LengthPrefixed(&serialized) {
+			return nil, errors.New("malformed SCT list entry")
+		}
+
+		var version uint8
+		var timestamp uint64
+		var extensions, signature cryptobyte.String
+		var sct SCT
+		if !serialized.ReadUint8(&version) ||
+			!serialized.CopyBytes(sct.LogID[:]) ||
+			!serialized.ReadUint64(&timestamp) ||
+			!serialized.ReadUint16LengthPrefixed(&extensions) ||
+			!serialized.Skip(2) ||
+			!serialized.ReadUint16LengthPrefixed(&signature) ||
+			!serialized.Empty() {
+			return nil, errors.New("malformed SCT")
+		}
+
+		// Only v1 SCTs are defined
+		if version != 0 {
+			continue
+		}
+
+		sct.Timestamp = int64(timestamp)
+		sct.Extensions = extensions
+		scts = append(scts, sct)
+	}
+
+	return scts, nil
+}
@@ -0,0 +1,133 @@
+package staticctapi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"filippo.io/sunlight"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// EntrySlab holds the entries parsed from a data tile so that they can be
+// reused for the next tile. Parsing a tile with sunlight.ReadTileLeaf
+// allocates each of its 256 entries, and their chain fingerprints, and on a
+// scan of a whole log the garbage collector spends much of its time freeing
+// them again.
+//
+// An EntrySlab isn't safe for concurrent use. The zero value is ready to use.
+type EntrySlab struct {
+	entries  []sunlight.LogEntry
+	pointers []*sunlight.LogEntry
+}
+
+// Parse parses the entries of a data tile into the slab, and returns them.
+// Like ParseDataTile, it reads entries until tileData is exhausted. The
+// entries refer to tileData rather than copying from it, and are overwritten
+// by the next call to Parse, so anything kept from them must be copied first.
+func (s *EntrySlab) Parse(tileData []byte) ([]*sunlight.LogEntry, error) {
+	if len(tileData) == 0 {
+		return nil, errors.New("empty tile")
+	}
+
+	if cap(s.entries) < 256 {
+		s.entries = make([]sunlight.LogEntry, 256)
+		s.pointers = make([]*sunlight.LogEntry, 0, 256)
+	}
+
+	s.pointers = s.pointers[:0]
+
+	for len(tileData) > 0 {
+		if len(s.pointers) == 256 {
+			return nil, errors.New("tile holds more than 256 entries")
+		}
+
+		entry := &s.entries[len(s.pointers)]
+
+		rest, err := readTileLeaf(tileData, entry)
+		if err != nil {
+			return nil, fmt.Errorf("reading entry %d from tile: %w", len(s.pointers), err)
+		}
+
+		s.pointers = append(s.pointers, entry)
+		tileData = rest
+	}
+
+	return s.pointers, nil
+}
+
+// readTileLeaf parses the first entry of tile into entry, reusing its chain
+// fingerprints slice, and returns the rest of tile. It accepts the same
+// encoding as sunlight.ReadTileLeaf.
+func readTileLeaf(tile []byte, entry *sunlight.LogEntry) ([]byte, error) {
+	fingerprints := entry.ChainFingerprints[:0]
+	*entry = sunlight.LogEntry{}
+
+	s := cryptobyte.String(tile)
+
+	var timestamp uint64
+	var entryType uint16
+	if !s.ReadUint64(&timestamp) || !s.ReadUint16(&entryType) || timestamp > 1<<63-1 {
+		return nil, errors.New("invalid data tile")
+	}
+	entry.Timestamp = int64(timestamp)
+
+	var extensions, chain cryptobyte.String
+	switch entryType {
+	case 0:
+		if !s.ReadUint24LengthPrefixed((*cryptobyte.String)(&entry.Certificate)) ||
+			!s.ReadUint16LengthPrefixed(&extensions) ||
+			!s.ReadUint16LengthPrefixed(&chain) {
+			return nil, errors.New("invalid data tile x509_entry")
+		}
+	case 1:
+		entry.IsPrecert = true
+		if !s.CopyBytes(entry.IssuerKeyHash[:]) ||
+			!s.ReadUint24LengthPrefixed((*cryptobyte.String)(&entry.Certificate)) ||
+			!s.ReadUint16LengthPrefixed(&extensions) ||
+			!s.ReadUint24LengthPrefixed((*cryptobyte.String)(&entry.PreCertificate)) ||
+			!s.ReadUint16LengthPrefixed(&chain) {
+			return nil, errors.New("invalid data tile precert_entry")
+		}
+	default:
+		return nil, fmt.Errorf("invalid data tile: unknown type %d", entryType)
+	}
+
+	// The only extension is leaf_index, a 40-bit integer
+	var extensionType uint8
+	var extensionData cryptobyte.String
+	var leafIndex []byte
+	if !extensions.ReadUint8(&extensionType) || extensionType != 0 ||
+		!extensions.ReadUint16LengthPrefixed(&extensionData) ||
+		!extensionData.ReadBytes(&leafIndex, 5) || !extensionData.Empty() ||
+		!extensions.Empty() {
+		return nil, errors.New("invalid data tile extensions")
+	}
+	entry.LeafIndex = int64(leafIndex[0])<<32 | int64(leafIndex[1])<<24 | int64(leafIndex[2])<<16 | int64(leafIndex[3])<<8 | int64(leafIndex[4])
+
+	for !chain.Empty() {
+		var fingerprint [32]byte
+		if !chain.CopyBytes(fingerprint[:]) {
+			return nil, errors.New("invalid data tile fingerprints")
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	entry.ChainFingerprints = fingerprints
+
+	return s, nil
+}
+
+// slabPool holds the EntrySlabs of DataSources filtering tiles as they're
+// parsed. See DataSource.DERFilter.
+var slabPool = sync.Pool{
+	New: func() any {
+		return new(EntrySlab)
+	},
+}
+
+// releaseSlab returns slab to slabPool. A nil slab is ignored.
+func releaseSlab(slab *EntrySlab) {
+	if slab != nil {
+		slabPool.Put(slab)
+	}
+}
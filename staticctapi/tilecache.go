@@ -0,0 +1,76 @@
+package staticctapi
+
+import (
+	"container/list"
+	"sync"
+
+	"filippo.io/sunlight"
+)
+
+// DefaultTileCacheSize is the number of data tiles a Log keeps in memory when
+// TileCacheSize is zero. It comfortably holds the tiles probed by the last
+// steps of GetBoundingTilesFromTimes, which include the boundary tiles that a
+// DataSource then searches first.
+const DefaultTileCacheSize = 8
+
+// tileCache holds the most recently used data tiles of a log. It is safe for
+// concurrent use.
+type tileCache struct {
+	mu      sync.Mutex
+	entries map[int64]*list.Element
+	order   *list.List
+}
+
+func newTileCache() *tileCache {
+	return &tileCache{
+		entries: make(map[int64]*list.Element),
+		order:   list.New(),
+	}
+}
+
+type cachedTile struct {
+	tileIndex int64
+	entries   []*sunlight.LogEntry
+}
+
+// get returns the entries of the tile at tileIndex, if cached. A nil
+// tileCache holds nothing.
+func (c *tileCache) get(tileIndex int64) ([]*sunlight.LogEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[tileIndex]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(cachedTile).entries, true
+}
+
+// add caches the entries of the tile at tileIndex, evicting the least recently
+// used tile if the cache holds more than size tiles.
+func (c *tileCache) add(tileIndex int64, entries []*sunlight.LogEntry, size int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[tileIndex]; ok {
+		return
+	}
+
+	c.entries[tileIndex] = c.order.PushFront(cachedTile{tileIndex: tileIndex, entries: entries})
+
+	for c.order.Len() > size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(cachedTile).tileIndex)
+	}
+}
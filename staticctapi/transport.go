@@ -0,0 +1,103 @@
+package staticctapi
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultMaxConnections is the number of concurrent connections a Log
+	// allows to its endpoint until a DataSource asks for more.
+	defaultMaxConnections = 10
+
+	// idleConnTimeout is how long an unused connection is kept open before
+	// it's closed.
+	idleConnTimeout = 90 * time.Second
+
+	// responseHeaderTimeout is how long to wait for a log to begin responding
+	// once a request has been written. Without it, a stalled connection holds
+	// on to one of the transport's limited connection slots indefinitely.
+	responseHeaderTimeout = 30 * time.Second
+
+	// dialTimeout bounds the time spent establishing a TCP connection.
+	dialTimeout = 30 * time.Second
+
+	// tlsHandshakeTimeout bounds the time spent on a TLS handshake.
+	tlsHandshakeTimeout = 10 * time.Second
+)
+
+// newTransport returns an http.Transport sized to support maxConnections
+// concurrent requests to a single log endpoint. The default transport only
+// keeps two idle connections per host, so under high concurrency most requests
+// would otherwise pay for a fresh TCP and TLS handshake. tlsConfig may be nil.
+func newTransport(maxConnections int, tlsConfig *tls.Config) *http.Transport {
+	if maxConnections < 1 {
+		maxConnections = 1
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxConnections,
+		MaxIdleConnsPerHost:   maxConnections,
+		MaxConnsPerHost:       maxConnections,
+		IdleConnTimeout:       idleConnTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		TLSClientConfig:       tlsConfig,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// client returns the HTTP client currently used by the Log, replacing it first
+// if TLSConfig has been changed since it was created, or creating it if the
+// Log wasn't created with NewLog.
+func (l *Log) client() *http.Client {
+	l.clientMu.Lock()
+	defer l.clientMu.Unlock()
+
+	if l.httpClient == nil {
+		l.replaceClient(max(l.maxConnections, defaultMaxConnections))
+	} else if l.TLSConfig != l.clientTLSConfig {
+		l.replaceClient(l.maxConnections)
+	}
+
+	return l.httpClient
+}
+
+// replaceClient swaps in a client with a freshly-built transport. Requests
+// already in flight on the old transport are unaffected. clientMu must be
+// held.
+func (l *Log) replaceClient(maxConnections int) {
+	previous := l.httpClient
+	l.httpClient = &http.Client{Transport: newTransport(maxConnections, l.TLSConfig)}
+	l.maxConnections = maxConnections
+	l.clientTLSConfig = l.TLSConfig
+
+	if previous != nil {
+		previous.CloseIdleConnections()
+	}
+}
+
+// reserveConnections makes sure the Log's HTTP transport allows at least
+// maxConnections concurrent connections, replacing the transport if it's
+// currently sized for fewer. Requests already in flight on the old transport
+// are unaffected.
+func (l *Log) reserveConnections(maxConnections int) {
+	l.clientMu.Lock()
+	defer l.clientMu.Unlock()
+
+	if maxConnections <= l.maxConnections {
+		return
+	}
+
+	l.replaceClient(maxConnections)
+}
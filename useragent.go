@@ -0,0 +1,34 @@
+package x509search
+
+import (
+	"runtime/debug"
+)
+
+// modulePath is the import path of this module.
+const modulePath = "github.com/letsencrypt/x509search"
+
+// DefaultUserAgent is the User-Agent header sent by this module's data
+// sources and enrichers unless they're configured with another. It names the
+// module and its version, and links to the project, so that the operators of
+// logs and other services can tell where requests come from. Applications are
+// encouraged to set their own User-Agent with contact details for whoever
+// runs them.
+var DefaultUserAgent = defaultUserAgent()
+
+func defaultUserAgent() string {
+	version := "devel"
+
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath && dep.Version != "" {
+				version = dep.Version
+			}
+		}
+	}
+
+	return "x509search/" + version + " (+https://" + modulePath + ")"
+}